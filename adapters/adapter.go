@@ -1,6 +1,15 @@
 package adapters
 
-import "github.com/gaurishhs/keezle/models"
+import (
+	"errors"
+	"time"
+
+	"github.com/gaurishhs/keezle/models"
+)
+
+// ErrSessionLimitReached is returned when a session can not be created because the user has reached the
+// maximum number of sessions and the limit strategy rejects new sessions.
+var ErrSessionLimitReached = errors.New("session limit reached")
 
 // CreateUserOpts defines the options for creating a new user.
 type CreateUserOpts[UA models.AnyStruct] struct {
@@ -27,3 +36,224 @@ type Adapter[UA, SA models.AnyStruct] interface {
 	UpdateKey(keyId string, updatedKey *models.DBKey) (*models.DBKey, error)
 	DeleteKey(keyId string) error
 }
+
+// SessionLimitStrategy defines what happens when a user with the maximum number of sessions logs in again.
+type SessionLimitStrategy int
+
+const (
+	// SessionLimitReject rejects the new session.
+	SessionLimitReject SessionLimitStrategy = iota
+	// SessionLimitEvictOldest deletes the sessions created first to make room for the new session.
+	SessionLimitEvictOldest
+	// SessionLimitEvictLeastRecentlyUsed deletes the sessions used least recently to make room for the new session.
+	SessionLimitEvictLeastRecentlyUsed
+)
+
+// SessionLimit defines the maximum number of concurrent sessions per user.
+type SessionLimit struct {
+	// Max is the maximum number of valid sessions a user can have, zero disables the limit.
+	Max      int
+	Strategy SessionLimitStrategy
+}
+
+// SessionLimiter is implemented by adapters which can enforce a session limit atomically.
+// CreateSessionWithLimit counts the sessions of the user which are still valid at now, applies the limit
+// strategy and creates the session in a single transaction, so that concurrent logins can not exceed the limit.
+// Sessions whose id has been rotated away are not counted.
+type SessionLimiter[SA models.AnyStruct] interface {
+	CreateSessionWithLimit(session *models.DBSession[SA], limit *SessionLimit, now time.Time) error
+}
+
+// SessionRotator is implemented by adapters which can rotate a session id atomically.
+// RotateSession replaces the session by the new session in a single transaction: the session is pointed to
+// the new session and expires at graceExpiresAt, but only if it has not been replaced yet, and the new session
+// is created, enforcing the limit like CreateSessionWithLimit unless it is nil. It returns the id of the
+// session which replaced the session. If the session had already been replaced, the id of its existing
+// successor is returned and no session is created, so that concurrent requests rotating the same session
+// agree on a single successor. It returns sql.ErrNoRows if the session does not exist.
+type SessionRotator[SA models.AnyStruct] interface {
+	RotateSession(sessionId string, session *models.DBSession[SA], graceExpiresAt time.Time, limit *SessionLimit, now time.Time) (string, error)
+}
+
+// Revocation revokes stateless session tokens before they expire.
+// It either revokes a single session by its id, or every session of a user issued before RevokedAt.
+type Revocation struct {
+	SessionID string
+	UserID    string
+	RevokedAt time.Time
+	// ExpiresAt is the time after which the revocation is no longer needed, because every token it revokes
+	// has expired.
+	ExpiresAt time.Time
+}
+
+// RevocationStore is implemented by adapters which can store revocations of stateless session tokens.
+// GetRevocations returns the revocations which have not expired at now.
+type RevocationStore interface {
+	CreateRevocation(revocation *Revocation) error
+	GetRevocations(now time.Time) ([]*Revocation, error)
+}
+
+// RefreshToken is a stored refresh token. Only the hash of the token is stored.
+type RefreshToken struct {
+	Hash string
+	// Family is the id of the session the token was issued for. Every token obtained by refreshing a token
+	// belongs to the family of the refreshed token.
+	Family    string
+	UserID    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// UsedAt is the time the token was exchanged for a new token pair.
+	UsedAt *time.Time
+}
+
+// RefreshTokenStore is implemented by adapters which can store refresh tokens.
+// UseRefreshToken marks the token as used at now and returns it as it was before, atomically, so that only
+// one of two concurrent uses sees the token unused. GetRefreshToken returns the token without using it.
+// Both return sql.ErrNoRows if the token does not exist.
+type RefreshTokenStore interface {
+	CreateRefreshToken(token *RefreshToken) error
+	GetRefreshToken(hash string) (*RefreshToken, error)
+	UseRefreshToken(hash string, now time.Time) (*RefreshToken, error)
+	DeleteRefreshTokenFamily(family string) error
+}
+
+// ProviderToken is the OAuth token a provider issued for a key, e.g. to call the provider's API on behalf of
+// the user. The tokens are stored encrypted.
+type ProviderToken struct {
+	KeyID  string
+	UserID string
+	// Tokens holds the encrypted access and refresh tokens.
+	Tokens string
+	// ExpiresAt is the time the access token expires, if the provider reported it.
+	ExpiresAt *time.Time
+	// RevokedAt is the time the provider rejected the refresh token, as the user has revoked the grant.
+	RevokedAt *time.Time
+	UpdatedAt time.Time
+}
+
+// ProviderTokenStore is implemented by adapters which can store provider tokens.
+// SetProviderToken creates or replaces the token of the key. GetProviderToken returns sql.ErrNoRows if the key
+// has no token.
+type ProviderTokenStore interface {
+	SetProviderToken(token *ProviderToken) error
+	GetProviderToken(keyId string) (*ProviderToken, error)
+	DeleteProviderToken(keyId string) error
+}
+
+// OAuthClient is a client registered with the authorization server.
+type OAuthClient struct {
+	ID string
+	// SecretHash is the hash of the client secret. It is empty for public clients, e.g. single page and native
+	// apps, which can not keep a secret and must use PKCE.
+	SecretHash string
+	Name       string
+	// RedirectURIs are the URIs the client may redirect users back to, compared exactly.
+	RedirectURIs []string
+	// Scope is the space separated list of scopes the client may request.
+	Scope string
+	// FirstParty clients are trusted and skip the consent screen.
+	FirstParty bool
+	CreatedAt  time.Time
+}
+
+// OAuthClientStore is implemented by adapters which can store the clients of the authorization server.
+// GetOAuthClient returns sql.ErrNoRows if the client does not exist.
+type OAuthClientStore interface {
+	CreateOAuthClient(client *OAuthClient) error
+	GetOAuthClient(clientId string) (*OAuthClient, error)
+	DeleteOAuthClient(clientId string) error
+}
+
+// AuthorizationCode is an authorization code issued to a client. Only the hash of the code is stored.
+type AuthorizationCode struct {
+	Hash     string
+	ClientID string
+	UserID   string
+	// RedirectURI is the redirect URI of the authorization request, RedirectURIProvided reports whether the
+	// request included it. The token request must include the same URI only if it did.
+	RedirectURI         string
+	RedirectURIProvided bool
+	Scope               string
+	// CodeChallenge is the S256 PKCE challenge the code verifier must match, if the client sent one.
+	CodeChallenge string
+	Nonce         string
+	// AuthTime is the time the user last entered their credentials.
+	AuthTime  time.Time
+	ExpiresAt time.Time
+	// UsedAt is the time the code was exchanged, GrantID the id of the grant created by the exchange.
+	UsedAt  *time.Time
+	GrantID string
+}
+
+// OAuthConsent is the consent of a user to a client accessing the scopes.
+type OAuthConsent struct {
+	ClientID  string
+	UserID    string
+	Scope     string
+	UpdatedAt time.Time
+}
+
+// OAuthGrant is the authorization of a client to act on behalf of a user, created when the client exchanges
+// an authorization code. It is the family of the refresh tokens issued to the client.
+type OAuthGrant struct {
+	ID        string
+	ClientID  string
+	UserID    string
+	Scope     string
+	AuthTime  time.Time
+	CreatedAt time.Time
+}
+
+// OAuthGrantStore is implemented by adapters which can store the grants of the authorization server.
+// UseAuthorizationCode marks the code as used at now by the grant and returns it as it was before, atomically,
+// so that only one of two concurrent exchanges sees the code unused and a reused code identifies its grant.
+// Used codes must be kept until they expire.
+// SetOAuthConsent creates or replaces the consent of the user to the client. DeleteOAuthGrants deletes every
+// grant of the user to the client. Getters return sql.ErrNoRows if nothing was found.
+type OAuthGrantStore interface {
+	CreateAuthorizationCode(code *AuthorizationCode) error
+	UseAuthorizationCode(hash, grantId string, now time.Time) (*AuthorizationCode, error)
+	SetOAuthConsent(consent *OAuthConsent) error
+	GetOAuthConsent(clientId, userId string) (*OAuthConsent, error)
+	DeleteOAuthConsent(clientId, userId string) error
+	CreateOAuthGrant(grant *OAuthGrant) error
+	GetOAuthGrant(grantId string) (*OAuthGrant, error)
+	DeleteOAuthGrant(grantId string) error
+	DeleteOAuthGrants(clientId, userId string) error
+}
+
+// Statuses of a device code.
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+)
+
+// DeviceCode is a pending device authorization of RFC 8628. Only the hash of the device code is stored, the
+// user code is stored normalized.
+type DeviceCode struct {
+	Hash     string
+	UserCode string
+	ClientID string
+	Scope    string
+	Status   string
+	// UserID and AuthTime are set once the user approved the code.
+	UserID    string
+	AuthTime  *time.Time
+	ExpiresAt time.Time
+	// LastPolledAt is the time the device last polled the token endpoint.
+	LastPolledAt *time.Time
+}
+
+// DeviceCodeStore is implemented by adapters which can store the device codes of the authorization server.
+// CompleteDeviceCode sets the status, user and authentication time of a pending code, it returns
+// sql.ErrNoRows if the code is not pending. PollDeviceCode sets the time the code was last polled to now and
+// returns the code as it was before, atomically. UseDeviceCode deletes the code and returns it atomically, so
+// that the tokens of a code are only issued once. Getters return sql.ErrNoRows if the code does not exist.
+type DeviceCodeStore interface {
+	CreateDeviceCode(code *DeviceCode) error
+	GetDeviceCodeByUserCode(userCode string) (*DeviceCode, error)
+	CompleteDeviceCode(hash, status, userId string, authTime time.Time) error
+	PollDeviceCode(hash string, now time.Time) (*DeviceCode, error)
+	UseDeviceCode(hash string) (*DeviceCode, error)
+}
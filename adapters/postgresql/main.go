@@ -2,17 +2,35 @@ package postgresql
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/gaurishhs/keezle/adapters"
 	"github.com/gaurishhs/keezle/models"
 	"github.com/jackc/pgx/v5"
 )
 
+// TableConfig names the tables of the adapter, which schema.sql creates.
 type TableConfig struct {
 	SessionTable string
 	UserTable    string
 	KeyTable     string
+	// RevocationTable stores the revocations of stateless sessions.
+	RevocationTable string
+	// RefreshTokenTable stores the hashed refresh tokens of the token service.
+	RefreshTokenTable string
+	// ProviderTokenTable stores the encrypted OAuth tokens of provider keys.
+	ProviderTokenTable string
+	// OAuthClientTable, AuthorizationCodeTable, OAuthConsentTable and OAuthGrantTable store the clients and
+	// grants of the authorization server.
+	OAuthClientTable       string
+	AuthorizationCodeTable string
+	OAuthConsentTable      string
+	OAuthGrantTable        string
+	// DeviceCodeTable stores the device codes of the authorization server.
+	DeviceCodeTable string
 }
 
 type PostgreSQLAdapter[UA, SA models.AnyStruct] struct {
@@ -39,11 +57,26 @@ func deref(s *string) string {
 }
 
 func (a *PostgreSQLAdapter[UA, SA]) CreateUser(opts *adapters.CreateUserOpts[UA]) error {
-	_, err := a.Conn.Exec(context.Background(), fmt.Sprintf("INSERT INTO \"%s\" (id, attributes) VALUES ($1, $2)", a.Tables.UserTable), opts.User.ID, opts.User.Attributes)
+	tx, err := a.Conn.Begin(context.Background())
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback(context.Background())
+
+	if _, err := tx.Exec(context.Background(), fmt.Sprintf("INSERT INTO \"%s\" (id, attributes) VALUES ($1, $2)", a.Tables.UserTable), opts.User.ID, opts.User.Attributes); err != nil {
+		return err
+	}
+
+	if opts.Key != nil {
+		if _, err := tx.Exec(context.Background(), fmt.Sprintf(
+			"INSERT INTO \"%s\" (\"id\", \"user_id\", \"password\") VALUES ($1, $2, $3)",
+			a.Tables.KeyTable,
+		), opts.Key.ID, opts.Key.UserID, opts.Key.Password); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(context.Background())
 }
 
 func (a *PostgreSQLAdapter[UA, SA]) GetUser(userId string) (*models.User[UA], error) {
@@ -87,16 +120,126 @@ func (a *PostgreSQLAdapter[UA, SA]) DeleteUser(userId string) error {
 }
 
 func (a *PostgreSQLAdapter[UA, SA]) CreateSession(session *models.DBSession[SA]) error {
-	if _, err := a.Conn.Exec(context.Background(), fmt.Sprintf("INSERT INTO \"%s\" (\"id\", \"user_id\", \"active_expires_at\", \"idle_expires_at\", \"attributes\") VALUES ($1, $2, $3, $4, $5)", a.Tables.SessionTable), session.ID, session.UserId, session.ActiveExpiresAt, session.IdleExpiresAt, session.Attributes); err != nil {
+	if _, err := a.Conn.Exec(
+		context.Background(),
+		fmt.Sprintf("INSERT INTO \"%s\" (%s) VALUES (%s)", a.Tables.SessionTable, columnList(sessionColumns), placeholders(1, len(sessionColumns))),
+		sessionValues(session)...,
+	); err != nil {
 		return err
 	}
 	return nil
 }
 
+func (a *PostgreSQLAdapter[UA, SA]) CreateSessionWithLimit(session *models.DBSession[SA], limit *adapters.SessionLimit, now time.Time) error {
+	ctx := context.Background()
+	tx, err := a.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := a.insertSession(ctx, tx, session, limit, now); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) RotateSession(sessionId string, session *models.DBSession[SA], graceExpiresAt time.Time, limit *adapters.SessionLimit, now time.Time) (string, error) {
+	ctx := context.Background()
+	tx, err := a.Conn.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(
+		ctx,
+		fmt.Sprintf(
+			"UPDATE \"%s\" SET \"replaced_by\" = $1, \"active_expires_at\" = $2, \"idle_expires_at\" = $2 WHERE \"id\" = $3 AND \"replaced_by\" IS NULL",
+			a.Tables.SessionTable,
+		),
+		deref(session.ID),
+		graceExpiresAt,
+		sessionId,
+	)
+	if err != nil {
+		return "", err
+	}
+	if result.RowsAffected() == 0 {
+		// The session has already been replaced by a concurrent request, or does not exist.
+		var replacedBy string
+		err := tx.QueryRow(ctx, fmt.Sprintf("SELECT \"replaced_by\" FROM \"%s\" WHERE \"id\" = $1", a.Tables.SessionTable), sessionId).Scan(&replacedBy)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", sql.ErrNoRows
+		}
+		return replacedBy, err
+	}
+
+	if err := a.insertSession(ctx, tx, session, limit, now); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
+	return deref(session.ID), nil
+}
+
+// insertSession creates the session within the transaction, enforcing the limit unless it is nil.
+func (a *PostgreSQLAdapter[UA, SA]) insertSession(ctx context.Context, tx pgx.Tx, session *models.DBSession[SA], limit *adapters.SessionLimit, now time.Time) error {
+	if limit != nil {
+		// Locking the user row serializes concurrent logins of the same user.
+		if _, err := tx.Exec(ctx, fmt.Sprintf("SELECT 1 FROM \"%s\" WHERE \"id\" = $1 FOR UPDATE", a.Tables.UserTable), session.UserId); err != nil {
+			return err
+		}
+
+		order := "\"created_at\""
+		if limit.Strategy == adapters.SessionLimitEvictLeastRecentlyUsed {
+			order = "COALESCE(\"last_seen_at\", \"created_at\")"
+		}
+		rows, err := tx.Query(
+			ctx,
+			fmt.Sprintf(
+				"SELECT \"id\" FROM \"%s\" WHERE \"user_id\" = $1 AND \"idle_expires_at\" > $2 AND \"replaced_by\" IS NULL ORDER BY %s",
+				a.Tables.SessionTable,
+				order,
+			),
+			session.UserId,
+			now,
+		)
+		if err != nil {
+			return err
+		}
+		sessionIds, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return err
+		}
+
+		if excess := len(sessionIds) - limit.Max + 1; excess > 0 {
+			if limit.Strategy == adapters.SessionLimitReject {
+				return adapters.ErrSessionLimitReached
+			}
+			if _, err := tx.Exec(
+				ctx,
+				fmt.Sprintf("DELETE FROM \"%s\" WHERE \"id\" = ANY($1)", a.Tables.SessionTable),
+				sessionIds[:excess],
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := tx.Exec(
+		ctx,
+		fmt.Sprintf("INSERT INTO \"%s\" (%s) VALUES (%s)", a.Tables.SessionTable, columnList(sessionColumns), placeholders(1, len(sessionColumns))),
+		sessionValues(session)...,
+	)
+	return err
+}
+
 func (a *PostgreSQLAdapter[UA, SA]) GetSessionAndUser(sessionId string) (*models.DBSession[SA], *models.User[UA], error) {
-	row := a.Conn.QueryRow(context.Background(), fmt.Sprintf("SELECT \"id\", \"user_id\", \"active_expires_at\", \"idle_expires_at\", \"attributes\" FROM \"%s\" WHERE \"id\" = $1", a.Tables.SessionTable), sessionId)
+	row := a.Conn.QueryRow(context.Background(), fmt.Sprintf("SELECT %s FROM \"%s\" WHERE \"id\" = $1", columnList(sessionColumns), a.Tables.SessionTable), sessionId)
 	var session models.DBSession[SA]
-	if err := row.Scan(&session.ID, &session.UserId, &session.ActiveExpiresAt, &session.IdleExpiresAt, &session.Attributes); err != nil {
+	if err := row.Scan(sessionFields(&session)...); err != nil {
 		return nil, nil, err
 	}
 
@@ -112,7 +255,8 @@ func (a *PostgreSQLAdapter[UA, SA]) GetSessionsByUser(userId string) ([]*models.
 	rows, err := a.Conn.Query(
 		context.Background(),
 		fmt.Sprintf(
-			"SELECT \"id\", \"user_id\", \"active_expires_at\", \"idle_expires_at\", \"attributes\" FROM \"%s\" WHERE \"user_id\" = ?",
+			"SELECT %s FROM \"%s\" WHERE \"user_id\" = $1",
+			columnList(sessionColumns),
 			a.Tables.SessionTable,
 		),
 		userId,
@@ -122,7 +266,7 @@ func (a *PostgreSQLAdapter[UA, SA]) GetSessionsByUser(userId string) ([]*models.
 	}
 
 	defer rows.Close()
-	sessions, err := pgx.CollectRows(rows, pgx.RowToStructByPos[*models.DBSession[SA]])
+	sessions, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByPos[models.DBSession[SA]])
 	if err != nil {
 		return nil, err
 	}
@@ -133,24 +277,16 @@ func (a *PostgreSQLAdapter[UA, SA]) UpdateSession(sessionId string, newSession *
 	updatedRow := a.Conn.QueryRow(
 		context.Background(),
 		fmt.Sprintf(
-			"UPDATE \"%s\" SET "+
-				"\"id\" = COALESCE($1, \"id\"), "+
-				"\"user_id\" = COALESCE($2, \"user_id\"), "+
-				"\"active_expires_at\" = COALESCE($3, \"active_expires_at\"), "+
-				"\"idle_expires_at\" = COALESCE($4, \"idle_expires_at\"), "+
-				"\"attributes\" = COALESCE($5, \"attributes\") "+
-				"WHERE \"id\" = $6 RETURNING \"id\", \"user_id\", \"active_expires_at\", \"idle_expires_at\", \"attributes\"",
+			"UPDATE \"%s\" SET %s WHERE \"id\" = $%d RETURNING %s",
 			a.Tables.SessionTable,
+			coalesceList(sessionColumns),
+			len(sessionColumns)+1,
+			columnList(sessionColumns),
 		),
-		newSession.ID,
-		newSession.UserId,
-		newSession.ActiveExpiresAt,
-		newSession.IdleExpiresAt,
-		newSession.Attributes,
-		sessionId,
+		append(sessionValues(newSession), sessionId)...,
 	)
 	var session models.DBSession[SA]
-	if err := updatedRow.Scan(&session.ID, &session.UserId, &session.ActiveExpiresAt, &session.IdleExpiresAt, &session.Attributes); err != nil {
+	if err := updatedRow.Scan(sessionFields(&session)...); err != nil {
 		return nil, err
 	}
 
@@ -202,7 +338,7 @@ func (a *PostgreSQLAdapter[UA, SA]) GetKeysByUser(userId string) ([]*models.DBKe
 	rows, err := a.Conn.Query(
 		context.Background(),
 		fmt.Sprintf(
-			"SELECT \"id\", \"user_id\", \"attributes\" FROM \"%s\" WHERE \"user_id\" = $1",
+			"SELECT \"id\", \"user_id\", \"password\" FROM \"%s\" WHERE \"user_id\" = $1",
 			a.Tables.KeyTable,
 		),
 		userId,
@@ -250,3 +386,451 @@ func (a *PostgreSQLAdapter[UA, SA]) DeleteKey(keyId string) error {
 	}
 	return nil
 }
+
+func (a *PostgreSQLAdapter[UA, SA]) CreateRevocation(revocation *adapters.Revocation) error {
+	ctx := context.Background()
+	tx, err := a.Conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(
+		ctx,
+		fmt.Sprintf("DELETE FROM \"%s\" WHERE \"expires_at\" <= $1", a.Tables.RevocationTable),
+		revocation.RevokedAt,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		ctx,
+		fmt.Sprintf(
+			"INSERT INTO \"%s\" (\"session_id\", \"user_id\", \"revoked_at\", \"expires_at\") VALUES ($1, $2, $3, $4)",
+			a.Tables.RevocationTable,
+		),
+		revocation.SessionID,
+		revocation.UserID,
+		revocation.RevokedAt,
+		revocation.ExpiresAt,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) GetRevocations(now time.Time) ([]*adapters.Revocation, error) {
+	rows, err := a.Conn.Query(
+		context.Background(),
+		fmt.Sprintf(
+			"SELECT \"session_id\", \"user_id\", \"revoked_at\", \"expires_at\" FROM \"%s\" WHERE \"expires_at\" > $1",
+			a.Tables.RevocationTable,
+		),
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	revocations, err := pgx.CollectRows(rows, pgx.RowToAddrOfStructByPos[adapters.Revocation])
+	if err != nil {
+		return nil, err
+	}
+	return revocations, nil
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) CreateRefreshToken(token *adapters.RefreshToken) error {
+	_, err := a.Conn.Exec(
+		context.Background(),
+		fmt.Sprintf(
+			"INSERT INTO \"%s\" (\"hash\", \"family\", \"user_id\", \"created_at\", \"expires_at\", \"used_at\") VALUES ($1, $2, $3, $4, $5, $6)",
+			a.Tables.RefreshTokenTable,
+		),
+		token.Hash,
+		token.Family,
+		token.UserID,
+		token.CreatedAt,
+		token.ExpiresAt,
+		token.UsedAt,
+	)
+	return err
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) UseRefreshToken(hash string, now time.Time) (*adapters.RefreshToken, error) {
+	var token adapters.RefreshToken
+	row := a.Conn.QueryRow(
+		context.Background(),
+		fmt.Sprintf(
+			"UPDATE \"%s\" SET \"used_at\" = $1 WHERE \"hash\" = $2 AND \"used_at\" IS NULL RETURNING \"hash\", \"family\", \"user_id\", \"created_at\", \"expires_at\", \"used_at\"",
+			a.Tables.RefreshTokenTable,
+		),
+		now,
+		hash,
+	)
+	err := row.Scan(&token.Hash, &token.Family, &token.UserID, &token.CreatedAt, &token.ExpiresAt, &token.UsedAt)
+	if err == nil {
+		// Return the token as it was before it was used.
+		token.UsedAt = nil
+		return &token, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	// The token has either been used before or does not exist.
+	return a.GetRefreshToken(hash)
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) GetRefreshToken(hash string) (*adapters.RefreshToken, error) {
+	var token adapters.RefreshToken
+	row := a.Conn.QueryRow(
+		context.Background(),
+		fmt.Sprintf("SELECT \"hash\", \"family\", \"user_id\", \"created_at\", \"expires_at\", \"used_at\" FROM \"%s\" WHERE \"hash\" = $1", a.Tables.RefreshTokenTable),
+		hash,
+	)
+	if err := row.Scan(&token.Hash, &token.Family, &token.UserID, &token.CreatedAt, &token.ExpiresAt, &token.UsedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) DeleteRefreshTokenFamily(family string) error {
+	_, err := a.Conn.Exec(context.Background(), fmt.Sprintf("DELETE FROM \"%s\" WHERE \"family\" = $1", a.Tables.RefreshTokenTable), family)
+	return err
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) SetProviderToken(token *adapters.ProviderToken) error {
+	_, err := a.Conn.Exec(
+		context.Background(),
+		fmt.Sprintf(
+			"INSERT INTO \"%s\" (\"key_id\", \"user_id\", \"tokens\", \"expires_at\", \"revoked_at\", \"updated_at\") VALUES ($1, $2, $3, $4, $5, $6) "+
+				"ON CONFLICT (\"key_id\") DO UPDATE SET \"user_id\" = excluded.\"user_id\", \"tokens\" = excluded.\"tokens\", "+
+				"\"expires_at\" = excluded.\"expires_at\", \"revoked_at\" = excluded.\"revoked_at\", \"updated_at\" = excluded.\"updated_at\"",
+			a.Tables.ProviderTokenTable,
+		),
+		token.KeyID,
+		token.UserID,
+		token.Tokens,
+		token.ExpiresAt,
+		token.RevokedAt,
+		token.UpdatedAt,
+	)
+	return err
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) GetProviderToken(keyId string) (*adapters.ProviderToken, error) {
+	var token adapters.ProviderToken
+	row := a.Conn.QueryRow(
+		context.Background(),
+		fmt.Sprintf(
+			"SELECT \"key_id\", \"user_id\", \"tokens\", \"expires_at\", \"revoked_at\", \"updated_at\" FROM \"%s\" WHERE \"key_id\" = $1",
+			a.Tables.ProviderTokenTable,
+		),
+		keyId,
+	)
+	if err := row.Scan(&token.KeyID, &token.UserID, &token.Tokens, &token.ExpiresAt, &token.RevokedAt, &token.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) DeleteProviderToken(keyId string) error {
+	_, err := a.Conn.Exec(context.Background(), fmt.Sprintf("DELETE FROM \"%s\" WHERE \"key_id\" = $1", a.Tables.ProviderTokenTable), keyId)
+	return err
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) CreateOAuthClient(client *adapters.OAuthClient) error {
+	_, err := a.Conn.Exec(
+		context.Background(),
+		fmt.Sprintf(
+			"INSERT INTO \"%s\" (\"id\", \"secret_hash\", \"name\", \"redirect_uris\", \"scope\", \"first_party\", \"created_at\") VALUES ($1, $2, $3, $4, $5, $6, $7)",
+			a.Tables.OAuthClientTable,
+		),
+		client.ID,
+		client.SecretHash,
+		client.Name,
+		client.RedirectURIs,
+		client.Scope,
+		client.FirstParty,
+		client.CreatedAt,
+	)
+	return err
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) GetOAuthClient(clientId string) (*adapters.OAuthClient, error) {
+	var client adapters.OAuthClient
+	row := a.Conn.QueryRow(
+		context.Background(),
+		fmt.Sprintf(
+			"SELECT \"id\", \"secret_hash\", \"name\", \"redirect_uris\", \"scope\", \"first_party\", \"created_at\" FROM \"%s\" WHERE \"id\" = $1",
+			a.Tables.OAuthClientTable,
+		),
+		clientId,
+	)
+	if err := row.Scan(&client.ID, &client.SecretHash, &client.Name, &client.RedirectURIs, &client.Scope, &client.FirstParty, &client.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) DeleteOAuthClient(clientId string) error {
+	_, err := a.Conn.Exec(context.Background(), fmt.Sprintf("DELETE FROM \"%s\" WHERE \"id\" = $1", a.Tables.OAuthClientTable), clientId)
+	return err
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) CreateAuthorizationCode(code *adapters.AuthorizationCode) error {
+	_, err := a.Conn.Exec(
+		context.Background(),
+		fmt.Sprintf(
+			"INSERT INTO \"%s\" (%s) VALUES (%s)",
+			a.Tables.AuthorizationCodeTable,
+			columnList(authorizationCodeColumns),
+			placeholders(1, len(authorizationCodeColumns)),
+		),
+		authorizationCodeValues(code)...,
+	)
+	return err
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) UseAuthorizationCode(hash, grantId string, now time.Time) (*adapters.AuthorizationCode, error) {
+	var code adapters.AuthorizationCode
+	row := a.Conn.QueryRow(
+		context.Background(),
+		fmt.Sprintf(
+			"UPDATE \"%s\" SET \"used_at\" = $1, \"grant_id\" = $2 WHERE \"hash\" = $3 AND \"used_at\" IS NULL RETURNING %s",
+			a.Tables.AuthorizationCodeTable,
+			columnList(authorizationCodeColumns),
+		),
+		now,
+		grantId,
+		hash,
+	)
+	err := row.Scan(authorizationCodeFields(&code)...)
+	if err == nil {
+		// Return the code as it was before it was used.
+		code.UsedAt, code.GrantID = nil, ""
+		return &code, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	// The code has either been used before or does not exist.
+	row = a.Conn.QueryRow(
+		context.Background(),
+		fmt.Sprintf("SELECT %s FROM \"%s\" WHERE \"hash\" = $1", columnList(authorizationCodeColumns), a.Tables.AuthorizationCodeTable),
+		hash,
+	)
+	if err := row.Scan(authorizationCodeFields(&code)...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) SetOAuthConsent(consent *adapters.OAuthConsent) error {
+	_, err := a.Conn.Exec(
+		context.Background(),
+		fmt.Sprintf(
+			"INSERT INTO \"%s\" (\"client_id\", \"user_id\", \"scope\", \"updated_at\") VALUES ($1, $2, $3, $4) "+
+				"ON CONFLICT (\"client_id\", \"user_id\") DO UPDATE SET \"scope\" = excluded.\"scope\", \"updated_at\" = excluded.\"updated_at\"",
+			a.Tables.OAuthConsentTable,
+		),
+		consent.ClientID,
+		consent.UserID,
+		consent.Scope,
+		consent.UpdatedAt,
+	)
+	return err
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) GetOAuthConsent(clientId, userId string) (*adapters.OAuthConsent, error) {
+	var consent adapters.OAuthConsent
+	row := a.Conn.QueryRow(
+		context.Background(),
+		fmt.Sprintf("SELECT \"client_id\", \"user_id\", \"scope\", \"updated_at\" FROM \"%s\" WHERE \"client_id\" = $1 AND \"user_id\" = $2", a.Tables.OAuthConsentTable),
+		clientId,
+		userId,
+	)
+	if err := row.Scan(&consent.ClientID, &consent.UserID, &consent.Scope, &consent.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+	return &consent, nil
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) DeleteOAuthConsent(clientId, userId string) error {
+	_, err := a.Conn.Exec(context.Background(), fmt.Sprintf("DELETE FROM \"%s\" WHERE \"client_id\" = $1 AND \"user_id\" = $2", a.Tables.OAuthConsentTable), clientId, userId)
+	return err
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) CreateOAuthGrant(grant *adapters.OAuthGrant) error {
+	_, err := a.Conn.Exec(
+		context.Background(),
+		fmt.Sprintf(
+			"INSERT INTO \"%s\" (\"id\", \"client_id\", \"user_id\", \"scope\", \"auth_time\", \"created_at\") VALUES ($1, $2, $3, $4, $5, $6)",
+			a.Tables.OAuthGrantTable,
+		),
+		grant.ID,
+		grant.ClientID,
+		grant.UserID,
+		grant.Scope,
+		grant.AuthTime,
+		grant.CreatedAt,
+	)
+	return err
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) GetOAuthGrant(grantId string) (*adapters.OAuthGrant, error) {
+	var grant adapters.OAuthGrant
+	row := a.Conn.QueryRow(
+		context.Background(),
+		fmt.Sprintf("SELECT \"id\", \"client_id\", \"user_id\", \"scope\", \"auth_time\", \"created_at\" FROM \"%s\" WHERE \"id\" = $1", a.Tables.OAuthGrantTable),
+		grantId,
+	)
+	if err := row.Scan(&grant.ID, &grant.ClientID, &grant.UserID, &grant.Scope, &grant.AuthTime, &grant.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+	return &grant, nil
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) DeleteOAuthGrant(grantId string) error {
+	_, err := a.Conn.Exec(context.Background(), fmt.Sprintf("DELETE FROM \"%s\" WHERE \"id\" = $1", a.Tables.OAuthGrantTable), grantId)
+	return err
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) DeleteOAuthGrants(clientId, userId string) error {
+	_, err := a.Conn.Exec(context.Background(), fmt.Sprintf("DELETE FROM \"%s\" WHERE \"client_id\" = $1 AND \"user_id\" = $2", a.Tables.OAuthGrantTable), clientId, userId)
+	return err
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) CreateDeviceCode(code *adapters.DeviceCode) error {
+	_, err := a.Conn.Exec(
+		context.Background(),
+		fmt.Sprintf(
+			"INSERT INTO \"%s\" (\"hash\", \"user_code\", \"client_id\", \"scope\", \"status\", \"user_id\", \"auth_time\", \"expires_at\", \"last_polled_at\") "+
+				"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+			a.Tables.DeviceCodeTable,
+		),
+		code.Hash,
+		code.UserCode,
+		code.ClientID,
+		code.Scope,
+		code.Status,
+		code.UserID,
+		code.AuthTime,
+		code.ExpiresAt,
+		code.LastPolledAt,
+	)
+	return err
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) GetDeviceCodeByUserCode(userCode string) (*adapters.DeviceCode, error) {
+	var code adapters.DeviceCode
+	row := a.Conn.QueryRow(
+		context.Background(),
+		fmt.Sprintf(
+			"SELECT \"hash\", \"user_code\", \"client_id\", \"scope\", \"status\", \"user_id\", \"auth_time\", \"expires_at\", \"last_polled_at\" FROM \"%s\" WHERE \"user_code\" = $1",
+			a.Tables.DeviceCodeTable,
+		),
+		userCode,
+	)
+	if err := row.Scan(&code.Hash, &code.UserCode, &code.ClientID, &code.Scope, &code.Status, &code.UserID, &code.AuthTime, &code.ExpiresAt, &code.LastPolledAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) CompleteDeviceCode(hash, status, userId string, authTime time.Time) error {
+	res, err := a.Conn.Exec(
+		context.Background(),
+		fmt.Sprintf(
+			"UPDATE \"%s\" SET \"status\" = $1, \"user_id\" = $2, \"auth_time\" = $3 WHERE \"hash\" = $4 AND \"status\" = $5",
+			a.Tables.DeviceCodeTable,
+		),
+		status,
+		userId,
+		authTime,
+		hash,
+		adapters.DeviceCodePending,
+	)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) PollDeviceCode(hash string, now time.Time) (*adapters.DeviceCode, error) {
+	ctx := context.Background()
+	tx, err := a.Conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var code adapters.DeviceCode
+	row := tx.QueryRow(
+		ctx,
+		fmt.Sprintf(
+			"SELECT \"hash\", \"user_code\", \"client_id\", \"scope\", \"status\", \"user_id\", \"auth_time\", \"expires_at\", \"last_polled_at\" FROM \"%s\" WHERE \"hash\" = $1 FOR UPDATE",
+			a.Tables.DeviceCodeTable,
+		),
+		hash,
+	)
+	if err := row.Scan(&code.Hash, &code.UserCode, &code.ClientID, &code.Scope, &code.Status, &code.UserID, &code.AuthTime, &code.ExpiresAt, &code.LastPolledAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, fmt.Sprintf("UPDATE \"%s\" SET \"last_polled_at\" = $1 WHERE \"hash\" = $2", a.Tables.DeviceCodeTable), now, hash); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (a *PostgreSQLAdapter[UA, SA]) UseDeviceCode(hash string) (*adapters.DeviceCode, error) {
+	var code adapters.DeviceCode
+	row := a.Conn.QueryRow(
+		context.Background(),
+		fmt.Sprintf(
+			"DELETE FROM \"%s\" WHERE \"hash\" = $1 RETURNING \"hash\", \"user_code\", \"client_id\", \"scope\", \"status\", \"user_id\", \"auth_time\", \"expires_at\", \"last_polled_at\"",
+			a.Tables.DeviceCodeTable,
+		),
+		hash,
+	)
+	if err := row.Scan(&code.Hash, &code.UserCode, &code.ClientID, &code.Scope, &code.Status, &code.UserID, &code.AuthTime, &code.ExpiresAt, &code.LastPolledAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, sql.ErrNoRows
+		}
+		return nil, err
+	}
+	return &code, nil
+}
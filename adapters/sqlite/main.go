@@ -1,8 +1,12 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/gaurishhs/keezle/adapters"
 	"github.com/gaurishhs/keezle/models"
@@ -10,10 +14,25 @@ import (
 	_ "modernc.org/sqlite"
 )
 
+// TableConfig names the tables of the adapter, which schema.sql creates.
 type TableConfig struct {
 	SessionTable string
 	UserTable    string
 	KeyTable     string
+	// RevocationTable stores the revocations of stateless sessions.
+	RevocationTable string
+	// RefreshTokenTable stores the hashed refresh tokens of the token service.
+	RefreshTokenTable string
+	// ProviderTokenTable stores the encrypted OAuth tokens of provider keys.
+	ProviderTokenTable string
+	// OAuthClientTable, AuthorizationCodeTable, OAuthConsentTable and OAuthGrantTable store the clients and
+	// grants of the authorization server.
+	OAuthClientTable       string
+	AuthorizationCodeTable string
+	OAuthConsentTable      string
+	OAuthGrantTable        string
+	// DeviceCodeTable stores the device codes of the authorization server.
+	DeviceCodeTable string
 }
 
 type SQLiteAdapter[UA, SA models.AnyStruct] struct {
@@ -38,14 +57,56 @@ func deref(s *string) string {
 	return *s
 }
 
-func (a *SQLiteAdapter[UA, SA]) CreateUser(opts *adapters.CreateUserOpts[UA]) error {
-	_, err := a.DB.Exec(fmt.Sprintf("insert into `%s` (id, attributes) values (?, ?)", a.Tables.UserTable), opts.User.ID, opts.User.Attributes)
+// immediateTx runs fn in a transaction which takes the write lock when it begins. A deferred transaction
+// which reads before it writes fails with SQLITE_BUSY when another writer holds the lock, while an immediate
+// transaction waits for the busy timeout of the connection, so that concurrent writers are serialized.
+func (a *SQLiteAdapter[UA, SA]) immediateTx(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := a.DB.Conn(ctx)
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return err
+	}
+	if err := fn(ctx, conn); err != nil {
+		conn.ExecContext(ctx, "ROLLBACK")
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+		conn.ExecContext(ctx, "ROLLBACK")
+		return err
+	}
 	return nil
 }
 
+func (a *SQLiteAdapter[UA, SA]) CreateUser(opts *adapters.CreateUserOpts[UA]) error {
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(fmt.Sprintf("insert into `%s` (id, attributes) values (?, ?)", a.Tables.UserTable), opts.User.ID, opts.User.Attributes)
+	if err != nil {
+		return err
+	}
+
+	if opts.Key != nil {
+		_, err = tx.Exec(fmt.Sprintf(
+			"INSERT INTO `%s` (`id`, `user_id`, `password`) VALUES (?, ?, ?)",
+			a.Tables.KeyTable,
+		), opts.Key.ID, opts.Key.UserID, opts.Key.Password)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
 func (a *SQLiteAdapter[UA, SA]) GetUser(userId string) (*models.User[UA], error) {
 	var user models.User[UA]
 	row := a.DB.QueryRow(fmt.Sprintf("select id, attributes from `%s` where id = ?", a.Tables.UserTable), userId)
@@ -90,7 +151,10 @@ func (a *SQLiteAdapter[UA, SA]) DeleteUser(userId string) error {
 }
 
 func (a *SQLiteAdapter[UA, SA]) CreateSession(session *models.DBSession[SA]) error {
-	_, err := a.DB.Exec(fmt.Sprintf("INSERT INTO `%s` (`id`, `user_id`, `active_expires_at`, `idle_expires_at`, `attributes`) VALUES (?, ?, ?, ?, ?) ", a.Tables.SessionTable), session.ID, session.UserId, session.ActiveExpiresAt, session.IdleExpiresAt, session.Attributes)
+	_, err := a.DB.Exec(
+		fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s)", a.Tables.SessionTable, columnList(sessionColumns), placeholders(len(sessionColumns))),
+		sessionValues(session)...,
+	)
 
 	if err != nil {
 		return err
@@ -99,10 +163,109 @@ func (a *SQLiteAdapter[UA, SA]) CreateSession(session *models.DBSession[SA]) err
 	return nil
 }
 
+func (a *SQLiteAdapter[UA, SA]) CreateSessionWithLimit(session *models.DBSession[SA], limit *adapters.SessionLimit, now time.Time) error {
+	return a.immediateTx(func(ctx context.Context, conn *sql.Conn) error {
+		return a.insertSession(ctx, conn, session, limit, now)
+	})
+}
+
+func (a *SQLiteAdapter[UA, SA]) RotateSession(sessionId string, session *models.DBSession[SA], graceExpiresAt time.Time, limit *adapters.SessionLimit, now time.Time) (string, error) {
+	replacedBy := deref(session.ID)
+	err := a.immediateTx(func(ctx context.Context, conn *sql.Conn) error {
+		result, err := conn.ExecContext(
+			ctx,
+			fmt.Sprintf(
+				"UPDATE `%s` SET `replaced_by` = ?, `active_expires_at` = ?, `idle_expires_at` = ? WHERE `id` = ? AND `replaced_by` IS NULL",
+				a.Tables.SessionTable,
+			),
+			replacedBy,
+			graceExpiresAt,
+			graceExpiresAt,
+			sessionId,
+		)
+		if err != nil {
+			return err
+		}
+		replaced, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if replaced == 1 {
+			return a.insertSession(ctx, conn, session, limit, now)
+		}
+
+		// The session has already been replaced by a concurrent request, or does not exist.
+		return conn.QueryRowContext(
+			ctx,
+			fmt.Sprintf("SELECT `replaced_by` FROM `%s` WHERE `id` = ?", a.Tables.SessionTable),
+			sessionId,
+		).Scan(&replacedBy)
+	})
+	if err != nil {
+		return "", err
+	}
+	return replacedBy, nil
+}
+
+// insertSession creates the session within the transaction of the connection, enforcing the limit unless it
+// is nil.
+func (a *SQLiteAdapter[UA, SA]) insertSession(ctx context.Context, conn *sql.Conn, session *models.DBSession[SA], limit *adapters.SessionLimit, now time.Time) error {
+	if limit != nil {
+		order := "`created_at`"
+		if limit.Strategy == adapters.SessionLimitEvictLeastRecentlyUsed {
+			order = "COALESCE(`last_seen_at`, `created_at`)"
+		}
+		rows, err := conn.QueryContext(
+			ctx,
+			fmt.Sprintf(
+				"SELECT `id` FROM `%s` WHERE `user_id` = ? AND `idle_expires_at` > ? AND `replaced_by` IS NULL ORDER BY %s",
+				a.Tables.SessionTable,
+				order,
+			),
+			session.UserId,
+			now,
+		)
+		if err != nil {
+			return err
+		}
+		var sessionIds []string
+		for rows.Next() {
+			var sessionId string
+			if err := rows.Scan(&sessionId); err != nil {
+				rows.Close()
+				return err
+			}
+			sessionIds = append(sessionIds, sessionId)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if excess := len(sessionIds) - limit.Max + 1; excess > 0 {
+			if limit.Strategy == adapters.SessionLimitReject {
+				return adapters.ErrSessionLimitReached
+			}
+			for _, sessionId := range sessionIds[:excess] {
+				if _, err := conn.ExecContext(ctx, fmt.Sprintf("DELETE FROM `%s` WHERE `id` = ?", a.Tables.SessionTable), sessionId); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	_, err := conn.ExecContext(
+		ctx,
+		fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s)", a.Tables.SessionTable, columnList(sessionColumns), placeholders(len(sessionColumns))),
+		sessionValues(session)...,
+	)
+	return err
+}
+
 func (a *SQLiteAdapter[UA, SA]) GetSessionAndUser(sessionId string) (*models.DBSession[SA], *models.User[UA], error) {
-	row := a.DB.QueryRow(fmt.Sprintf("SELECT `id`, `user_id`, `active_expires_at`, `idle_expires_at`, `attributes` FROM `%s` WHERE `id` = ?", a.Tables.SessionTable), sessionId)
+	row := a.DB.QueryRow(fmt.Sprintf("SELECT %s FROM `%s` WHERE `id` = ?", columnList(sessionColumns), a.Tables.SessionTable), sessionId)
 	var session models.DBSession[SA]
-	if err := row.Scan(&session.ID, &session.UserId, &session.ActiveExpiresAt, &session.IdleExpiresAt, &session.Attributes); err != nil {
+	if err := row.Scan(sessionFields(&session)...); err != nil {
 		return nil, nil, err
 	}
 
@@ -117,7 +280,8 @@ func (a *SQLiteAdapter[UA, SA]) GetSessionAndUser(sessionId string) (*models.DBS
 func (a *SQLiteAdapter[UA, SA]) GetSessionsByUser(userId string) ([]*models.DBSession[SA], error) {
 	rows, err := a.DB.Query(
 		fmt.Sprintf(
-			"SELECT `id`, `user_id`, `active_expires_at`, `idle_expires_at`, `attributes` FROM `%s` WHERE `user_id` = ?",
+			"SELECT %s FROM `%s` WHERE `user_id` = ?",
+			columnList(sessionColumns),
 			a.Tables.SessionTable,
 		),
 		userId,
@@ -135,25 +299,16 @@ func (a *SQLiteAdapter[UA, SA]) GetSessionsByUser(userId string) ([]*models.DBSe
 func (a *SQLiteAdapter[UA, SA]) UpdateSession(sessionId string, newSession *models.DBSession[SA]) (*models.DBSession[SA], error) {
 	updatedRow := a.DB.QueryRow(
 		fmt.Sprintf(
-			"UPDATE `%s` SET"+
-				"`id` = COALESCE(?, `id`), "+
-				"`user_id` = COALESCE(?, `user_id`), "+
-				"`active_expires_at` = COALESCE(?, `active_expires_at`), "+
-				"`idle_expires_at` = COALESCE(?, `idle_expires_at`), "+
-				"`attributes` = COALESCE(?, `attributes`) "+
-				"WHERE `id` = ? RETURNING `id`, `user_id`, `active_expires_at`, `idle_expires_at`, `attributes`",
+			"UPDATE `%s` SET %s WHERE `id` = ? RETURNING %s",
 			a.Tables.SessionTable,
+			coalesceList(sessionColumns),
+			columnList(sessionColumns),
 		),
-		newSession.ID,
-		newSession.UserId,
-		newSession.ActiveExpiresAt,
-		newSession.IdleExpiresAt,
-		newSession.Attributes,
-		sessionId,
+		append(sessionValues(newSession), sessionId)...,
 	)
 	var session models.DBSession[SA]
 
-	if err := updatedRow.Scan(session.ID, session.UserId, session.ActiveExpiresAt, session.IdleExpiresAt, &session.Attributes); err != nil {
+	if err := updatedRow.Scan(sessionFields(&session)...); err != nil {
 		return nil, err
 	}
 
@@ -203,7 +358,7 @@ func (a *SQLiteAdapter[UA, SA]) GetKey(keyId string) (*models.DBKey, error) {
 func (a *SQLiteAdapter[UA, SA]) GetKeysByUser(userId string) ([]*models.DBKey, error) {
 	rows, err := a.DB.Query(
 		fmt.Sprintf(
-			"SELECT `id`, `user_id`, `attributes` FROM `%s` WHERE `user_id` = ?",
+			"SELECT `id`, `user_id`, `password` FROM `%s` WHERE `user_id` = ?",
 			a.Tables.KeyTable,
 		),
 		userId,
@@ -248,3 +403,401 @@ func (a *SQLiteAdapter[UA, SA]) DeleteKey(keyId string) error {
 	}
 	return nil
 }
+
+func (a *SQLiteAdapter[UA, SA]) CreateRevocation(revocation *adapters.Revocation) error {
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		fmt.Sprintf("DELETE FROM `%s` WHERE `expires_at` <= ?", a.Tables.RevocationTable),
+		revocation.RevokedAt,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		fmt.Sprintf(
+			"INSERT INTO `%s` (`session_id`, `user_id`, `revoked_at`, `expires_at`) VALUES (?, ?, ?, ?)",
+			a.Tables.RevocationTable,
+		),
+		revocation.SessionID,
+		revocation.UserID,
+		revocation.RevokedAt,
+		revocation.ExpiresAt,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (a *SQLiteAdapter[UA, SA]) GetRevocations(now time.Time) ([]*adapters.Revocation, error) {
+	rows, err := a.DB.Query(
+		fmt.Sprintf(
+			"SELECT `session_id`, `user_id`, `revoked_at`, `expires_at` FROM `%s` WHERE `expires_at` > ?",
+			a.Tables.RevocationTable,
+		),
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	var revocations []*adapters.Revocation
+	err = rowsToStructs(rows, &revocations)
+	return revocations, err
+}
+
+func (a *SQLiteAdapter[UA, SA]) CreateRefreshToken(token *adapters.RefreshToken) error {
+	_, err := a.DB.Exec(
+		fmt.Sprintf(
+			"INSERT INTO `%s` (`hash`, `family`, `user_id`, `created_at`, `expires_at`, `used_at`) VALUES (?, ?, ?, ?, ?, ?)",
+			a.Tables.RefreshTokenTable,
+		),
+		token.Hash,
+		token.Family,
+		token.UserID,
+		token.CreatedAt,
+		token.ExpiresAt,
+		token.UsedAt,
+	)
+	return err
+}
+
+func (a *SQLiteAdapter[UA, SA]) UseRefreshToken(hash string, now time.Time) (*adapters.RefreshToken, error) {
+	var token adapters.RefreshToken
+	row := a.DB.QueryRow(
+		fmt.Sprintf(
+			"UPDATE `%s` SET `used_at` = ? WHERE `hash` = ? AND `used_at` IS NULL RETURNING `hash`, `family`, `user_id`, `created_at`, `expires_at`, `used_at`",
+			a.Tables.RefreshTokenTable,
+		),
+		now,
+		hash,
+	)
+	err := row.Scan(&token.Hash, &token.Family, &token.UserID, &token.CreatedAt, &token.ExpiresAt, &token.UsedAt)
+	if err == nil {
+		// Return the token as it was before it was used.
+		token.UsedAt = nil
+		return &token, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// The token has either been used before or does not exist.
+	return a.GetRefreshToken(hash)
+}
+
+func (a *SQLiteAdapter[UA, SA]) GetRefreshToken(hash string) (*adapters.RefreshToken, error) {
+	var token adapters.RefreshToken
+	row := a.DB.QueryRow(
+		fmt.Sprintf("SELECT `hash`, `family`, `user_id`, `created_at`, `expires_at`, `used_at` FROM `%s` WHERE `hash` = ?", a.Tables.RefreshTokenTable),
+		hash,
+	)
+	if err := row.Scan(&token.Hash, &token.Family, &token.UserID, &token.CreatedAt, &token.ExpiresAt, &token.UsedAt); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (a *SQLiteAdapter[UA, SA]) DeleteRefreshTokenFamily(family string) error {
+	_, err := a.DB.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE `family` = ?", a.Tables.RefreshTokenTable), family)
+	return err
+}
+
+func (a *SQLiteAdapter[UA, SA]) SetProviderToken(token *adapters.ProviderToken) error {
+	_, err := a.DB.Exec(
+		fmt.Sprintf(
+			"INSERT INTO `%s` (`key_id`, `user_id`, `tokens`, `expires_at`, `revoked_at`, `updated_at`) VALUES (?, ?, ?, ?, ?, ?) "+
+				"ON CONFLICT (`key_id`) DO UPDATE SET `user_id` = excluded.`user_id`, `tokens` = excluded.`tokens`, "+
+				"`expires_at` = excluded.`expires_at`, `revoked_at` = excluded.`revoked_at`, `updated_at` = excluded.`updated_at`",
+			a.Tables.ProviderTokenTable,
+		),
+		token.KeyID,
+		token.UserID,
+		token.Tokens,
+		token.ExpiresAt,
+		token.RevokedAt,
+		token.UpdatedAt,
+	)
+	return err
+}
+
+func (a *SQLiteAdapter[UA, SA]) GetProviderToken(keyId string) (*adapters.ProviderToken, error) {
+	var token adapters.ProviderToken
+	row := a.DB.QueryRow(
+		fmt.Sprintf(
+			"SELECT `key_id`, `user_id`, `tokens`, `expires_at`, `revoked_at`, `updated_at` FROM `%s` WHERE `key_id` = ?",
+			a.Tables.ProviderTokenTable,
+		),
+		keyId,
+	)
+	if err := row.Scan(&token.KeyID, &token.UserID, &token.Tokens, &token.ExpiresAt, &token.RevokedAt, &token.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (a *SQLiteAdapter[UA, SA]) DeleteProviderToken(keyId string) error {
+	_, err := a.DB.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE `key_id` = ?", a.Tables.ProviderTokenTable), keyId)
+	return err
+}
+
+func (a *SQLiteAdapter[UA, SA]) CreateOAuthClient(client *adapters.OAuthClient) error {
+	_, err := a.DB.Exec(
+		fmt.Sprintf(
+			"INSERT INTO `%s` (`id`, `secret_hash`, `name`, `redirect_uris`, `scope`, `first_party`, `created_at`) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			a.Tables.OAuthClientTable,
+		),
+		client.ID,
+		client.SecretHash,
+		client.Name,
+		// Redirect URIs can not contain spaces.
+		strings.Join(client.RedirectURIs, " "),
+		client.Scope,
+		client.FirstParty,
+		client.CreatedAt,
+	)
+	return err
+}
+
+func (a *SQLiteAdapter[UA, SA]) GetOAuthClient(clientId string) (*adapters.OAuthClient, error) {
+	var client adapters.OAuthClient
+	var redirectURIs string
+	row := a.DB.QueryRow(
+		fmt.Sprintf(
+			"SELECT `id`, `secret_hash`, `name`, `redirect_uris`, `scope`, `first_party`, `created_at` FROM `%s` WHERE `id` = ?",
+			a.Tables.OAuthClientTable,
+		),
+		clientId,
+	)
+	if err := row.Scan(&client.ID, &client.SecretHash, &client.Name, &redirectURIs, &client.Scope, &client.FirstParty, &client.CreatedAt); err != nil {
+		return nil, err
+	}
+	client.RedirectURIs = strings.Fields(redirectURIs)
+	return &client, nil
+}
+
+func (a *SQLiteAdapter[UA, SA]) DeleteOAuthClient(clientId string) error {
+	_, err := a.DB.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE `id` = ?", a.Tables.OAuthClientTable), clientId)
+	return err
+}
+
+func (a *SQLiteAdapter[UA, SA]) CreateAuthorizationCode(code *adapters.AuthorizationCode) error {
+	_, err := a.DB.Exec(
+		fmt.Sprintf(
+			"INSERT INTO `%s` (%s) VALUES (%s)",
+			a.Tables.AuthorizationCodeTable,
+			columnList(authorizationCodeColumns),
+			placeholders(len(authorizationCodeColumns)),
+		),
+		authorizationCodeValues(code)...,
+	)
+	return err
+}
+
+func (a *SQLiteAdapter[UA, SA]) UseAuthorizationCode(hash, grantId string, now time.Time) (*adapters.AuthorizationCode, error) {
+	var code adapters.AuthorizationCode
+	row := a.DB.QueryRow(
+		fmt.Sprintf(
+			"UPDATE `%s` SET `used_at` = ?, `grant_id` = ? WHERE `hash` = ? AND `used_at` IS NULL RETURNING %s",
+			a.Tables.AuthorizationCodeTable,
+			columnList(authorizationCodeColumns),
+		),
+		now,
+		grantId,
+		hash,
+	)
+	err := row.Scan(authorizationCodeFields(&code)...)
+	if err == nil {
+		// Return the code as it was before it was used.
+		code.UsedAt, code.GrantID = nil, ""
+		return &code, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// The code has either been used before or does not exist.
+	row = a.DB.QueryRow(
+		fmt.Sprintf("SELECT %s FROM `%s` WHERE `hash` = ?", columnList(authorizationCodeColumns), a.Tables.AuthorizationCodeTable),
+		hash,
+	)
+	if err := row.Scan(authorizationCodeFields(&code)...); err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (a *SQLiteAdapter[UA, SA]) SetOAuthConsent(consent *adapters.OAuthConsent) error {
+	_, err := a.DB.Exec(
+		fmt.Sprintf(
+			"INSERT INTO `%s` (`client_id`, `user_id`, `scope`, `updated_at`) VALUES (?, ?, ?, ?) "+
+				"ON CONFLICT (`client_id`, `user_id`) DO UPDATE SET `scope` = excluded.`scope`, `updated_at` = excluded.`updated_at`",
+			a.Tables.OAuthConsentTable,
+		),
+		consent.ClientID,
+		consent.UserID,
+		consent.Scope,
+		consent.UpdatedAt,
+	)
+	return err
+}
+
+func (a *SQLiteAdapter[UA, SA]) GetOAuthConsent(clientId, userId string) (*adapters.OAuthConsent, error) {
+	var consent adapters.OAuthConsent
+	row := a.DB.QueryRow(
+		fmt.Sprintf("SELECT `client_id`, `user_id`, `scope`, `updated_at` FROM `%s` WHERE `client_id` = ? AND `user_id` = ?", a.Tables.OAuthConsentTable),
+		clientId,
+		userId,
+	)
+	if err := row.Scan(&consent.ClientID, &consent.UserID, &consent.Scope, &consent.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+func (a *SQLiteAdapter[UA, SA]) DeleteOAuthConsent(clientId, userId string) error {
+	_, err := a.DB.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE `client_id` = ? AND `user_id` = ?", a.Tables.OAuthConsentTable), clientId, userId)
+	return err
+}
+
+func (a *SQLiteAdapter[UA, SA]) CreateOAuthGrant(grant *adapters.OAuthGrant) error {
+	_, err := a.DB.Exec(
+		fmt.Sprintf(
+			"INSERT INTO `%s` (`id`, `client_id`, `user_id`, `scope`, `auth_time`, `created_at`) VALUES (?, ?, ?, ?, ?, ?)",
+			a.Tables.OAuthGrantTable,
+		),
+		grant.ID,
+		grant.ClientID,
+		grant.UserID,
+		grant.Scope,
+		grant.AuthTime,
+		grant.CreatedAt,
+	)
+	return err
+}
+
+func (a *SQLiteAdapter[UA, SA]) GetOAuthGrant(grantId string) (*adapters.OAuthGrant, error) {
+	var grant adapters.OAuthGrant
+	row := a.DB.QueryRow(
+		fmt.Sprintf("SELECT `id`, `client_id`, `user_id`, `scope`, `auth_time`, `created_at` FROM `%s` WHERE `id` = ?", a.Tables.OAuthGrantTable),
+		grantId,
+	)
+	if err := row.Scan(&grant.ID, &grant.ClientID, &grant.UserID, &grant.Scope, &grant.AuthTime, &grant.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+func (a *SQLiteAdapter[UA, SA]) DeleteOAuthGrant(grantId string) error {
+	_, err := a.DB.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE `id` = ?", a.Tables.OAuthGrantTable), grantId)
+	return err
+}
+
+func (a *SQLiteAdapter[UA, SA]) DeleteOAuthGrants(clientId, userId string) error {
+	_, err := a.DB.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE `client_id` = ? AND `user_id` = ?", a.Tables.OAuthGrantTable), clientId, userId)
+	return err
+}
+
+func (a *SQLiteAdapter[UA, SA]) CreateDeviceCode(code *adapters.DeviceCode) error {
+	_, err := a.DB.Exec(
+		fmt.Sprintf(
+			"INSERT INTO `%s` (`hash`, `user_code`, `client_id`, `scope`, `status`, `user_id`, `auth_time`, `expires_at`, `last_polled_at`) "+
+				"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			a.Tables.DeviceCodeTable,
+		),
+		code.Hash,
+		code.UserCode,
+		code.ClientID,
+		code.Scope,
+		code.Status,
+		code.UserID,
+		code.AuthTime,
+		code.ExpiresAt,
+		code.LastPolledAt,
+	)
+	return err
+}
+
+func (a *SQLiteAdapter[UA, SA]) GetDeviceCodeByUserCode(userCode string) (*adapters.DeviceCode, error) {
+	var code adapters.DeviceCode
+	row := a.DB.QueryRow(
+		fmt.Sprintf(
+			"SELECT `hash`, `user_code`, `client_id`, `scope`, `status`, `user_id`, `auth_time`, `expires_at`, `last_polled_at` FROM `%s` WHERE `user_code` = ?",
+			a.Tables.DeviceCodeTable,
+		),
+		userCode,
+	)
+	if err := row.Scan(&code.Hash, &code.UserCode, &code.ClientID, &code.Scope, &code.Status, &code.UserID, &code.AuthTime, &code.ExpiresAt, &code.LastPolledAt); err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (a *SQLiteAdapter[UA, SA]) CompleteDeviceCode(hash, status, userId string, authTime time.Time) error {
+	res, err := a.DB.Exec(
+		fmt.Sprintf(
+			"UPDATE `%s` SET `status` = ?, `user_id` = ?, `auth_time` = ? WHERE `hash` = ? AND `status` = ?",
+			a.Tables.DeviceCodeTable,
+		),
+		status,
+		userId,
+		authTime,
+		hash,
+		adapters.DeviceCodePending,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (a *SQLiteAdapter[UA, SA]) PollDeviceCode(hash string, now time.Time) (*adapters.DeviceCode, error) {
+	var code adapters.DeviceCode
+	err := a.immediateTx(func(ctx context.Context, conn *sql.Conn) error {
+		row := conn.QueryRowContext(
+			ctx,
+			fmt.Sprintf(
+				"SELECT `hash`, `user_code`, `client_id`, `scope`, `status`, `user_id`, `auth_time`, `expires_at`, `last_polled_at` FROM `%s` WHERE `hash` = ?",
+				a.Tables.DeviceCodeTable,
+			),
+			hash,
+		)
+		if err := row.Scan(&code.Hash, &code.UserCode, &code.ClientID, &code.Scope, &code.Status, &code.UserID, &code.AuthTime, &code.ExpiresAt, &code.LastPolledAt); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("UPDATE `%s` SET `last_polled_at` = ? WHERE `hash` = ?", a.Tables.DeviceCodeTable), now, hash)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+func (a *SQLiteAdapter[UA, SA]) UseDeviceCode(hash string) (*adapters.DeviceCode, error) {
+	var code adapters.DeviceCode
+	row := a.DB.QueryRow(
+		fmt.Sprintf(
+			"DELETE FROM `%s` WHERE `hash` = ? RETURNING `hash`, `user_code`, `client_id`, `scope`, `status`, `user_id`, `auth_time`, `expires_at`, `last_polled_at`",
+			a.Tables.DeviceCodeTable,
+		),
+		hash,
+	)
+	if err := row.Scan(&code.Hash, &code.UserCode, &code.ClientID, &code.Scope, &code.Status, &code.UserID, &code.AuthTime, &code.ExpiresAt, &code.LastPolledAt); err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
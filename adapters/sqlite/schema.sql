@@ -0,0 +1,133 @@
+-- Tables of the SQLite adapter, named as in TableConfig. Foreign keys are only enforced with
+-- PRAGMA foreign_keys = ON, deleting a user then deletes its keys and sessions.
+
+CREATE TABLE users (
+    id TEXT PRIMARY KEY,
+    attributes TEXT NOT NULL
+);
+
+CREATE TABLE keys (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    password TEXT
+);
+
+CREATE INDEX keys_user_id ON keys (user_id);
+
+CREATE TABLE sessions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    active_expires_at DATETIME NOT NULL,
+    idle_expires_at DATETIME,
+    attributes TEXT,
+    persistent INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME,
+    issued_at DATETIME,
+    replaced_by TEXT,
+    last_seen_at DATETIME,
+    ip_address TEXT,
+    user_agent TEXT,
+    -- binding is the JSON encoded models.SessionBinding.
+    binding TEXT,
+    authenticated_at DATETIME,
+    auth_level INTEGER,
+    -- auth_levels is the JSON encoded models.AuthLevels.
+    auth_levels TEXT
+);
+
+CREATE INDEX sessions_user_id ON sessions (user_id);
+
+-- revocations lists the revoked stateless sessions, session_id is empty if every session of the user created
+-- before revoked_at is revoked.
+CREATE TABLE revocations (
+    session_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    revoked_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX revocations_expires_at ON revocations (expires_at);
+
+-- refresh_tokens stores the hashes of refresh tokens, family is the session or grant they were issued for.
+CREATE TABLE refresh_tokens (
+    hash TEXT PRIMARY KEY,
+    family TEXT NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME
+);
+
+CREATE INDEX refresh_tokens_family ON refresh_tokens (family);
+
+-- provider_tokens stores the encrypted OAuth tokens of provider keys.
+CREATE TABLE provider_tokens (
+    key_id TEXT PRIMARY KEY REFERENCES keys (id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    tokens TEXT NOT NULL,
+    expires_at DATETIME,
+    revoked_at DATETIME,
+    updated_at DATETIME NOT NULL
+);
+
+-- oauth_clients, authorization_codes, oauth_consents and oauth_grants store the clients and grants of the
+-- authorization server. Used authorization codes are kept until they expire, so that a reused code revokes
+-- the grant created by its first exchange.
+CREATE TABLE oauth_clients (
+    id TEXT PRIMARY KEY,
+    secret_hash TEXT NOT NULL,
+    name TEXT NOT NULL,
+    -- redirect_uris is the space separated list of redirect URIs.
+    redirect_uris TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    first_party INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL
+);
+
+CREATE TABLE authorization_codes (
+    hash TEXT PRIMARY KEY,
+    client_id TEXT NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    redirect_uri_provided INTEGER NOT NULL DEFAULT 0,
+    scope TEXT NOT NULL,
+    code_challenge TEXT NOT NULL,
+    nonce TEXT NOT NULL,
+    auth_time DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    grant_id TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE oauth_consents (
+    client_id TEXT NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    scope TEXT NOT NULL,
+    updated_at DATETIME NOT NULL,
+    PRIMARY KEY (client_id, user_id)
+);
+
+CREATE TABLE oauth_grants (
+    id TEXT PRIMARY KEY,
+    client_id TEXT NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    scope TEXT NOT NULL,
+    auth_time DATETIME NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX oauth_grants_client_id_user_id ON oauth_grants (client_id, user_id);
+
+-- device_codes stores the device codes of the authorization server. user_id and auth_time are set once the
+-- user approved or denied the login.
+CREATE TABLE device_codes (
+    hash TEXT PRIMARY KEY,
+    user_code TEXT NOT NULL UNIQUE,
+    client_id TEXT NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    scope TEXT NOT NULL,
+    status TEXT NOT NULL,
+    user_id TEXT NOT NULL DEFAULT '',
+    auth_time DATETIME,
+    expires_at DATETIME NOT NULL,
+    last_polled_at DATETIME
+);
@@ -3,14 +3,164 @@ package sqlite
 import (
 	"database/sql"
 	"reflect"
+	"strings"
+
+	"github.com/gaurishhs/keezle/adapters"
+	"github.com/gaurishhs/keezle/models"
 )
 
+// sessionColumns lists the columns of the session table in the field order of models.DBSession.
+var sessionColumns = []string{
+	"id",
+	"user_id",
+	"active_expires_at",
+	"idle_expires_at",
+	"attributes",
+	"persistent",
+	"created_at",
+	"issued_at",
+	"replaced_by",
+	"last_seen_at",
+	"ip_address",
+	"user_agent",
+	"binding",
+	"authenticated_at",
+	"auth_level",
+	"auth_levels",
+}
+
+// sessionFields returns pointers to the fields of the session in the order of sessionColumns.
+func sessionFields[SA models.AnyStruct](session *models.DBSession[SA]) []any {
+	return []any{
+		&session.ID,
+		&session.UserId,
+		&session.ActiveExpiresAt,
+		&session.IdleExpiresAt,
+		&session.Attributes,
+		&session.Persistent,
+		&session.CreatedAt,
+		&session.IssuedAt,
+		&session.ReplacedBy,
+		&session.LastSeenAt,
+		&session.IPAddress,
+		&session.UserAgent,
+		&session.Binding,
+		&session.AuthenticatedAt,
+		&session.AuthLevel,
+		&session.AuthLevels,
+	}
+}
+
+// sessionValues returns the fields of the session in the order of sessionColumns.
+func sessionValues[SA models.AnyStruct](session *models.DBSession[SA]) []any {
+	return []any{
+		session.ID,
+		session.UserId,
+		session.ActiveExpiresAt,
+		session.IdleExpiresAt,
+		session.Attributes,
+		session.Persistent,
+		session.CreatedAt,
+		session.IssuedAt,
+		session.ReplacedBy,
+		session.LastSeenAt,
+		session.IPAddress,
+		session.UserAgent,
+		session.Binding,
+		session.AuthenticatedAt,
+		session.AuthLevel,
+		session.AuthLevels,
+	}
+}
+
+// authorizationCodeColumns lists the columns of the authorization code table in the field order of
+// adapters.AuthorizationCode.
+var authorizationCodeColumns = []string{
+	"hash",
+	"client_id",
+	"user_id",
+	"redirect_uri",
+	"redirect_uri_provided",
+	"scope",
+	"code_challenge",
+	"nonce",
+	"auth_time",
+	"expires_at",
+	"used_at",
+	"grant_id",
+}
+
+// authorizationCodeFields returns pointers to the fields of the code in the order of authorizationCodeColumns.
+func authorizationCodeFields(code *adapters.AuthorizationCode) []any {
+	return []any{
+		&code.Hash,
+		&code.ClientID,
+		&code.UserID,
+		&code.RedirectURI,
+		&code.RedirectURIProvided,
+		&code.Scope,
+		&code.CodeChallenge,
+		&code.Nonce,
+		&code.AuthTime,
+		&code.ExpiresAt,
+		&code.UsedAt,
+		&code.GrantID,
+	}
+}
+
+// authorizationCodeValues returns the fields of the code in the order of authorizationCodeColumns.
+func authorizationCodeValues(code *adapters.AuthorizationCode) []any {
+	return []any{
+		code.Hash,
+		code.ClientID,
+		code.UserID,
+		code.RedirectURI,
+		code.RedirectURIProvided,
+		code.Scope,
+		code.CodeChallenge,
+		code.Nonce,
+		code.AuthTime,
+		code.ExpiresAt,
+		code.UsedAt,
+		code.GrantID,
+	}
+}
+
+// columnList returns the quoted, comma separated column names.
+func columnList(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = "`" + column + "`"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// placeholders returns n comma separated query placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// coalesceList returns the SET clause of an update which only overwrites the columns whose value is not NULL.
+func coalesceList(columns []string) string {
+	set := make([]string, len(columns))
+	for i, column := range columns {
+		set[i] = "`" + column + "` = COALESCE(?, `" + column + "`)"
+	}
+	return strings.Join(set, ", ")
+}
+
+// rowsToStructs scans the rows into a slice of structs or struct pointers, field by field in column order.
 func rowsToStructs(rows *sql.Rows, dest any) error {
 	destv := reflect.ValueOf(dest).Elem()
-	args := make([]any, destv.Type().Elem().NumField())
+	elemType := destv.Type().Elem()
+	structType := elemType
+	if elemType.Kind() == reflect.Pointer {
+		structType = elemType.Elem()
+	}
+	args := make([]any, structType.NumField())
 
 	for rows.Next() {
-		rowp := reflect.New(destv.Type().Elem())
+		rowp := reflect.New(structType)
 		rowv := rowp.Elem()
 
 		for i := 0; i < rowv.NumField(); i++ {
@@ -20,7 +170,11 @@ func rowsToStructs(rows *sql.Rows, dest any) error {
 		if err := rows.Scan(args...); err != nil {
 			return err
 		}
-		destv.Set(reflect.Append(destv, rowv))
+		if elemType.Kind() == reflect.Pointer {
+			destv.Set(reflect.Append(destv, rowp))
+		} else {
+			destv.Set(reflect.Append(destv, rowv))
+		}
 	}
-	return nil
+	return rows.Err()
 }
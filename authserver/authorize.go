@@ -0,0 +1,352 @@
+package authserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/adapters"
+	"github.com/gaurishhs/keezle/models"
+	"github.com/gaurishhs/keezle/utils"
+)
+
+// Fields of the consent form posted back to the authorization endpoint.
+const (
+	consentField      = "consent"
+	consentTokenField = "consent_token"
+	consentAllow      = "allow"
+)
+
+// ConsentRequest describes the consent screen for a client requesting scopes.
+type ConsentRequest struct {
+	Client *adapters.OAuthClient
+	// UserID is the id of the signed in user.
+	UserID string
+	Scopes []string
+	// Action is the URL the consent form posts to.
+	Action string
+	// Params are the hidden fields of the consent form. The form must post them back together with a
+	// "consent" field of "allow" or "deny".
+	Params url.Values
+}
+
+// authorizationRequest is a validated authorization request.
+type authorizationRequest struct {
+	client      *adapters.OAuthClient
+	redirectURI string
+	// redirectURIProvided reports whether the request included the redirect URI, instead of using the only
+	// URI of the client.
+	redirectURIProvided bool
+	state               string
+	scope               string
+	codeChallenge       string
+	nonce               string
+	prompt              []string
+	// maxAge is the maximum age of the authentication in seconds, or -1.
+	maxAge int
+	params url.Values
+}
+
+// Authorize serves the authorization endpoint.
+// Users without a session are sent to the login page, users who have not consented to the requested scopes
+// of a third-party client are shown the consent screen. The endpoint then redirects back to the client with
+// an authorization code. The prompt values "none" and "consent" and the "max_age" parameter are supported.
+func (s *Server[UA, SA]) Authorize(w http.ResponseWriter, req *http.Request) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodPost) {
+		return
+	}
+
+	authReq, err := s.Keezle.HandleRequest(req)
+	if err != nil {
+		if errors.Is(err, keezle.ErrInvalidRequestOrigin) {
+			http.Error(w, "invalid request origin", http.StatusForbidden)
+			return
+		}
+		s.failInternal(w, req, err)
+		return
+	}
+	authReq.WriteCookie = func(cookie *http.Cookie) { http.SetCookie(w, cookie) }
+
+	req.Body = http.MaxBytesReader(w, req.Body, maxBodySize)
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	ar, ok := s.parseAuthorizationRequest(w, req)
+	if !ok {
+		return
+	}
+
+	session, err := authReq.Validate()
+	if err != nil {
+		s.failInternal(w, req, err)
+		return
+	}
+	if session == nil || (ar.maxAge >= 0 && s.now().Sub(session.AuthenticatedAt) > time.Duration(ar.maxAge)*time.Second) {
+		if slices.Contains(ar.prompt, "none") {
+			s.redirectError(w, req, ar, ErrorLoginRequired, "")
+			return
+		}
+		s.redirectToLogin(w, req, ar)
+		return
+	}
+
+	if !ar.client.FirstParty {
+		consented, err := s.checkConsent(w, req, ar, session)
+		if err != nil {
+			s.failInternal(w, req, err)
+			return
+		}
+		if !consented {
+			return
+		}
+	}
+
+	code, err := utils.GenerateRandomString(32)
+	if err != nil {
+		s.failInternal(w, req, err)
+		return
+	}
+	err = s.grants.CreateAuthorizationCode(&adapters.AuthorizationCode{
+		Hash:                hashToken(code),
+		ClientID:            ar.client.ID,
+		UserID:              session.User.ID,
+		RedirectURI:         ar.redirectURI,
+		RedirectURIProvided: ar.redirectURIProvided,
+		Scope:               ar.scope,
+		CodeChallenge:       ar.codeChallenge,
+		Nonce:               ar.nonce,
+		AuthTime:            session.AuthenticatedAt,
+		ExpiresAt:           s.now().Add(s.Config.AuthorizationCodeLifetime),
+	})
+	if err != nil {
+		s.failInternal(w, req, err)
+		return
+	}
+	s.redirect(w, req, ar, url.Values{"code": {code}})
+}
+
+// parseAuthorizationRequest validates the parameters of an authorization request.
+// Errors before the redirect URI has been validated are shown to the user, as redirecting to an unverified
+// URI would make the server an open redirector. Later errors are sent to the client.
+func (s *Server[UA, SA]) parseAuthorizationRequest(w http.ResponseWriter, req *http.Request) (*authorizationRequest, bool) {
+	params := url.Values{}
+	for name, values := range req.Form {
+		if name != consentField && name != consentTokenField {
+			params[name] = values
+		}
+	}
+
+	client, err := s.GetClient(params.Get("client_id"))
+	if err != nil {
+		if errors.Is(err, ErrClientNotFound) {
+			http.Error(w, "unknown client", http.StatusBadRequest)
+			return nil, false
+		}
+		s.failInternal(w, req, err)
+		return nil, false
+	}
+
+	ar := &authorizationRequest{
+		client:      client,
+		redirectURI: params.Get("redirect_uri"),
+		state:       params.Get("state"),
+		nonce:       params.Get("nonce"),
+		prompt:      strings.Fields(params.Get("prompt")),
+		maxAge:      -1,
+		params:      params,
+	}
+	ar.redirectURIProvided = ar.redirectURI != ""
+	if !ar.redirectURIProvided && len(client.RedirectURIs) == 1 {
+		ar.redirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, ar.redirectURI) {
+		http.Error(w, "invalid redirect uri", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if params.Get("response_type") != "code" {
+		s.redirectError(w, req, ar, ErrorUnsupportedResponseType, "only the code response type is supported")
+		return nil, false
+	}
+
+	ar.codeChallenge = params.Get("code_challenge")
+	switch {
+	case ar.codeChallenge == "" && client.SecretHash == "":
+		s.redirectError(w, req, ar, ErrorInvalidRequest, "public clients must use PKCE")
+		return nil, false
+	case ar.codeChallenge != "" && params.Get("code_challenge_method") != "S256":
+		s.redirectError(w, req, ar, ErrorInvalidRequest, "only the S256 code challenge method is supported")
+		return nil, false
+	}
+
+	ar.scope = strings.Join(scopes(params.Get("scope")), " ")
+	if ar.scope == "" {
+		ar.scope = client.Scope
+	}
+	if !containsScopes(client.Scope, ar.scope) {
+		s.redirectError(w, req, ar, ErrorInvalidScope, "")
+		return nil, false
+	}
+
+	if maxAge := params.Get("max_age"); maxAge != "" {
+		if ar.maxAge, err = strconv.Atoi(maxAge); err != nil || ar.maxAge < 0 {
+			s.redirectError(w, req, ar, ErrorInvalidRequest, "invalid max_age")
+			return nil, false
+		}
+	}
+	return ar, true
+}
+
+// checkConsent reports whether the user consented to the requested scopes, storing the consent posted by the
+// consent form. If the user has to consent, it renders the consent screen and returns false.
+func (s *Server[UA, SA]) checkConsent(w http.ResponseWriter, req *http.Request, ar *authorizationRequest, session *models.Session[UA, SA]) (bool, error) {
+	token := consentToken(session.ID, ar)
+
+	if req.Method == http.MethodPost && req.PostForm.Has(consentField) {
+		// The consent token proves that the consent form was rendered for this session and request, so that
+		// other sites can not post consent on behalf of the user.
+		if !hmac.Equal([]byte(req.PostForm.Get(consentTokenField)), []byte(token)) {
+			http.Error(w, "invalid consent", http.StatusForbidden)
+			return false, nil
+		}
+		if req.PostForm.Get(consentField) != consentAllow {
+			s.redirectError(w, req, ar, ErrorAccessDenied, "")
+			return false, nil
+		}
+
+		var previous string
+		if consent, err := s.grants.GetOAuthConsent(ar.client.ID, session.User.ID); err == nil {
+			previous = consent.Scope
+		}
+		err := s.grants.SetOAuthConsent(&adapters.OAuthConsent{
+			ClientID:  ar.client.ID,
+			UserID:    session.User.ID,
+			Scope:     mergeScopes(previous, ar.scope),
+			UpdatedAt: s.now(),
+		})
+		return err == nil, err
+	}
+
+	if !slices.Contains(ar.prompt, "consent") {
+		consent, err := s.grants.GetOAuthConsent(ar.client.ID, session.User.ID)
+		if err == nil && containsScopes(consent.Scope, ar.scope) {
+			return true, nil
+		}
+	}
+	if slices.Contains(ar.prompt, "none") {
+		s.redirectError(w, req, ar, ErrorConsentRequired, "")
+		return false, nil
+	}
+
+	params := url.Values{}
+	for name, values := range ar.params {
+		params[name] = values
+	}
+	params.Set(consentTokenField, token)
+	// The consent screen must not be framed, so that it can not be clickjacked.
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	s.Config.RenderConsent(w, req, &ConsentRequest{
+		Client: ar.client,
+		UserID: session.User.ID,
+		Scopes: scopes(ar.scope),
+		Action: s.endpoint(AuthorizationPath),
+		Params: params,
+	})
+	return false, nil
+}
+
+// consentToken returns the token binding the consent form to the session and the authorization request.
+func consentToken(sessionId string, ar *authorizationRequest) string {
+	mac := hmac.New(sha256.New, []byte(sessionId))
+	mac.Write([]byte(ar.client.ID + "\x00" + ar.redirectURI + "\x00" + ar.scope))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// redirectToLogin sends the user to the login page, which returns to the authorization request.
+func (s *Server[UA, SA]) redirectToLogin(w http.ResponseWriter, req *http.Request, ar *authorizationRequest) {
+	if s.Config.LoginURL == "" {
+		s.redirectError(w, req, ar, ErrorLoginRequired, "")
+		return
+	}
+	s.loginRedirect(w, req, s.endpoint(AuthorizationPath)+"?"+ar.params.Encode())
+}
+
+// loginRedirect redirects the user to the login page, which returns to returnTo after login.
+func (s *Server[UA, SA]) loginRedirect(w http.ResponseWriter, req *http.Request, returnTo string) {
+	if s.Config.LoginURL == "" {
+		http.Error(w, "login required", http.StatusUnauthorized)
+		return
+	}
+	target, err := url.Parse(s.Config.LoginURL)
+	if err != nil {
+		s.failInternal(w, req, err)
+		return
+	}
+	query := target.Query()
+	query.Set(s.Config.ReturnToParam, returnTo)
+	target.RawQuery = query.Encode()
+	http.Redirect(w, req, target.String(), http.StatusSeeOther)
+}
+
+// redirect redirects the user back to the client with the parameters, the state of the request and the
+// issuer, which lets clients talking to several servers detect mix-up attacks, see RFC 9207.
+func (s *Server[UA, SA]) redirect(w http.ResponseWriter, req *http.Request, ar *authorizationRequest, params url.Values) {
+	target, err := url.Parse(ar.redirectURI)
+	if err != nil {
+		s.failInternal(w, req, err)
+		return
+	}
+	query := target.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if ar.state != "" {
+		query.Set("state", ar.state)
+	}
+	query.Set("iss", s.Config.Issuer)
+	target.RawQuery = query.Encode()
+	http.Redirect(w, req, target.String(), http.StatusSeeOther)
+}
+
+// redirectError redirects the user back to the client with an error.
+func (s *Server[UA, SA]) redirectError(w http.ResponseWriter, req *http.Request, ar *authorizationRequest, code, description string) {
+	params := url.Values{"error": {code}}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	s.redirect(w, req, ar, params)
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Authorize {{.Client.Name}}</title></head>
+<body>
+<form method="post" action="{{.Action}}">
+<p>{{.Client.Name}} would like to access your account:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+{{range $name, $values := .Params}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">
+{{end}}{{end}}<button type="submit" name="consent" value="deny">Deny</button>
+<button type="submit" name="consent" value="allow">Allow</button>
+</form>
+</body>
+</html>
+`))
+
+// renderConsent renders the default consent screen.
+func renderConsent(w http.ResponseWriter, req *http.Request, consent *ConsentRequest) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	consentTemplate.Execute(w, consent)
+}
@@ -0,0 +1,384 @@
+// Package authserver turns Keezle into an OAuth 2.0 authorization server and OpenID Connect provider, so that
+// first-party apps and partners can sign users in with the accounts of the main app.
+// It implements the authorization code flow with PKCE on top of Keezle sessions: users sign in with the
+// application's own login page, consent to the scopes requested by third-party clients and the client
+// exchanges the code for an access token, a refresh token and an ID token. The server also serves the
+// userinfo, token revocation, JWKS and discovery endpoints.
+// Devices without a browser, e.g. CLI tools, log in with the device authorization grant of RFC 8628.
+// Clients, authorization codes, consents and grants are stored by the adapter, which must implement
+// adapters.OAuthClientStore, adapters.OAuthGrantStore and adapters.RefreshTokenStore. The device
+// authorization grant is available if it also implements adapters.DeviceCodeStore.
+package authserver
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/adapters"
+	"github.com/gaurishhs/keezle/jwt"
+	"github.com/gaurishhs/keezle/models"
+	"github.com/gaurishhs/keezle/utils"
+)
+
+// Error codes of RFC 6749 and OpenID Connect returned by the endpoints.
+const (
+	ErrorInvalidRequest          = "invalid_request"
+	ErrorInvalidClient           = "invalid_client"
+	ErrorInvalidGrant            = "invalid_grant"
+	ErrorUnauthorizedClient      = "unauthorized_client"
+	ErrorUnsupportedGrantType    = "unsupported_grant_type"
+	ErrorUnsupportedResponseType = "unsupported_response_type"
+	ErrorInvalidScope            = "invalid_scope"
+	ErrorAccessDenied            = "access_denied"
+	ErrorLoginRequired           = "login_required"
+	ErrorConsentRequired         = "consent_required"
+	ErrorInvalidToken            = "invalid_token"
+	ErrorInsufficientScope       = "insufficient_scope"
+	ErrorServerError             = "server_error"
+)
+
+// ScopeOpenID is the scope requesting an ID token.
+const ScopeOpenID = "openid"
+
+var (
+	// ErrInvalidRedirectURI is returned when a client is registered with a redirect URI which is not absolute,
+	// has a fragment or uses plain HTTP for a host other than the loopback interface.
+	ErrInvalidRedirectURI = errors.New("authserver: invalid redirect uri")
+	// ErrClientNotFound is returned when a client does not exist.
+	ErrClientNotFound = errors.New("authserver: client not found")
+)
+
+// maxBodySize is the maximum size of a request body accepted by the endpoints.
+const maxBodySize = 1 << 20
+
+// Config defines the configuration of an authorization server.
+type Config[UA models.AnyStruct] struct {
+	// Issuer is the URL identifying the server, e.g. "https://example.com/oauth". The endpoints are served
+	// below its path.
+	Issuer string
+	// Keys sign access tokens and ID tokens. The signing key must be an asymmetric key, so that clients can
+	// verify ID tokens with the keys published by the JWKS endpoint.
+	Keys *jwt.KeySet
+	// Audience is written to the "aud" claim of access tokens, if set. It identifies the API accepting them.
+	Audience string
+	// LoginURL is the login page users without a session are sent to. The URL of the authorization request is
+	// appended to it as the ReturnToParam query parameter, the login page redirects back to it after login.
+	LoginURL string
+	// ReturnToParam defaults to "return_to".
+	ReturnToParam string
+	// RenderConsent renders the consent screen asking the user to grant scopes to a third-party client.
+	// It defaults to a minimal HTML form.
+	RenderConsent func(w http.ResponseWriter, req *http.Request, consent *ConsentRequest)
+	// UserClaims returns the claims about the user included in ID tokens and userinfo responses for the
+	// granted scopes, e.g. "email" and "email_verified" for the "email" scope. The "sub" claim is always
+	// the user id.
+	UserClaims func(user *models.User[UA], scopes []string) (map[string]any, error)
+	// ScopesSupported are the scopes published by the discovery document.
+	ScopesSupported []string
+	// AuthorizationCodeLifetime defaults to 1 minute.
+	AuthorizationCodeLifetime time.Duration
+	// AccessTokenLifetime is the lifetime of access tokens and ID tokens, defaults to 15 minutes.
+	AccessTokenLifetime time.Duration
+	// RefreshTokenLifetime defaults to 30 days. Every refresh issues a new refresh token.
+	RefreshTokenLifetime time.Duration
+	// DeviceCodeLifetime is how long a device login can be approved, defaults to 10 minutes.
+	DeviceCodeLifetime time.Duration
+	// DevicePollInterval is the minimum interval between two polls of a device, defaults to 5 seconds.
+	DevicePollInterval time.Duration
+	// RenderDeviceVerification renders the verification page of the device authorization grant.
+	// It defaults to a minimal HTML page.
+	RenderDeviceVerification func(w http.ResponseWriter, req *http.Request, verification *DeviceVerification)
+}
+
+// Server is an OAuth 2.0 authorization server for the users of a Keezle instance.
+type Server[UA, SA models.AnyStruct] struct {
+	Keezle *keezle.Keezle[UA, SA]
+	Config *Config[UA]
+
+	clients       adapters.OAuthClientStore
+	grants        adapters.OAuthGrantStore
+	refreshTokens adapters.RefreshTokenStore
+	// devices is nil if the adapter does not support the device authorization grant.
+	devices adapters.DeviceCodeStore
+	// basePath is the path of the issuer, which the endpoints are served below.
+	basePath string
+}
+
+// New creates an authorization server for the Keezle instance.
+// It panics if the configuration is invalid or the adapter does not implement the required stores.
+func New[UA, SA models.AnyStruct](k *keezle.Keezle[UA, SA], config *Config[UA]) *Server[UA, SA] {
+	if config == nil || config.Keys == nil || config.Keys.SigningKey() == nil {
+		panic("authorization server requires a signing key")
+	}
+	if _, err := config.Keys.SigningKey().JWK(); err != nil {
+		panic("authorization server requires an asymmetric signing key")
+	}
+	issuer, err := url.Parse(config.Issuer)
+	if err != nil || issuer.Scheme == "" || issuer.Host == "" || issuer.RawQuery != "" || issuer.Fragment != "" {
+		panic("authorization server requires an issuer URL")
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+
+	if config.ReturnToParam == "" {
+		config.ReturnToParam = "return_to"
+	}
+
+	if config.RenderConsent == nil {
+		config.RenderConsent = renderConsent
+	}
+
+	if config.AuthorizationCodeLifetime == 0 {
+		config.AuthorizationCodeLifetime = time.Minute
+	}
+
+	if config.AccessTokenLifetime == 0 {
+		config.AccessTokenLifetime = time.Minute * 15
+	}
+
+	if config.RefreshTokenLifetime == 0 {
+		config.RefreshTokenLifetime = time.Hour * 24 * 30
+	}
+
+	if config.DeviceCodeLifetime == 0 {
+		config.DeviceCodeLifetime = time.Minute * 10
+	}
+
+	if config.DevicePollInterval == 0 {
+		config.DevicePollInterval = time.Second * 5
+	}
+
+	if config.RenderDeviceVerification == nil {
+		config.RenderDeviceVerification = renderDevice
+	}
+
+	s := &Server[UA, SA]{
+		Keezle:   k,
+		Config:   config,
+		basePath: strings.TrimSuffix(issuer.Path, "/"),
+	}
+	var ok bool
+	if s.clients, ok = k.Config.Adapter.(adapters.OAuthClientStore); !ok {
+		panic("authorization server requires an adapter implementing adapters.OAuthClientStore")
+	}
+	if s.grants, ok = k.Config.Adapter.(adapters.OAuthGrantStore); !ok {
+		panic("authorization server requires an adapter implementing adapters.OAuthGrantStore")
+	}
+	if s.refreshTokens, ok = k.Config.Adapter.(adapters.RefreshTokenStore); !ok {
+		panic("authorization server requires an adapter implementing adapters.RefreshTokenStore")
+	}
+	s.devices, _ = k.Config.Adapter.(adapters.DeviceCodeStore)
+	return s
+}
+
+// Endpoint paths, relative to the path of the issuer.
+const (
+	AuthorizationPath = "/authorize"
+	TokenPath         = "/token"
+	UserInfoPath      = "/userinfo"
+	RevocationPath    = "/revoke"
+	JWKSPath          = "/jwks"
+	// DeviceAuthorizationPath and DeviceVerificationPath are only served if the adapter supports the device
+	// authorization grant.
+	DeviceAuthorizationPath = "/device_authorization"
+	DeviceVerificationPath  = "/device"
+)
+
+// Handler returns a handler serving the endpoints and discovery documents below the path of the issuer.
+// It expects the request path to be unchanged, so mount it at the root or at the path of the issuer.
+func (s *Server[UA, SA]) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(s.basePath+AuthorizationPath, s.Authorize)
+	mux.HandleFunc(s.basePath+TokenPath, s.Token)
+	mux.HandleFunc(s.basePath+UserInfoPath, s.UserInfo)
+	mux.HandleFunc(s.basePath+RevocationPath, s.Revoke)
+	mux.HandleFunc(s.basePath+JWKSPath, s.JWKS)
+	if s.devices != nil {
+		mux.HandleFunc(s.basePath+DeviceAuthorizationPath, s.DeviceAuthorization)
+		mux.HandleFunc(s.basePath+DeviceVerificationPath, s.VerifyDevice)
+	}
+	mux.HandleFunc(s.basePath+"/.well-known/openid-configuration", s.Discovery)
+	mux.HandleFunc(s.basePath+"/.well-known/oauth-authorization-server", s.Discovery)
+	return mux
+}
+
+// endpoint returns the URL of the endpoint.
+func (s *Server[UA, SA]) endpoint(path string) string {
+	return s.Config.Issuer + path
+}
+
+// now returns the current time of the clock of the Keezle instance.
+func (s *Server[UA, SA]) now() time.Time {
+	return s.Keezle.Config.Clock.Now()
+}
+
+// hashToken returns the hash of a code, refresh token or client secret, which are stored hashed.
+// They are random, so a fast hash suffices.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RegisterClientOptions defines the options of a new client.
+type RegisterClientOptions struct {
+	Name         string
+	RedirectURIs []string
+	// Scope is the space separated list of scopes the client may request.
+	Scope string
+	// Public clients have no secret, see adapters.OAuthClient.
+	Public bool
+	// FirstParty clients skip the consent screen.
+	FirstParty bool
+}
+
+// RegisterClient registers a client and returns it with its secret, which is only stored hashed and can not
+// be recovered. The secret is empty for public clients. Clients without redirect URIs can only use the device
+// authorization grant.
+func (s *Server[UA, SA]) RegisterClient(opts RegisterClientOptions) (*adapters.OAuthClient, string, error) {
+	for _, redirectURI := range opts.RedirectURIs {
+		if !isValidRedirectURI(redirectURI) {
+			return nil, "", ErrInvalidRedirectURI
+		}
+	}
+
+	clientId, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return nil, "", err
+	}
+	client := &adapters.OAuthClient{
+		ID:           strings.TrimRight(clientId, "="),
+		Name:         opts.Name,
+		RedirectURIs: opts.RedirectURIs,
+		Scope:        strings.Join(strings.Fields(opts.Scope), " "),
+		FirstParty:   opts.FirstParty,
+		CreatedAt:    s.now(),
+	}
+	var secret string
+	if !opts.Public {
+		if secret, err = utils.GenerateRandomString(32); err != nil {
+			return nil, "", err
+		}
+		client.SecretHash = hashToken(secret)
+	}
+	if err := s.clients.CreateOAuthClient(client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+// deniedRedirectSchemes are the schemes which run or embed content in the browser instead of navigating to an
+// app, so that redirecting to them with a code would run script in the origin of the authorization server.
+var deniedRedirectSchemes = []string{"javascript", "data", "vbscript", "file", "blob", "about"}
+
+// isValidRedirectURI reports whether the URI can be registered. Native apps may use custom schemes, plain
+// HTTP is only allowed for the loopback interface, see RFC 8252.
+func isValidRedirectURI(redirectURI string) bool {
+	u, err := url.Parse(redirectURI)
+	if err != nil || !u.IsAbs() || u.Fragment != "" || strings.ContainsAny(redirectURI, " ") {
+		return false
+	}
+	// url.Parse lowercases the scheme.
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		return u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1" || u.Hostname() == "::1"
+	}
+	return !slices.Contains(deniedRedirectSchemes, u.Scheme)
+}
+
+// GetClient returns the client with the id. It returns ErrClientNotFound if the client does not exist.
+func (s *Server[UA, SA]) GetClient(clientId string) (*adapters.OAuthClient, error) {
+	client, err := s.clients.GetOAuthClient(clientId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrClientNotFound
+		}
+		return nil, err
+	}
+	return client, nil
+}
+
+// DeleteClient deletes the client. Its refresh tokens stop working, access tokens stay valid until they expire.
+func (s *Server[UA, SA]) DeleteClient(clientId string) error {
+	return s.clients.DeleteOAuthClient(clientId)
+}
+
+// RevokeConsent revokes the consent of the user to the client and every grant of the user to the client, so
+// that the client has to ask for consent again and its refresh tokens stop working.
+func (s *Server[UA, SA]) RevokeConsent(clientId, userId string) error {
+	if err := s.grants.DeleteOAuthConsent(clientId, userId); err != nil {
+		return err
+	}
+	return s.grants.DeleteOAuthGrants(clientId, userId)
+}
+
+// scopes splits a space separated list of scopes.
+func scopes(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// containsScopes reports whether the granted scopes contain every requested scope.
+func containsScopes(granted, requested string) bool {
+	grantedScopes := scopes(granted)
+	for _, scope := range scopes(requested) {
+		if !slices.Contains(grantedScopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeScopes returns the union of two lists of scopes.
+func mergeScopes(a, b string) string {
+	merged := scopes(a)
+	for _, scope := range scopes(b) {
+		if !slices.Contains(merged, scope) {
+			merged = append(merged, scope)
+		}
+	}
+	return strings.Join(merged, " ")
+}
+
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// writeJSON writes a JSON response which must not be cached, as it may contain tokens.
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// fail responds with an OAuth error.
+func fail(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, errorResponse{Error: code, ErrorDescription: description})
+}
+
+// failInternal logs the error and responds with a server error.
+func (s *Server[UA, SA]) failInternal(w http.ResponseWriter, req *http.Request, err error) {
+	s.Keezle.Config.Logger.Log("error: authserver: %s %s: %v", req.Method, req.URL.Path, err)
+	fail(w, http.StatusInternalServerError, ErrorServerError, "")
+}
+
+// allowMethods responds with 405 Method Not Allowed and returns false unless the request uses one of the methods.
+func allowMethods(w http.ResponseWriter, req *http.Request, methods ...string) bool {
+	if slices.Contains(methods, req.Method) {
+		return true
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	fail(w, http.StatusMethodNotAllowed, ErrorInvalidRequest, "method not allowed")
+	return false
+}
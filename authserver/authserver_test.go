@@ -0,0 +1,423 @@
+package authserver_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/authserver"
+	"github.com/gaurishhs/keezle/jwt"
+	"github.com/gaurishhs/keezle/keezletest"
+)
+
+type attributes = keezletest.Attributes
+
+var epoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	issuer      = "https://auth.example.com/oauth"
+	redirectURI = "https://app.example.com/callback"
+	verifier    = "dBjftJeZ4CVP-mJ0kanZhOmZkj7lOtHyJcn3BTJgvwk"
+)
+
+type oauthAdapter struct {
+	*keezletest.MemoryAdapter[attributes, attributes]
+	*keezletest.RefreshTokenStore
+	*keezletest.OAuthStore
+}
+
+// server is an authorization server for a user "u1" with a session, on a memory adapter and a fake clock.
+type server struct {
+	auth    *authserver.Server[attributes, attributes]
+	keezle  *keezle.Keezle[attributes, attributes]
+	adapter *oauthAdapter
+	clock   *keezletest.FakeClock
+	handler http.Handler
+	session string
+}
+
+func newServer(t *testing.T) *server {
+	t.Helper()
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{
+		adapter: &oauthAdapter{keezletest.NewMemoryAdapter[attributes, attributes](), &keezletest.RefreshTokenStore{}, &keezletest.OAuthStore{}},
+		clock:   keezletest.NewFakeClock(epoch),
+	}
+	s.keezle = keezle.New(&keezle.Config[attributes, attributes]{Adapter: s.adapter, Clock: s.clock})
+	s.auth = authserver.New(s.keezle, &authserver.Config[attributes]{
+		Issuer:   issuer,
+		Keys:     jwt.NewKeySet(jwt.NewECDSAKey("k1", privateKey)),
+		LoginURL: "/login",
+	})
+	s.handler = s.auth.Handler()
+
+	if _, err := s.keezle.CreateUser(keezle.CreateUserOptions[attributes]{UserID: "u1", Attributes: &attributes{}}); err != nil {
+		t.Fatal(err)
+	}
+	session, err := s.keezle.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.session = session.ID
+	return s
+}
+
+// client is a registered client and its secret, which is empty for public clients.
+type client struct {
+	id     string
+	secret string
+}
+
+func (s *server) registerClient(t *testing.T, opts authserver.RegisterClientOptions) client {
+	t.Helper()
+	registered, secret, err := s.auth.RegisterClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client{registered.ID, secret}
+}
+
+// serve serves the request with the session cookie of the user, if session is set.
+func (s *server) serve(req *http.Request, session string) *http.Response {
+	if session != "" {
+		req.AddCookie(&http.Cookie{Name: "auth_session", Value: session})
+	}
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+// authorize sends an authorization request of the user and returns the URL it redirected to.
+func (s *server) authorize(t *testing.T, params url.Values) *url.URL {
+	t.Helper()
+	res := s.serve(httptest.NewRequest(http.MethodGet, issuer+authserver.AuthorizationPath+"?"+params.Encode(), nil), s.session)
+	if res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("authorization request = %d", res.StatusCode)
+	}
+	location, err := url.Parse(res.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+// code returns an authorization code of the user for the first-party client. The request includes the redirect
+// URI and a code challenge for the verifier unless they are removed from the parameters.
+func (s *server) code(t *testing.T, c client, edit func(params url.Values)) string {
+	t.Helper()
+	params := url.Values{
+		"client_id":             {c.id},
+		"response_type":         {"code"},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {"openid"},
+		"code_challenge":        {challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	if edit != nil {
+		edit(params)
+	}
+	code := s.authorize(t, params).Query().Get("code")
+	if code == "" {
+		t.Fatal("the authorization request did not return a code")
+	}
+	return code
+}
+
+// post posts the form to the endpoint with the credentials of the client.
+func (s *server) post(t *testing.T, path string, c client, form url.Values) (int, map[string]any) {
+	t.Helper()
+	if c.secret == "" {
+		form.Set("client_id", c.id)
+	}
+	req := httptest.NewRequest(http.MethodPost, issuer+path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c.secret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.id), url.QueryEscape(c.secret))
+	}
+	res := s.serve(req, "")
+	defer res.Body.Close()
+	var body map[string]any
+	if data, _ := io.ReadAll(res.Body); len(data) > 0 {
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Fatalf("POST %s: %v", path, err)
+		}
+	}
+	return res.StatusCode, body
+}
+
+// exchange exchanges a code of the client for tokens and fails the test if the exchange fails.
+func (s *server) exchange(t *testing.T, c client, code string) map[string]any {
+	t.Helper()
+	status, body := s.post(t, authserver.TokenPath, c, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	})
+	if status != http.StatusOK {
+		t.Fatalf("code exchange = %d %v", status, body)
+	}
+	return body
+}
+
+func (s *server) refresh(t *testing.T, c client, refreshToken string) (int, map[string]any) {
+	t.Helper()
+	return s.post(t, authserver.TokenPath, c, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}})
+}
+
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestAuthorizationCodeExchange(t *testing.T) {
+	tests := []struct {
+		name string
+		// authorization edits the parameters of the authorization request, token the token request.
+		authorization func(params url.Values)
+		token         func(form url.Values)
+		otherClient   bool
+		elapsed       time.Duration
+		status        int
+	}{
+		{name: "valid", status: http.StatusOK},
+		{name: "wrong verifier", token: func(form url.Values) { form.Set("code_verifier", "wrong") }, status: http.StatusBadRequest},
+		{name: "missing verifier", token: func(form url.Values) { form.Del("code_verifier") }, status: http.StatusBadRequest},
+		{
+			name: "verifier without challenge",
+			authorization: func(params url.Values) {
+				params.Del("code_challenge")
+				params.Del("code_challenge_method")
+			},
+			status: http.StatusBadRequest,
+		},
+		{name: "other redirect uri", token: func(form url.Values) { form.Set("redirect_uri", redirectURI+"/other") }, status: http.StatusBadRequest},
+		{name: "missing redirect uri", token: func(form url.Values) { form.Del("redirect_uri") }, status: http.StatusBadRequest},
+		{
+			name:          "redirect uri omitted from both requests",
+			authorization: func(params url.Values) { params.Del("redirect_uri") },
+			token:         func(form url.Values) { form.Del("redirect_uri") },
+			status:        http.StatusOK,
+		},
+		{name: "other client", otherClient: true, status: http.StatusBadRequest},
+		{name: "expired", elapsed: time.Minute, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t)
+			c := s.registerClient(t, authserver.RegisterClientOptions{RedirectURIs: []string{redirectURI}, Scope: "openid", FirstParty: true})
+			other := s.registerClient(t, authserver.RegisterClientOptions{RedirectURIs: []string{redirectURI}, Scope: "openid", FirstParty: true})
+
+			code := s.code(t, c, tt.authorization)
+			s.clock.Advance(tt.elapsed)
+			form := url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {code},
+				"redirect_uri":  {redirectURI},
+				"code_verifier": {verifier},
+			}
+			if tt.token != nil {
+				tt.token(form)
+			}
+			exchanging := c
+			if tt.otherClient {
+				exchanging = other
+			}
+			status, body := s.post(t, authserver.TokenPath, exchanging, form)
+			if status != tt.status {
+				t.Fatalf("code exchange = %d %v, want %d", status, body, tt.status)
+			}
+			if status != http.StatusOK {
+				if body["error"] != authserver.ErrorInvalidGrant {
+					t.Errorf("error = %v, want %q", body["error"], authserver.ErrorInvalidGrant)
+				}
+				return
+			}
+			if body["access_token"] == nil || body["refresh_token"] == nil || body["id_token"] == nil {
+				t.Errorf("token response = %v", body)
+			}
+		})
+	}
+}
+
+func TestAuthorizationCodeReuse(t *testing.T) {
+	s := newServer(t)
+	c := s.registerClient(t, authserver.RegisterClientOptions{RedirectURIs: []string{redirectURI}, Scope: "openid", FirstParty: true})
+	code := s.code(t, c, nil)
+	tokens := s.exchange(t, c, code)
+
+	status, body := s.post(t, authserver.TokenPath, c, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	})
+	if status != http.StatusBadRequest || body["error"] != authserver.ErrorInvalidGrant {
+		t.Fatalf("reusing the code = %d %v", status, body)
+	}
+	// The grant issued for the code is revoked.
+	if s.adapter.Grants() != 0 {
+		t.Error("the grant of the reused code was not revoked")
+	}
+	if status, _ := s.refresh(t, c, tokens["refresh_token"].(string)); status != http.StatusBadRequest {
+		t.Errorf("refreshing the tokens of a reused code = %d", status)
+	}
+	if _, err := s.auth.ValidateAccessToken(tokens["access_token"].(string), true); err == nil {
+		t.Error("the access token of a reused code is valid")
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	s := newServer(t)
+	c := s.registerClient(t, authserver.RegisterClientOptions{RedirectURIs: []string{redirectURI}, Scope: "openid", FirstParty: true})
+	tokens := s.exchange(t, c, s.code(t, c, nil))
+
+	status, refreshed := s.refresh(t, c, tokens["refresh_token"].(string))
+	if status != http.StatusOK {
+		t.Fatalf("refresh = %d %v", status, refreshed)
+	}
+	if status, body := s.refresh(t, c, tokens["refresh_token"].(string)); status != http.StatusBadRequest || body["error"] != authserver.ErrorInvalidGrant {
+		t.Fatalf("reusing the refresh token = %d %v", status, body)
+	}
+	// Reuse revokes the grant, including the tokens of the last refresh.
+	if status, _ := s.refresh(t, c, refreshed["refresh_token"].(string)); status != http.StatusBadRequest {
+		t.Errorf("refreshing after a reuse = %d", status)
+	}
+	if _, err := s.auth.ValidateAccessToken(refreshed["access_token"].(string), true); err == nil {
+		t.Error("the access token of a revoked grant is valid")
+	}
+	if _, err := s.auth.ValidateAccessToken(refreshed["access_token"].(string), false); err != nil {
+		t.Errorf("the access token is not valid offline: %v", err)
+	}
+}
+
+func TestOtherClient(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		path string
+		// status and code are the response to the request of the other client, revoked reports whether the
+		// grant is revoked afterwards.
+		status  int
+		code    string
+		revoked bool
+	}{
+		{"refresh", authserver.TokenPath, http.StatusBadRequest, authserver.ErrorInvalidGrant, true},
+		{"revoke", authserver.RevocationPath, http.StatusBadRequest, authserver.ErrorUnauthorizedClient, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t)
+			c := s.registerClient(t, authserver.RegisterClientOptions{RedirectURIs: []string{redirectURI}, Scope: "openid", FirstParty: true})
+			other := s.registerClient(t, authserver.RegisterClientOptions{RedirectURIs: []string{redirectURI}, Scope: "openid"})
+			refreshToken := s.exchange(t, c, s.code(t, c, nil))["refresh_token"].(string)
+
+			status, body := s.post(t, tt.path, other, url.Values{
+				"grant_type":    {"refresh_token"},
+				"refresh_token": {refreshToken},
+				"token":         {refreshToken},
+			})
+			if status != tt.status || body["error"] != tt.code {
+				t.Fatalf("request of the other client = %d %v, want %d %q", status, body, tt.status, tt.code)
+			}
+			if revoked := s.adapter.Grants() == 0; revoked != tt.revoked {
+				t.Errorf("grant revoked = %t, want %t", revoked, tt.revoked)
+			}
+		})
+	}
+
+	t.Run("revoke own token", func(t *testing.T) {
+		s := newServer(t)
+		c := s.registerClient(t, authserver.RegisterClientOptions{RedirectURIs: []string{redirectURI}, Scope: "openid", FirstParty: true})
+		refreshToken := s.exchange(t, c, s.code(t, c, nil))["refresh_token"].(string)
+		if status, body := s.post(t, authserver.RevocationPath, c, url.Values{"token": {refreshToken}}); status != http.StatusOK {
+			t.Fatalf("revocation = %d %v", status, body)
+		}
+		if status, _ := s.refresh(t, c, refreshToken); status != http.StatusBadRequest {
+			t.Errorf("refreshing a revoked token = %d", status)
+		}
+	})
+}
+
+var consentTokenPattern = regexp.MustCompile(`name="consent_token" value="([^"]+)"`)
+
+// consentToken renders the consent screen of the request for the session and returns its consent token.
+func (s *server) consentToken(t *testing.T, params url.Values, session string) string {
+	t.Helper()
+	res := s.serve(httptest.NewRequest(http.MethodGet, issuer+authserver.AuthorizationPath+"?"+params.Encode(), nil), session)
+	defer res.Body.Close()
+	page, _ := io.ReadAll(res.Body)
+	match := consentTokenPattern.FindSubmatch(page)
+	if res.StatusCode != http.StatusOK || match == nil {
+		t.Fatalf("consent screen = %d %s", res.StatusCode, page)
+	}
+	return string(match[1])
+}
+
+func TestConsent(t *testing.T) {
+	s := newServer(t)
+	c := s.registerClient(t, authserver.RegisterClientOptions{RedirectURIs: []string{redirectURI}, Scope: "openid profile"})
+	params := url.Values{"client_id": {c.id}, "response_type": {"code"}, "scope": {"openid"}, "state": {"state"}}
+	token := s.consentToken(t, params, s.session)
+
+	otherSession, err := s.keezle.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(token, session string) *http.Response {
+		form := url.Values{"consent": {"allow"}, "consent_token": {token}}
+		for name, values := range params {
+			form[name] = values
+		}
+		req := httptest.NewRequest(http.MethodPost, issuer+authserver.AuthorizationPath, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return s.serve(req, session)
+	}
+
+	for _, tt := range []struct {
+		name, token, session string
+	}{
+		{"missing token", "", s.session},
+		{"forged token", "forged", s.session},
+		{"token of another session", s.consentToken(t, params, otherSession.ID), s.session},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := post(tt.token, tt.session); res.StatusCode != http.StatusForbidden {
+				t.Errorf("consent = %d, want %d", res.StatusCode, http.StatusForbidden)
+			}
+		})
+	}
+	params.Set("prompt", "none")
+	if location := s.authorize(t, params); location.Query().Get("error") != authserver.ErrorConsentRequired {
+		t.Errorf("prompt=none before consent redirected to %s", location)
+	}
+	params.Del("prompt")
+
+	res := post(token, s.session)
+	location, _ := url.Parse(res.Header.Get("Location"))
+	if res.StatusCode != http.StatusSeeOther || location.Query().Get("code") == "" || location.Query().Get("state") != "state" {
+		t.Fatalf("consent = %d, redirected to %s", res.StatusCode, location)
+	}
+	// The consent is remembered for the scopes.
+	if location := s.authorize(t, params); location.Query().Get("code") == "" {
+		t.Errorf("authorization after consent redirected to %s", location)
+	}
+	params.Set("scope", "openid profile")
+	params.Set("prompt", "none")
+	if location := s.authorize(t, params); location.Query().Get("error") != authserver.ErrorConsentRequired {
+		t.Errorf("authorization of more scopes redirected to %s", location)
+	}
+}
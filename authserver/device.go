@@ -0,0 +1,376 @@
+package authserver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/adapters"
+	"github.com/gaurishhs/keezle/utils"
+)
+
+// DeviceCodeGrantType is the grant type of the device authorization grant.
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Error codes of the device authorization grant.
+const (
+	ErrorAuthorizationPending = "authorization_pending"
+	ErrorSlowDown             = "slow_down"
+	ErrorExpiredToken         = "expired_token"
+	// ErrorInvalidUserCode is shown on the verification page for unknown, expired or used user codes.
+	ErrorInvalidUserCode = "invalid_user_code"
+)
+
+// userCodeAlphabet are the characters of user codes. It has no vowels, so that codes never spell words, and
+// no characters which are easily confused.
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// userCodeLength is the length of user codes, giving 20^8 possible codes.
+const userCodeLength = 8
+
+// generateUserCode returns a random user code.
+func generateUserCode() (string, error) {
+	code := make([]byte, 0, userCodeLength)
+	buf := make([]byte, userCodeLength*2)
+	for len(code) < userCodeLength {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			// Rejecting the bytes above the largest multiple of the alphabet size keeps the codes uniform.
+			if int(b) < 256-256%len(userCodeAlphabet) && len(code) < userCodeLength {
+				code = append(code, userCodeAlphabet[int(b)%len(userCodeAlphabet)])
+			}
+		}
+	}
+	return string(code), nil
+}
+
+// normalizeUserCode uppercases a user code entered by the user and strips the separator and whitespace.
+func normalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return -1
+	}, strings.ToUpper(userCode))
+}
+
+// formatUserCode formats a normalized user code for display, e.g. "BCDF-GHJK".
+func formatUserCode(userCode string) string {
+	if len(userCode) != userCodeLength {
+		return userCode
+	}
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
+
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// DeviceAuthorization serves the device authorization endpoint of RFC 8628, which devices without a browser,
+// e.g. CLI tools, call to start a login. The device shows the user code and the verification URI to the user
+// and polls the token endpoint until the user approved or denied the login on the verification page.
+func (s *Server[UA, SA]) DeviceAuthorization(w http.ResponseWriter, req *http.Request) {
+	if !allowMethods(w, req, http.MethodPost) {
+		return
+	}
+	if s.devices == nil {
+		fail(w, http.StatusBadRequest, ErrorUnauthorizedClient, "the device authorization grant is not supported")
+		return
+	}
+	req.Body = http.MaxBytesReader(w, req.Body, maxBodySize)
+	if err := req.ParseForm(); err != nil {
+		fail(w, http.StatusBadRequest, ErrorInvalidRequest, "")
+		return
+	}
+
+	client, err := s.authenticateClient(req)
+	if err != nil {
+		s.failToken(w, req, err)
+		return
+	}
+	scope := strings.Join(scopes(req.PostForm.Get("scope")), " ")
+	if scope == "" {
+		scope = client.Scope
+	}
+	if !containsScopes(client.Scope, scope) {
+		fail(w, http.StatusBadRequest, ErrorInvalidScope, "")
+		return
+	}
+
+	deviceCode, err := utils.GenerateRandomString(32)
+	if err != nil {
+		s.failInternal(w, req, err)
+		return
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		s.failInternal(w, req, err)
+		return
+	}
+	err = s.devices.CreateDeviceCode(&adapters.DeviceCode{
+		Hash:      hashToken(deviceCode),
+		UserCode:  userCode,
+		ClientID:  client.ID,
+		Scope:     scope,
+		Status:    adapters.DeviceCodePending,
+		ExpiresAt: s.now().Add(s.Config.DeviceCodeLifetime),
+	})
+	if err != nil {
+		s.failInternal(w, req, err)
+		return
+	}
+
+	verificationURI := s.endpoint(DeviceVerificationPath)
+	writeJSON(w, http.StatusOK, deviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                formatUserCode(userCode),
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?" + url.Values{"user_code": {formatUserCode(userCode)}}.Encode(),
+		ExpiresIn:               int64(s.Config.DeviceCodeLifetime.Seconds()),
+		Interval:                int64(s.Config.DevicePollInterval.Seconds()),
+	})
+}
+
+// DeviceVerification describes the state of the verification page.
+type DeviceVerification struct {
+	// UserCode is the formatted user code, it is empty until the user entered a code.
+	UserCode string
+	// Client and Scopes describe the login the user is asked to approve, once a valid code was entered.
+	Client *adapters.OAuthClient
+	Scopes []string
+	// Error is ErrorInvalidUserCode if the entered code is not valid.
+	Error string
+	// Result is adapters.DeviceCodeApproved or adapters.DeviceCodeDenied once the user decided.
+	Result string
+	// Action is the URL the verification form posts to.
+	Action string
+	// Params are the hidden fields of the form approving the login. The form must post them back together with
+	// a "consent" field of "allow" or "deny".
+	Params url.Values
+}
+
+// VerifyDevice serves the verification page, where the signed in user enters the user code shown by the
+// device and approves or denies its login. The login is bound to the user's session: the device receives
+// tokens for the user who approved it. Codes in the "user_code" query parameter are filled in, but the user
+// always has to confirm the login, so that a link can not log a device in on behalf of the user.
+// As user codes are short, the endpoint should be rate limited.
+func (s *Server[UA, SA]) VerifyDevice(w http.ResponseWriter, req *http.Request) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodPost) {
+		return
+	}
+	if s.devices == nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	authReq, err := s.Keezle.HandleRequest(req)
+	if err != nil {
+		if errors.Is(err, keezle.ErrInvalidRequestOrigin) {
+			http.Error(w, "invalid request origin", http.StatusForbidden)
+			return
+		}
+		s.failInternal(w, req, err)
+		return
+	}
+	authReq.WriteCookie = func(cookie *http.Cookie) { http.SetCookie(w, cookie) }
+
+	req.Body = http.MaxBytesReader(w, req.Body, maxBodySize)
+	if err := req.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	userCode := normalizeUserCode(req.Form.Get("user_code"))
+
+	session, err := authReq.Validate()
+	if err != nil {
+		s.failInternal(w, req, err)
+		return
+	}
+	if session == nil {
+		returnTo := s.endpoint(DeviceVerificationPath)
+		if userCode != "" {
+			returnTo += "?" + url.Values{"user_code": {formatUserCode(userCode)}}.Encode()
+		}
+		s.loginRedirect(w, req, returnTo)
+		return
+	}
+
+	verification := &DeviceVerification{Action: s.endpoint(DeviceVerificationPath)}
+	if userCode == "" {
+		s.renderDeviceVerification(w, req, verification)
+		return
+	}
+	verification.UserCode = formatUserCode(userCode)
+
+	code, err := s.devices.GetDeviceCodeByUserCode(userCode)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.failInternal(w, req, err)
+		return
+	}
+	if err != nil || code.Status != adapters.DeviceCodePending || !code.ExpiresAt.After(s.now()) {
+		verification.Error = ErrorInvalidUserCode
+		s.renderDeviceVerification(w, req, verification)
+		return
+	}
+	if verification.Client, err = s.GetClient(code.ClientID); err != nil {
+		if errors.Is(err, ErrClientNotFound) {
+			verification.Error = ErrorInvalidUserCode
+			s.renderDeviceVerification(w, req, verification)
+			return
+		}
+		s.failInternal(w, req, err)
+		return
+	}
+	verification.Scopes = scopes(code.Scope)
+
+	token := deviceToken(session.ID, code.Hash)
+	if req.Method == http.MethodPost && req.PostForm.Has(consentField) {
+		// As for the consent screen, the token proves that the form was rendered for this session.
+		if !hmac.Equal([]byte(req.PostForm.Get(consentTokenField)), []byte(token)) {
+			http.Error(w, "invalid consent", http.StatusForbidden)
+			return
+		}
+		status := adapters.DeviceCodeDenied
+		if req.PostForm.Get(consentField) == consentAllow {
+			status = adapters.DeviceCodeApproved
+		}
+		if err := s.devices.CompleteDeviceCode(code.Hash, status, session.User.ID, session.AuthenticatedAt); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				verification.Error = ErrorInvalidUserCode
+				s.renderDeviceVerification(w, req, verification)
+				return
+			}
+			s.failInternal(w, req, err)
+			return
+		}
+		verification.Result = status
+		s.renderDeviceVerification(w, req, verification)
+		return
+	}
+
+	verification.Params = url.Values{"user_code": {verification.UserCode}, consentTokenField: {token}}
+	s.renderDeviceVerification(w, req, verification)
+}
+
+// deviceToken returns the token binding the verification form to the session and the device code.
+func deviceToken(sessionId, deviceCodeHash string) string {
+	mac := hmac.New(sha256.New, []byte(sessionId))
+	mac.Write([]byte("device\x00" + deviceCodeHash))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Server[UA, SA]) renderDeviceVerification(w http.ResponseWriter, req *http.Request, verification *DeviceVerification) {
+	// The verification page must not be framed, so that it can not be clickjacked.
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	s.Config.RenderDeviceVerification(w, req, verification)
+}
+
+// exchangeDeviceCode exchanges the device code of an approved login for tokens, creating a grant.
+func (s *Server[UA, SA]) exchangeDeviceCode(client *adapters.OAuthClient, form url.Values) (*tokenResponse, error) {
+	if s.devices == nil {
+		return nil, &tokenError{status: http.StatusBadRequest, code: ErrorUnsupportedGrantType}
+	}
+	now := s.now()
+	code, err := s.devices.PollDeviceCode(hashToken(form.Get("device_code")), now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errInvalidGrant
+		}
+		return nil, err
+	}
+	switch {
+	case code.ClientID != client.ID:
+		return nil, errInvalidGrant
+	case !code.ExpiresAt.After(now):
+		return nil, &tokenError{status: http.StatusBadRequest, code: ErrorExpiredToken}
+	case code.LastPolledAt != nil && now.Sub(*code.LastPolledAt) < s.Config.DevicePollInterval:
+		return nil, &tokenError{status: http.StatusBadRequest, code: ErrorSlowDown}
+	case code.Status == adapters.DeviceCodePending:
+		return nil, &tokenError{status: http.StatusBadRequest, code: ErrorAuthorizationPending}
+	case code.Status != adapters.DeviceCodeApproved:
+		return nil, &tokenError{status: http.StatusBadRequest, code: ErrorAccessDenied}
+	}
+
+	// Only one of concurrent polls gets to use the code.
+	if _, err := s.devices.UseDeviceCode(code.Hash); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errInvalidGrant
+		}
+		return nil, err
+	}
+
+	user, err := s.Keezle.GetUser(code.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errInvalidGrant
+		}
+		return nil, err
+	}
+	grantId, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return nil, err
+	}
+	grant := &adapters.OAuthGrant{
+		ID:        grantId,
+		ClientID:  client.ID,
+		UserID:    code.UserID,
+		Scope:     code.Scope,
+		CreatedAt: now,
+	}
+	if code.AuthTime != nil {
+		grant.AuthTime = *code.AuthTime
+	}
+	if err := s.grants.CreateOAuthGrant(grant); err != nil {
+		return nil, err
+	}
+	return s.issue(grant, user, grant.Scope, "")
+}
+
+var deviceTemplate = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Device login</title></head>
+<body>
+{{if eq .Result "approved"}}<p>Your device has been logged in. You can return to it now.</p>
+{{else if eq .Result "denied"}}<p>The login of your device has been denied.</p>
+{{else if .Client}}<form method="post" action="{{.Action}}">
+<p>{{.Client.Name}} wants to log in to your account with the code {{.UserCode}} and access:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+<p>Only continue if the code matches the code shown on your device.</p>
+{{range $name, $values := .Params}}{{range $values}}<input type="hidden" name="{{$name}}" value="{{.}}">
+{{end}}{{end}}<button type="submit" name="consent" value="deny">Deny</button>
+<button type="submit" name="consent" value="allow">Allow</button>
+</form>
+{{else}}<form method="get" action="{{.Action}}">
+{{if .Error}}<p>The code is invalid or has expired.</p>
+{{end}}<label>Enter the code shown on your device: <input name="user_code" value="{{.UserCode}}" autocomplete="off" autofocus></label>
+<button type="submit">Continue</button>
+</form>
+{{end}}</body>
+</html>
+`))
+
+// renderDevice renders the default verification page.
+func renderDevice(w http.ResponseWriter, req *http.Request, verification *DeviceVerification) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if verification.Error != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	deviceTemplate.Execute(w, verification)
+}
@@ -0,0 +1,123 @@
+package authserver_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle/authserver"
+)
+
+// startDevice starts a device login of the client and returns its device code and user code.
+func (s *server) startDevice(t *testing.T, c client) (string, string) {
+	t.Helper()
+	status, body := s.post(t, authserver.DeviceAuthorizationPath, c, url.Values{"scope": {"openid"}})
+	if status != http.StatusOK {
+		t.Fatalf("device authorization = %d %v", status, body)
+	}
+	return body["device_code"].(string), body["user_code"].(string)
+}
+
+// verifyDevice approves or denies the login of the user code on the verification page.
+func (s *server) verifyDevice(t *testing.T, userCode, consent string) {
+	t.Helper()
+	res := s.serve(httptest.NewRequest(http.MethodGet, issuer+authserver.DeviceVerificationPath+"?"+url.Values{"user_code": {userCode}}.Encode(), nil), s.session)
+	page, _ := io.ReadAll(res.Body)
+	match := consentTokenPattern.FindSubmatch(page)
+	if res.StatusCode != http.StatusOK || match == nil {
+		t.Fatalf("verification page = %d %s", res.StatusCode, page)
+	}
+
+	form := url.Values{"user_code": {userCode}, "consent": {consent}, "consent_token": {string(match[1])}}
+	req := httptest.NewRequest(http.MethodPost, issuer+authserver.DeviceVerificationPath, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if res := s.serve(req, s.session); res.StatusCode != http.StatusOK {
+		t.Fatalf("verification = %d", res.StatusCode)
+	}
+}
+
+func (s *server) poll(t *testing.T, c client, deviceCode string) (int, map[string]any) {
+	t.Helper()
+	return s.post(t, authserver.TokenPath, c, url.Values{"grant_type": {authserver.DeviceCodeGrantType}, "device_code": {deviceCode}})
+}
+
+func TestDevicePoll(t *testing.T) {
+	s := newServer(t)
+	c := s.registerClient(t, authserver.RegisterClientOptions{Scope: "openid", Public: true})
+	deviceCode, userCode := s.startDevice(t, c)
+
+	// Each step polls after the elapsed time, approving or denying the login first if consent is set.
+	steps := []struct {
+		name    string
+		elapsed time.Duration
+		consent string
+		status  int
+		code    string
+	}{
+		{"first poll", 0, "", http.StatusBadRequest, authserver.ErrorAuthorizationPending},
+		{"poll within the interval", 4 * time.Second, "", http.StatusBadRequest, authserver.ErrorSlowDown},
+		// The poll within the interval counts as a poll.
+		{"poll after the previous interval", 4 * time.Second, "", http.StatusBadRequest, authserver.ErrorSlowDown},
+		{"poll after the interval", 5 * time.Second, "", http.StatusBadRequest, authserver.ErrorAuthorizationPending},
+		{"approved within the interval", time.Second, "allow", http.StatusBadRequest, authserver.ErrorSlowDown},
+		{"approved", 5 * time.Second, "", http.StatusOK, ""},
+		{"used", 5 * time.Second, "", http.StatusBadRequest, authserver.ErrorInvalidGrant},
+	}
+	for _, step := range steps {
+		s.clock.Advance(step.elapsed)
+		if step.consent != "" {
+			s.verifyDevice(t, userCode, step.consent)
+		}
+		status, body := s.poll(t, c, deviceCode)
+		if status != step.status || (step.code != "" && body["error"] != step.code) {
+			t.Fatalf("%s: poll = %d %v, want %d %q", step.name, status, body, step.status, step.code)
+		}
+		if status == http.StatusOK {
+			claims, err := s.auth.ValidateAccessToken(body["access_token"].(string), true)
+			if err != nil || claims.Subject != "u1" || claims.ClientID != c.id {
+				t.Errorf("%s: access token claims %+v, %v", step.name, claims, err)
+			}
+		}
+	}
+}
+
+func TestDevicePollFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		consent     string
+		elapsed     time.Duration
+		otherClient bool
+		code        string
+	}{
+		{name: "denied", consent: "deny", code: authserver.ErrorAccessDenied},
+		{name: "expired", elapsed: 10 * time.Minute, code: authserver.ErrorExpiredToken},
+		{name: "other client", consent: "allow", otherClient: true, code: authserver.ErrorInvalidGrant},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t)
+			c := s.registerClient(t, authserver.RegisterClientOptions{Scope: "openid", Public: true})
+			other := s.registerClient(t, authserver.RegisterClientOptions{Scope: "openid", Public: true})
+			deviceCode, userCode := s.startDevice(t, c)
+			if tt.consent != "" {
+				s.verifyDevice(t, userCode, tt.consent)
+			}
+			s.clock.Advance(tt.elapsed)
+
+			polling := c
+			if tt.otherClient {
+				polling = other
+			}
+			if status, body := s.poll(t, polling, deviceCode); status != http.StatusBadRequest || body["error"] != tt.code {
+				t.Errorf("poll = %d %v, want %q", status, body, tt.code)
+			}
+			if s.adapter.Grants() != 0 {
+				t.Error("a grant was created")
+			}
+		})
+	}
+}
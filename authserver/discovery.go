@@ -0,0 +1,125 @@
+package authserver
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gaurishhs/keezle"
+)
+
+// UserInfo serves the userinfo endpoint of OpenID Connect, returning the claims about the user of an access
+// token issued for the "openid" scope.
+func (s *Server[UA, SA]) UserInfo(w http.ResponseWriter, req *http.Request) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodPost) {
+		return
+	}
+
+	accessToken, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || accessToken == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+s.Config.Issuer+`"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	claims, err := s.ValidateAccessToken(accessToken, true)
+	if err != nil {
+		if errors.Is(err, keezle.ErrInvalidAccessToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+s.Config.Issuer+`", error="`+ErrorInvalidToken+`"`)
+			fail(w, http.StatusUnauthorized, ErrorInvalidToken, "")
+			return
+		}
+		s.failInternal(w, req, err)
+		return
+	}
+	if !claims.HasScope(ScopeOpenID) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+s.Config.Issuer+`", error="`+ErrorInsufficientScope+`"`)
+		fail(w, http.StatusForbidden, ErrorInsufficientScope, "")
+		return
+	}
+
+	user, err := s.Keezle.GetUser(claims.Subject)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			fail(w, http.StatusUnauthorized, ErrorInvalidToken, "")
+			return
+		}
+		s.failInternal(w, req, err)
+		return
+	}
+	userClaims, err := s.userClaims(user, claims.Scope)
+	if err != nil {
+		s.failInternal(w, req, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, userClaims)
+}
+
+// JWKS serves the public keys of the key set, which clients verify ID tokens and APIs verify access tokens with.
+func (s *Server[UA, SA]) JWKS(w http.ResponseWriter, req *http.Request) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodHead) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(s.Config.Keys.JWKSet())
+}
+
+// DiscoveryDocument is the metadata of the server, served as the OpenID Connect discovery document and the
+// authorization server metadata of RFC 8414.
+type DiscoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint,omitempty"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	PromptValuesSupported             []string `json:"prompt_values_supported"`
+	// AuthorizationResponseIssParameterSupported announces the "iss" parameter of RFC 9207.
+	AuthorizationResponseIssParameterSupported bool `json:"authorization_response_iss_parameter_supported"`
+}
+
+// DiscoveryDocument returns the discovery document of the server.
+func (s *Server[UA, SA]) DiscoveryDocument() *DiscoveryDocument {
+	document := &DiscoveryDocument{
+		Issuer:                                     s.Config.Issuer,
+		AuthorizationEndpoint:                      s.endpoint(AuthorizationPath),
+		TokenEndpoint:                              s.endpoint(TokenPath),
+		UserInfoEndpoint:                           s.endpoint(UserInfoPath),
+		RevocationEndpoint:                         s.endpoint(RevocationPath),
+		JWKSURI:                                    s.endpoint(JWKSPath),
+		ScopesSupported:                            s.Config.ScopesSupported,
+		ResponseTypesSupported:                     []string{"code"},
+		GrantTypesSupported:                        []string{"authorization_code", "refresh_token"},
+		SubjectTypesSupported:                      []string{"public"},
+		IDTokenSigningAlgValuesSupported:           []string{s.Config.Keys.SigningKey().Algorithm},
+		TokenEndpointAuthMethodsSupported:          []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:              []string{"S256"},
+		PromptValuesSupported:                      []string{"none", "consent"},
+		AuthorizationResponseIssParameterSupported: true,
+	}
+	if s.devices != nil {
+		document.DeviceAuthorizationEndpoint = s.endpoint(DeviceAuthorizationPath)
+		document.GrantTypesSupported = append(document.GrantTypesSupported, DeviceCodeGrantType)
+	}
+	return document
+}
+
+// Discovery serves the discovery document.
+func (s *Server[UA, SA]) Discovery(w http.ResponseWriter, req *http.Request) {
+	if !allowMethods(w, req, http.MethodGet, http.MethodHead) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(s.DiscoveryDocument())
+}
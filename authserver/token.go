@@ -0,0 +1,445 @@
+package authserver
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/adapters"
+	"github.com/gaurishhs/keezle/jwt"
+	"github.com/gaurishhs/keezle/models"
+	"github.com/gaurishhs/keezle/utils"
+)
+
+// AccessTokenClaims are the claims of an access token, following the JWT profile of RFC 9068.
+type AccessTokenClaims struct {
+	jwt.RegisteredClaims
+	ClientID string `json:"client_id"`
+	Scope    string `json:"scope,omitempty"`
+	// GrantID is the id of the grant the token was issued for.
+	GrantID string `json:"gid"`
+}
+
+// Scopes returns the scopes of the token.
+func (c *AccessTokenClaims) Scopes() []string {
+	return scopes(c.Scope)
+}
+
+// HasScope reports whether the token was issued for the scope.
+func (c *AccessTokenClaims) HasScope(scope string) bool {
+	return containsScopes(c.Scope, scope)
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// tokenError is an error of the token endpoint.
+type tokenError struct {
+	status      int
+	code        string
+	description string
+}
+
+func (e *tokenError) Error() string {
+	return e.code
+}
+
+var (
+	errInvalidClient = &tokenError{status: http.StatusUnauthorized, code: ErrorInvalidClient}
+	errInvalidGrant  = &tokenError{status: http.StatusBadRequest, code: ErrorInvalidGrant}
+)
+
+// Token serves the token endpoint, exchanging authorization codes, refresh tokens and the device codes of
+// approved device logins for tokens.
+// Confidential clients authenticate with HTTP Basic authentication or the client_secret form field.
+// Refresh tokens are single-use, reusing a refresh token revokes its grant as it indicates that the token has
+// been stolen.
+func (s *Server[UA, SA]) Token(w http.ResponseWriter, req *http.Request) {
+	if !allowMethods(w, req, http.MethodPost) {
+		return
+	}
+	req.Body = http.MaxBytesReader(w, req.Body, maxBodySize)
+	if err := req.ParseForm(); err != nil {
+		fail(w, http.StatusBadRequest, ErrorInvalidRequest, "")
+		return
+	}
+
+	client, err := s.authenticateClient(req)
+	if err == nil {
+		var res *tokenResponse
+		switch req.PostForm.Get("grant_type") {
+		case "authorization_code":
+			res, err = s.exchangeCode(client, req.PostForm)
+		case "refresh_token":
+			res, err = s.refresh(client, req.PostForm)
+		case DeviceCodeGrantType:
+			res, err = s.exchangeDeviceCode(client, req.PostForm)
+		default:
+			err = &tokenError{status: http.StatusBadRequest, code: ErrorUnsupportedGrantType}
+		}
+		if err == nil {
+			writeJSON(w, http.StatusOK, res)
+			return
+		}
+	}
+	s.failToken(w, req, err)
+}
+
+// failToken responds with the error of a token request, logging other errors as internal errors.
+func (s *Server[UA, SA]) failToken(w http.ResponseWriter, req *http.Request, err error) {
+	var tokenErr *tokenError
+	if !errors.As(err, &tokenErr) {
+		s.failInternal(w, req, err)
+		return
+	}
+	if tokenErr.status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+s.Config.Issuer+`"`)
+	}
+	fail(w, tokenErr.status, tokenErr.code, tokenErr.description)
+}
+
+// authenticateClient returns the client of the request, verifying the secret of confidential clients.
+func (s *Server[UA, SA]) authenticateClient(req *http.Request) (*adapters.OAuthClient, error) {
+	clientId, secret, basic := req.BasicAuth()
+	if basic {
+		// Credentials of the basic scheme are form encoded, see RFC 6749 section 2.3.1.
+		var err error
+		if clientId, err = url.QueryUnescape(clientId); err != nil {
+			return nil, errInvalidClient
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return nil, errInvalidClient
+		}
+	} else {
+		clientId, secret = req.PostForm.Get("client_id"), req.PostForm.Get("client_secret")
+	}
+	if clientId == "" {
+		return nil, errInvalidClient
+	}
+
+	client, err := s.GetClient(clientId)
+	if err != nil {
+		if errors.Is(err, ErrClientNotFound) {
+			return nil, errInvalidClient
+		}
+		return nil, err
+	}
+	if client.SecretHash == "" {
+		if secret != "" {
+			return nil, errInvalidClient
+		}
+		return client, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, errInvalidClient
+	}
+	return client, nil
+}
+
+// exchangeCode exchanges an authorization code for tokens, creating a grant. Reusing a code revokes the grant
+// created by its first exchange, as the code has been intercepted, see RFC 6749 section 4.1.2.
+func (s *Server[UA, SA]) exchangeCode(client *adapters.OAuthClient, form url.Values) (*tokenResponse, error) {
+	grantId, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	code, err := s.grants.UseAuthorizationCode(hashToken(form.Get("code")), grantId, now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errInvalidGrant
+		}
+		return nil, err
+	}
+	if code.UsedAt != nil {
+		s.Keezle.Config.Logger.Log("debug: authserver: authorization code was reused, revoking its grant")
+		if err := s.revokeGrant(code.GrantID); err != nil {
+			return nil, err
+		}
+		return nil, errInvalidGrant
+	}
+	if code.ClientID != client.ID || !code.ExpiresAt.After(now) {
+		return nil, errInvalidGrant
+	}
+	// The redirect URI must be repeated only if the authorization request included it, see RFC 6749 section
+	// 4.1.3.
+	if code.RedirectURIProvided && code.RedirectURI != form.Get("redirect_uri") {
+		return nil, errInvalidGrant
+	}
+
+	verifier := form.Get("code_verifier")
+	if code.CodeChallenge == "" {
+		// A verifier without a challenge indicates that the challenge was stripped from the request.
+		if verifier != "" {
+			return nil, errInvalidGrant
+		}
+	} else {
+		sum := sha256.Sum256([]byte(verifier))
+		challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+		if verifier == "" || subtle.ConstantTimeCompare([]byte(challenge), []byte(code.CodeChallenge)) != 1 {
+			return nil, errInvalidGrant
+		}
+	}
+
+	user, err := s.Keezle.GetUser(code.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errInvalidGrant
+		}
+		return nil, err
+	}
+
+	grant := &adapters.OAuthGrant{
+		ID:        grantId,
+		ClientID:  client.ID,
+		UserID:    code.UserID,
+		Scope:     code.Scope,
+		AuthTime:  code.AuthTime,
+		CreatedAt: now,
+	}
+	if err := s.grants.CreateOAuthGrant(grant); err != nil {
+		return nil, err
+	}
+	return s.issue(grant, user, grant.Scope, code.Nonce)
+}
+
+// refresh exchanges a refresh token for new tokens of the same grant. The client may request a subset of the
+// scopes of the grant.
+func (s *Server[UA, SA]) refresh(client *adapters.OAuthClient, form url.Values) (*tokenResponse, error) {
+	now := s.now()
+	token, err := s.refreshTokens.UseRefreshToken(hashToken(form.Get("refresh_token")), now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errInvalidGrant
+		}
+		return nil, err
+	}
+	if token.UsedAt != nil {
+		s.Keezle.Config.Logger.Log("debug: authserver: refresh token of a grant was reused, revoking the grant")
+		if err := s.revokeGrant(token.Family); err != nil {
+			return nil, err
+		}
+		return nil, errInvalidGrant
+	}
+	if !token.ExpiresAt.After(now) {
+		return nil, errInvalidGrant
+	}
+
+	grant, err := s.grants.GetOAuthGrant(token.Family)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errInvalidGrant
+		}
+		return nil, err
+	}
+	if grant.ClientID != client.ID {
+		// The token has leaked to another client.
+		if err := s.revokeGrant(grant.ID); err != nil {
+			return nil, err
+		}
+		return nil, errInvalidGrant
+	}
+
+	scope := grant.Scope
+	if requested := form.Get("scope"); requested != "" {
+		if !containsScopes(grant.Scope, requested) {
+			return nil, &tokenError{status: http.StatusBadRequest, code: ErrorInvalidScope}
+		}
+		scope = strings.Join(scopes(requested), " ")
+	}
+
+	user, err := s.Keezle.GetUser(grant.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errInvalidGrant
+		}
+		return nil, err
+	}
+	return s.issue(grant, user, scope, "")
+}
+
+// issue issues an access token and a refresh token for the grant, and an ID token for the "openid" scope.
+func (s *Server[UA, SA]) issue(grant *adapters.OAuthGrant, user *models.User[UA], scope, nonce string) (*tokenResponse, error) {
+	now := s.now()
+	expiresAt := now.Add(s.Config.AccessTokenLifetime)
+
+	tokenId, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return nil, err
+	}
+	claims := AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenId,
+			Issuer:    s.Config.Issuer,
+			Subject:   grant.UserID,
+			ExpiresAt: expiresAt.Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		ClientID: grant.ClientID,
+		Scope:    scope,
+		GrantID:  grant.ID,
+	}
+	if s.Config.Audience != "" {
+		claims.Audience = []string{s.Config.Audience}
+	}
+	res := &tokenResponse{
+		TokenType: "Bearer",
+		ExpiresIn: int64(s.Config.AccessTokenLifetime.Seconds()),
+		Scope:     scope,
+	}
+	if res.AccessToken, err = s.Config.Keys.Sign(claims); err != nil {
+		return nil, err
+	}
+
+	if res.RefreshToken, err = utils.GenerateRandomString(32); err != nil {
+		return nil, err
+	}
+	err = s.refreshTokens.CreateRefreshToken(&adapters.RefreshToken{
+		Hash:      hashToken(res.RefreshToken),
+		Family:    grant.ID,
+		UserID:    grant.UserID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.Config.RefreshTokenLifetime),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if containsScopes(scope, ScopeOpenID) {
+		if res.IDToken, err = s.idToken(grant, user, scope, nonce); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// idToken issues an ID token for the grant.
+func (s *Server[UA, SA]) idToken(grant *adapters.OAuthGrant, user *models.User[UA], scope, nonce string) (string, error) {
+	claims, err := s.userClaims(user, scope)
+	if err != nil {
+		return "", err
+	}
+	now := s.now()
+	claims["iss"] = s.Config.Issuer
+	claims["aud"] = grant.ClientID
+	claims["azp"] = grant.ClientID
+	claims["exp"] = now.Add(s.Config.AccessTokenLifetime).Unix()
+	claims["iat"] = now.Unix()
+	claims["auth_time"] = grant.AuthTime.Unix()
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	return s.Config.Keys.Sign(claims)
+}
+
+// userClaims returns the claims about the user for the scopes.
+func (s *Server[UA, SA]) userClaims(user *models.User[UA], scope string) (map[string]any, error) {
+	claims := map[string]any{}
+	if s.Config.UserClaims != nil {
+		userClaims, err := s.Config.UserClaims(user, scopes(scope))
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range userClaims {
+			claims[name] = value
+		}
+	}
+	claims["sub"] = user.ID
+	return claims, nil
+}
+
+// revokeGrant deletes the grant and its refresh tokens.
+func (s *Server[UA, SA]) revokeGrant(grantId string) error {
+	if err := s.refreshTokens.DeleteRefreshTokenFamily(grantId); err != nil {
+		return err
+	}
+	return s.grants.DeleteOAuthGrant(grantId)
+}
+
+// Revoke serves the token revocation endpoint of RFC 7009. Revoking a refresh token revokes its grant.
+// Access tokens can not be revoked and expire on their own, unless the API checks their grant with
+// ValidateAccessToken. As required by the RFC, unknown tokens are not reported and clients can only revoke the
+// tokens issued to them.
+func (s *Server[UA, SA]) Revoke(w http.ResponseWriter, req *http.Request) {
+	if !allowMethods(w, req, http.MethodPost) {
+		return
+	}
+	req.Body = http.MaxBytesReader(w, req.Body, maxBodySize)
+	if err := req.ParseForm(); err != nil {
+		fail(w, http.StatusBadRequest, ErrorInvalidRequest, "")
+		return
+	}
+
+	client, err := s.authenticateClient(req)
+	if err != nil {
+		s.failToken(w, req, err)
+		return
+	}
+
+	// The token is not used, so that a refused request does not make the next refresh look like a reuse.
+	token, err := s.refreshTokens.GetRefreshToken(hashToken(req.PostForm.Get("token")))
+	var grant *adapters.OAuthGrant
+	if err == nil {
+		grant, err = s.grants.GetOAuthGrant(token.Family)
+	}
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			s.failInternal(w, req, err)
+			return
+		}
+		// Unknown tokens and tokens of revoked grants are not reported.
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	// Clients may only revoke their own tokens, see RFC 7009 section 2.1.
+	if grant.ClientID != client.ID {
+		fail(w, http.StatusBadRequest, ErrorUnauthorizedClient, "the token was not issued to the client")
+		return
+	}
+	if err := s.revokeGrant(grant.ID); err != nil {
+		s.failInternal(w, req, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ValidateAccessToken verifies an access token issued by the server and returns its claims, e.g. in the
+// middleware of an API. The token is verified offline, unless checkGrant is set, in which case its grant must
+// not have been revoked. It returns keezle.ErrInvalidAccessToken if the token is invalid.
+func (s *Server[UA, SA]) ValidateAccessToken(accessToken string, checkGrant bool) (*AccessTokenClaims, error) {
+	var claims AccessTokenClaims
+	if err := s.Config.Keys.Parse(accessToken, &claims); err != nil {
+		return nil, keezle.ErrInvalidAccessToken
+	}
+	if claims.Issuer != s.Config.Issuer || claims.GrantID == "" || claims.ClientID == "" {
+		return nil, keezle.ErrInvalidAccessToken
+	}
+	if s.Config.Audience != "" && !claims.HasAudience(s.Config.Audience) {
+		return nil, keezle.ErrInvalidAccessToken
+	}
+	if err := claims.Validate(s.now(), 0); err != nil {
+		return nil, keezle.ErrInvalidAccessToken
+	}
+
+	if checkGrant {
+		if _, err := s.grants.GetOAuthGrant(claims.GrantID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, keezle.ErrInvalidAccessToken
+			}
+			return nil, err
+		}
+	}
+	return &claims, nil
+}
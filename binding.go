@@ -0,0 +1,119 @@
+package keezle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+
+	"github.com/gaurishhs/keezle/models"
+)
+
+// BindingPolicy defines what happens when a session is used by a client which does not match its binding.
+type BindingPolicy int
+
+const (
+	// BindingReject rejects the request, the session stays valid for the client it is bound to.
+	BindingReject BindingPolicy = iota
+	// BindingRequireReauth rejects the request and deletes the session, so that the user has to log in again.
+	BindingRequireReauth
+	// BindingReport accepts the request and only reports the mismatch to Config.OnBindingMismatch.
+	BindingReport
+)
+
+// BindingConfig defines which client characteristics new sessions are bound to.
+// Sessions created before binding was enabled are not checked.
+type BindingConfig struct {
+	// IPv4PrefixLength binds sessions of IPv4 clients to the network prefix of this length, e.g. 24.
+	// Zero disables IPv4 binding.
+	IPv4PrefixLength int
+	// IPv6PrefixLength binds sessions of IPv6 clients to the network prefix of this length, e.g. 64.
+	// Zero disables IPv6 binding.
+	IPv6PrefixLength int
+	// UserAgent binds sessions to the user agent of the client.
+	UserAgent bool
+	// ClientCertificate binds sessions to the TLS client certificate of the client.
+	ClientCertificate bool
+	// Key binds sessions to the key the client proves possession of, see ClientInfo.KeyThumbprint.
+	Key    bool
+	Policy BindingPolicy
+}
+
+// BindingMismatch reports which bound characteristics did not match the client.
+type BindingMismatch struct {
+	IPAddress         bool
+	UserAgent         bool
+	ClientCertificate bool
+	Key               bool
+}
+
+// Any reports whether any characteristic did not match.
+func (m BindingMismatch) Any() bool {
+	return m.IPAddress || m.UserAgent || m.ClientCertificate || m.Key
+}
+
+// ipPrefix returns the network prefix of the IP address for the configured prefix lengths.
+// It returns an empty string if the address can not be parsed or the address family is not bound.
+func (c *BindingConfig) ipPrefix(ipAddress string) string {
+	addr, err := netip.ParseAddr(ipAddress)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	bits := c.IPv6PrefixLength
+	if addr.Is4() {
+		bits = c.IPv4PrefixLength
+	}
+	if bits <= 0 {
+		return ""
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.String()
+}
+
+func hashUserAgent(userAgent string) string {
+	sum := sha256.Sum256([]byte(userAgent))
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionBinding returns the binding of a session created for the client.
+func (c *BindingConfig) sessionBinding(client ClientInfo) *models.SessionBinding {
+	binding := &models.SessionBinding{
+		IPPrefix: c.ipPrefix(client.IPAddress),
+	}
+	if c.UserAgent {
+		binding.UserAgentHash = hashUserAgent(client.UserAgent)
+	}
+	if c.ClientCertificate {
+		binding.CertificateFingerprint = client.CertificateFingerprint
+	}
+	if c.Key {
+		binding.KeyThumbprint = client.KeyThumbprint
+	}
+	if *binding == (models.SessionBinding{}) {
+		return nil
+	}
+	return binding
+}
+
+// checkBinding compares the binding of a session with the client.
+func (c *BindingConfig) checkBinding(binding *models.SessionBinding, client ClientInfo) BindingMismatch {
+	var mismatch BindingMismatch
+	if binding.IPPrefix != "" {
+		prefix, err := netip.ParsePrefix(binding.IPPrefix)
+		addr, addrErr := netip.ParseAddr(client.IPAddress)
+		mismatch.IPAddress = err != nil || addrErr != nil || !prefix.Contains(addr.Unmap())
+	}
+	if binding.UserAgentHash != "" {
+		mismatch.UserAgent = binding.UserAgentHash != hashUserAgent(client.UserAgent)
+	}
+	if binding.CertificateFingerprint != "" {
+		mismatch.ClientCertificate = binding.CertificateFingerprint != client.CertificateFingerprint
+	}
+	if binding.KeyThumbprint != "" {
+		mismatch.Key = binding.KeyThumbprint != client.KeyThumbprint
+	}
+	return mismatch
+}
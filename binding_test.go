@@ -0,0 +1,146 @@
+package keezle_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/keezletest"
+	"github.com/gaurishhs/keezle/models"
+)
+
+var boundClient = keezle.ClientInfo{
+	IPAddress:              "192.0.2.10",
+	UserAgent:              "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0",
+	CertificateFingerprint: "c3ab8ff13720e8ad9047dd39466b3c8974e592c2fa383d4a3960714caef0c4f2",
+	KeyThumbprint:          "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs",
+}
+
+// newBoundKeezle returns an instance binding sessions to every characteristic of the client and the
+// mismatches reported to Config.OnBindingMismatch.
+func newBoundKeezle(t *testing.T, policy keezle.BindingPolicy) (*keezle.Keezle[attributes, attributes], *[]keezle.BindingMismatch) {
+	t.Helper()
+	var mismatches []keezle.BindingMismatch
+	k := keezle.New(&keezle.Config[attributes, attributes]{
+		Adapter: keezletest.NewMemoryAdapter[attributes, attributes](),
+		Session: &keezle.SessionConfig{
+			ActivePeriod: time.Hour,
+			IdlePeriod:   time.Hour,
+			Binding: &keezle.BindingConfig{
+				IPv4PrefixLength:  24,
+				IPv6PrefixLength:  64,
+				UserAgent:         true,
+				ClientCertificate: true,
+				Key:               true,
+				Policy:            policy,
+			},
+		},
+		Clock: keezletest.NewFakeClock(epoch),
+		OnBindingMismatch: func(_ *models.Session[attributes, attributes], _ keezle.ClientInfo, mismatch keezle.BindingMismatch) {
+			mismatches = append(mismatches, mismatch)
+		},
+	})
+	if _, err := k.CreateUser(keezle.CreateUserOptions[attributes]{UserID: "u1", Attributes: &attributes{}}); err != nil {
+		t.Fatal(err)
+	}
+	return k, &mismatches
+}
+
+func TestSessionBindingMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		client   func(client *keezle.ClientInfo)
+		mismatch keezle.BindingMismatch
+	}{
+		{"same network", func(c *keezle.ClientInfo) { c.IPAddress = "192.0.2.200" }, keezle.BindingMismatch{}},
+		{"other network", func(c *keezle.ClientInfo) { c.IPAddress = "198.51.100.10" }, keezle.BindingMismatch{IPAddress: true}},
+		{"invalid address", func(c *keezle.ClientInfo) { c.IPAddress = "" }, keezle.BindingMismatch{IPAddress: true}},
+		{"other user agent", func(c *keezle.ClientInfo) { c.UserAgent = "curl/8.0" }, keezle.BindingMismatch{UserAgent: true}},
+		{"other certificate", func(c *keezle.ClientInfo) { c.CertificateFingerprint = "" }, keezle.BindingMismatch{ClientCertificate: true}},
+		{"other key", func(c *keezle.ClientInfo) { c.KeyThumbprint = "other" }, keezle.BindingMismatch{Key: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, mismatches := newBoundKeezle(t, keezle.BindingReport)
+			session, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}, Client: boundClient})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := boundClient
+			tt.client(&client)
+			if _, err := k.ValidateSessionWithClient(session.ID, client); err != nil {
+				t.Fatal(err)
+			}
+			var got keezle.BindingMismatch
+			if len(*mismatches) > 0 {
+				got = (*mismatches)[0]
+			}
+			if got != tt.mismatch {
+				t.Errorf("mismatch = %+v, want %+v", got, tt.mismatch)
+			}
+		})
+	}
+}
+
+func TestSessionBindingIPv6(t *testing.T) {
+	k, mismatches := newBoundKeezle(t, keezle.BindingReject)
+	client := boundClient
+	client.IPAddress = "2001:db8:1:2::10"
+	session, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}, Client: client})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.IPAddress = "2001:db8:1:2:ffff::1"
+	if _, err := k.ValidateSessionWithClient(session.ID, client); err != nil {
+		t.Errorf("client within the /64 prefix: %v", err)
+	}
+	client.IPAddress = "2001:db8:1:3::10"
+	if _, err := k.ValidateSessionWithClient(session.ID, client); !errors.Is(err, keezle.ErrSessionBindingMismatch) {
+		t.Errorf("client outside the /64 prefix returned %v, want ErrSessionBindingMismatch", err)
+	}
+	if len(*mismatches) != 1 || !(*mismatches)[0].IPAddress {
+		t.Errorf("mismatches = %+v, want one IP address mismatch", *mismatches)
+	}
+}
+
+func TestSessionBindingPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy keezle.BindingPolicy
+		err    error
+		// kept reports whether the session remains valid for the bound client after the mismatch.
+		kept bool
+	}{
+		{"reject", keezle.BindingReject, keezle.ErrSessionBindingMismatch, true},
+		{"require reauth", keezle.BindingRequireReauth, keezle.ErrSessionBindingMismatch, false},
+		{"report", keezle.BindingReport, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, mismatches := newBoundKeezle(t, tt.policy)
+			session, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}, Client: boundClient})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			other := boundClient
+			other.UserAgent = "curl/8.0"
+			if _, err := k.ValidateSessionWithClient(session.ID, other); !errors.Is(err, tt.err) {
+				t.Errorf("mismatching client returned %v, want %v", err, tt.err)
+			}
+			if len(*mismatches) != 1 {
+				t.Errorf("OnBindingMismatch was called %d times, want once", len(*mismatches))
+			}
+			if _, err := k.ValidateSessionWithClient(session.ID, boundClient); (err == nil) != tt.kept {
+				t.Errorf("bound client after the mismatch returned %v, want kept = %v", err, tt.kept)
+			}
+			// ValidateSession does not check the binding.
+			if _, err := k.ValidateSession(session.ID); (err == nil) != tt.kept {
+				t.Errorf("validating without a client returned %v, want kept = %v", err, tt.kept)
+			}
+		})
+	}
+}
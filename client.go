@@ -0,0 +1,43 @@
+package keezle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+)
+
+// ClientInfo describes the client a session is created for.
+type ClientInfo struct {
+	IPAddress string
+	UserAgent string
+	// CertificateFingerprint is the hex encoded SHA-256 fingerprint of the TLS client certificate.
+	CertificateFingerprint string
+	// KeyThumbprint is the JWK thumbprint of a key the client has proven possession of, e.g. the key of a
+	// verified DPoP proof. It is never set by Keezle itself, see utils.JWKThumbprint.
+	KeyThumbprint string
+}
+
+// ClientInfo returns the client information of the request.
+// The IP address is read with Config.ClientIP, which defaults to the host of the remote address, and the
+// certificate fingerprint from the first TLS peer certificate.
+func (k *Keezle[UA, SA]) ClientInfo(req *http.Request) ClientInfo {
+	client := ClientInfo{
+		IPAddress: k.Config.ClientIP(req),
+		UserAgent: req.UserAgent(),
+	}
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 {
+		sum := sha256.Sum256(req.TLS.PeerCertificates[0].Raw)
+		client.CertificateFingerprint = hex.EncodeToString(sum[:])
+	}
+	return client
+}
+
+// remoteIP returns the host of the remote address of the request.
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
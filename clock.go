@@ -0,0 +1,21 @@
+package keezle
+
+import "time"
+
+// Clock tells the current time. Keezle reads the time from Config.Clock wherever it creates, expires, renews
+// or rotates sessions and tokens, so that tests can control it, e.g. with keezletest.FakeClock.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the clock backed by time.Now, which Config.Clock defaults to.
+var SystemClock Clock = systemClock{}
+
+// now returns the current time of the configured clock.
+func (k *Keezle[UA, SA]) now() time.Time {
+	return k.Config.Clock.Now()
+}
@@ -0,0 +1,97 @@
+package keezle
+
+import (
+	"database/sql"
+	"errors"
+	"maps"
+	"time"
+
+	"github.com/gaurishhs/keezle/models"
+)
+
+// Authentication levels of a session.
+const (
+	// AuthLevelLogin is the level of a session created by a login.
+	AuthLevelLogin = 1
+	// AuthLevelElevated is the level of a session whose user re-entered their credentials with ElevateSession.
+	AuthLevelElevated = 2
+)
+
+// ElevateSessionOptions defines the credentials used to elevate a session.
+type ElevateSessionOptions struct {
+	Provider       string
+	ProviderUserID string
+	Password       string
+	// Client is the client of the request, which is checked against the session binding.
+	Client ClientInfo
+	// Level is the authentication level the session is elevated to, defaults to AuthLevelElevated.
+	// Sessions already at a higher level keep it, but only the time of this level is refreshed.
+	Level int
+}
+
+// ElevateSession re-verifies the credentials of the session's user with UseKey and records the time of the
+// authentication with the level on the session, as required by IsRecentlyAuthenticated.
+// It returns ErrInvalidKeyId if the key does not belong to the user of the session, without verifying the
+// password of the key.
+func (k *Keezle[UA, SA]) ElevateSession(sessionId string, opts ElevateSessionOptions) (*models.Session[UA, SA], error) {
+	session, err := k.ValidateSessionWithClient(sessionId, opts.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := k.GetKey(opts.Provider, opts.ProviderUserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidKeyId
+		}
+		return nil, err
+	}
+	if key.UserID != session.User.ID {
+		return nil, ErrInvalidKeyId
+	}
+	if _, err := k.UseKey(opts.Provider, opts.ProviderUserID, opts.Password); err != nil {
+		return nil, err
+	}
+
+	level := opts.Level
+	if level == 0 {
+		level = AuthLevelElevated
+	}
+	now := k.now()
+	levels := maps.Clone(session.AuthLevels)
+	if levels == nil {
+		levels = models.AuthLevels{}
+	}
+	levels[level] = now
+
+	event := &SessionEvent[UA, SA]{EventMeta: k.newEventMeta(EventSessionElevated), Session: session}
+	if err := k.Events.before(event); err != nil {
+		return nil, err
+	}
+
+	elevated, err := k.UpdateSession(session.ID, &models.DBSession[SA]{
+		AuthenticatedAt: &now,
+		AuthLevel:       ptr(max(level, session.AuthLevel)),
+		AuthLevels:      &levels,
+	})
+	if err != nil {
+		return nil, err
+	}
+	elevated.Fresh = session.Fresh
+	event.Session = elevated
+	k.Events.after(event)
+	return elevated, nil
+}
+
+// IsRecentlyAuthenticated reports whether the user of the session has authenticated with at least the level
+// within the window, either by logging in or by elevating the session.
+// Only authentications with the level or a higher one count, a recent login does not renew an elevation.
+func (k *Keezle[UA, SA]) IsRecentlyAuthenticated(session *models.Session[UA, SA], level int, window time.Duration) bool {
+	now := k.now()
+	for authLevel, authenticatedAt := range session.AuthLevels {
+		if authLevel >= level && now.Sub(authenticatedAt) < window {
+			return true
+		}
+	}
+	return false
+}
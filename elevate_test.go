@@ -0,0 +1,103 @@
+package keezle_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+)
+
+func TestElevateSession(t *testing.T) {
+	client := keezle.ClientInfo{IPAddress: "192.0.2.1", UserAgent: "Firefox"}
+	k, clock := newKeezle(t, &keezle.SessionConfig{
+		ActivePeriod: time.Hour,
+		IdlePeriod:   time.Hour,
+		Binding:      &keezle.BindingConfig{UserAgent: true},
+	})
+	if _, err := k.CreateUser(keezle.CreateUserOptions[attributes]{UserID: "u2", Attributes: &attributes{}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []keezle.CreateKeyOptions{
+		{UserID: "u1", Provider: "email", ProviderUserID: "u1@example.com", Password: "password"},
+		{UserID: "u2", Provider: "email", ProviderUserID: "u2@example.com", Password: "other password"},
+	} {
+		if _, err := k.CreateKey(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	session, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}, Client: client})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logins []string
+	k.Events.Subscribe(keezle.EventAll, func(event keezle.Event) error {
+		if event, ok := event.(*keezle.LoginEvent); ok {
+			logins = append(logins, event.ProviderUserID)
+		}
+		return nil
+	})
+	clock.Advance(20 * time.Minute)
+
+	tests := []struct {
+		name           string
+		providerUserId string
+		password       string
+		client         keezle.ClientInfo
+		err            error
+		logins         int
+	}{
+		{"key of another user", "u2@example.com", "other password", client, keezle.ErrInvalidKeyId, 0},
+		{"unknown key", "u3@example.com", "password", client, keezle.ErrInvalidKeyId, 0},
+		{"wrong password", "u1@example.com", "wrong", client, keezle.ErrInvalidPassword, 1},
+		{"other client", "u1@example.com", "password", keezle.ClientInfo{IPAddress: "192.0.2.1", UserAgent: "Chrome"}, keezle.ErrSessionBindingMismatch, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logins = nil
+			_, err := k.ElevateSession(session.ID, keezle.ElevateSessionOptions{
+				Provider:       "email",
+				ProviderUserID: tt.providerUserId,
+				Password:       tt.password,
+				Client:         tt.client,
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("ElevateSession returned %v, want %v", err, tt.err)
+			}
+			if len(logins) != tt.logins {
+				t.Errorf("logins = %v, want %d", logins, tt.logins)
+			}
+		})
+	}
+
+	validated, err := k.ValidateSession(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.IsRecentlyAuthenticated(validated, keezle.AuthLevelElevated, 10*time.Minute) {
+		t.Error("failed elevations elevated the session")
+	}
+
+	elevated, err := k.ElevateSession(session.ID, keezle.ElevateSessionOptions{
+		Provider:       "email",
+		ProviderUserID: "u1@example.com",
+		Password:       "password",
+		Client:         client,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elevated.AuthLevel != keezle.AuthLevelElevated || !elevated.AuthenticatedAt.Equal(clock.Now()) {
+		t.Errorf("elevated session = %+v", elevated)
+	}
+	if !k.IsRecentlyAuthenticated(elevated, keezle.AuthLevelElevated, 10*time.Minute) {
+		t.Error("the elevated session is not recently authenticated")
+	}
+	// The login is not recent, and an elevation does not count for a higher level.
+	if k.IsRecentlyAuthenticated(session, keezle.AuthLevelLogin, 10*time.Minute) {
+		t.Error("the login is recent")
+	}
+	if k.IsRecentlyAuthenticated(elevated, keezle.AuthLevelElevated+1, 10*time.Minute) {
+		t.Error("the elevation counts for a higher level")
+	}
+}
@@ -1,10 +1,29 @@
 package keezle
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/gaurishhs/keezle/adapters"
+)
 
 var (
-	ErrProviderColon        = errors.New("provider must not contain colons (:)")
-	ErrInvalidSessionId     = errors.New("invalid session id")
-	ErrInvalidPassword      = errors.New("invalid password")
-	ErrInvalidRequestOrigin = errors.New("invalid request origin")
+	ErrProviderColon             = errors.New("provider must not contain colons (:)")
+	ErrInvalidSessionId          = errors.New("invalid session id")
+	ErrSessionExpired            = errors.New("session expired")
+	ErrInvalidKeyId              = errors.New("invalid key id")
+	ErrInvalidPassword           = errors.New("invalid password")
+	ErrInvalidRequestOrigin      = errors.New("invalid request origin")
+	ErrSessionLimitReached       = adapters.ErrSessionLimitReached
+	ErrSessionBindingMismatch    = errors.New("session binding mismatch")
+	ErrStatelessSession          = errors.New("operation not supported for stateless sessions")
+	ErrRevocationNotSupported    = errors.New("adapter does not support revoking stateless sessions")
+	ErrRefreshTokensNotSupported = errors.New("adapter does not support refresh tokens")
+	ErrInvalidRefreshToken       = errors.New("invalid refresh token")
+	ErrRefreshTokenReused        = errors.New("refresh token reused")
+	ErrInvalidAccessToken        = errors.New("invalid access token")
+	ErrProviderTokensDisabled    = errors.New("provider tokens are not configured")
+	ErrProviderTokensUnsupported = errors.New("adapter does not support provider tokens")
+	ErrProviderTokenNotFound     = errors.New("provider token not found")
+	ErrProviderTokenExpired      = errors.New("provider token expired and can not be refreshed")
+	ErrProviderGrantRevoked      = errors.New("provider grant revoked")
 )
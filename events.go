@@ -0,0 +1,267 @@
+package keezle
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/gaurishhs/keezle/logger"
+	"github.com/gaurishhs/keezle/models"
+)
+
+// EventType identifies the type of an event.
+type EventType string
+
+// Event types.
+const (
+	// EventAll subscribes to every event type.
+	EventAll EventType = "*"
+
+	EventUserCreated EventType = "user.created"
+	EventUserDeleted EventType = "user.deleted"
+
+	EventKeyCreated      EventType = "key.created"
+	EventKeyDeleted      EventType = "key.deleted"
+	EventPasswordChanged EventType = "key.password_changed"
+
+	EventLoginSucceeded EventType = "login.succeeded"
+	EventLoginFailed    EventType = "login.failed"
+
+	EventSessionCreated         EventType = "session.created"
+	EventSessionRenewed         EventType = "session.renewed"
+	EventSessionRotated         EventType = "session.rotated"
+	EventSessionElevated        EventType = "session.elevated"
+	EventSessionRevoked         EventType = "session.revoked"
+	EventSessionExpired         EventType = "session.expired"
+	EventSessionBindingMismatch EventType = "session.binding_mismatch"
+)
+
+// ErrEventVetoed is wrapped by the error returned when a synchronous subscriber vetoes an operation.
+var ErrEventVetoed = errors.New("vetoed by event subscriber")
+
+// Event is implemented by every event. Events are passed by pointer, subscribers switch on their concrete
+// type to read them.
+type Event interface {
+	EventType() EventType
+	EventTime() time.Time
+}
+
+// EventMeta holds the type and time of an event.
+type EventMeta struct {
+	Type EventType
+	Time time.Time
+}
+
+func (m EventMeta) EventType() EventType { return m.Type }
+func (m EventMeta) EventTime() time.Time { return m.Time }
+
+func (k *Keezle[UA, SA]) newEventMeta(eventType EventType) EventMeta {
+	return EventMeta{Type: eventType, Time: k.now()}
+}
+
+// UserEvent is emitted when a user is created or deleted.
+// The user of EventUserDeleted events only has its ID set.
+type UserEvent[UA models.AnyStruct] struct {
+	EventMeta
+	User *models.User[UA]
+}
+
+// KeyEvent is emitted when a key is created, deleted or its password is changed.
+type KeyEvent struct {
+	EventMeta
+	KeyID  string
+	UserID string
+}
+
+// LoginEvent is emitted when a key is used with UseKey.
+// Err is set for EventLoginFailed events, UserID is empty if the key does not exist.
+type LoginEvent struct {
+	EventMeta
+	Provider       string
+	ProviderUserID string
+	UserID         string
+	Err            error
+}
+
+// SessionEvent is emitted when a session is created, renewed, rotated or elevated.
+// Synchronous subscribers receive the session as it is before the change, asynchronous subscribers receive the
+// changed session. PreviousID is the id a rotated session had before.
+type SessionEvent[UA, SA models.AnyStruct] struct {
+	EventMeta
+	Session    *models.Session[UA, SA]
+	PreviousID string
+}
+
+// BindingMismatchEvent is emitted when a session is validated for a client which does not match its binding.
+type BindingMismatchEvent[UA, SA models.AnyStruct] struct {
+	EventMeta
+	Session  *models.Session[UA, SA]
+	Client   ClientInfo
+	Mismatch BindingMismatch
+}
+
+// SessionRevokedEvent is emitted when a session is deleted or revoked, and when ValidateSession deletes an
+// expired session. For EventSessionRevoked events deleting every session of a user, SessionID is empty.
+// UserID is empty if the deleted session did not exist.
+type SessionRevokedEvent struct {
+	EventMeta
+	SessionID string
+	UserID    string
+}
+
+// copier is implemented by the events, which copy themselves for asynchronous subscribers so that these do
+// not share the session or user of an event with the caller of the operation, which may modify them.
+type copier interface {
+	copyEvent() Event
+}
+
+func copyEvent(event Event) Event {
+	if c, ok := event.(copier); ok {
+		return c.copyEvent()
+	}
+	return event
+}
+
+func (e *KeyEvent) copyEvent() Event {
+	copied := *e
+	return &copied
+}
+
+func (e *LoginEvent) copyEvent() Event {
+	copied := *e
+	return &copied
+}
+
+func (e *SessionRevokedEvent) copyEvent() Event {
+	copied := *e
+	return &copied
+}
+
+func (e *UserEvent[UA]) copyEvent() Event {
+	copied := *e
+	copied.User = copyUser(e.User)
+	return &copied
+}
+
+func (e *SessionEvent[UA, SA]) copyEvent() Event {
+	copied := *e
+	copied.Session = copySession(e.Session)
+	return &copied
+}
+
+func (e *BindingMismatchEvent[UA, SA]) copyEvent() Event {
+	copied := *e
+	copied.Session = copySession(e.Session)
+	return &copied
+}
+
+func copyUser[UA models.AnyStruct](user *models.User[UA]) *models.User[UA] {
+	if user == nil {
+		return nil
+	}
+	copied := *user
+	return &copied
+}
+
+// copySession copies the session and its user. Attributes are shared, they are not modified by keezle.
+func copySession[UA, SA models.AnyStruct](session *models.Session[UA, SA]) *models.Session[UA, SA] {
+	if session == nil {
+		return nil
+	}
+	copied := *session
+	copied.User = copyUser(session.User)
+	copied.AuthLevels = maps.Clone(session.AuthLevels)
+	return &copied
+}
+
+type syncSubscriber struct {
+	eventType EventType
+	handler   func(Event) error
+}
+
+type asyncSubscriber struct {
+	eventType EventType
+	handler   func(Event)
+}
+
+// EventBus delivers events to subscribers.
+// Synchronous subscribers are called before the change reported by an event is stored and can veto it by
+// returning an error, which aborts the operation. Events reporting a failure or an expiry can not be vetoed.
+// Asynchronous subscribers are called in their own goroutine once the change has been stored.
+type EventBus struct {
+	mu     sync.RWMutex
+	sync   []syncSubscriber
+	async  []asyncSubscriber
+	logger logger.Logger
+}
+
+func newEventBus(logger logger.Logger) *EventBus {
+	return &EventBus{logger: logger}
+}
+
+// Subscribe adds a synchronous subscriber for the event type, or every event for EventAll.
+func (b *EventBus) Subscribe(eventType EventType, handler func(Event) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sync = append(b.sync, syncSubscriber{eventType: eventType, handler: handler})
+}
+
+// SubscribeAsync adds an asynchronous subscriber for the event type, or every event for EventAll.
+func (b *EventBus) SubscribeAsync(eventType EventType, handler func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.async = append(b.async, asyncSubscriber{eventType: eventType, handler: handler})
+}
+
+func matches(subscribed, eventType EventType) bool {
+	return subscribed == EventAll || subscribed == eventType
+}
+
+// before calls the synchronous subscribers of the event and returns the first veto.
+func (b *EventBus) before(event Event) error {
+	b.mu.RLock()
+	subscribers := b.sync
+	b.mu.RUnlock()
+
+	for _, subscriber := range subscribers {
+		if !matches(subscriber.eventType, event.EventType()) {
+			continue
+		}
+		if err := subscriber.handler(event); err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrEventVetoed, event.EventType(), err)
+		}
+	}
+	return nil
+}
+
+// after calls the asynchronous subscribers of the event. Each subscriber receives its own copy of the event,
+// since the caller keeps using the session of the event once the operation returned.
+func (b *EventBus) after(event Event) {
+	b.mu.RLock()
+	subscribers := b.async
+	b.mu.RUnlock()
+
+	for _, subscriber := range subscribers {
+		if !matches(subscriber.eventType, event.EventType()) {
+			continue
+		}
+		go func(handler func(Event), event Event) {
+			defer func() {
+				if r := recover(); r != nil {
+					b.logger.Log("error: event subscriber for %s panicked: %v", event.EventType(), r)
+				}
+			}()
+			handler(event)
+		}(subscriber.handler, copyEvent(event))
+	}
+}
+
+// notify delivers an event which can not be vetoed to every subscriber.
+func (b *EventBus) notify(event Event) {
+	if err := b.before(event); err != nil {
+		b.logger.Log("debug: ignoring veto of %s event: %v", event.EventType(), err)
+	}
+	b.after(event)
+}
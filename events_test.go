@@ -0,0 +1,114 @@
+package keezle_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+)
+
+func TestEvents(t *testing.T) {
+	k, _ := newKeezle(t, nil)
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		async []keezle.EventType
+	)
+	k.Events.SubscribeAsync(keezle.EventAll, func(event keezle.Event) {
+		defer wg.Done()
+		mu.Lock()
+		defer mu.Unlock()
+		async = append(async, event.EventType())
+	})
+	veto := errors.New("password changes are disabled")
+	k.Events.Subscribe(keezle.EventPasswordChanged, func(keezle.Event) error { return veto })
+	var revoked *keezle.SessionRevokedEvent
+	k.Events.Subscribe(keezle.EventSessionRevoked, func(event keezle.Event) error {
+		revoked = event.(*keezle.SessionRevokedEvent)
+		return nil
+	})
+
+	wg.Add(1)
+	if _, err := k.CreateKey(keezle.CreateKeyOptions{UserID: "u1", Provider: "email", ProviderUserID: "u1@example.com", Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+	wg.Add(1)
+	if _, err := k.UseKey("email", "u1@example.com", "wrong"); !errors.Is(err, keezle.ErrInvalidPassword) {
+		t.Fatalf("UseKey with a wrong password returned %v", err)
+	}
+	wg.Add(1)
+	if _, err := k.UseKey("email", "u1@example.com", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.UpdateKey("email", "u1@example.com", "changed"); !errors.Is(err, keezle.ErrEventVetoed) || !errors.Is(err, veto) {
+		t.Errorf("vetoed password change returned %v", err)
+	}
+	if _, err := k.UseKey("email", "u1@example.com", "password"); err != nil {
+		t.Error("the vetoed password change was stored")
+	}
+	wg.Add(2)
+	session, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg.Add(1)
+	if err := k.DeleteSession(session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if revoked == nil || revoked.SessionID != session.ID || revoked.UserID != "u1" {
+		t.Errorf("revoked event = %+v", revoked)
+	}
+
+	wg.Wait()
+	want := []keezle.EventType{
+		keezle.EventKeyCreated, keezle.EventLoginFailed, keezle.EventLoginSucceeded,
+		keezle.EventLoginSucceeded, keezle.EventSessionCreated, keezle.EventSessionRevoked,
+	}
+	counts := map[keezle.EventType]int{}
+	for _, eventType := range async {
+		counts[eventType]++
+	}
+	for _, eventType := range want {
+		counts[eventType]--
+	}
+	for eventType, count := range counts {
+		if count != 0 {
+			t.Errorf("asynchronous subscriber received %v, want %v (%s)", async, want, eventType)
+			break
+		}
+	}
+}
+
+// TestAsyncEventSessionCopy runs with -race: the caller of ValidateSession modifies the renewed session while
+// an asynchronous subscriber reads the session of its event.
+func TestAsyncEventSessionCopy(t *testing.T) {
+	k, clock := newKeezle(t, &keezle.SessionConfig{ActivePeriod: time.Hour, IdlePeriod: time.Hour})
+	session, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	renewed := make(chan time.Time, 1)
+	k.Events.SubscribeAsync(keezle.EventSessionRenewed, func(event keezle.Event) {
+		session := event.(*keezle.SessionEvent[attributes, attributes]).Session
+		if !session.Fresh {
+			renewed <- time.Time{}
+			return
+		}
+		renewed <- session.ActiveExpiresAt
+	})
+
+	clock.Advance(45 * time.Minute)
+	validated, err := k.ValidateSession(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := validated.ActiveExpiresAt
+	validated.Fresh = false
+	validated.ActiveExpiresAt = time.Time{}
+	validated.User.ID = ""
+	if got := <-renewed; !got.Equal(want) {
+		t.Errorf("subscriber received active expiry %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,19 @@
+module github.com/gaurishhs/keezle/grpcauth
+
+go 1.24.2
+
+require (
+	github.com/gaurishhs/keezle v0.0.0-20250709172739-4ff048670fb0
+	github.com/gaurishhs/keezle/models v0.0.0-20250709172739-4ff048670fb0
+	google.golang.org/grpc v1.73.0
+)
+
+require (
+	github.com/rs/xid v1.6.0 // indirect
+	golang.org/x/crypto v0.39.0 // indirect
+	golang.org/x/net v0.38.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/text v0.26.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250324211829-b45e905df463 // indirect
+	google.golang.org/protobuf v1.36.6 // indirect
+)
@@ -0,0 +1,201 @@
+// Package grpcauth provides gRPC server interceptors which validate Keezle sessions.
+// The session token is read from the request metadata, validated with ValidateSessionWithClient and the
+// resulting session is stored in the context of the call. Renewed session tokens are returned to
+// the client in the response header.
+package grpcauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"strings"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Options defines the options for the interceptors.
+type Options struct {
+	// MetadataKey is the metadata key holding the session token, defaults to "authorization".
+	// Values prefixed with "Bearer " are accepted.
+	MetadataKey string
+	// RefreshKey is the response header key used to return a renewed session token,
+	// defaults to "x-session-token".
+	RefreshKey string
+	// Public reports whether a method can be called without a session.
+	// Sessions sent to public methods are still validated and stored in the context.
+	Public func(fullMethod string) bool
+}
+
+// Interceptors holds the gRPC interceptors for a Keezle instance.
+type Interceptors[UA, SA models.AnyStruct] struct {
+	Keezle  *keezle.Keezle[UA, SA]
+	Options *Options
+}
+
+type sessionContextKey struct{}
+
+// New creates the interceptors for the provided Keezle instance.
+func New[UA, SA models.AnyStruct](k *keezle.Keezle[UA, SA], opts *Options) *Interceptors[UA, SA] {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if opts.MetadataKey == "" {
+		opts.MetadataKey = "authorization"
+	}
+
+	if opts.RefreshKey == "" {
+		opts.RefreshKey = "x-session-token"
+	}
+
+	if opts.Public == nil {
+		opts.Public = func(string) bool { return false }
+	}
+
+	return &Interceptors[UA, SA]{
+		Keezle:  k,
+		Options: opts,
+	}
+}
+
+// NewContext returns a copy of the context holding the session.
+func NewContext[UA, SA models.AnyStruct](ctx context.Context, session *models.Session[UA, SA]) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, session)
+}
+
+// SessionFromContext returns the session stored in the context by the interceptors.
+func SessionFromContext[UA, SA models.AnyStruct](ctx context.Context) (*models.Session[UA, SA], bool) {
+	session, ok := ctx.Value(sessionContextKey{}).(*models.Session[UA, SA])
+	return session, ok && session != nil
+}
+
+// sessionToken reads the session token from the incoming metadata.
+func (i *Interceptors[UA, SA]) sessionToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(i.Options.MetadataKey)
+	if len(values) == 0 {
+		return ""
+	}
+	token := strings.TrimSpace(values[0])
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = strings.TrimSpace(token[7:])
+	}
+	return token
+}
+
+// clientInfo returns the client information of the call from its peer and metadata.
+func clientInfo(ctx context.Context) keezle.ClientInfo {
+	var client keezle.ClientInfo
+	if p, ok := peer.FromContext(ctx); ok {
+		if addr, err := netip.ParseAddrPort(p.Addr.String()); err == nil {
+			client.IPAddress = addr.Addr().String()
+		}
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.PeerCertificates) > 0 {
+			sum := sha256.Sum256(tlsInfo.State.PeerCertificates[0].Raw)
+			client.CertificateFingerprint = hex.EncodeToString(sum[:])
+		}
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("user-agent"); len(values) > 0 {
+			client.UserAgent = values[0]
+		}
+	}
+	return client
+}
+
+// isInvalidSession reports whether an error returned by ValidateSession means the call carries no usable session.
+func isInvalidSession(err error) bool {
+	return errors.Is(err, keezle.ErrInvalidSessionId) ||
+		errors.Is(err, keezle.ErrSessionExpired) ||
+		errors.Is(err, keezle.ErrSessionBindingMismatch)
+}
+
+// toStatus converts an error returned by ValidateSession to a gRPC status error.
+func (i *Interceptors[UA, SA]) toStatus(err error) error {
+	if isInvalidSession(err) {
+		return status.Error(codes.Unauthenticated, "invalid session")
+	}
+	i.Keezle.Config.Logger.Log("error: grpcauth: failed to validate session: %v", err)
+	return status.Error(codes.Internal, "failed to validate session")
+}
+
+// authenticate validates the session of the call and returns the context holding it.
+// The returned metadata holds the renewed session token if the session was renewed.
+func (i *Interceptors[UA, SA]) authenticate(ctx context.Context, fullMethod string) (context.Context, metadata.MD, error) {
+	public := i.Options.Public(fullMethod)
+	token := i.sessionToken(ctx)
+	if token == "" {
+		if public {
+			return ctx, nil, nil
+		}
+		return nil, nil, status.Error(codes.Unauthenticated, "missing session")
+	}
+
+	session, err := i.Keezle.ValidateSessionWithClient(token, clientInfo(ctx))
+	if err != nil {
+		if public && isInvalidSession(err) {
+			return ctx, nil, nil
+		}
+		return nil, nil, i.toStatus(err)
+	}
+
+	var md metadata.MD
+	if session.Fresh {
+		md = metadata.Pairs(i.Options.RefreshKey, session.ID)
+	}
+	return NewContext(ctx, session), md, nil
+}
+
+// Unary returns a unary server interceptor validating the session of every call.
+func (i *Interceptors[UA, SA]) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, md, err := i.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		if md != nil {
+			if err := grpc.SetHeader(ctx, md); err != nil {
+				grpc.SetTrailer(ctx, md)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// serverStream wraps a grpc.ServerStream to replace its context.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// Stream returns a stream server interceptor validating the session of every stream.
+func (i *Interceptors[UA, SA]) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, md, err := i.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		if md != nil {
+			if err := ss.SetHeader(md); err != nil {
+				ss.SetTrailer(md)
+			}
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
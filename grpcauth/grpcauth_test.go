@@ -0,0 +1,229 @@
+package grpcauth_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/grpcauth"
+	"github.com/gaurishhs/keezle/keezletest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type attributes = keezletest.Attributes
+
+// healthServer reports the user of the session of a call as the service of its response, which is otherwise
+// unused, so that the tests see what the interceptors stored in the context.
+type healthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+}
+
+func sessionUser(ctx context.Context) string {
+	session, ok := grpcauth.SessionFromContext[attributes, attributes](ctx)
+	if !ok {
+		return ""
+	}
+	return session.User.ID
+}
+
+func (healthServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	status := grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	if sessionUser(ctx) == "u1" {
+		status = grpc_health_v1.HealthCheckResponse_SERVING
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: status}, nil
+}
+
+func (healthServer) Watch(req *grpc_health_v1.HealthCheckRequest, stream grpc_health_v1.Health_WatchServer) error {
+	status := grpc_health_v1.HealthCheckResponse_NOT_SERVING
+	if sessionUser(stream.Context()) == "u1" {
+		status = grpc_health_v1.HealthCheckResponse_SERVING
+	}
+	return stream.Send(&grpc_health_v1.HealthCheckResponse{Status: status})
+}
+
+type fixture struct {
+	keezle  *keezle.Keezle[attributes, attributes]
+	clock   *keezletest.FakeClock
+	client  grpc_health_v1.HealthClient
+	session string
+}
+
+// newFixture serves the health service behind the interceptors on an in-memory connection. Check is public when
+// public is set, Watch never is.
+func newFixture(t *testing.T, public bool) *fixture {
+	t.Helper()
+	clock := keezletest.NewFakeClock(time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC))
+	k := keezle.New(&keezle.Config[attributes, attributes]{
+		Adapter: keezletest.NewMemoryAdapter[attributes, attributes](),
+		Session: &keezle.SessionConfig{ActivePeriod: time.Hour, IdlePeriod: time.Hour},
+		Clock:   clock,
+	})
+	if _, err := k.CreateUser(keezle.CreateUserOptions[attributes]{UserID: "u1", Attributes: &attributes{}}); err != nil {
+		t.Fatal(err)
+	}
+	session, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interceptors := grpcauth.New(k, &grpcauth.Options{
+		Public: func(fullMethod string) bool {
+			return public && fullMethod == grpc_health_v1.Health_Check_FullMethodName
+		},
+	})
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.UnaryInterceptor(interceptors.Unary()), grpc.StreamInterceptor(interceptors.Stream()))
+	grpc_health_v1.RegisterHealthServer(server, healthServer{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &fixture{keezle: k, clock: clock, client: grpc_health_v1.NewHealthClient(conn), session: session.ID}
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", token)
+}
+
+func TestUnary(t *testing.T) {
+	f := newFixture(t, false)
+	tests := []struct {
+		name string
+		ctx  context.Context
+		code codes.Code
+	}{
+		{"session", withToken(f.session), codes.OK},
+		{"bearer session", withToken("Bearer " + f.session), codes.OK},
+		{"missing token", context.Background(), codes.Unauthenticated},
+		{"empty token", withToken(""), codes.Unauthenticated},
+		{"invalid token", withToken("invalid"), codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := f.client.Check(tt.ctx, &grpc_health_v1.HealthCheckRequest{})
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %v, want %v: %v", code, tt.code, err)
+			}
+			if err == nil && res.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+				t.Errorf("session was not stored in the context")
+			}
+		})
+	}
+}
+
+func TestUnaryExpiredSession(t *testing.T) {
+	f := newFixture(t, false)
+	f.clock.Advance(2 * time.Hour)
+	_, err := f.client.Check(withToken(f.session), &grpc_health_v1.HealthCheckRequest{})
+	if code := status.Code(err); code != codes.Unauthenticated {
+		t.Fatalf("code = %v, want Unauthenticated: %v", code, err)
+	}
+}
+
+func TestUnaryRenewedSession(t *testing.T) {
+	f := newFixture(t, false)
+	f.clock.Advance(45 * time.Minute)
+
+	var header metadata.MD
+	if _, err := f.client.Check(withToken(f.session), &grpc_health_v1.HealthCheckRequest{}, grpc.Header(&header)); err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get("x-session-token"); len(got) != 1 || got[0] != f.session {
+		t.Errorf("x-session-token = %q, want the renewed session", got)
+	}
+
+	header = nil
+	if _, err := f.client.Check(withToken(f.session), &grpc_health_v1.HealthCheckRequest{}, grpc.Header(&header)); err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get("x-session-token"); len(got) != 0 {
+		t.Errorf("x-session-token = %q for a session which was not renewed", got)
+	}
+}
+
+func TestUnaryPublic(t *testing.T) {
+	f := newFixture(t, true)
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		serving bool
+	}{
+		{"session", withToken(f.session), true},
+		{"missing token", context.Background(), false},
+		{"invalid token", withToken("invalid"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := f.client.Check(tt.ctx, &grpc_health_v1.HealthCheckRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if serving := res.Status == grpc_health_v1.HealthCheckResponse_SERVING; serving != tt.serving {
+				t.Errorf("session in context = %v, want %v", serving, tt.serving)
+			}
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	f := newFixture(t, true)
+	tests := []struct {
+		name string
+		ctx  context.Context
+		code codes.Code
+	}{
+		{"session", withToken(f.session), codes.OK},
+		{"missing token", context.Background(), codes.Unauthenticated},
+		{"invalid token", withToken("invalid"), codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := f.client.Watch(tt.ctx, &grpc_health_v1.HealthCheckRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := stream.Recv()
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("code = %v, want %v: %v", code, tt.code, err)
+			}
+			if err == nil && res.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+				t.Errorf("session was not stored in the stream context")
+			}
+		})
+	}
+}
+
+func TestStreamRenewedSession(t *testing.T) {
+	f := newFixture(t, false)
+	f.clock.Advance(45 * time.Minute)
+
+	stream, err := f.client.Watch(withToken(f.session), &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := stream.Header()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := header.Get("x-session-token"); len(got) != 1 || got[0] != f.session {
+		t.Errorf("x-session-token = %q, want the renewed session", got)
+	}
+}
@@ -0,0 +1,332 @@
+// Package httpauth provides ready-made net/http handlers for the common authentication endpoints
+// built on top of Keezle, i.e. password sign-up, login, logout, logout from every device,
+// the management of a user's sessions and re-authentication before sensitive actions.
+// The handlers accept both JSON and form-encoded request bodies, so the same handler can serve
+// API clients as well as plain HTML forms.
+package httpauth
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/models"
+)
+
+// Error codes returned by the handlers.
+// Login and sign-up failures are deliberately reported with a single code so that the response
+// never reveals whether an account exists.
+const (
+	ErrorInvalidRequest     = "invalid_request"
+	ErrorInvalidCredentials = "invalid_credentials"
+	ErrorSignUpFailed       = "sign_up_failed"
+	ErrorUnauthorized       = "unauthorized"
+	ErrorNotFound           = "not_found"
+	ErrorNotSupported       = "not_supported"
+	ErrorInvalidOrigin      = "invalid_origin"
+	ErrorSessionLimit       = "session_limit_reached"
+	ErrorReauthRequired     = "reauthentication_required"
+	ErrorInternal           = "internal_error"
+)
+
+// maxBodySize is the maximum size of a request body accepted by the handlers.
+const maxBodySize = 1 << 20
+
+// AttributeDecoder decodes the user attributes from a sign-up request.
+// The fields contain every top-level field of the request body as JSON, regardless of whether it was
+// sent as JSON or form-encoded. Form-encoded fields are JSON strings.
+type AttributeDecoder[UA models.AnyStruct] func(req *http.Request, fields map[string]json.RawMessage) (*UA, error)
+
+// RedirectConfig defines where browser requests are redirected after a handler completes.
+// Redirects are only used for form-encoded requests, JSON requests always receive a JSON response.
+type RedirectConfig struct {
+	AfterSignUp string
+	AfterLogin  string
+	AfterLogout string
+	// AfterReauthenticate is the URL the user is redirected to after re-entering their password.
+	AfterReauthenticate string
+	// OnError is the URL the user is redirected to when a handler fails.
+	// The error code is appended to it as the "error" query parameter.
+	OnError string
+}
+
+// Config defines the configuration for the HTTP handlers.
+type Config[UA, SA models.AnyStruct] struct {
+	// Provider is the key provider used for password keys, defaults to "email".
+	Provider string
+	// IdentifierField is the name of the field holding the provider user id, defaults to "email".
+	IdentifierField string
+	// PasswordField is the name of the field holding the password, defaults to "password".
+	PasswordField string
+	// RememberMeField is the name of the field requesting a "remember me" session, defaults to "remember_me".
+	RememberMeField string
+	// NormalizeIdentifier normalizes the identifier before it is used as the provider user id.
+	// Defaults to trimming spaces and lowercasing.
+	NormalizeIdentifier func(identifier string) string
+	// ValidatePassword is called on sign-up to enforce a password policy.
+	ValidatePassword func(password string) error
+	// DecodeAttributes decodes the user attributes on sign-up. It takes precedence over AttributeFields.
+	DecodeAttributes AttributeDecoder[UA]
+	// AttributeFields are the request fields decoded into UA using its JSON representation on sign-up, if
+	// DecodeAttributes is not set. Other fields are ignored, so that clients can not set attributes such as
+	// roles. Users are created without attributes if neither is set.
+	AttributeFields []string
+	// SessionAttributes returns the attributes stored with sessions created by the handlers.
+	SessionAttributes func(req *http.Request) SA
+	// SessionParam is the name of the path value or request field holding the session to revoke,
+	// defaults to "session".
+	SessionParam string
+	// RecentAuthWindow is how long an authentication counts as recent for RequireRecentAuth,
+	// defaults to 10 minutes.
+	RecentAuthWindow time.Duration
+	// RecentAuthLevel is the authentication level required by RequireRecentAuth, defaults to
+	// keezle.AuthLevelLogin so that a fresh login also counts as recent.
+	RecentAuthLevel int
+	Redirects       *RedirectConfig
+}
+
+// Handlers holds the HTTP handlers for a Keezle instance.
+type Handlers[UA, SA models.AnyStruct] struct {
+	Keezle *keezle.Keezle[UA, SA]
+	Config *Config[UA, SA]
+
+	dummyHashOnce sync.Once
+	dummyHash     string
+}
+
+// New creates the HTTP handlers for the provided Keezle instance.
+func New[UA, SA models.AnyStruct](k *keezle.Keezle[UA, SA], config *Config[UA, SA]) *Handlers[UA, SA] {
+	if config == nil {
+		config = &Config[UA, SA]{}
+	}
+
+	if config.Provider == "" {
+		config.Provider = "email"
+	}
+
+	if config.IdentifierField == "" {
+		config.IdentifierField = "email"
+	}
+
+	if config.PasswordField == "" {
+		config.PasswordField = "password"
+	}
+
+	if config.RememberMeField == "" {
+		config.RememberMeField = "remember_me"
+	}
+
+	if config.NormalizeIdentifier == nil {
+		config.NormalizeIdentifier = func(identifier string) string {
+			return strings.ToLower(strings.TrimSpace(identifier))
+		}
+	}
+
+	if config.DecodeAttributes == nil && len(config.AttributeFields) > 0 {
+		config.DecodeAttributes = decodeAttributeFields[UA](config.AttributeFields, config.PasswordField)
+	}
+
+	if config.SessionParam == "" {
+		config.SessionParam = "session"
+	}
+
+	if config.RecentAuthWindow == 0 {
+		config.RecentAuthWindow = 10 * time.Minute
+	}
+
+	if config.RecentAuthLevel == 0 {
+		config.RecentAuthLevel = keezle.AuthLevelLogin
+	}
+
+	if config.Redirects == nil {
+		config.Redirects = &RedirectConfig{}
+	}
+
+	return &Handlers[UA, SA]{
+		Keezle: k,
+		Config: config,
+	}
+}
+
+// decodeAttributeFields returns an AttributeDecoder which decodes the fields into UA using its JSON
+// representation. The password is never part of the attributes.
+func decodeAttributeFields[UA models.AnyStruct](fields []string, passwordField string) AttributeDecoder[UA] {
+	return func(req *http.Request, values map[string]json.RawMessage) (*UA, error) {
+		allowed := make(map[string]json.RawMessage, len(fields))
+		for _, name := range fields {
+			if value, ok := values[name]; ok && name != passwordField {
+				allowed[name] = value
+			}
+		}
+		data, err := json.Marshal(allowed)
+		if err != nil {
+			return nil, err
+		}
+		var attributes UA
+		if err := json.Unmarshal(data, &attributes); err != nil {
+			return nil, err
+		}
+		return &attributes, nil
+	}
+}
+
+// isJSON reports whether the request body is JSON encoded.
+func isJSON(req *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// readFields reads the top-level fields of a JSON or form-encoded request body as JSON.
+// Form-encoded fields are JSON strings.
+func readFields(w http.ResponseWriter, req *http.Request) (map[string]json.RawMessage, error) {
+	req.Body = http.MaxBytesReader(w, req.Body, maxBodySize)
+	fields := map[string]json.RawMessage{}
+	if isJSON(req) {
+		if err := json.NewDecoder(req.Body).Decode(&fields); err != nil {
+			return nil, err
+		}
+		return fields, nil
+	}
+
+	if err := req.ParseForm(); err != nil {
+		return nil, err
+	}
+	for name := range req.PostForm {
+		data, err := json.Marshal(req.PostForm.Get(name))
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = data
+	}
+	return fields, nil
+}
+
+// fieldValues returns the fields as strings. Strings are unquoted, other values keep their JSON text and
+// null values are skipped.
+func fieldValues(fields map[string]json.RawMessage) url.Values {
+	values := url.Values{}
+	for name, value := range fields {
+		var s string
+		switch {
+		case json.Unmarshal(value, &s) == nil:
+			values.Set(name, s)
+		case string(value) != "null":
+			values.Set(name, string(value))
+		}
+	}
+	return values
+}
+
+// readValues reads the top-level fields of a JSON or form-encoded request body as strings.
+func readValues(w http.ResponseWriter, req *http.Request) (url.Values, error) {
+	fields, err := readFields(w, req)
+	if err != nil {
+		return nil, err
+	}
+	return fieldValues(fields), nil
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeJSON writes a JSON response with the provided status code.
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if body != nil {
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// success responds to a successful request, redirecting browser requests if a redirect is configured.
+func (h *Handlers[UA, SA]) success(w http.ResponseWriter, req *http.Request, redirect string, status int, body any) {
+	if redirect != "" && !isJSON(req) {
+		http.Redirect(w, req, redirect, http.StatusSeeOther)
+		return
+	}
+	if body == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, status, body)
+}
+
+// fail responds to a failed request with the provided error code.
+func (h *Handlers[UA, SA]) fail(w http.ResponseWriter, req *http.Request, status int, code string) {
+	if h.Config.Redirects.OnError != "" && !isJSON(req) {
+		target, err := url.Parse(h.Config.Redirects.OnError)
+		if err == nil {
+			query := target.Query()
+			query.Set("error", code)
+			target.RawQuery = query.Encode()
+			http.Redirect(w, req, target.String(), http.StatusSeeOther)
+			return
+		}
+	}
+	writeJSON(w, status, errorResponse{Error: code})
+}
+
+// failInternal logs the error and responds with an internal error.
+func (h *Handlers[UA, SA]) failInternal(w http.ResponseWriter, req *http.Request, err error) {
+	h.Keezle.Config.Logger.Log("error: httpauth: %s %s: %v", req.Method, req.URL.Path, err)
+	h.fail(w, req, http.StatusInternalServerError, ErrorInternal)
+}
+
+// handleRequest validates the request method and origin, and returns the AuthRequest for it.
+// It responds to the client and returns nil if the request cannot be handled.
+// Only POST requests are accepted unless other methods are provided.
+func (h *Handlers[UA, SA]) handleRequest(w http.ResponseWriter, req *http.Request, methods ...string) *keezle.AuthRequest[UA, SA] {
+	if len(methods) == 0 {
+		methods = []string{http.MethodPost}
+	}
+	if !slices.Contains(methods, req.Method) {
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: ErrorInvalidRequest})
+		return nil
+	}
+
+	authReq, err := h.Keezle.HandleRequest(req)
+	if err != nil {
+		if errors.Is(err, keezle.ErrInvalidRequestOrigin) {
+			h.fail(w, req, http.StatusForbidden, ErrorInvalidOrigin)
+			return nil
+		}
+		h.failInternal(w, req, err)
+		return nil
+	}
+	return authReq
+}
+
+// requireSession validates the session of the request.
+// It responds to the client and returns nil if the request has no valid session.
+func (h *Handlers[UA, SA]) requireSession(w http.ResponseWriter, req *http.Request, authReq *keezle.AuthRequest[UA, SA]) *models.Session[UA, SA] {
+	session, err := authReq.Validate()
+	if err != nil {
+		h.failInternal(w, req, err)
+		return nil
+	}
+	if session == nil {
+		h.setSessionCookie(w, nil)
+		h.fail(w, req, http.StatusUnauthorized, ErrorUnauthorized)
+		return nil
+	}
+	if session.Fresh {
+		h.setSessionCookie(w, session)
+	}
+	return session
+}
+
+// setSessionCookie sets the session cookie on the response.
+// Passing a nil session removes the session cookie.
+func (h *Handlers[UA, SA]) setSessionCookie(w http.ResponseWriter, session *models.Session[UA, SA]) {
+	http.SetCookie(w, h.Keezle.CreateSessionCookie(session))
+}
@@ -0,0 +1,278 @@
+package httpauth_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/httpauth"
+	"github.com/gaurishhs/keezle/keezletest"
+)
+
+type attributes = keezletest.Attributes
+
+var epoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// server serves the handlers of a Keezle instance on a memory adapter and a fake clock.
+type server struct {
+	*httptest.Server
+	keezle *keezle.Keezle[attributes, attributes]
+	clock  *keezletest.FakeClock
+	// compares counts the password comparisons, including those with the dummy hash.
+	compares atomic.Int32
+}
+
+func newServer(t *testing.T, session *keezle.SessionConfig, config *httpauth.Config[attributes, attributes]) *server {
+	t.Helper()
+	s := &server{clock: keezletest.NewFakeClock(epoch)}
+	s.keezle = keezle.New(&keezle.Config[attributes, attributes]{
+		Adapter: keezletest.NewMemoryAdapter[attributes, attributes](),
+		Session: session,
+		Clock:   s.clock,
+		Hash: func(password string) (string, error) {
+			return "hash:" + password, nil
+		},
+		ComparePasswordAndHash: func(password, hash string) (bool, error) {
+			s.compares.Add(1)
+			return hash == "hash:"+password, nil
+		},
+	})
+
+	h := httpauth.New(s.keezle, config)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/signup", h.SignUp)
+	mux.HandleFunc("/login", h.Login)
+	mux.HandleFunc("/logout", h.Logout)
+	mux.HandleFunc("/logout-all", h.LogoutAll)
+	mux.HandleFunc("/sessions", h.ListSessions)
+	mux.HandleFunc("/sessions/revoke", h.RevokeSession)
+	mux.HandleFunc("/sessions/{session}", h.RevokeSession)
+	mux.HandleFunc("/sessions/others", h.RevokeOtherSessions)
+	mux.HandleFunc("/reauthenticate", h.Reauthenticate)
+	mux.Handle("/sensitive", h.RequireRecentAuth(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// client is a browser of the server which keeps the session cookie.
+type client struct {
+	t       *testing.T
+	server  *server
+	session string
+}
+
+func (s *server) client(t *testing.T) *client {
+	return &client{t: t, server: s}
+}
+
+// do sends the body as JSON, or without a body if it is nil, and returns the status and the decoded response.
+func (c *client) do(method, path string, body any) (int, map[string]any) {
+	c.t.Helper()
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, c.server.URL+path, bytes.NewReader(data))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.session != "" {
+		req.AddCookie(&http.Cookie{Name: "auth_session", Value: c.session})
+	}
+	res, err := c.server.Client().Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == "auth_session" {
+			c.session = cookie.Value
+		}
+	}
+	var decoded map[string]any
+	if res.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(res.Body).Decode(&decoded); err != nil {
+			c.t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return res.StatusCode, decoded
+}
+
+func (c *client) post(path string, body any) (int, map[string]any) {
+	c.t.Helper()
+	return c.do(http.MethodPost, path, body)
+}
+
+// signUp signs up a user with the email address and the password "password".
+func (c *client) signUp(email string) string {
+	c.t.Helper()
+	status, body := c.post("/signup", map[string]any{"email": email, "password": "password"})
+	if status != http.StatusCreated {
+		c.t.Fatalf("sign-up = %d %v", status, body)
+	}
+	return body["user_id"].(string)
+}
+
+func (c *client) login(email string) {
+	c.t.Helper()
+	if status, body := c.post("/login", map[string]any{"email": email, "password": "password"}); status != http.StatusOK {
+		c.t.Fatalf("login = %d %v", status, body)
+	}
+}
+
+func TestSignUp(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   map[string]any
+		status int
+		code   string
+	}{
+		{"valid", map[string]any{"email": "u2@example.com", "password": "password", "name": "User Two"}, http.StatusCreated, ""},
+		{"existing email", map[string]any{"email": " U1@example.com", "password": "password"}, http.StatusBadRequest, httpauth.ErrorSignUpFailed},
+		{"missing password", map[string]any{"email": "u2@example.com"}, http.StatusBadRequest, httpauth.ErrorInvalidRequest},
+		{"weak password", map[string]any{"email": "u2@example.com", "password": "short"}, http.StatusBadRequest, httpauth.ErrorInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t, nil, &httpauth.Config[attributes, attributes]{
+				AttributeFields: []string{"name"},
+				ValidatePassword: func(password string) error {
+					if len(password) < 8 {
+						return keezle.ErrInvalidPassword
+					}
+					return nil
+				},
+			})
+			s.client(t).signUp("u1@example.com")
+
+			c := s.client(t)
+			status, body := c.post("/signup", tt.body)
+			if status != tt.status || (tt.code != "" && body["error"] != tt.code) {
+				t.Fatalf("sign-up = %d %v, want %d %q", status, body, tt.status, tt.code)
+			}
+			if tt.code != "" {
+				return
+			}
+			user, err := s.keezle.GetUser(body["user_id"].(string))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (*user.Attributes)["name"] != "User Two" {
+				t.Errorf("attributes = %v", *user.Attributes)
+			}
+			if status, _ := c.do(http.MethodGet, "/sessions", nil); status != http.StatusOK {
+				t.Errorf("the session of the sign-up is not valid: %d", status)
+			}
+		})
+	}
+}
+
+func TestSignUpAttributeFields(t *testing.T) {
+	s := newServer(t, nil, &httpauth.Config[attributes, attributes]{AttributeFields: []string{"name"}})
+	status, body := s.client(t).post("/signup", map[string]any{"email": "u1@example.com", "password": "password", "name": "User One", "role": "admin"})
+	if status != http.StatusCreated {
+		t.Fatalf("sign-up = %d %v", status, body)
+	}
+	user, err := s.keezle.GetUser(body["user_id"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := *user.Attributes; len(got) != 1 || got["name"] != "User One" {
+		t.Errorf("attributes = %v, want only the name", got)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		status   int
+		code     string
+	}{
+		{"valid", "u1@example.com", "password", http.StatusOK, ""},
+		{"normalized email", " U1@Example.com ", "password", http.StatusOK, ""},
+		{"wrong password", "u1@example.com", "wrong", http.StatusUnauthorized, httpauth.ErrorInvalidCredentials},
+		// Unknown users are compared with a dummy hash, so that they take as long as a wrong password.
+		{"unknown user", "u2@example.com", "password", http.StatusUnauthorized, httpauth.ErrorInvalidCredentials},
+		{"missing password", "u1@example.com", "", http.StatusBadRequest, httpauth.ErrorInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t, nil, nil)
+			userId := s.client(t).signUp("u1@example.com")
+
+			c := s.client(t)
+			s.compares.Store(0)
+			status, body := c.post("/login", map[string]any{"email": tt.email, "password": tt.password})
+			if status != tt.status || (tt.code != "" && body["error"] != tt.code) {
+				t.Fatalf("login = %d %v, want %d %q", status, body, tt.status, tt.code)
+			}
+			if compares, want := s.compares.Load(), int32(1); tt.password != "" && compares != want {
+				t.Errorf("password compared %d times, want %d", compares, want)
+			}
+			if tt.code == "" && (body["user_id"] != userId || c.session == "") {
+				t.Errorf("login = %v, session cookie %q", body, c.session)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	s := newServer(t, nil, nil)
+	c := s.client(t)
+	c.signUp("u1@example.com")
+	other := s.client(t)
+	other.login("u1@example.com")
+
+	session := c.session
+	if status, _ := c.post("/logout", nil); status != http.StatusNoContent || c.session != "" {
+		t.Fatalf("logout = %d, session cookie %q", status, c.session)
+	}
+	if _, err := s.keezle.GetSession(session); err == nil {
+		t.Error("the session was not deleted")
+	}
+	if status, _ := c.post("/logout", nil); status != http.StatusNoContent {
+		t.Errorf("logout without a session = %d", status)
+	}
+	if status, _ := other.do(http.MethodGet, "/sessions", nil); status != http.StatusOK {
+		t.Errorf("logout deleted the session of another device: %d", status)
+	}
+
+	c.login("u1@example.com")
+	if status, _ := c.post("/logout-all", nil); status != http.StatusNoContent {
+		t.Fatalf("logout from every device = %d", status)
+	}
+	if status, body := other.do(http.MethodGet, "/sessions", nil); status != http.StatusUnauthorized || body["error"] != httpauth.ErrorUnauthorized {
+		t.Errorf("session of another device after logout from every device = %d %v", status, body)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	s := newServer(t, nil, nil)
+	req, err := http.NewRequest(http.MethodGet, s.URL+"/login", strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed || res.Header.Get("Allow") != http.MethodPost {
+		t.Errorf("GET /login = %d, Allow %q", res.StatusCode, res.Header.Get("Allow"))
+	}
+}
@@ -0,0 +1,211 @@
+package httpauth
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/models"
+)
+
+type sessionResponse struct {
+	UserID    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// credentials reads the identifier and password from the request values.
+func (h *Handlers[UA, SA]) credentials(values url.Values) (identifier, password string) {
+	return h.Config.NormalizeIdentifier(values.Get(h.Config.IdentifierField)), values.Get(h.Config.PasswordField)
+}
+
+// rememberMe reports whether the request asks for a "remember me" session.
+func (h *Handlers[UA, SA]) rememberMe(values url.Values) bool {
+	switch strings.ToLower(values.Get(h.Config.RememberMeField)) {
+	case "1", "true", "on", "yes":
+		return true
+	}
+	return false
+}
+
+// createSession creates a session for the user and sets the session cookie.
+func (h *Handlers[UA, SA]) createSession(w http.ResponseWriter, req *http.Request, userId string, rememberMe bool) (*models.Session[UA, SA], error) {
+	opts := keezle.CreateSessionOptions[SA]{
+		UserId:     userId,
+		RememberMe: rememberMe,
+		Client:     h.Keezle.ClientInfo(req),
+	}
+	if h.Config.SessionAttributes != nil {
+		opts.Attributes = h.Config.SessionAttributes(req)
+	}
+	session, err := h.Keezle.CreateSession(opts)
+	if err != nil {
+		return nil, err
+	}
+	h.setSessionCookie(w, session)
+	return session, nil
+}
+
+// compareDummyHash compares the password against a fixed hash so that a login attempt for
+// an unknown account takes as long as one with a wrong password.
+func (h *Handlers[UA, SA]) compareDummyHash(password string) {
+	h.dummyHashOnce.Do(func() {
+		hash, err := h.Keezle.Config.Hash("keezle-dummy-password")
+		if err != nil {
+			h.Keezle.Config.Logger.Log("error: httpauth: failed to create dummy hash: %v", err)
+			return
+		}
+		h.dummyHash = hash
+	})
+	if h.dummyHash != "" {
+		h.Keezle.Config.ComparePasswordAndHash(password, h.dummyHash)
+	}
+}
+
+// SignUp creates a new user with a password key and logs them in.
+func (h *Handlers[UA, SA]) SignUp(w http.ResponseWriter, req *http.Request) {
+	if h.handleRequest(w, req) == nil {
+		return
+	}
+
+	fields, err := readFields(w, req)
+	if err != nil {
+		h.fail(w, req, http.StatusBadRequest, ErrorInvalidRequest)
+		return
+	}
+	values := fieldValues(fields)
+
+	identifier, password := h.credentials(values)
+	if identifier == "" || password == "" {
+		h.fail(w, req, http.StatusBadRequest, ErrorInvalidRequest)
+		return
+	}
+
+	if h.Config.ValidatePassword != nil {
+		if err := h.Config.ValidatePassword(password); err != nil {
+			h.fail(w, req, http.StatusBadRequest, ErrorInvalidRequest)
+			return
+		}
+	}
+
+	opts := keezle.CreateUserOptions[UA]{}
+	if h.Config.DecodeAttributes != nil {
+		opts.Attributes, err = h.Config.DecodeAttributes(req, fields)
+		if err != nil {
+			h.fail(w, req, http.StatusBadRequest, ErrorInvalidRequest)
+			return
+		}
+	}
+	opts.Key.Provider = h.Config.Provider
+	opts.Key.ProviderUserID = identifier
+	opts.Key.Password = password
+
+	user, err := h.Keezle.CreateUser(opts)
+	if err != nil {
+		// The most common cause is an existing key, which must not be revealed to the client.
+		h.Keezle.Config.Logger.Log("debug: httpauth: failed to create user: %v", err)
+		h.fail(w, req, http.StatusBadRequest, ErrorSignUpFailed)
+		return
+	}
+
+	session, err := h.createSession(w, req, user.ID, h.rememberMe(values))
+	if err != nil {
+		h.failInternal(w, req, err)
+		return
+	}
+
+	h.success(w, req, h.Config.Redirects.AfterSignUp, http.StatusCreated, sessionResponse{
+		UserID:    user.ID,
+		ExpiresAt: session.IdleExpiresAt,
+	})
+}
+
+// Login validates the password of a key and creates a new session for its user.
+func (h *Handlers[UA, SA]) Login(w http.ResponseWriter, req *http.Request) {
+	if h.handleRequest(w, req) == nil {
+		return
+	}
+
+	values, err := readValues(w, req)
+	if err != nil {
+		h.fail(w, req, http.StatusBadRequest, ErrorInvalidRequest)
+		return
+	}
+
+	identifier, password := h.credentials(values)
+	if identifier == "" || password == "" {
+		h.fail(w, req, http.StatusBadRequest, ErrorInvalidRequest)
+		return
+	}
+
+	key, err := h.Keezle.UseKey(h.Config.Provider, identifier, password)
+	if err != nil {
+		switch {
+		case errors.Is(err, keezle.ErrInvalidKeyId):
+			h.compareDummyHash(password)
+			h.fail(w, req, http.StatusUnauthorized, ErrorInvalidCredentials)
+		case errors.Is(err, keezle.ErrInvalidPassword):
+			h.fail(w, req, http.StatusUnauthorized, ErrorInvalidCredentials)
+		default:
+			h.failInternal(w, req, err)
+		}
+		return
+	}
+
+	session, err := h.createSession(w, req, key.UserID, h.rememberMe(values))
+	if err != nil {
+		if errors.Is(err, keezle.ErrSessionLimitReached) {
+			h.fail(w, req, http.StatusForbidden, ErrorSessionLimit)
+			return
+		}
+		h.failInternal(w, req, err)
+		return
+	}
+
+	h.success(w, req, h.Config.Redirects.AfterLogin, http.StatusOK, sessionResponse{
+		UserID:    key.UserID,
+		ExpiresAt: session.IdleExpiresAt,
+	})
+}
+
+// Logout deletes the current session and removes the session cookie.
+// It succeeds even if the request has no session.
+func (h *Handlers[UA, SA]) Logout(w http.ResponseWriter, req *http.Request) {
+	authReq := h.handleRequest(w, req)
+	if authReq == nil {
+		return
+	}
+
+	if authReq.SessionID != nil {
+		if err := h.Keezle.DeleteSession(*authReq.SessionID); err != nil {
+			h.failInternal(w, req, err)
+			return
+		}
+	}
+
+	h.setSessionCookie(w, nil)
+	h.success(w, req, h.Config.Redirects.AfterLogout, http.StatusNoContent, nil)
+}
+
+// LogoutAll deletes every session of the current user and removes the session cookie.
+func (h *Handlers[UA, SA]) LogoutAll(w http.ResponseWriter, req *http.Request) {
+	authReq := h.handleRequest(w, req)
+	if authReq == nil {
+		return
+	}
+
+	session := h.requireSession(w, req, authReq)
+	if session == nil {
+		return
+	}
+
+	if err := h.Keezle.DeleteAllUserSessions(session.User.ID); err != nil {
+		h.failInternal(w, req, err)
+		return
+	}
+
+	h.setSessionCookie(w, nil)
+	h.success(w, req, h.Config.Redirects.AfterLogout, http.StatusNoContent, nil)
+}
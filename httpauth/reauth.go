@@ -0,0 +1,112 @@
+package httpauth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+)
+
+type reauthResponse struct {
+	AuthenticatedAt time.Time `json:"authenticated_at"`
+	AuthLevel       int       `json:"auth_level"`
+}
+
+// Reauthenticate elevates the current session after the user re-entered their password.
+// The password is verified with the user's key of Config.Provider, the identifier field is ignored.
+func (h *Handlers[UA, SA]) Reauthenticate(w http.ResponseWriter, req *http.Request) {
+	authReq := h.handleRequest(w, req)
+	if authReq == nil {
+		return
+	}
+
+	session := h.requireSession(w, req, authReq)
+	if session == nil {
+		return
+	}
+
+	values, err := readValues(w, req)
+	if err != nil {
+		h.fail(w, req, http.StatusBadRequest, ErrorInvalidRequest)
+		return
+	}
+
+	_, password := h.credentials(values)
+	if password == "" {
+		h.fail(w, req, http.StatusBadRequest, ErrorInvalidRequest)
+		return
+	}
+	identifier, err := h.providerUserId(session.User.ID)
+	if err != nil {
+		h.failInternal(w, req, err)
+		return
+	}
+
+	elevated, err := h.Keezle.ElevateSession(session.ID, keezle.ElevateSessionOptions{
+		Provider:       h.Config.Provider,
+		ProviderUserID: identifier,
+		Password:       password,
+		Client:         authReq.Client,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, keezle.ErrInvalidKeyId), errors.Is(err, keezle.ErrInvalidPassword):
+			h.fail(w, req, http.StatusUnauthorized, ErrorInvalidCredentials)
+		default:
+			h.failInternal(w, req, err)
+		}
+		return
+	}
+
+	h.success(w, req, h.Config.Redirects.AfterReauthenticate, http.StatusOK, reauthResponse{
+		AuthenticatedAt: elevated.AuthenticatedAt,
+		AuthLevel:       elevated.AuthLevel,
+	})
+}
+
+// providerUserId returns the provider user id of the user's key of Config.Provider.
+// It returns an empty string if the user has no such key, which fails the elevation.
+func (h *Handlers[UA, SA]) providerUserId(userId string) (string, error) {
+	keys, err := h.Keezle.GetKeysByUser(userId)
+	if err != nil {
+		return "", err
+	}
+	prefix := h.Config.Provider + ":"
+	for _, key := range keys {
+		if providerUserId, ok := strings.CutPrefix(key.ID, prefix); ok {
+			return providerUserId, nil
+		}
+	}
+	return "", nil
+}
+
+// RequireRecentAuth wraps a handler for a sensitive action, so that it is only called if the user has
+// authenticated with at least Config.RecentAuthLevel within Config.RecentAuthWindow.
+// Other requests are rejected with 401 Unauthorized if they have no session and 403 Forbidden otherwise,
+// in which case the client should call Reauthenticate and retry.
+func (h *Handlers[UA, SA]) RequireRecentAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		authReq, err := h.Keezle.HandleRequest(req)
+		if err != nil {
+			if errors.Is(err, keezle.ErrInvalidRequestOrigin) {
+				h.fail(w, req, http.StatusForbidden, ErrorInvalidOrigin)
+				return
+			}
+			h.failInternal(w, req, err)
+			return
+		}
+
+		session := h.requireSession(w, req, authReq)
+		if session == nil {
+			return
+		}
+
+		if !h.Keezle.IsRecentlyAuthenticated(session, h.Config.RecentAuthLevel, h.Config.RecentAuthWindow) {
+			h.fail(w, req, http.StatusForbidden, ErrorReauthRequired)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,96 @@
+package httpauth_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/httpauth"
+)
+
+func TestRequireRecentAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   int
+		elapsed time.Duration
+		status  int
+	}{
+		{"recent login", keezle.AuthLevelLogin, 9 * time.Minute, http.StatusNoContent},
+		{"login outside the window", keezle.AuthLevelLogin, 10 * time.Minute, http.StatusForbidden},
+		{"login below the level", keezle.AuthLevelElevated, 0, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t, nil, &httpauth.Config[attributes, attributes]{RecentAuthLevel: tt.level})
+			c := s.client(t)
+			if status, _ := c.post("/sensitive", nil); status != http.StatusUnauthorized {
+				t.Errorf("sensitive action without a session = %d", status)
+			}
+			c.signUp("u1@example.com")
+			s.clock.Advance(tt.elapsed)
+			status, body := c.post("/sensitive", nil)
+			if status != tt.status || (status == http.StatusForbidden && body["error"] != httpauth.ErrorReauthRequired) {
+				t.Errorf("sensitive action = %d %v, want %d", status, body, tt.status)
+			}
+		})
+	}
+}
+
+func TestReauthenticate(t *testing.T) {
+	s := newServer(t, nil, &httpauth.Config[attributes, attributes]{RecentAuthLevel: keezle.AuthLevelElevated})
+	c := s.client(t)
+	c.signUp("u1@example.com")
+	s.clock.Advance(time.Hour)
+
+	if status, body := c.post("/reauthenticate", map[string]any{"password": "wrong"}); status != http.StatusUnauthorized || body["error"] != httpauth.ErrorInvalidCredentials {
+		t.Errorf("reauthentication with a wrong password = %d %v", status, body)
+	}
+	if status, _ := c.post("/sensitive", nil); status != http.StatusForbidden {
+		t.Errorf("sensitive action after a failed reauthentication = %d", status)
+	}
+
+	status, body := c.post("/reauthenticate", map[string]any{"password": "password"})
+	if status != http.StatusOK || body["auth_level"] != float64(keezle.AuthLevelElevated) {
+		t.Fatalf("reauthentication = %d %v", status, body)
+	}
+	if status, _ := c.post("/sensitive", nil); status != http.StatusNoContent {
+		t.Errorf("sensitive action after reauthentication = %d", status)
+	}
+	s.clock.Advance(10 * time.Minute)
+	if status, _ := c.post("/sensitive", nil); status != http.StatusForbidden {
+		t.Errorf("sensitive action after the window = %d", status)
+	}
+}
+
+func TestReauthenticateOtherUser(t *testing.T) {
+	s := newServer(t, nil, nil)
+	if status, _ := s.client(t).post("/signup", map[string]any{"email": "victim@example.com", "password": "victim password"}); status != http.StatusCreated {
+		t.Fatalf("sign-up = %d", status)
+	}
+	c := s.client(t)
+	c.signUp("u1@example.com")
+
+	var (
+		mu     sync.Mutex
+		logins []string
+	)
+	s.keezle.Events.Subscribe(keezle.EventAll, func(event keezle.Event) error {
+		if event, ok := event.(*keezle.LoginEvent); ok {
+			mu.Lock()
+			defer mu.Unlock()
+			logins = append(logins, event.ProviderUserID)
+		}
+		return nil
+	})
+
+	// The identifier is ignored, the password is checked with the key of the session's user.
+	status, _ := c.post("/reauthenticate", map[string]any{"email": "victim@example.com", "password": "victim password"})
+	if status != http.StatusUnauthorized {
+		t.Errorf("reauthentication with the password of another user = %d", status)
+	}
+	if len(logins) != 1 || logins[0] != "u1@example.com" {
+		t.Errorf("logins = %v, want the key of the session's user", logins)
+	}
+}
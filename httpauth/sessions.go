@@ -0,0 +1,177 @@
+package httpauth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/models"
+	"github.com/gaurishhs/keezle/utils"
+)
+
+// SessionHandle returns the public handle of a session.
+// Session ids are bearer credentials and must never be sent to the client for sessions other than
+// the current one, so the session endpoints identify sessions by a hash of their id instead.
+func SessionHandle(sessionId string) string {
+	sum := sha256.Sum256([]byte(sessionId))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type sessionInfo struct {
+	ID              string    `json:"id"`
+	Current         bool      `json:"current"`
+	State           string    `json:"state"`
+	ActiveExpiresAt time.Time `json:"active_expires_at"`
+	IdleExpiresAt   time.Time `json:"idle_expires_at"`
+	CreatedAt       time.Time `json:"created_at"`
+	LastSeenAt      time.Time `json:"last_seen_at"`
+	IPAddress       string    `json:"ip_address,omitempty"`
+	UserAgent       string    `json:"user_agent,omitempty"`
+	Device          string    `json:"device"`
+}
+
+type sessionsResponse struct {
+	Sessions []sessionInfo `json:"sessions"`
+}
+
+// getUserSessions returns the sessions of the user. It responds to the client and returns false if they can
+// not be read. Stateless sessions are not stored and can not be listed, so the session endpoints respond as if
+// they were not registered.
+func (h *Handlers[UA, SA]) getUserSessions(w http.ResponseWriter, req *http.Request, userId string) ([]*models.Session[UA, SA], bool) {
+	sessions, err := h.Keezle.GetAllUserSessions(userId)
+	if err != nil {
+		if errors.Is(err, keezle.ErrStatelessSession) {
+			h.fail(w, req, http.StatusNotFound, ErrorNotSupported)
+			return nil, false
+		}
+		h.failInternal(w, req, err)
+		return nil, false
+	}
+	return sessions, true
+}
+
+// ListSessions lists the valid sessions of the current user, marking the session of the request
+// as the current one.
+func (h *Handlers[UA, SA]) ListSessions(w http.ResponseWriter, req *http.Request) {
+	authReq := h.handleRequest(w, req, http.MethodGet, http.MethodHead)
+	if authReq == nil {
+		return
+	}
+
+	current := h.requireSession(w, req, authReq)
+	if current == nil {
+		return
+	}
+
+	sessions, ok := h.getUserSessions(w, req, current.User.ID)
+	if !ok {
+		return
+	}
+
+	res := sessionsResponse{
+		Sessions: make([]sessionInfo, 0, len(sessions)),
+	}
+	for _, session := range sessions {
+		res.Sessions = append(res.Sessions, sessionInfo{
+			ID:              SessionHandle(session.ID),
+			Current:         session.ID == current.ID,
+			State:           session.State,
+			ActiveExpiresAt: session.ActiveExpiresAt,
+			IdleExpiresAt:   session.IdleExpiresAt,
+			CreatedAt:       session.CreatedAt,
+			LastSeenAt:      session.LastSeenAt,
+			IPAddress:       session.IPAddress,
+			UserAgent:       session.UserAgent,
+			Device:          utils.DescribeUserAgent(session.UserAgent),
+		})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// RevokeSession revokes a single session of the current user.
+// The session handle is read from the path value named by Config.SessionParam, falling back to
+// the request field of the same name. Sessions of other users are reported as not found.
+func (h *Handlers[UA, SA]) RevokeSession(w http.ResponseWriter, req *http.Request) {
+	authReq := h.handleRequest(w, req, http.MethodPost, http.MethodDelete)
+	if authReq == nil {
+		return
+	}
+
+	current := h.requireSession(w, req, authReq)
+	if current == nil {
+		return
+	}
+
+	handle := req.PathValue(h.Config.SessionParam)
+	if handle == "" && req.Method == http.MethodPost {
+		values, err := readValues(w, req)
+		if err != nil {
+			h.fail(w, req, http.StatusBadRequest, ErrorInvalidRequest)
+			return
+		}
+		handle = values.Get(h.Config.SessionParam)
+	}
+	if handle == "" {
+		h.fail(w, req, http.StatusBadRequest, ErrorInvalidRequest)
+		return
+	}
+
+	sessions, ok := h.getUserSessions(w, req, current.User.ID)
+	if !ok {
+		return
+	}
+
+	var target *models.Session[UA, SA]
+	for _, session := range sessions {
+		if SessionHandle(session.ID) == handle {
+			target = session
+			break
+		}
+	}
+	if target == nil {
+		h.fail(w, req, http.StatusNotFound, ErrorNotFound)
+		return
+	}
+
+	if err := h.Keezle.DeleteSession(target.ID); err != nil {
+		h.failInternal(w, req, err)
+		return
+	}
+
+	if target.ID == current.ID {
+		h.setSessionCookie(w, nil)
+	}
+	h.success(w, req, "", http.StatusNoContent, nil)
+}
+
+// RevokeOtherSessions revokes every session of the current user except the session of the request.
+func (h *Handlers[UA, SA]) RevokeOtherSessions(w http.ResponseWriter, req *http.Request) {
+	authReq := h.handleRequest(w, req, http.MethodPost, http.MethodDelete)
+	if authReq == nil {
+		return
+	}
+
+	current := h.requireSession(w, req, authReq)
+	if current == nil {
+		return
+	}
+
+	sessions, ok := h.getUserSessions(w, req, current.User.ID)
+	if !ok {
+		return
+	}
+
+	for _, session := range sessions {
+		if session.ID == current.ID {
+			continue
+		}
+		if err := h.Keezle.DeleteSession(session.ID); err != nil {
+			h.failInternal(w, req, err)
+			return
+		}
+	}
+	h.success(w, req, "", http.StatusNoContent, nil)
+}
@@ -0,0 +1,142 @@
+package httpauth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/httpauth"
+	"github.com/gaurishhs/keezle/jwt"
+)
+
+// listSessions returns the listed sessions by handle.
+func (c *client) listSessions() map[string]map[string]any {
+	c.t.Helper()
+	status, body := c.do(http.MethodGet, "/sessions", nil)
+	if status != http.StatusOK {
+		c.t.Fatalf("list sessions = %d %v", status, body)
+	}
+	sessions := map[string]map[string]any{}
+	for _, session := range body["sessions"].([]any) {
+		session := session.(map[string]any)
+		sessions[session["id"].(string)] = session
+	}
+	return sessions
+}
+
+func TestListSessions(t *testing.T) {
+	s := newServer(t, nil, nil)
+	c := s.client(t)
+	c.signUp("u1@example.com")
+	other := s.client(t)
+	other.login("u1@example.com")
+	s.client(t).signUp("u2@example.com")
+
+	sessions := c.listSessions()
+	if len(sessions) != 2 {
+		t.Fatalf("sessions = %v, want the two sessions of the user", sessions)
+	}
+	for _, id := range []string{c.session, other.session} {
+		session, ok := sessions[httpauth.SessionHandle(id)]
+		if !ok {
+			t.Fatalf("session %s is not listed by its handle", id)
+		}
+		if session["current"] != (id == c.session) {
+			t.Errorf("session %v, current = %v", session, session["current"])
+		}
+	}
+	if _, ok := sessions[c.session]; ok {
+		t.Error("a session is listed by its id")
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	s := newServer(t, nil, nil)
+	c := s.client(t)
+	c.signUp("u1@example.com")
+	other := s.client(t)
+	other.login("u1@example.com")
+	stranger := s.client(t)
+	stranger.signUp("u2@example.com")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   any
+		status int
+	}{
+		{"session of another user", http.MethodDelete, "/sessions/" + httpauth.SessionHandle(stranger.session), nil, http.StatusNotFound},
+		{"session id instead of handle", http.MethodDelete, "/sessions/" + other.session, nil, http.StatusNotFound},
+		{"missing handle", http.MethodPost, "/sessions/revoke", map[string]any{}, http.StatusBadRequest},
+		{"request field", http.MethodPost, "/sessions/revoke", map[string]any{"session": httpauth.SessionHandle(other.session)}, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, body := c.do(tt.method, tt.path, tt.body); status != tt.status {
+				t.Errorf("revoke = %d %v, want %d", status, body, tt.status)
+			}
+		})
+	}
+
+	if status, _ := other.do(http.MethodGet, "/sessions", nil); status != http.StatusUnauthorized {
+		t.Errorf("revoked session = %d", status)
+	}
+	if status, _ := stranger.do(http.MethodGet, "/sessions", nil); status != http.StatusOK {
+		t.Errorf("session of another user = %d", status)
+	}
+
+	// Revoking the current session removes its cookie.
+	if status, _ := c.do(http.MethodDelete, "/sessions/"+httpauth.SessionHandle(c.session), nil); status != http.StatusNoContent || c.session != "" {
+		t.Errorf("revoking the current session = %d, session cookie %q", status, c.session)
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	s := newServer(t, nil, nil)
+	c := s.client(t)
+	c.signUp("u1@example.com")
+	others := []*client{s.client(t), s.client(t)}
+	for _, other := range others {
+		other.login("u1@example.com")
+	}
+
+	if status, _ := c.post("/sessions/others", nil); status != http.StatusNoContent {
+		t.Fatalf("revoke other sessions = %d", status)
+	}
+	if sessions := c.listSessions(); len(sessions) != 1 {
+		t.Errorf("sessions = %v, want the current session", sessions)
+	}
+	for _, other := range others {
+		if status, _ := other.do(http.MethodGet, "/sessions", nil); status != http.StatusUnauthorized {
+			t.Errorf("other session = %d", status)
+		}
+	}
+}
+
+func TestSessionsStateless(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(t, &keezle.SessionConfig{
+		ActivePeriod: time.Hour,
+		IdlePeriod:   time.Hour,
+		Stateless:    &keezle.StatelessConfig{Keys: jwt.NewKeySet(jwt.NewEd25519Key("k1", privateKey))},
+	}, nil)
+	c := s.client(t)
+	c.signUp("u1@example.com")
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/sessions"},
+		{http.MethodDelete, "/sessions/" + httpauth.SessionHandle(c.session)},
+		{http.MethodPost, "/sessions/others"},
+	} {
+		if status, body := c.do(req.method, req.path, nil); status != http.StatusNotFound || body["error"] != httpauth.ErrorNotSupported {
+			t.Errorf("%s %s = %d %v, want %d %q", req.method, req.path, status, body, http.StatusNotFound, httpauth.ErrorNotSupported)
+		}
+	}
+}
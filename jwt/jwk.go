@@ -0,0 +1,153 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+var ErrUnsupportedKey = errors.New("jwt: unsupported key")
+
+// JWK is a public JSON Web Key, as defined in RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	Use       string `json:"use,omitempty"`
+	// N and E are the modulus and exponent of RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Curve, X and Y are the curve and coordinates of EC and OKP keys.
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+// JWKSet is a JSON Web Key Set.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(b) == 0 {
+		return nil, ErrUnsupportedKey
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Key returns the verification key of the JWK. Keys without an algorithm get the algorithm of their type.
+// It returns ErrUnsupportedKey for keys of other types, curves or algorithms.
+func (j *JWK) Key() (*Key, error) {
+	switch j.KeyType {
+	case "RSA":
+		if j.Algorithm != "" && j.Algorithm != RS256 {
+			return nil, ErrUnsupportedKey
+		}
+		n, err := decodeBigInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(j.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, ErrUnsupportedKey
+		}
+		return NewRSAVerificationKey(j.KeyID, &rsa.PublicKey{N: n, E: int(e.Int64())}), nil
+	case "EC":
+		if j.Curve != "P-256" || (j.Algorithm != "" && j.Algorithm != ES256) {
+			return nil, ErrUnsupportedKey
+		}
+		x, err := decodeBigInt(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, ErrUnsupportedKey
+		}
+		return NewECDSAVerificationKey(j.KeyID, &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}), nil
+	case "OKP":
+		if j.Curve != "Ed25519" || (j.Algorithm != "" && j.Algorithm != EdDSA) {
+			return nil, ErrUnsupportedKey
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, ErrUnsupportedKey
+		}
+		return NewEd25519VerificationKey(j.KeyID, ed25519.PublicKey(x)), nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// ParseJWKSet parses a JSON Web Key Set into a key set for verification.
+// Unsupported keys and keys which are not meant for signatures are skipped.
+func ParseJWKSet(data []byte) (*KeySet, error) {
+	var set JWKSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := NewKeySet()
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.Key()
+		if err != nil {
+			continue
+		}
+		keys.Add(key)
+	}
+	return keys, nil
+}
+
+func encodeBigInt(value *big.Int, size int) string {
+	return base64.RawURLEncoding.EncodeToString(value.FillBytes(make([]byte, size)))
+}
+
+// JWK returns the public JWK of the key, so that other services can verify the tokens signed with it.
+// It returns ErrUnsupportedKey for HS256 keys, whose secret must never be published.
+func (k *Key) JWK() (*JWK, error) {
+	jwk := &JWK{KeyID: k.ID, Algorithm: k.Algorithm, Use: "sig"}
+	switch {
+	case k.Algorithm == RS256 && k.RSAPublicKey != nil:
+		jwk.KeyType = "RSA"
+		jwk.N = encodeBigInt(k.RSAPublicKey.N, (k.RSAPublicKey.N.BitLen()+7)/8)
+		e := big.NewInt(int64(k.RSAPublicKey.E))
+		jwk.E = encodeBigInt(e, (e.BitLen()+7)/8)
+	case k.Algorithm == ES256 && k.ECDSAPublicKey != nil && k.ECDSAPublicKey.Curve == elliptic.P256():
+		jwk.KeyType = "EC"
+		jwk.Curve = "P-256"
+		jwk.X = encodeBigInt(k.ECDSAPublicKey.X, 32)
+		jwk.Y = encodeBigInt(k.ECDSAPublicKey.Y, 32)
+	case k.Algorithm == EdDSA && len(k.PublicKey) == ed25519.PublicKeySize:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(k.PublicKey)
+	default:
+		return nil, ErrUnsupportedKey
+	}
+	return jwk, nil
+}
+
+// JWKSet returns the public keys of the set as a JSON Web Key Set. Keys which can not be published are
+// skipped.
+func (s *KeySet) JWKSet() *JWKSet {
+	set := &JWKSet{Keys: []JWK{}}
+	for _, key := range s.Keys() {
+		if jwk, err := key.JWK(); err == nil {
+			set.Keys = append(set.Keys, *jwk)
+		}
+	}
+	slices.SortFunc(set.Keys, func(a, b JWK) int { return strings.Compare(a.KeyID, b.KeyID) })
+	return set
+}
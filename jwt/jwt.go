@@ -0,0 +1,206 @@
+// Package jwt signs and verifies compact JSON Web Tokens using HMAC (HS256), Ed25519 (EdDSA), RSA (RS256) or
+// ECDSA P-256 (ES256) keys.
+// Keys are identified by a key id which is written to the "kid" header, so that signing keys can be
+// rotated while tokens signed with older keys are still accepted.
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Supported algorithms.
+const (
+	HS256 = "HS256"
+	EdDSA = "EdDSA"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+var (
+	ErrInvalidToken     = errors.New("jwt: invalid token")
+	ErrUnknownKey       = errors.New("jwt: unknown key id")
+	ErrInvalidSignature = errors.New("jwt: invalid signature")
+	ErrNoSigningKey     = errors.New("jwt: no signing key")
+	ErrExpired          = errors.New("jwt: token expired")
+	ErrNotYetValid      = errors.New("jwt: token not yet valid")
+)
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// Sign signs the claims with the key and returns the compact token.
+func Sign(key *Key, claims any) (string, error) {
+	if key == nil || !key.CanSign() {
+		return "", ErrNoSigningKey
+	}
+
+	headerJSON, err := json.Marshal(header{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	signature, err := key.sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Parse verifies the signature of the token with the key named by its "kid" header and decodes the claims.
+// The algorithm of the token must match the algorithm of the key. Parse does not validate the claims.
+func Parse(keys *KeySet, token string, claims any) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidToken
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	var h header
+	if err := json.Unmarshal(headerJSON, &h); err != nil {
+		return ErrInvalidToken
+	}
+
+	key := keys.Key(h.KeyID)
+	if key == nil {
+		return ErrUnknownKey
+	}
+	if h.Algorithm != key.Algorithm {
+		return ErrInvalidSignature
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return ErrInvalidSignature
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := json.Unmarshal(claimsJSON, claims); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// Audience is the audience claim, which may be a single string or an array of strings.
+type Audience []string
+
+// UnmarshalJSON accepts both forms of the audience claim.
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var audience string
+	if err := json.Unmarshal(data, &audience); err == nil {
+		*a = Audience{audience}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// RegisteredClaims holds the registered claims of RFC 7519. Times are Unix timestamps in seconds.
+type RegisteredClaims struct {
+	ID        string   `json:"jti,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+}
+
+// Validate checks the time based claims at now, allowing for the clock skew given by leeway.
+func (c *RegisteredClaims) Validate(now time.Time, leeway time.Duration) error {
+	if c.ExpiresAt != 0 && !now.Add(-leeway).Before(time.Unix(c.ExpiresAt, 0)) {
+		return ErrExpired
+	}
+	if c.NotBefore != 0 && now.Add(leeway).Before(time.Unix(c.NotBefore, 0)) {
+		return ErrNotYetValid
+	}
+	return nil
+}
+
+// HasAudience reports whether the audience claim contains the audience.
+func (c *RegisteredClaims) HasAudience(audience string) bool {
+	for _, aud := range c.Audience {
+		if aud == audience {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *Key) sign(signingInput []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write(signingInput)
+		return mac.Sum(nil), nil
+	case EdDSA:
+		return ed25519.Sign(k.PrivateKey, signingInput), nil
+	case RS256:
+		digest := sha256.Sum256(signingInput)
+		return rsa.SignPKCS1v15(rand.Reader, k.RSAPrivateKey, crypto.SHA256, digest[:])
+	case ES256:
+		digest := sha256.Sum256(signingInput)
+		r, s, err := ecdsa.Sign(rand.Reader, k.ECDSAPrivateKey, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		// ES256 signatures are the fixed size big-endian encodings of r and s, as defined in RFC 7518.
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+	}
+	return nil, ErrNoSigningKey
+}
+
+func (k *Key) verify(signingInput, signature []byte) bool {
+	switch k.Algorithm {
+	case HS256:
+		if len(k.Secret) == 0 {
+			return false
+		}
+		expected, err := k.sign(signingInput)
+		return err == nil && hmac.Equal(expected, signature)
+	case EdDSA:
+		return len(k.PublicKey) == ed25519.PublicKeySize && ed25519.Verify(k.PublicKey, signingInput, signature)
+	case RS256:
+		digest := sha256.Sum256(signingInput)
+		return k.RSAPublicKey != nil && rsa.VerifyPKCS1v15(k.RSAPublicKey, crypto.SHA256, digest[:], signature) == nil
+	case ES256:
+		if k.ECDSAPublicKey == nil || len(signature) != 64 {
+			return false
+		}
+		digest := sha256.Sum256(signingInput)
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(k.ECDSAPublicKey, digest[:], r, s)
+	}
+	return false
+}
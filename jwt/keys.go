@@ -0,0 +1,175 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"sync"
+)
+
+// Key is a key used to sign or verify tokens.
+type Key struct {
+	// ID is the key id written to the "kid" header of signed tokens.
+	ID        string
+	Algorithm string
+	// Secret is the shared secret of HS256 keys.
+	Secret []byte
+	// PrivateKey is the private key of EdDSA keys, it is only required for signing.
+	PrivateKey ed25519.PrivateKey
+	// PublicKey is the public key of EdDSA keys.
+	PublicKey ed25519.PublicKey
+	// RSAPrivateKey is the private key of RS256 keys, it is only required for signing.
+	RSAPrivateKey *rsa.PrivateKey
+	// RSAPublicKey is the public key of RS256 keys.
+	RSAPublicKey *rsa.PublicKey
+	// ECDSAPrivateKey is the P-256 private key of ES256 keys, it is only required for signing.
+	ECDSAPrivateKey *ecdsa.PrivateKey
+	// ECDSAPublicKey is the P-256 public key of ES256 keys.
+	ECDSAPublicKey *ecdsa.PublicKey
+}
+
+// NewHMACKey returns a HS256 key. The secret should be at least 32 random bytes.
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, Algorithm: HS256, Secret: secret}
+}
+
+// NewEd25519Key returns an EdDSA key which can sign and verify tokens.
+func NewEd25519Key(id string, privateKey ed25519.PrivateKey) *Key {
+	return &Key{
+		ID:         id,
+		Algorithm:  EdDSA,
+		PrivateKey: privateKey,
+		PublicKey:  privateKey.Public().(ed25519.PublicKey),
+	}
+}
+
+// NewEd25519VerificationKey returns an EdDSA key which can only verify tokens, e.g. on edge services
+// which must not be able to issue tokens.
+func NewEd25519VerificationKey(id string, publicKey ed25519.PublicKey) *Key {
+	return &Key{ID: id, Algorithm: EdDSA, PublicKey: publicKey}
+}
+
+// NewRSAKey returns a RS256 key which can sign and verify tokens.
+func NewRSAKey(id string, privateKey *rsa.PrivateKey) *Key {
+	return &Key{ID: id, Algorithm: RS256, RSAPrivateKey: privateKey, RSAPublicKey: &privateKey.PublicKey}
+}
+
+// NewRSAVerificationKey returns a RS256 key which can only verify tokens.
+func NewRSAVerificationKey(id string, publicKey *rsa.PublicKey) *Key {
+	return &Key{ID: id, Algorithm: RS256, RSAPublicKey: publicKey}
+}
+
+// NewECDSAKey returns an ES256 key which can sign and verify tokens. The key must use the P-256 curve.
+func NewECDSAKey(id string, privateKey *ecdsa.PrivateKey) *Key {
+	return &Key{ID: id, Algorithm: ES256, ECDSAPrivateKey: privateKey, ECDSAPublicKey: &privateKey.PublicKey}
+}
+
+// NewECDSAVerificationKey returns an ES256 key which can only verify tokens. The key must use the P-256 curve.
+func NewECDSAVerificationKey(id string, publicKey *ecdsa.PublicKey) *Key {
+	return &Key{ID: id, Algorithm: ES256, ECDSAPublicKey: publicKey}
+}
+
+// CanSign reports whether the key holds the private key or secret required for signing. Verification keys
+// can not sign.
+func (k *Key) CanSign() bool {
+	switch k.Algorithm {
+	case HS256:
+		return len(k.Secret) > 0
+	case EdDSA:
+		return len(k.PrivateKey) == ed25519.PrivateKeySize
+	case RS256:
+		return k.RSAPrivateKey != nil
+	case ES256:
+		return k.ECDSAPrivateKey != nil && k.ECDSAPrivateKey.Curve == elliptic.P256()
+	}
+	return false
+}
+
+// KeySet holds the keys accepted for verification and the key used for signing.
+// Keys are rotated by adding the new key, making it the signing key once every verifier knows it and
+// removing the old key after the tokens signed with it have expired.
+// It is safe for concurrent use, and the zero value is an empty set.
+type KeySet struct {
+	mu         sync.RWMutex
+	keys       map[string]*Key
+	signingKey string
+}
+
+// NewKeySet returns a key set holding the keys, signing with the first one.
+func NewKeySet(keys ...*Key) *KeySet {
+	set := &KeySet{keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		set.keys[key.ID] = key
+	}
+	if len(keys) > 0 {
+		set.signingKey = keys[0].ID
+	}
+	return set
+}
+
+// Add adds a key to the set. A key with the same id is replaced.
+func (s *KeySet) Add(key *Key) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil {
+		s.keys = map[string]*Key{}
+	}
+	s.keys[key.ID] = key
+}
+
+// Remove removes the key from the set.
+func (s *KeySet) Remove(keyId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, keyId)
+	if s.signingKey == keyId {
+		s.signingKey = ""
+	}
+}
+
+// SetSigningKey selects the key used for signing. It returns ErrUnknownKey if the set has no such key.
+func (s *KeySet) SetSigningKey(keyId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[keyId]; !ok {
+		return ErrUnknownKey
+	}
+	s.signingKey = keyId
+	return nil
+}
+
+// Key returns the key with the id, or nil.
+func (s *KeySet) Key(keyId string) *Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys[keyId]
+}
+
+// Keys returns the keys of the set.
+func (s *KeySet) Keys() []*Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]*Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// SigningKey returns the key used for signing, or nil.
+func (s *KeySet) SigningKey() *Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys[s.signingKey]
+}
+
+// Sign signs the claims with the signing key of the set.
+func (s *KeySet) Sign(claims any) (string, error) {
+	return Sign(s.SigningKey(), claims)
+}
+
+// Parse verifies the token with the keys of the set and decodes its claims.
+func (s *KeySet) Parse(token string, claims any) error {
+	return Parse(s, token, claims)
+}
@@ -5,6 +5,7 @@
 package keezle
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/gaurishhs/keezle/adapters"
@@ -14,17 +15,63 @@ import (
 )
 
 // SessionCookieConfig defines the configuration for session cookies.
+// Cookies of "remember me" sessions expire with the session if Expires is set, otherwise after a year.
+// Cookies of regular sessions never set an expiry and are removed when the browser is closed.
 type SessionCookieConfig struct {
-	Expires bool
-	Name    string
-	Secure  bool
+	Expires  bool
+	Name     string
+	Secure   bool
+	Domain   string
+	Path     string
+	SameSite http.SameSite
 }
 
+// RememberMeConfig defines the lifetime of "remember me" sessions.
+type RememberMeConfig struct {
+	ActivePeriod time.Duration
+	IdlePeriod   time.Duration
+}
+
+// SessionLimit defines the maximum number of concurrent sessions per user.
+type SessionLimit = adapters.SessionLimit
+
+// SessionLimitStrategy defines what happens when a user with the maximum number of sessions logs in again.
+type SessionLimitStrategy = adapters.SessionLimitStrategy
+
+// Session limit strategies.
+const (
+	SessionLimitReject                 = adapters.SessionLimitReject
+	SessionLimitEvictOldest            = adapters.SessionLimitEvictOldest
+	SessionLimitEvictLeastRecentlyUsed = adapters.SessionLimitEvictLeastRecentlyUsed
+)
+
 // SessionConfig defines the configuration for user sessions.
+// ActivePeriod and IdlePeriod apply to regular sessions, which use a browser-session cookie.
+// Sessions created with the RememberMe option use the periods from RememberMe instead.
 type SessionConfig struct {
 	ActivePeriod time.Duration
 	IdlePeriod   time.Duration
+	RememberMe   *RememberMeConfig
 	Cookie       *SessionCookieConfig
+	// MaxLifetime is the absolute lifetime of a session after which the user has to log in again,
+	// regardless of activity. Zero disables the limit.
+	MaxLifetime time.Duration
+	// RotationPeriod is the interval after which the session id is replaced by a new one when the session
+	// is validated. Zero disables rotation.
+	RotationPeriod time.Duration
+	// RotationGracePeriod is how long a rotated session id stays valid, defaults to 30 seconds.
+	RotationGracePeriod time.Duration
+	// RenewalThreshold is the fraction of the active period which has to elapse before a validated session
+	// is renewed, defaults to 0.5. Lower values keep expiries closer to the last request at the cost of more
+	// database writes, 1 only renews idle sessions.
+	RenewalThreshold float64
+	// Limit caps the number of concurrent sessions per user. Adapters implementing adapters.SessionLimiter
+	// enforce it atomically, for other adapters racing logins may briefly exceed it.
+	Limit *SessionLimit
+	// Binding binds new sessions to characteristics of the client which created them.
+	Binding *BindingConfig
+	// Stateless enables stateless sessions, see StatelessConfig.
+	Stateless *StatelessConfig
 }
 
 type CSRFProtectionConfig struct {
@@ -42,6 +89,18 @@ type Config[UA, SA models.AnyStruct] struct {
 	GetUserAttributes      func(user *models.User[UA]) (*UA, error)
 	GetSessionAttributes   func(dbSession *models.DBSession[SA]) (*SA, error)
 	CSRF                   *CSRFProtectionConfig
+	// Clock tells the current time, defaults to SystemClock.
+	Clock Clock
+	// ClientIP returns the IP address of the client stored with new sessions, defaults to the host of the
+	// remote address. Set it to read a proxy header such as X-Forwarded-For when behind a trusted proxy.
+	ClientIP func(req *http.Request) string
+	// OnBindingMismatch is called when a session is validated for a client which does not match its binding,
+	// regardless of the binding policy.
+	OnBindingMismatch func(session *models.Session[UA, SA], client ClientInfo, mismatch BindingMismatch)
+	// ProviderTokens enables storing the OAuth tokens of provider keys, see ProviderTokenConfig.
+	ProviderTokens *ProviderTokenConfig
+	// KeyProviders verify the passwords of the keys of the providers they are registered for, see KeyProvider.
+	KeyProviders map[string]KeyProvider
 }
 
 // Keezle is the main struct that holds the configuration and provides methods for authentication and session management.
@@ -50,6 +109,11 @@ type Config[UA, SA models.AnyStruct] struct {
 // associated with a session.
 type Keezle[UA, SA models.AnyStruct] struct {
 	Config *Config[UA, SA]
+	// Events delivers the events of user, key and session changes to subscribers.
+	Events *EventBus
+
+	revocations        revocationList
+	providerTokenLocks keyedMutex
 }
 
 // New creates a new instance of Keezle with the provided configuration.
@@ -66,6 +130,12 @@ func New[UA, SA models.AnyStruct](config *Config[UA, SA]) (res *Keezle[UA, SA])
 		res.Config.Logger = logger.NoOpLogger
 	}
 
+	if res.Config.Clock == nil {
+		res.Config.Clock = SystemClock
+	}
+
+	res.Events = newEventBus(res.Config.Logger)
+
 	if res.Config.Hash == nil {
 		res.Config.Logger.Log("debug: hash function is not set, using default hash function")
 		res.Config.Hash = utils.HashPassword
@@ -83,5 +153,62 @@ func New[UA, SA models.AnyStruct](config *Config[UA, SA]) (res *Keezle[UA, SA])
 		}
 	}
 
-	return nil
+	if res.Config.Session.RememberMe == nil {
+		res.Config.Session.RememberMe = &RememberMeConfig{
+			ActivePeriod: time.Hour * 24 * 7,
+			IdlePeriod:   time.Hour * 24 * 30,
+		}
+	}
+
+	if res.Config.Session.RenewalThreshold <= 0 || res.Config.Session.RenewalThreshold > 1 {
+		res.Config.Session.RenewalThreshold = 0.5
+	}
+
+	if res.Config.Session.RotationGracePeriod == 0 {
+		res.Config.Session.RotationGracePeriod = time.Second * 30
+	}
+
+	if res.Config.Session.Stateless != nil {
+		if res.Config.Session.Stateless.Keys == nil || !res.Config.Session.Stateless.canSign() {
+			panic("stateless sessions require a signing key")
+		}
+		if res.Config.Session.Stateless.RevocationSyncInterval == 0 {
+			res.Config.Session.Stateless.RevocationSyncInterval = time.Second * 30
+		}
+	}
+
+	if res.Config.ProviderTokens != nil {
+		if len(res.Config.ProviderTokens.EncryptionKey) != 32 {
+			panic("provider tokens require a 32 byte encryption key")
+		}
+		if res.Config.ProviderTokens.RefreshLeeway == 0 {
+			res.Config.ProviderTokens.RefreshLeeway = time.Minute
+		}
+	}
+
+	if res.Config.Session.Cookie == nil {
+		res.Config.Session.Cookie = &SessionCookieConfig{
+			Name:    "auth_session",
+			Secure:  true,
+			Expires: true,
+		}
+	}
+
+	if res.Config.ClientIP == nil {
+		res.Config.ClientIP = remoteIP
+	}
+
+	if res.Config.GetUserAttributes == nil {
+		res.Config.GetUserAttributes = func(user *models.User[UA]) (*UA, error) {
+			return user.Attributes, nil
+		}
+	}
+
+	if res.Config.GetSessionAttributes == nil {
+		res.Config.GetSessionAttributes = func(dbSession *models.DBSession[SA]) (*SA, error) {
+			return dbSession.Attributes, nil
+		}
+	}
+
+	return res
 }
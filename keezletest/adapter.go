@@ -0,0 +1,288 @@
+// Package keezletest provides helpers for testing code built on keezle.
+package keezletest
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/gaurishhs/keezle/adapters"
+	"github.com/gaurishhs/keezle/models"
+)
+
+// ErrDuplicateKey is returned by MemoryAdapter when a key with the id of a created key exists.
+var ErrDuplicateKey = errors.New("keezletest: duplicate key")
+
+// Attributes are user or session attributes stored as JSON, for tests which do not need their own type.
+type Attributes map[string]any
+
+// Value implements driver.Valuer.
+func (a Attributes) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+// Scan implements sql.Scanner. As models.AnyStruct requires a value receiver, the attributes are decoded into
+// the map, which must not be nil.
+func (a Attributes) Scan(src any) error {
+	if a == nil {
+		return errors.New("keezletest: cannot scan into nil Attributes")
+	}
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(src, &a)
+	case string:
+		return json.Unmarshal([]byte(src), &a)
+	default:
+		return fmt.Errorf("keezletest: cannot scan %T into Attributes", src)
+	}
+}
+
+// MemoryAdapter is an adapters.Adapter which keeps users, sessions and keys in memory. It implements none of
+// the optional adapter interfaces, so that the fallbacks of keezle are used. It is safe for concurrent use.
+type MemoryAdapter[UA, SA models.AnyStruct] struct {
+	mu       sync.Mutex
+	users    map[string]*models.User[UA]
+	sessions map[string]*models.DBSession[SA]
+	keys     map[string]*models.DBKey
+}
+
+// NewMemoryAdapter returns an empty MemoryAdapter.
+func NewMemoryAdapter[UA, SA models.AnyStruct]() *MemoryAdapter[UA, SA] {
+	return &MemoryAdapter[UA, SA]{
+		users:    map[string]*models.User[UA]{},
+		sessions: map[string]*models.DBSession[SA]{},
+		keys:     map[string]*models.DBKey{},
+	}
+}
+
+// Sessions returns the number of stored sessions, including expired and rotated ones.
+func (a *MemoryAdapter[UA, SA]) Sessions() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.sessions)
+}
+
+func (a *MemoryAdapter[UA, SA]) CreateUser(opts *adapters.CreateUserOpts[UA]) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if opts.Key != nil {
+		if _, ok := a.keys[*opts.Key.ID]; ok {
+			return ErrDuplicateKey
+		}
+		key := *opts.Key
+		a.keys[*key.ID] = &key
+	}
+	user := *opts.User
+	a.users[user.ID] = &user
+	return nil
+}
+
+func (a *MemoryAdapter[UA, SA]) GetUser(userId string) (*models.User[UA], error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.getUser(userId)
+}
+
+func (a *MemoryAdapter[UA, SA]) getUser(userId string) (*models.User[UA], error) {
+	user, ok := a.users[userId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// GetUsersByAttribute compares the attribute of the JSON encoded attributes of the users with the value.
+func (a *MemoryAdapter[UA, SA]) GetUsersByAttribute(attribute string, value string) ([]*models.User[UA], error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var users []*models.User[UA]
+	for _, user := range a.users {
+		if user.Attributes == nil {
+			continue
+		}
+		encoded, err := (*user.Attributes).Value()
+		if err != nil {
+			return nil, err
+		}
+		var attributes map[string]any
+		if b, ok := encoded.([]byte); !ok || json.Unmarshal(b, &attributes) != nil {
+			continue
+		}
+		if found, ok := attributes[attribute]; ok && fmt.Sprint(found) == value {
+			copied := *user
+			users = append(users, &copied)
+		}
+	}
+	return users, nil
+}
+
+func (a *MemoryAdapter[UA, SA]) UpdateUser(userId string, attributes UA) (*models.User[UA], error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	user, ok := a.users[userId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	user.Attributes = &attributes
+	copied := *user
+	return &copied, nil
+}
+
+func (a *MemoryAdapter[UA, SA]) DeleteUser(userId string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.users, userId)
+	for id, session := range a.sessions {
+		if *session.UserId == userId {
+			delete(a.sessions, id)
+		}
+	}
+	for id, key := range a.keys {
+		if *key.UserID == userId {
+			delete(a.keys, id)
+		}
+	}
+	return nil
+}
+
+func (a *MemoryAdapter[UA, SA]) CreateSession(session *models.DBSession[SA]) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	copied := *session
+	a.sessions[*session.ID] = &copied
+	return nil
+}
+
+func (a *MemoryAdapter[UA, SA]) GetSessionAndUser(sessionId string) (*models.DBSession[SA], *models.User[UA], error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	session, ok := a.sessions[sessionId]
+	if !ok {
+		return nil, nil, sql.ErrNoRows
+	}
+	user, err := a.getUser(*session.UserId)
+	if err != nil {
+		return nil, nil, err
+	}
+	copied := *session
+	return &copied, user, nil
+}
+
+func (a *MemoryAdapter[UA, SA]) GetSessionsByUser(userId string) ([]*models.DBSession[SA], error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var sessions []*models.DBSession[SA]
+	for _, session := range a.sessions {
+		if *session.UserId == userId {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+	return sessions, nil
+}
+
+// UpdateSession overwrites the fields of the session which are set in the new session, like the SQL adapters.
+func (a *MemoryAdapter[UA, SA]) UpdateSession(sessionId string, newSession *models.DBSession[SA]) (*models.DBSession[SA], error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	session, ok := a.sessions[sessionId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	mergeNonNil(session, newSession)
+	if *session.ID != sessionId {
+		delete(a.sessions, sessionId)
+		a.sessions[*session.ID] = session
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (a *MemoryAdapter[UA, SA]) DeleteSession(sessionId string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.sessions, sessionId)
+	return nil
+}
+
+func (a *MemoryAdapter[UA, SA]) DeleteAllUserSessions(userId string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for id, session := range a.sessions {
+		if *session.UserId == userId {
+			delete(a.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (a *MemoryAdapter[UA, SA]) CreateKey(key *models.DBKey) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.keys[*key.ID]; ok {
+		return ErrDuplicateKey
+	}
+	copied := *key
+	a.keys[*key.ID] = &copied
+	return nil
+}
+
+func (a *MemoryAdapter[UA, SA]) GetKey(keyId string) (*models.DBKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key, ok := a.keys[keyId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	copied := *key
+	return &copied, nil
+}
+
+func (a *MemoryAdapter[UA, SA]) GetKeysByUser(userId string) ([]*models.DBKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var keys []*models.DBKey
+	for _, key := range a.keys {
+		if *key.UserID == userId {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+	return keys, nil
+}
+
+func (a *MemoryAdapter[UA, SA]) UpdateKey(keyId string, updatedKey *models.DBKey) (*models.DBKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key, ok := a.keys[keyId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	mergeNonNil(key, updatedKey)
+	copied := *key
+	return &copied, nil
+}
+
+func (a *MemoryAdapter[UA, SA]) DeleteKey(keyId string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.keys, keyId)
+	return nil
+}
+
+// mergeNonNil sets the pointer fields of dst to the fields of src which are not nil.
+func mergeNonNil[T any](dst, src *T) {
+	dstv, srcv := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for i := range srcv.NumField() {
+		if field := srcv.Field(i); field.Kind() == reflect.Pointer && !field.IsNil() {
+			dstv.Field(i).Set(field)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package keezletest
+
+import (
+	"database/sql"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gaurishhs/keezle/adapters"
+)
+
+// OAuthStore is an adapters.OAuthClientStore, adapters.OAuthGrantStore and adapters.DeviceCodeStore which keeps
+// the clients and grants of the authorization server in memory. Embed it with a MemoryAdapter and a
+// RefreshTokenStore to test the authorization server. It is safe for concurrent use.
+type OAuthStore struct {
+	mu       sync.Mutex
+	clients  map[string]adapters.OAuthClient
+	codes    map[string]adapters.AuthorizationCode
+	consents map[[2]string]adapters.OAuthConsent
+	grants   map[string]adapters.OAuthGrant
+	devices  map[string]adapters.DeviceCode
+}
+
+// init creates the maps of a zero OAuthStore. It must be called with the lock held.
+func (s *OAuthStore) init() {
+	if s.clients == nil {
+		s.clients = map[string]adapters.OAuthClient{}
+		s.codes = map[string]adapters.AuthorizationCode{}
+		s.consents = map[[2]string]adapters.OAuthConsent{}
+		s.grants = map[string]adapters.OAuthGrant{}
+		s.devices = map[string]adapters.DeviceCode{}
+	}
+}
+
+func (s *OAuthStore) CreateOAuthClient(client *adapters.OAuthClient) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.init()
+	stored := *client
+	stored.RedirectURIs = slices.Clone(client.RedirectURIs)
+	s.clients[client.ID] = stored
+	return nil
+}
+
+func (s *OAuthStore) GetOAuthClient(clientId string) (*adapters.OAuthClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client, ok := s.clients[clientId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	client.RedirectURIs = slices.Clone(client.RedirectURIs)
+	return &client, nil
+}
+
+func (s *OAuthStore) DeleteOAuthClient(clientId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, clientId)
+	return nil
+}
+
+func (s *OAuthStore) CreateAuthorizationCode(code *adapters.AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.init()
+	s.codes[code.Hash] = *code
+	return nil
+}
+
+func (s *OAuthStore) UseAuthorizationCode(hash, grantId string, now time.Time) (*adapters.AuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := s.codes[hash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if code.UsedAt == nil {
+		used := code
+		used.UsedAt, used.GrantID = &now, grantId
+		s.codes[hash] = used
+	}
+	return &code, nil
+}
+
+func (s *OAuthStore) SetOAuthConsent(consent *adapters.OAuthConsent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.init()
+	s.consents[[2]string{consent.ClientID, consent.UserID}] = *consent
+	return nil
+}
+
+func (s *OAuthStore) GetOAuthConsent(clientId, userId string) (*adapters.OAuthConsent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	consent, ok := s.consents[[2]string{clientId, userId}]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &consent, nil
+}
+
+func (s *OAuthStore) DeleteOAuthConsent(clientId, userId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.consents, [2]string{clientId, userId})
+	return nil
+}
+
+func (s *OAuthStore) CreateOAuthGrant(grant *adapters.OAuthGrant) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.init()
+	s.grants[grant.ID] = *grant
+	return nil
+}
+
+func (s *OAuthStore) GetOAuthGrant(grantId string) (*adapters.OAuthGrant, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	grant, ok := s.grants[grantId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &grant, nil
+}
+
+func (s *OAuthStore) DeleteOAuthGrant(grantId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.grants, grantId)
+	return nil
+}
+
+func (s *OAuthStore) DeleteOAuthGrants(clientId, userId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, grant := range s.grants {
+		if grant.ClientID == clientId && grant.UserID == userId {
+			delete(s.grants, id)
+		}
+	}
+	return nil
+}
+
+// Grants returns the number of stored grants.
+func (s *OAuthStore) Grants() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.grants)
+}
+
+func (s *OAuthStore) CreateDeviceCode(code *adapters.DeviceCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.init()
+	s.devices[code.Hash] = *code
+	return nil
+}
+
+func (s *OAuthStore) GetDeviceCodeByUserCode(userCode string) (*adapters.DeviceCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, code := range s.devices {
+		if code.UserCode == userCode {
+			return &code, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *OAuthStore) CompleteDeviceCode(hash, status, userId string, authTime time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := s.devices[hash]
+	if !ok || code.Status != adapters.DeviceCodePending {
+		return sql.ErrNoRows
+	}
+	code.Status, code.UserID, code.AuthTime = status, userId, &authTime
+	s.devices[hash] = code
+	return nil
+}
+
+func (s *OAuthStore) PollDeviceCode(hash string, now time.Time) (*adapters.DeviceCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := s.devices[hash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	polled := code
+	polled.LastPolledAt = &now
+	s.devices[hash] = polled
+	return &code, nil
+}
+
+func (s *OAuthStore) UseDeviceCode(hash string) (*adapters.DeviceCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code, ok := s.devices[hash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	delete(s.devices, hash)
+	return &code, nil
+}
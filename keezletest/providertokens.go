@@ -0,0 +1,42 @@
+package keezletest
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/gaurishhs/keezle/adapters"
+)
+
+// ProviderTokenStore is an adapters.ProviderTokenStore which keeps provider tokens in memory. Embed it with a
+// MemoryAdapter to test provider tokens. It is safe for concurrent use.
+type ProviderTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]adapters.ProviderToken
+}
+
+func (s *ProviderTokenStore) SetProviderToken(token *adapters.ProviderToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens == nil {
+		s.tokens = map[string]adapters.ProviderToken{}
+	}
+	s.tokens[token.KeyID] = *token
+	return nil
+}
+
+func (s *ProviderTokenStore) GetProviderToken(keyId string) (*adapters.ProviderToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[keyId]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &token, nil
+}
+
+func (s *ProviderTokenStore) DeleteProviderToken(keyId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tokens, keyId)
+	return nil
+}
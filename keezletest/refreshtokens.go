@@ -0,0 +1,69 @@
+package keezletest
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/gaurishhs/keezle/adapters"
+)
+
+// RefreshTokenStore is an adapters.RefreshTokenStore which keeps refresh tokens in memory. Embed it with a
+// MemoryAdapter to test the token service or the authorization server. It is safe for concurrent use.
+type RefreshTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]adapters.RefreshToken
+}
+
+func (s *RefreshTokenStore) CreateRefreshToken(token *adapters.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tokens == nil {
+		s.tokens = map[string]adapters.RefreshToken{}
+	}
+	s.tokens[token.Hash] = *token
+	return nil
+}
+
+func (s *RefreshTokenStore) GetRefreshToken(hash string) (*adapters.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &token, nil
+}
+
+func (s *RefreshTokenStore) UseRefreshToken(hash string, now time.Time) (*adapters.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[hash]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	if token.UsedAt == nil {
+		used := token
+		used.UsedAt = &now
+		s.tokens[hash] = used
+	}
+	return &token, nil
+}
+
+func (s *RefreshTokenStore) DeleteRefreshTokenFamily(family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, token := range s.tokens {
+		if token.Family == family {
+			delete(s.tokens, hash)
+		}
+	}
+	return nil
+}
+
+// RefreshTokens returns the number of stored refresh tokens.
+func (s *RefreshTokenStore) RefreshTokens() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tokens)
+}
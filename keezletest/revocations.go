@@ -0,0 +1,43 @@
+package keezletest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gaurishhs/keezle/adapters"
+)
+
+// RevocationStore is an adapters.RevocationStore which keeps revocations in memory. Embed it with a
+// MemoryAdapter to test stateless sessions. It is safe for concurrent use.
+type RevocationStore struct {
+	mu          sync.Mutex
+	revocations []adapters.Revocation
+	fetches     int
+}
+
+func (s *RevocationStore) CreateRevocation(revocation *adapters.Revocation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revocations = append(s.revocations, *revocation)
+	return nil
+}
+
+func (s *RevocationStore) GetRevocations(now time.Time) ([]*adapters.Revocation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetches++
+	var revocations []*adapters.Revocation
+	for _, revocation := range s.revocations {
+		if revocation.ExpiresAt.After(now) {
+			revocations = append(revocations, &revocation)
+		}
+	}
+	return revocations, nil
+}
+
+// Fetches returns the number of GetRevocations calls.
+func (s *RevocationStore) Fetches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
@@ -1,11 +1,21 @@
 package keezle
 
 import (
+	"database/sql"
+	"errors"
 	"strings"
 
 	"github.com/gaurishhs/keezle/models"
 )
 
+// KeyProvider verifies the passwords of the keys of a provider in place of a stored password hash, e.g. by
+// binding to a directory. The keys of a key provider are created without a password.
+type KeyProvider interface {
+	// VerifyPassword verifies the password of the provider user. It returns ErrInvalidPassword if the password
+	// is wrong.
+	VerifyPassword(providerUserId, password string) error
+}
+
 // CreateKeyOptions defines the options for creating a new key.
 type CreateKeyOptions struct {
 	UserID         string
@@ -47,16 +57,25 @@ func (k *Keezle[UA, SA]) CreateKey(opts CreateKeyOptions) (*models.Key, error) {
 		return nil, err
 	}
 
-	hashedPassword, err := k.Config.Hash(opts.Password)
-
-	if err != nil {
-		return nil, err
+	// Keys without a password, e.g. of OAuth providers, are used without one.
+	var hashedPassword *string
+	if opts.Password != "" {
+		hash, err := k.Config.Hash(opts.Password)
+		if err != nil {
+			return nil, err
+		}
+		hashedPassword = &hash
 	}
 
 	key := &models.DBKey{
 		ID:       &keyId,
 		UserID:   &opts.UserID,
-		Password: &hashedPassword,
+		Password: hashedPassword,
+	}
+
+	event := &KeyEvent{EventMeta: k.newEventMeta(EventKeyCreated), KeyID: keyId, UserID: opts.UserID}
+	if err := k.Events.before(event); err != nil {
+		return nil, err
 	}
 
 	err = k.Config.Adapter.CreateKey(key)
@@ -65,6 +84,7 @@ func (k *Keezle[UA, SA]) CreateKey(opts CreateKeyOptions) (*models.Key, error) {
 		return nil, err
 	}
 
+	k.Events.after(event)
 	return TransformKey(key), nil
 }
 
@@ -74,7 +94,21 @@ func (k *Keezle[UA, SA]) DeleteKey(provider, providerUserId string) error {
 	if err != nil {
 		return err
 	}
-	return k.Config.Adapter.DeleteKey(keyId)
+
+	event := &KeyEvent{EventMeta: k.newEventMeta(EventKeyDeleted), KeyID: keyId}
+	if err := k.Events.before(event); err != nil {
+		return err
+	}
+	if err := k.Config.Adapter.DeleteKey(keyId); err != nil {
+		return err
+	}
+	if store, err := k.providerTokenStore(); err == nil {
+		if err := store.DeleteProviderToken(keyId); err != nil {
+			return err
+		}
+	}
+	k.Events.after(event)
+	return nil
 }
 
 // GetKey retrieves a key by its provider and provider user ID.
@@ -118,6 +152,15 @@ func (k *Keezle[UA, SA]) UpdateKey(provider, providerUserId, password string) (*
 		return nil, err
 	}
 
+	key, err := k.Config.Adapter.GetKey(keyId)
+	if err != nil {
+		return nil, err
+	}
+	event := &KeyEvent{EventMeta: k.newEventMeta(EventPasswordChanged), KeyID: keyId, UserID: deref(key.UserID)}
+	if err := k.Events.before(event); err != nil {
+		return nil, err
+	}
+
 	hashedPassword, err := k.Config.Hash(password)
 	if err != nil {
 		return nil, err
@@ -131,35 +174,72 @@ func (k *Keezle[UA, SA]) UpdateKey(provider, providerUserId, password string) (*
 		return nil, err
 	}
 
+	k.Events.after(event)
 	return TransformKey(updatedKey), nil
 }
 
 // UseKey retrieves a key by its provider and provider user ID, and validates the password if it exists.
+// The passwords of providers with a KeyProvider are verified by the KeyProvider.
+// It emits an EventLoginSucceeded event, which subscribers can veto, or an EventLoginFailed event.
 func (k *Keezle[UA, SA]) UseKey(provider, providerUserId, password string) (*models.Key, error) {
+	key, err := k.useKey(provider, providerUserId, password)
+	event := &LoginEvent{
+		EventMeta:      k.newEventMeta(EventLoginSucceeded),
+		Provider:       provider,
+		ProviderUserID: providerUserId,
+	}
+	if key != nil {
+		event.UserID = deref(key.UserID)
+	}
+	if err == nil {
+		err = k.Events.before(event)
+	}
+	if err != nil {
+		event.Type = EventLoginFailed
+		event.Err = err
+		k.Events.notify(event)
+		return nil, err
+	}
+	k.Events.after(event)
+	return TransformKey(key), nil
+}
+
+// useKey retrieves a key and validates the password. The key is returned along with password errors.
+func (k *Keezle[UA, SA]) useKey(provider, providerUserId, password string) (*models.DBKey, error) {
 	keyId, err := createKeyId(provider, providerUserId)
 	if err != nil {
 		return nil, err
 	}
 	key, err := k.Config.Adapter.GetKey(keyId)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidKeyId
+		}
 		return nil, err
 	}
+	if keyProvider, ok := k.Config.KeyProviders[provider]; ok {
+		// Empty passwords are rejected, as directories treat a bind without a password as anonymous.
+		if password == "" {
+			return key, ErrInvalidPassword
+		}
+		return key, keyProvider.VerifyPassword(providerUserId, password)
+	}
 	if key.Password != nil {
 		if password == "" {
-			return nil, ErrInvalidPassword
+			return key, ErrInvalidPassword
 		}
 
 		valid, err := k.Config.ComparePasswordAndHash(password, deref(key.Password))
 		if err != nil {
-			return nil, err
+			return key, err
 		}
 		if !valid {
-			return nil, ErrInvalidPassword
+			return key, ErrInvalidPassword
 		}
 	} else {
 		if password != "" {
-			return nil, ErrInvalidPassword
+			return key, ErrInvalidPassword
 		}
 	}
-	return TransformKey(key), nil
+	return key, nil
 }
@@ -0,0 +1,18 @@
+module github.com/gaurishhs/keezle/ldap
+
+go 1.24.2
+
+require (
+	github.com/gaurishhs/keezle v0.0.0-20250709172739-4ff048670fb0
+	github.com/gaurishhs/keezle/models v0.0.0-20250709172739-4ff048670fb0
+	github.com/go-ldap/ldap/v3 v3.4.12
+)
+
+require (
+	github.com/Azure/go-ntlmssp v0.0.0-20221128193559-754e69321358 // indirect
+	github.com/go-asn1-ber/asn1-ber v1.5.8-0.20250403174932-29230038a667 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/rs/xid v1.6.0 // indirect
+	golang.org/x/crypto v0.39.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+)
@@ -0,0 +1,298 @@
+// Package ldap authenticates users against an LDAP directory or Active Directory. A Provider is registered as
+// the keezle.KeyProvider of its keys with Register, so that keezle.Keezle.UseKey verifies passwords with a bind
+// instead of a stored hash, and a SignIn provisions a local user with a key on the first login and syncs the attributes of
+// the directory entry.
+// Connections to ldap:// URLs are upgraded with StartTLS, so that passwords are never sent in plain text.
+package ldap
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/models"
+	"github.com/gaurishhs/keezle/utils"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+var (
+	// ErrNotInGroup is returned when the user is not a member of any of the required groups.
+	ErrNotInGroup = errors.New("ldap: user is not a member of a required group")
+)
+
+// Conn is a connection to the directory. It is implemented by *goldap.Conn, tests provide a stand-in with
+// Config.Dial.
+type Conn interface {
+	StartTLS(config *tls.Config) error
+	Bind(username, password string) error
+	Search(req *goldap.SearchRequest) (*goldap.SearchResult, error)
+	Close() error
+}
+
+// Config defines the configuration of a Provider.
+type Config struct {
+	// Name is the key provider of directory users, defaults to "ldap".
+	Name string
+	// URL is the URL of the directory, e.g. "ldap://dc.example.com" or "ldaps://dc.example.com".
+	URL string
+	// TLSConfig is used for StartTLS and ldaps:// URLs. The server name defaults to the host of the URL.
+	TLSConfig *tls.Config
+	// InsecureSkipStartTLS sends passwords over ldap:// URLs in plain text. It must only be used with a local
+	// test directory.
+	InsecureSkipStartTLS bool
+	// BindDN and BindPassword are the credentials of the service account which searches users by name.
+	// Without a service account users bind with the DN built from UserDN.
+	BindDN       string
+	BindPassword string
+	// BaseDN is the subtree users are searched in.
+	BaseDN string
+	// UserFilter finds a user by name, the escaped name replaces "%s". Defaults to "(uid=%s)", Active Directory
+	// uses "(sAMAccountName=%s)".
+	UserFilter string
+	// UserDN is the DN of a user for directories without a service account, the escaped name replaces "%s",
+	// e.g. "uid=%s,ou=people,dc=example,dc=com".
+	UserDN string
+	// Attributes are the attributes of the user entry which are read.
+	Attributes []string
+	// RequiredGroups are the DNs of the groups a user must be a member of one of, if set.
+	RequiredGroups []string
+	// GroupAttribute is the attribute listing the groups of a user, defaults to "memberOf".
+	GroupAttribute string
+	// Timeout is the timeout of connecting and of every request, defaults to 10 seconds.
+	Timeout time.Duration
+	// Dial opens a connection to the directory, defaults to dialing URL.
+	Dial func() (Conn, error)
+}
+
+// Entry is the directory entry of a user.
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Attribute returns the first value of an attribute, or an empty string.
+func (e *Entry) Attribute(name string) string {
+	if values := e.Attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Provider authenticates users against a directory.
+type Provider struct {
+	Config Config
+	// useTLS is set if connections have to be upgraded with StartTLS.
+	useTLS bool
+
+	mu sync.Mutex
+	// verified holds the results of binds made before using a key by their one-time tickets, see verify.
+	verified map[string]verification
+}
+
+// verification is the result of a bind of a user.
+type verification struct {
+	username string
+	err      error
+}
+
+// New creates a provider for the directory.
+// It panics if the URL is invalid or neither a service account nor a user DN is configured.
+func New(config Config) *Provider {
+	directory, err := url.Parse(config.URL)
+	if err != nil || (directory.Scheme != "ldap" && directory.Scheme != "ldaps") || directory.Host == "" {
+		panic("ldap provider requires an ldap:// or ldaps:// URL")
+	}
+	if config.BindDN == "" && config.UserDN == "" {
+		panic("ldap provider requires a service account or a user DN")
+	}
+	if config.BindDN != "" && config.BaseDN == "" {
+		panic("ldap provider requires a base DN to search users in")
+	}
+	if config.Name == "" {
+		config.Name = "ldap"
+	}
+	if config.UserFilter == "" {
+		config.UserFilter = "(uid=%s)"
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = "memberOf"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = time.Second * 10
+	}
+	if config.TLSConfig == nil {
+		config.TLSConfig = &tls.Config{}
+	}
+	if config.TLSConfig.ServerName == "" {
+		config.TLSConfig = config.TLSConfig.Clone()
+		config.TLSConfig.ServerName = directory.Hostname()
+	}
+
+	p := &Provider{
+		Config:   config,
+		useTLS:   directory.Scheme == "ldap" && !config.InsecureSkipStartTLS,
+		verified: map[string]verification{},
+	}
+	if p.Config.Dial == nil {
+		p.Config.Dial = p.dial
+	}
+	return p
+}
+
+// dial connects to the URL of the directory.
+func (p *Provider) dial() (Conn, error) {
+	conn, err := goldap.DialURL(p.Config.URL,
+		goldap.DialWithDialer(&net.Dialer{Timeout: p.Config.Timeout}),
+		goldap.DialWithTLSConfig(p.Config.TLSConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(p.Config.Timeout)
+	return conn, nil
+}
+
+// connect opens a connection, upgrading it with StartTLS.
+func (p *Provider) connect() (Conn, error) {
+	conn, err := p.Config.Dial()
+	if err != nil {
+		return nil, err
+	}
+	if p.useTLS {
+		if err := conn.StartTLS(p.Config.TLSConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Authenticate binds as the user with the password and returns the directory entry of the user.
+// It returns keezle.ErrInvalidPassword if the user does not exist or the password is wrong, and ErrNotInGroup
+// if the user is not a member of a required group.
+func (p *Provider) Authenticate(username, password string) (*Entry, error) {
+	// Directories treat a bind without a password as an anonymous bind, which succeeds.
+	if username == "" || password == "" {
+		return nil, keezle.ErrInvalidPassword
+	}
+	conn, err := p.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var dn string
+	if p.Config.BindDN != "" {
+		if err := conn.Bind(p.Config.BindDN, p.Config.BindPassword); err != nil {
+			return nil, err
+		}
+		entry, err := p.search(conn, p.Config.BaseDN, goldap.ScopeWholeSubtree,
+			fmt.Sprintf(p.Config.UserFilter, goldap.EscapeFilter(username)))
+		if err != nil {
+			return nil, err
+		}
+		dn = entry.DN
+	} else {
+		dn = fmt.Sprintf(p.Config.UserDN, goldap.EscapeDN(username))
+	}
+
+	if err := conn.Bind(dn, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, keezle.ErrInvalidPassword
+		}
+		return nil, err
+	}
+	// The entry is read as the user, so that the attributes are those visible to the user.
+	entry, err := p.search(conn, dn, goldap.ScopeBaseObject, "(objectClass=*)")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.Config.RequiredGroups) > 0 && !slices.ContainsFunc(entry.Attributes[p.Config.GroupAttribute], p.isRequiredGroup) {
+		return nil, ErrNotInGroup
+	}
+	return entry, nil
+}
+
+// isRequiredGroup reports whether the group is one of the required groups. DNs are compared case-insensitively.
+func (p *Provider) isRequiredGroup(group string) bool {
+	return slices.ContainsFunc(p.Config.RequiredGroups, func(required string) bool {
+		return strings.EqualFold(required, group)
+	})
+}
+
+// search returns the only entry matching the filter. It returns keezle.ErrInvalidPassword if there is none or
+// several, so that the existence of users is not revealed.
+func (p *Provider) search(conn Conn, baseDN string, scope int, filter string) (*Entry, error) {
+	attributes := append(slices.Clone(p.Config.Attributes), p.Config.GroupAttribute)
+	result, err := conn.Search(goldap.NewSearchRequest(baseDN, scope, goldap.NeverDerefAliases, 2,
+		int(p.Config.Timeout.Seconds()), false, filter, attributes, nil))
+	if err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) || goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+			return nil, keezle.ErrInvalidPassword
+		}
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, keezle.ErrInvalidPassword
+	}
+
+	entry := &Entry{DN: result.Entries[0].DN, Attributes: map[string][]string{}}
+	for _, attribute := range result.Entries[0].Attributes {
+		entry.Attributes[attribute.Name] = attribute.Values
+	}
+	return entry, nil
+}
+
+// Register registers the provider as the key provider of its keys in the configuration of a Keezle instance.
+// It must be called before keezle.New.
+func Register[UA, SA models.AnyStruct](config *keezle.Config[UA, SA], p *Provider) {
+	if config.KeyProviders == nil {
+		config.KeyProviders = map[string]keezle.KeyProvider{}
+	}
+	config.KeyProviders[p.Config.Name] = p
+}
+
+// VerifyPassword implements keezle.KeyProvider. A ticket returned by verify is accepted in place of the
+// password once, with the result of the bind it was issued for.
+func (p *Provider) VerifyPassword(username, password string) error {
+	p.mu.Lock()
+	result, ok := p.verified[password]
+	ok = ok && result.username == username
+	if ok {
+		delete(p.verified, password)
+	}
+	p.mu.Unlock()
+	if ok {
+		return result.err
+	}
+
+	_, err := p.Authenticate(username, password)
+	return err
+}
+
+// verify returns a one-time ticket carrying the result of a bind of the user, so that the key of the user can be
+// used with the ticket without binding again. The ticket must be released once the key was used.
+func (p *Provider) verify(username string, err error) (string, error) {
+	ticket, randErr := utils.GenerateRandomString(32)
+	if randErr != nil {
+		return "", randErr
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.verified[ticket] = verification{username: username, err: err}
+	return ticket, nil
+}
+
+// release removes the ticket if it was not used.
+func (p *Provider) release(ticket string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.verified, ticket)
+}
@@ -0,0 +1,345 @@
+package ldap_test
+
+import (
+	"crypto/tls"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/keezletest"
+	"github.com/gaurishhs/keezle/ldap"
+	"github.com/gaurishhs/keezle/models"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+type attributes = keezletest.Attributes
+
+const (
+	serviceDN = "cn=service,dc=example,dc=com"
+	jdoeDN    = "uid=jdoe,ou=people,dc=example,dc=com"
+	eveDN     = "uid=eve,ou=people,dc=example,dc=com"
+	toolsDN   = "cn=tools,ou=groups,dc=example,dc=com"
+)
+
+type entry struct {
+	password   string
+	attributes map[string][]string
+}
+
+// directory is an in-memory directory which records the binds of its connections.
+type directory struct {
+	mu       sync.Mutex
+	entries  map[string]*entry
+	binds    []string
+	startTLS int
+}
+
+func newDirectory() *directory {
+	return &directory{entries: map[string]*entry{
+		serviceDN: {password: "service", attributes: map[string][]string{"uid": {"service"}}},
+		jdoeDN: {password: "secret", attributes: map[string][]string{
+			"uid": {"jdoe"}, "mail": {"jdoe@example.com"}, "memberOf": {"CN=Tools,OU=Groups,DC=example,DC=com"},
+		}},
+		eveDN: {password: "secret", attributes: map[string][]string{"uid": {"eve"}, "mail": {"eve@example.com"}}},
+	}}
+}
+
+// dial returns a connection to the directory, which is already encrypted if tls is set.
+func (d *directory) dial(tls bool) func() (ldap.Conn, error) {
+	return func() (ldap.Conn, error) {
+		return &conn{directory: d, tls: tls}, nil
+	}
+}
+
+func (d *directory) set(dn string, update func(entry *entry)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	update(d.entries[dn])
+}
+
+// userBinds returns the number of binds with the DN and resets the recorded binds.
+func (d *directory) userBinds(dn string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	count := 0
+	for _, bound := range d.binds {
+		if bound == dn {
+			count++
+		}
+	}
+	d.binds = nil
+	return count
+}
+
+type conn struct {
+	directory *directory
+	tls       bool
+	bound     string
+}
+
+func (c *conn) StartTLS(*tls.Config) error {
+	c.directory.mu.Lock()
+	defer c.directory.mu.Unlock()
+	c.directory.startTLS++
+	c.tls = true
+	return nil
+}
+
+func (c *conn) Bind(dn, password string) error {
+	c.directory.mu.Lock()
+	defer c.directory.mu.Unlock()
+	c.directory.binds = append(c.directory.binds, dn)
+	if !c.tls {
+		return goldap.NewError(goldap.LDAPResultConfidentialityRequired, errors.New("confidentiality required"))
+	}
+	entry, ok := c.directory.entries[strings.ToLower(dn)]
+	if !ok || password == "" || entry.password != password {
+		return goldap.NewError(goldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+	c.bound = dn
+	return nil
+}
+
+var uidFilter = regexp.MustCompile(`^\(uid=(.*)\)$`)
+
+// Search supports reading an entry by DN and the filter "(uid=name)" without wildcards.
+func (c *conn) Search(req *goldap.SearchRequest) (*goldap.SearchResult, error) {
+	c.directory.mu.Lock()
+	defer c.directory.mu.Unlock()
+	if c.bound == "" {
+		return nil, goldap.NewError(goldap.LDAPResultInsufficientAccessRights, errors.New("anonymous search"))
+	}
+	result := &goldap.SearchResult{}
+	add := func(dn string, e *entry) {
+		found := &goldap.Entry{DN: dn}
+		for _, name := range req.Attributes {
+			if values, ok := e.attributes[name]; ok {
+				found.Attributes = append(found.Attributes, &goldap.EntryAttribute{Name: name, Values: values})
+			}
+		}
+		result.Entries = append(result.Entries, found)
+	}
+
+	if req.Scope == goldap.ScopeBaseObject {
+		e, ok := c.directory.entries[strings.ToLower(req.BaseDN)]
+		if !ok {
+			return nil, goldap.NewError(goldap.LDAPResultNoSuchObject, errors.New("no such object"))
+		}
+		add(req.BaseDN, e)
+		return result, nil
+	}
+	match := uidFilter.FindStringSubmatch(req.Filter)
+	if match == nil || strings.ContainsAny(match[1], `*()\`) {
+		return result, nil
+	}
+	for dn, e := range c.directory.entries {
+		if strings.EqualFold(e.attributes["uid"][0], match[1]) {
+			add(dn, e)
+		}
+	}
+	return result, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func newProvider(d *directory) *ldap.Provider {
+	return ldap.New(ldap.Config{
+		URL:            "ldap://dc.example.com",
+		BindDN:         serviceDN,
+		BindPassword:   "service",
+		BaseDN:         "dc=example,dc=com",
+		Attributes:     []string{"mail", "uid"},
+		RequiredGroups: []string{toolsDN},
+		Dial:           d.dial(false),
+	})
+}
+
+func TestNew(t *testing.T) {
+	p := newProvider(newDirectory())
+	if p.Config.Name != "ldap" || p.Config.TLSConfig.ServerName != "dc.example.com" {
+		t.Errorf("name = %q, server name = %q", p.Config.Name, p.Config.TLSConfig.ServerName)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	d := newDirectory()
+	p := newProvider(d)
+	tests := []struct {
+		name     string
+		username string
+		password string
+		err      error
+	}{
+		{"valid", "jdoe", "secret", nil},
+		{"wrong password", "jdoe", "wrong", keezle.ErrInvalidPassword},
+		{"empty password", "jdoe", "", keezle.ErrInvalidPassword},
+		{"unknown user", "nobody", "secret", keezle.ErrInvalidPassword},
+		{"wildcard", "j*", "secret", keezle.ErrInvalidPassword},
+		{"filter injection", "jdoe)(uid=*", "secret", keezle.ErrInvalidPassword},
+		{"not in group", "eve", "secret", ldap.ErrNotInGroup},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, err := p.Authenticate(tt.username, tt.password)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Authenticate returned %v, want %v", err, tt.err)
+			}
+			if err == nil && (entry.DN != jdoeDN || entry.Attribute("mail") != "jdoe@example.com") {
+				t.Errorf("entry = %+v", entry)
+			}
+		})
+	}
+	if d.startTLS != len(tests)-1 {
+		t.Errorf("StartTLS was called %d times, want %d", d.startTLS, len(tests)-1)
+	}
+}
+
+func TestAuthenticateUserDN(t *testing.T) {
+	d := newDirectory()
+	p := ldap.New(ldap.Config{
+		URL:        "ldaps://dc.example.com",
+		UserDN:     "uid=%s,ou=people,dc=example,dc=com",
+		Attributes: []string{"mail"},
+		Dial:       d.dial(true),
+	})
+
+	entry, err := p.Authenticate("eve", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.DN != eveDN || entry.Attribute("mail") != "eve@example.com" {
+		t.Errorf("entry = %+v", entry)
+	}
+	if d.startTLS != 0 {
+		t.Error("StartTLS was called for an ldaps:// URL")
+	}
+	if _, err := p.Authenticate("eve,ou=people", "secret"); !errors.Is(err, keezle.ErrInvalidPassword) {
+		t.Errorf("DN injection returned %v, want ErrInvalidPassword", err)
+	}
+}
+
+func TestSignIn(t *testing.T) {
+	d := newDirectory()
+	p := newProvider(d)
+	config := &keezle.Config[attributes, attributes]{Adapter: keezletest.NewMemoryAdapter[attributes, attributes]()}
+	ldap.Register(config, p)
+	k := keezle.New(config)
+	var (
+		mu     sync.Mutex
+		logins []keezle.EventType
+	)
+	k.Events.Subscribe(keezle.EventAll, func(event keezle.Event) error {
+		if event, ok := event.(*keezle.LoginEvent); ok {
+			mu.Lock()
+			defer mu.Unlock()
+			logins = append(logins, event.Type)
+		}
+		return nil
+	})
+	takeLogins := func() []keezle.EventType {
+		mu.Lock()
+		defer mu.Unlock()
+		taken := logins
+		logins = nil
+		return taken
+	}
+	signIn := ldap.NewSignIn(k, p, ldap.SignInConfig[attributes]{
+		UserAttributes: func(entry *ldap.Entry) (*attributes, error) {
+			return &attributes{"email": entry.Attribute("mail")}, nil
+		},
+		SyncAttributes: func(user *models.User[attributes], entry *ldap.Entry) (*attributes, error) {
+			return &attributes{"email": entry.Attribute("mail"), "synced": true}, nil
+		},
+	})
+	userAttributes := func(userId string) attributes {
+		t.Helper()
+		user, err := k.GetUser(userId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *user.Attributes
+	}
+
+	created, err := signIn.SignIn(" JDoe ", "secret", ldap.SignInOptions[attributes]{Attributes: attributes{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created.Created || created.Session == nil {
+		t.Fatalf("result = %+v", created)
+	}
+	if got := userAttributes(created.UserID); got["email"] != "jdoe@example.com" {
+		t.Errorf("attributes = %v", got)
+	}
+	d.userBinds(jdoeDN)
+	takeLogins()
+
+	t.Run("sync with a single bind", func(t *testing.T) {
+		d.set(jdoeDN, func(e *entry) { e.attributes["mail"] = []string{"john@example.com"} })
+		result, err := signIn.SignIn("jdoe", "secret", ldap.SignInOptions[attributes]{Attributes: attributes{}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Created || result.UserID != created.UserID {
+			t.Errorf("result = %+v", result)
+		}
+		if binds := d.userBinds(jdoeDN); binds != 1 {
+			t.Errorf("user bound %d times, want once", binds)
+		}
+		if got := userAttributes(created.UserID); got["email"] != "john@example.com" || got["synced"] != true {
+			t.Errorf("attributes = %v", got)
+		}
+		if got := takeLogins(); len(got) != 1 || got[0] != keezle.EventLoginSucceeded {
+			t.Errorf("login events = %v, want a succeeded login", got)
+		}
+	})
+
+	t.Run("wrong password with a single bind", func(t *testing.T) {
+		if _, err := signIn.SignIn("jdoe", "wrong", ldap.SignInOptions[attributes]{Attributes: attributes{}}); !errors.Is(err, keezle.ErrInvalidPassword) {
+			t.Fatalf("sign-in returned %v, want ErrInvalidPassword", err)
+		}
+		if binds := d.userBinds(jdoeDN); binds != 1 {
+			t.Errorf("user bound %d times, want once", binds)
+		}
+		if got := takeLogins(); len(got) != 1 || got[0] != keezle.EventLoginFailed {
+			t.Errorf("login events = %v, want a failed login", got)
+		}
+	})
+
+	t.Run("key", func(t *testing.T) {
+		if _, err := k.UseKey("ldap", "jdoe", "wrong"); !errors.Is(err, keezle.ErrInvalidPassword) {
+			t.Errorf("UseKey with a wrong password returned %v", err)
+		}
+		if _, err := k.UseKey("ldap", "jdoe", "secret"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("password changed", func(t *testing.T) {
+		d.set(jdoeDN, func(e *entry) { e.password = "changed" })
+		if _, err := signIn.SignIn("jdoe", "secret", ldap.SignInOptions[attributes]{Attributes: attributes{}}); !errors.Is(err, keezle.ErrInvalidPassword) {
+			t.Errorf("sign-in with the old password returned %v, want ErrInvalidPassword", err)
+		}
+	})
+
+	t.Run("removed from group", func(t *testing.T) {
+		d.set(jdoeDN, func(e *entry) { delete(e.attributes, "memberOf") })
+		if _, err := signIn.SignIn("jdoe", "changed", ldap.SignInOptions[attributes]{Attributes: attributes{}}); !errors.Is(err, ldap.ErrNotInGroup) {
+			t.Errorf("sign-in returned %v, want ErrNotInGroup", err)
+		}
+	})
+}
+
+func TestNewSignInUnregistered(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("NewSignIn did not panic for an unregistered provider")
+		}
+	}()
+	k := keezle.New(&keezle.Config[attributes, attributes]{Adapter: keezletest.NewMemoryAdapter[attributes, attributes]()})
+	ldap.NewSignIn(k, newProvider(newDirectory()), ldap.SignInConfig[attributes]{})
+}
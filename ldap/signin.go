@@ -0,0 +1,140 @@
+package ldap
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/models"
+)
+
+// SignInConfig defines the configuration of a SignIn.
+type SignInConfig[UA models.AnyStruct] struct {
+	// UserAttributes returns the attributes of a user created for a directory user.
+	UserAttributes func(entry *Entry) (*UA, error)
+	// SyncAttributes returns the attributes of an existing user updated with the directory entry, or nil to keep
+	// them. It is called on every sign-in, so that changes in the directory reach the user. The entry is the one
+	// read by the bind verifying the password.
+	SyncAttributes func(user *models.User[UA], entry *Entry) (*UA, error)
+}
+
+// SignIn signs directory users in, keeping the link between a directory user and a keezle user in a key of the
+// provider. The provider user id of the key is the lowercased user name, as directories compare names
+// case-insensitively.
+type SignIn[UA, SA models.AnyStruct] struct {
+	Keezle   *keezle.Keezle[UA, SA]
+	Provider *Provider
+	Config   SignInConfig[UA]
+}
+
+// NewSignIn creates a SignIn for the Keezle instance.
+// It panics if the provider was not registered as the key provider of its keys with Register.
+func NewSignIn[UA, SA models.AnyStruct](k *keezle.Keezle[UA, SA], p *Provider, config SignInConfig[UA]) *SignIn[UA, SA] {
+	if k.Config.KeyProviders[p.Config.Name] != p {
+		panic("ldap sign-in requires the provider to be registered with ldap.Register")
+	}
+	return &SignIn[UA, SA]{Keezle: k, Provider: p, Config: config}
+}
+
+// SignInOptions defines the options of the created session.
+type SignInOptions[SA models.AnyStruct] struct {
+	Attributes SA
+	RememberMe bool
+	Client     keezle.ClientInfo
+}
+
+// SignInResult is the result of a sign-in.
+type SignInResult[UA, SA models.AnyStruct] struct {
+	Session *models.Session[UA, SA]
+	UserID  string
+	// Created is set if a new user was created for the directory user.
+	Created bool
+}
+
+// SignIn signs in the directory user with the password and creates a session.
+// The password is verified with a single bind. Users with a key sign in with keezle.Keezle.UseKey, which is
+// passed the result of the bind and reports the sign-in to event subscribers, and their attributes are synced
+// with the directory entry read by the bind. Users without a key are provisioned with a new user.
+func (s *SignIn[UA, SA]) SignIn(username, password string, opts SignInOptions[SA]) (*SignInResult[UA, SA], error) {
+	provider := s.Provider.Config.Name
+	username = strings.ToLower(strings.TrimSpace(username))
+	result := &SignInResult[UA, SA]{}
+
+	_, err := s.Keezle.GetKey(provider, username)
+	switch {
+	case err == nil:
+		entry, verifyErr := s.Provider.Authenticate(username, password)
+		ticket, err := s.Provider.verify(username, verifyErr)
+		if err != nil {
+			return nil, err
+		}
+		key, err := s.Keezle.UseKey(provider, username, ticket)
+		s.Provider.release(ticket)
+		if err != nil {
+			return nil, err
+		}
+		result.UserID = key.UserID
+		if s.Config.SyncAttributes != nil {
+			if err := s.syncAttributes(key.UserID, entry); err != nil {
+				return nil, err
+			}
+		}
+	case errors.Is(err, sql.ErrNoRows):
+		entry, err := s.Provider.Authenticate(username, password)
+		if err != nil {
+			return nil, err
+		}
+		if result.UserID, err = s.createUser(provider, username, entry); err != nil {
+			return nil, err
+		}
+		result.Created = true
+	default:
+		return nil, err
+	}
+
+	result.Session, err = s.Keezle.CreateSession(keezle.CreateSessionOptions[SA]{
+		UserId:     result.UserID,
+		Attributes: opts.Attributes,
+		RememberMe: opts.RememberMe,
+		Client:     opts.Client,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// syncAttributes updates the attributes of the user with the directory entry.
+func (s *SignIn[UA, SA]) syncAttributes(userId string, entry *Entry) error {
+	user, err := s.Keezle.GetUser(userId)
+	if err != nil {
+		return err
+	}
+	attributes, err := s.Config.SyncAttributes(user, entry)
+	if err != nil || attributes == nil {
+		return err
+	}
+	_, err = s.Keezle.UpdateUser(userId, *attributes)
+	return err
+}
+
+// createUser creates a user with a key of the provider.
+func (s *SignIn[UA, SA]) createUser(provider, username string, entry *Entry) (string, error) {
+	opts := keezle.CreateUserOptions[UA]{}
+	opts.Key.Provider = provider
+	opts.Key.ProviderUserID = username
+	if s.Config.UserAttributes != nil {
+		attributes, err := s.Config.UserAttributes(entry)
+		if err != nil {
+			return "", err
+		}
+		opts.Attributes = attributes
+	}
+
+	created, err := s.Keezle.CreateUser(opts)
+	if err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
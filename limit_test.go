@@ -0,0 +1,76 @@
+package keezle_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+)
+
+func TestSessionLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy keezle.SessionLimitStrategy
+		err      error
+		// kept are the sessions which remain after the third login, the first session was created first and
+		// used last.
+		kept [2]bool
+	}{
+		{"reject", keezle.SessionLimitReject, keezle.ErrSessionLimitReached, [2]bool{true, true}},
+		{"evict oldest", keezle.SessionLimitEvictOldest, nil, [2]bool{false, true}},
+		{"evict least recently used", keezle.SessionLimitEvictLeastRecentlyUsed, nil, [2]bool{true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, clock := newKeezle(t, &keezle.SessionConfig{
+				ActivePeriod:     time.Hour,
+				IdlePeriod:       time.Hour,
+				RenewalThreshold: 0.01,
+				Limit:            &keezle.SessionLimit{Max: 2, Strategy: tt.strategy},
+			})
+			var sessions [2]string
+			for i := range sessions {
+				session, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				sessions[i] = session.ID
+				clock.Advance(time.Minute)
+			}
+			if validated, err := k.ValidateSession(sessions[0]); err != nil || !validated.Fresh {
+				t.Fatalf("first session was not renewed: %v", err)
+			}
+			clock.Advance(time.Minute)
+
+			_, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("third login returned %v, want %v", err, tt.err)
+			}
+			for i, id := range sessions {
+				if _, err := k.GetSession(id); (err == nil) != tt.kept[i] {
+					t.Errorf("session %d: kept = %v, want %v", i+1, err == nil, tt.kept[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSessionLimitIgnoresExpiredSessions(t *testing.T) {
+	k, clock := newKeezle(t, &keezle.SessionConfig{
+		ActivePeriod: time.Hour,
+		IdlePeriod:   time.Hour,
+		Limit:        &keezle.SessionLimit{Max: 1, Strategy: keezle.SessionLimitReject},
+	})
+	if _, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}}); !errors.Is(err, keezle.ErrSessionLimitReached) {
+		t.Fatalf("second login returned %v, want ErrSessionLimitReached", err)
+	}
+
+	clock.Advance(2 * time.Hour)
+	if _, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}}); err != nil {
+		t.Errorf("login after the session expired: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+// Package keezlechi provides Keezle middleware for chi routers.
+// chi uses standard net/http middleware, so the middleware can be used with any net/http router.
+package keezlechi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/models"
+)
+
+type authRequestContextKey struct{}
+
+// Middleware validates the session of every request and stores the AuthRequest in the request context.
+// Requests failing the CSRF check are rejected with 403 Forbidden.
+func Middleware[UA, SA models.AnyStruct](k *keezle.Keezle[UA, SA]) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			authReq, err := k.HandleRequest(req)
+			if err != nil {
+				if errors.Is(err, keezle.ErrInvalidRequestOrigin) {
+					http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+					return
+				}
+				k.Config.Logger.Log("error: keezlechi: %v", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			authReq.WriteCookie = func(cookie *http.Cookie) {
+				http.SetCookie(w, cookie)
+			}
+
+			if _, err := authReq.Validate(); err != nil {
+				k.Config.Logger.Log("error: keezlechi: failed to validate session: %v", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			ctx := context.WithValue(req.Context(), authRequestContextKey{}, authReq)
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+// RequireSession rejects requests without a valid session with 401 Unauthorized.
+// It must be used after Middleware.
+func RequireSession[UA, SA models.AnyStruct](next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, ok := Session[UA, SA](req.Context()); !ok {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// AuthRequest returns the AuthRequest stored in the context by Middleware.
+func AuthRequest[UA, SA models.AnyStruct](ctx context.Context) *keezle.AuthRequest[UA, SA] {
+	authReq, _ := ctx.Value(authRequestContextKey{}).(*keezle.AuthRequest[UA, SA])
+	return authReq
+}
+
+// Session returns the validated session of the request, if any.
+func Session[UA, SA models.AnyStruct](ctx context.Context) (*models.Session[UA, SA], bool) {
+	authReq := AuthRequest[UA, SA](ctx)
+	if authReq == nil {
+		return nil, false
+	}
+	session, err := authReq.Validate()
+	return session, err == nil && session != nil
+}
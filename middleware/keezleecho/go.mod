@@ -0,0 +1,22 @@
+module github.com/gaurishhs/keezle/middleware/keezleecho
+
+go 1.24.2
+
+require (
+	github.com/gaurishhs/keezle v0.0.0-20250709172739-4ff048670fb0
+	github.com/gaurishhs/keezle/models v0.0.0-20250709172739-4ff048670fb0
+	github.com/labstack/echo/v4 v4.13.4
+)
+
+require (
+	github.com/labstack/gommon v0.4.2 // indirect
+	github.com/mattn/go-colorable v0.1.14 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/rs/xid v1.6.0 // indirect
+	github.com/valyala/bytebufferpool v1.0.0 // indirect
+	github.com/valyala/fasttemplate v1.2.2 // indirect
+	golang.org/x/crypto v0.39.0 // indirect
+	golang.org/x/net v0.40.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/text v0.26.0 // indirect
+)
@@ -0,0 +1,67 @@
+// Package keezleecho provides Keezle middleware for echo.
+package keezleecho
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/models"
+	"github.com/labstack/echo/v4"
+)
+
+// ContextKey is the key under which the AuthRequest is stored in the echo context.
+const ContextKey = "keezle"
+
+// Middleware validates the session of every request and stores the AuthRequest in the echo context.
+// Requests failing the CSRF check are rejected with 403 Forbidden.
+func Middleware[UA, SA models.AnyStruct](k *keezle.Keezle[UA, SA]) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			authReq, err := k.HandleRequest(c.Request())
+			if err != nil {
+				if errors.Is(err, keezle.ErrInvalidRequestOrigin) {
+					return echo.NewHTTPError(http.StatusForbidden)
+				}
+				return err
+			}
+			authReq.WriteCookie = c.SetCookie
+
+			if _, err := authReq.Validate(); err != nil {
+				return err
+			}
+
+			c.Set(ContextKey, authReq)
+			return next(c)
+		}
+	}
+}
+
+// RequireSession rejects requests without a valid session with 401 Unauthorized.
+// It must be used after Middleware.
+func RequireSession[UA, SA models.AnyStruct]() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if _, ok := Session[UA, SA](c); !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized)
+			}
+			return next(c)
+		}
+	}
+}
+
+// AuthRequest returns the AuthRequest stored in the echo context by Middleware.
+func AuthRequest[UA, SA models.AnyStruct](c echo.Context) *keezle.AuthRequest[UA, SA] {
+	authReq, _ := c.Get(ContextKey).(*keezle.AuthRequest[UA, SA])
+	return authReq
+}
+
+// Session returns the validated session of the request, if any.
+func Session[UA, SA models.AnyStruct](c echo.Context) (*models.Session[UA, SA], bool) {
+	authReq := AuthRequest[UA, SA](c)
+	if authReq == nil {
+		return nil, false
+	}
+	session, err := authReq.Validate()
+	return session, err == nil && session != nil
+}
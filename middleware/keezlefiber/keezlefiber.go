@@ -0,0 +1,103 @@
+// Package keezlefiber provides Keezle middleware for fiber.
+// fiber is built on fasthttp, so the request is converted to a net/http request for Keezle and
+// session cookies are translated to fiber cookies.
+package keezlefiber
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+)
+
+// LocalsKey is the key under which the AuthRequest is stored in the fiber locals.
+const LocalsKey = "keezle"
+
+// toFiberCookie converts a net/http cookie to a fiber cookie.
+func toFiberCookie(cookie *http.Cookie) *fiber.Cookie {
+	fiberCookie := &fiber.Cookie{
+		Name:        cookie.Name,
+		Value:       cookie.Value,
+		Path:        cookie.Path,
+		Domain:      cookie.Domain,
+		MaxAge:      cookie.MaxAge,
+		Expires:     cookie.Expires,
+		Secure:      cookie.Secure,
+		HTTPOnly:    cookie.HttpOnly,
+		SessionOnly: cookie.MaxAge == 0 && cookie.Expires.IsZero(),
+	}
+	switch cookie.SameSite {
+	case http.SameSiteStrictMode:
+		fiberCookie.SameSite = fiber.CookieSameSiteStrictMode
+	case http.SameSiteNoneMode:
+		fiberCookie.SameSite = fiber.CookieSameSiteNoneMode
+	default:
+		fiberCookie.SameSite = fiber.CookieSameSiteLaxMode
+	}
+	return fiberCookie
+}
+
+// Middleware validates the session of every request and stores the AuthRequest in the fiber locals.
+// Requests failing the CSRF check are rejected with 403 Forbidden.
+func Middleware[UA, SA models.AnyStruct](k *keezle.Keezle[UA, SA]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req, err := adaptor.ConvertRequest(c, true)
+		if err != nil {
+			return err
+		}
+
+		authReq, err := k.HandleRequest(req)
+		if err != nil {
+			if errors.Is(err, keezle.ErrInvalidRequestOrigin) {
+				return fiber.ErrForbidden
+			}
+			return err
+		}
+		authReq.WriteCookie = func(cookie *http.Cookie) {
+			c.Cookie(toFiberCookie(cookie))
+		}
+
+		if _, err := authReq.Validate(); err != nil {
+			return err
+		}
+
+		c.Locals(LocalsKey, authReq)
+		return c.Next()
+	}
+}
+
+// RequireSession rejects requests without a valid session with 401 Unauthorized.
+// It must be used after Middleware.
+func RequireSession[UA, SA models.AnyStruct]() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := Session[UA, SA](c); !ok {
+			return fiber.ErrUnauthorized
+		}
+		return c.Next()
+	}
+}
+
+// SetSession sets the session cookie on the fiber response.
+// Passing a nil session removes the session cookie.
+func SetSession[UA, SA models.AnyStruct](c *fiber.Ctx, k *keezle.Keezle[UA, SA], session *models.Session[UA, SA]) {
+	c.Cookie(toFiberCookie(k.CreateSessionCookie(session)))
+}
+
+// AuthRequest returns the AuthRequest stored in the fiber locals by Middleware.
+func AuthRequest[UA, SA models.AnyStruct](c *fiber.Ctx) *keezle.AuthRequest[UA, SA] {
+	authReq, _ := c.Locals(LocalsKey).(*keezle.AuthRequest[UA, SA])
+	return authReq
+}
+
+// Session returns the validated session of the request, if any.
+func Session[UA, SA models.AnyStruct](c *fiber.Ctx) (*models.Session[UA, SA], bool) {
+	authReq := AuthRequest[UA, SA](c)
+	if authReq == nil {
+		return nil, false
+	}
+	session, err := authReq.Validate()
+	return session, err == nil && session != nil
+}
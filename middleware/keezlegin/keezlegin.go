@@ -0,0 +1,75 @@
+// Package keezlegin provides Keezle middleware for gin.
+package keezlegin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ContextKey is the key under which the AuthRequest is stored in the gin context.
+const ContextKey = "keezle"
+
+// Middleware validates the session of every request and stores the AuthRequest in the gin context.
+// Requests failing the CSRF check are aborted with 403 Forbidden.
+func Middleware[UA, SA models.AnyStruct](k *keezle.Keezle[UA, SA]) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authReq, err := k.HandleRequest(c.Request)
+		if err != nil {
+			if errors.Is(err, keezle.ErrInvalidRequestOrigin) {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			k.Config.Logger.Log("error: keezlegin: %v", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		authReq.WriteCookie = func(cookie *http.Cookie) {
+			http.SetCookie(c.Writer, cookie)
+		}
+
+		if _, err := authReq.Validate(); err != nil {
+			k.Config.Logger.Log("error: keezlegin: failed to validate session: %v", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+
+		c.Set(ContextKey, authReq)
+		c.Next()
+	}
+}
+
+// RequireSession aborts requests without a valid session with 401 Unauthorized.
+// It must be used after Middleware.
+func RequireSession[UA, SA models.AnyStruct]() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := Session[UA, SA](c); !ok {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
+
+// AuthRequest returns the AuthRequest stored in the gin context by Middleware.
+func AuthRequest[UA, SA models.AnyStruct](c *gin.Context) *keezle.AuthRequest[UA, SA] {
+	value, ok := c.Get(ContextKey)
+	if !ok {
+		return nil
+	}
+	authReq, _ := value.(*keezle.AuthRequest[UA, SA])
+	return authReq
+}
+
+// Session returns the validated session of the request, if any.
+func Session[UA, SA models.AnyStruct](c *gin.Context) (*models.Session[UA, SA], bool) {
+	authReq := AuthRequest[UA, SA](c)
+	if authReq == nil {
+		return nil, false
+	}
+	session, err := authReq.Validate()
+	return session, err == nil && session != nil
+}
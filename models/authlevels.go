@@ -0,0 +1,31 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AuthLevels maps each authentication level of a session to the time the user last authenticated with it.
+// It is stored as JSON.
+type AuthLevels map[int]time.Time
+
+// Value implements driver.Valuer.
+func (l AuthLevels) Value() (driver.Value, error) {
+	return json.Marshal(l)
+}
+
+// Scan implements sql.Scanner.
+func (l *AuthLevels) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(src, l)
+	case string:
+		return json.Unmarshal([]byte(src), l)
+	default:
+		return fmt.Errorf("models: cannot scan %T into AuthLevels", src)
+	}
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// SessionBinding holds the client characteristics a session is bound to.
+// Empty fields are not bound. It is stored as JSON.
+type SessionBinding struct {
+	// IPPrefix is the network prefix of the client IP address, e.g. "203.0.113.0/24".
+	IPPrefix string `json:"ip_prefix,omitempty"`
+	// UserAgentHash is the hex encoded SHA-256 hash of the client user agent.
+	UserAgentHash string `json:"user_agent_hash,omitempty"`
+	// CertificateFingerprint is the hex encoded SHA-256 fingerprint of the TLS client certificate.
+	CertificateFingerprint string `json:"certificate_fingerprint,omitempty"`
+	// KeyThumbprint is the JWK thumbprint of the key the client proves possession of, e.g. with DPoP.
+	KeyThumbprint string `json:"key_thumbprint,omitempty"`
+}
+
+// Value implements driver.Valuer.
+func (b SessionBinding) Value() (driver.Value, error) {
+	return json.Marshal(b)
+}
+
+// Scan implements sql.Scanner.
+func (b *SessionBinding) Scan(src any) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(src, b)
+	case string:
+		return json.Unmarshal([]byte(src), b)
+	default:
+		return fmt.Errorf("models: cannot scan %T into SessionBinding", src)
+	}
+}
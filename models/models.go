@@ -40,8 +40,40 @@ type DBSession[SA AnyStruct] struct {
 	ActiveExpiresAt *time.Time
 	IdleExpiresAt   *time.Time
 	Attributes      *SA
+	// Persistent indicates whether the session was created as a "remember me" session.
+	Persistent *bool
+	// CreatedAt is the time the user logged in. It is carried over when the session id is rotated.
+	CreatedAt *time.Time
+	// IssuedAt is the time the current session id was issued.
+	IssuedAt *time.Time
+	// ReplacedBy is the id of the session that replaced this one when its id was rotated.
+	ReplacedBy *string
+	// LastSeenAt is the time the session was last renewed or rotated.
+	LastSeenAt *time.Time
+	// IPAddress is the IP address of the client which created the session.
+	IPAddress *string
+	// UserAgent is the user agent of the client which created the session.
+	UserAgent *string
+	// Binding holds the client characteristics the session is bound to.
+	Binding *SessionBinding
+	// AuthenticatedAt is the time the user last entered their credentials for this session.
+	AuthenticatedAt *time.Time
+	// AuthLevel is the highest authentication level the session has reached.
+	AuthLevel *int
+	// AuthLevels holds the time of the last authentication with each level.
+	AuthLevels *AuthLevels
 }
 
+// Session states.
+const (
+	// SessionStateActive is the state of a session within its active period.
+	SessionStateActive = "active"
+	// SessionStateIdle is the state of a session past its active period which can still be renewed.
+	SessionStateIdle = "idle"
+	// SessionStateExpired is the state of a session past its idle period.
+	SessionStateExpired = "expired"
+)
+
 // Session represents a user session.
 // It contains the ID, associated User, active and idle expiration times, session attributes, and state.
 // The User is a pointer to allow for nil values.
@@ -57,8 +89,29 @@ type Session[UA, SA AnyStruct] struct {
 	IdleExpiresAt time.Time
 	// Attributes are the session attributes associated with this session.
 	Attributes *SA
-	// State indicates the current state of the session i.e. "active" or "idle".
+	// State indicates the current state of the session i.e. SessionStateActive, SessionStateIdle or
+	// SessionStateExpired.
 	State string
 	// Fresh indicates whether the session is newly created.
 	Fresh bool
+	// Persistent indicates whether the session is a "remember me" session.
+	// Persistent sessions use their own active and idle periods and a cookie which outlives the browser session.
+	Persistent bool
+	// CreatedAt is the time the user logged in.
+	CreatedAt time.Time
+	// LastSeenAt is the time the session was last renewed or rotated, it is accurate to
+	// SessionConfig.RenewalThreshold of the active period.
+	LastSeenAt time.Time
+	// IPAddress is the IP address of the client which created the session.
+	IPAddress string
+	// UserAgent is the user agent of the client which created the session.
+	UserAgent string
+	// AuthenticatedAt is the time the user last entered their credentials for this session, i.e. the
+	// login or the last elevation.
+	AuthenticatedAt time.Time
+	// AuthLevel is the highest authentication level the session has reached.
+	AuthLevel int
+	// AuthLevels holds the time of the last authentication with each level, so that a recent authentication
+	// with a low level does not count as a recent authentication with a higher one.
+	AuthLevels AuthLevels
 }
@@ -0,0 +1,277 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+)
+
+// maxResponseSize is the maximum size of a response read from a provider.
+const maxResponseSize = 1 << 20
+
+// Config holds the client registration of a provider.
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the URL of the callback handler, as registered with the provider.
+	RedirectURL string
+	// Scopes overrides the default scopes of the provider.
+	Scopes []string
+	// HTTPClient is used for requests to the provider, defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// BaseURL overrides the base URL of the authorization and token endpoints of built-in providers, e.g. for
+	// self-hosted instances or a local mock server.
+	BaseURL string
+	// APIURL overrides the base URL of the API built-in providers fetch the user from.
+	APIURL string
+	// Clock tells the current time, e.g. to compute the expiration time of tokens, defaults to
+	// keezle.SystemClock.
+	Clock keezle.Clock
+}
+
+// urlOrDefault returns the URL without a trailing slash, or the fallback if it is empty.
+func urlOrDefault(url, fallback string) string {
+	if url == "" {
+		return fallback
+	}
+	return strings.TrimSuffix(url, "/")
+}
+
+// defaultScopes sets the scopes of the config unless they are overridden.
+func (c *Config) defaultScopes(scopes ...string) {
+	if len(c.Scopes) == 0 {
+		c.Scopes = scopes
+	}
+}
+
+// Endpoint holds the authorization and token endpoints of a provider.
+type Endpoint struct {
+	AuthURL  string
+	TokenURL string
+}
+
+// Client is an OAuth 2.0 client for the endpoints of a provider. It implements the authorization and token
+// requests of Provider, so that providers only add their name and user info mapping.
+type Client struct {
+	Config   Config
+	Endpoint Endpoint
+	// AuthParams are added to every authorization URL, e.g. "prompt" or "access_type".
+	AuthParams url.Values
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.Config.HTTPClient != nil {
+		return c.Config.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) now() time.Time {
+	if c.Config.Clock == nil {
+		return keezle.SystemClock.Now()
+	}
+	return c.Config.Clock.Now()
+}
+
+// GetAuthorizationURL returns the URL of the authorization endpoint for the request.
+// The nonce is only sent by OpenID Connect providers.
+func (c *Client) GetAuthorizationURL(req AuthorizationRequest) string {
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {c.Config.ClientID},
+		"state":         {req.State},
+	}
+	if c.Config.RedirectURL != "" {
+		params.Set("redirect_uri", c.Config.RedirectURL)
+	}
+	if len(c.Config.Scopes) > 0 {
+		params.Set("scope", strings.Join(c.Config.Scopes, " "))
+	}
+	if req.CodeChallenge != "" {
+		params.Set("code_challenge", req.CodeChallenge)
+		params.Set("code_challenge_method", "S256")
+	}
+	for key, values := range c.AuthParams {
+		params[key] = values
+	}
+
+	separator := "?"
+	if strings.Contains(c.Endpoint.AuthURL, "?") {
+		separator = "&"
+	}
+	return c.Endpoint.AuthURL + separator + params.Encode()
+}
+
+// ExchangeCode exchanges an authorization code for a token.
+func (c *Client) ExchangeCode(ctx context.Context, req ExchangeRequest) (*Token, error) {
+	params := url.Values{
+		"grant_type": {"authorization_code"},
+		"code":       {req.Code},
+	}
+	if c.Config.RedirectURL != "" {
+		params.Set("redirect_uri", c.Config.RedirectURL)
+	}
+	if req.CodeVerifier != "" {
+		params.Set("code_verifier", req.CodeVerifier)
+	}
+	return c.requestToken(ctx, params)
+}
+
+// RefreshToken exchanges a refresh token for a new token.
+// Providers which do not rotate refresh tokens omit it from the response, the token then keeps the refresh
+// token it was refreshed with.
+func (c *Client) RefreshToken(ctx context.Context, refreshToken string) (*Token, error) {
+	token, err := c.requestToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	return token, nil
+}
+
+// tokenResponse is the response of a token endpoint, as defined in RFC 6749 section 5.1.
+type tokenResponse struct {
+	AccessToken  string          `json:"access_token"`
+	TokenType    string          `json:"token_type"`
+	RefreshToken string          `json:"refresh_token"`
+	ExpiresIn    json.RawMessage `json:"expires_in"`
+	Scope        string          `json:"scope"`
+	IDToken      string          `json:"id_token"`
+	Error
+}
+
+// requestToken sends a request to the token endpoint, authenticating the client with its credentials in the
+// request body, which every supported provider accepts.
+func (c *Client) requestToken(ctx context.Context, params url.Values) (*Token, error) {
+	params.Set("client_id", c.Config.ClientID)
+	if c.Config.ClientSecret != "" {
+		params.Set("client_secret", c.Config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint.TokenURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var response tokenResponse
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType == "application/x-www-form-urlencoded" {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, ErrInvalidToken
+		}
+		response = tokenResponse{
+			AccessToken:  values.Get("access_token"),
+			TokenType:    values.Get("token_type"),
+			RefreshToken: values.Get("refresh_token"),
+			Scope:        values.Get("scope"),
+			IDToken:      values.Get("id_token"),
+			Error:        Error{Code: values.Get("error"), Description: values.Get("error_description")},
+		}
+		if expiresIn := values.Get("expires_in"); expiresIn != "" {
+			response.ExpiresIn = json.RawMessage(expiresIn)
+		}
+	} else if err := json.Unmarshal(body, &response); err != nil && res.StatusCode == http.StatusOK {
+		return nil, ErrInvalidToken
+	}
+
+	// Some providers report errors with a successful status code.
+	if response.Error.Code != "" {
+		return nil, &response.Error
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oauth: token endpoint returned %s", res.Status)
+	}
+	if response.AccessToken == "" {
+		return nil, ErrInvalidToken
+	}
+
+	token := &Token{
+		AccessToken:  response.AccessToken,
+		TokenType:    response.TokenType,
+		RefreshToken: response.RefreshToken,
+		Scope:        response.Scope,
+		IDToken:      response.IDToken,
+	}
+	// expires_in is a number, but some providers send it as a string.
+	if expiresIn, err := strconv.ParseInt(strings.Trim(string(response.ExpiresIn), `"`), 10, 64); err == nil && expiresIn > 0 {
+		token.ExpiresAt = c.now().Add(time.Duration(expiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// GetJSON requests the URL with the access token of the token and decodes the JSON response into v.
+// Numbers are decoded as json.Number when v is a map, so that numeric user ids keep their precision.
+func (c *Client) GetJSON(ctx context.Context, token *Token, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("oauth: %s returned %s", url, res.Status)
+	}
+
+	decoder := json.NewDecoder(io.LimitReader(res.Body, maxResponseSize))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// ProviderTokens converts the token for storage with keezle.Keezle.SetProviderTokens.
+func (t *Token) ProviderTokens() *keezle.ProviderTokens {
+	return &keezle.ProviderTokens{
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+		TokenType:    t.TokenType,
+		Scope:        t.Scope,
+		ExpiresAt:    t.ExpiresAt,
+	}
+}
+
+// RefreshProviderTokens implements keezle.ProviderTokenRefresher. An ErrorInvalidGrant error of the provider is
+// reported as keezle.ErrProviderGrantRevoked.
+func (c *Client) RefreshProviderTokens(ctx context.Context, refreshToken string) (*keezle.ProviderTokens, error) {
+	token, err := c.RefreshToken(ctx, refreshToken)
+	if err != nil {
+		var oauthErr *Error
+		if errors.As(err, &oauthErr) && oauthErr.Code == ErrorInvalidGrant {
+			return nil, fmt.Errorf("%w: %w", keezle.ErrProviderGrantRevoked, err)
+		}
+		return nil, err
+	}
+	return token.ProviderTokens(), nil
+}
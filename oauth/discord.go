@@ -0,0 +1,57 @@
+package oauth
+
+import "context"
+
+// Discord is the Discord provider. It requests the "identify" and "email" scopes by default.
+type Discord struct {
+	*Client
+	APIURL string
+	// CDNURL is the base URL of avatar images.
+	CDNURL string
+}
+
+// NewDiscord creates a Discord provider.
+func NewDiscord(config Config) *Discord {
+	config.defaultScopes("identify", "email")
+	baseURL := urlOrDefault(config.BaseURL, "https://discord.com")
+	return &Discord{
+		Client: &Client{
+			Config: config,
+			Endpoint: Endpoint{
+				AuthURL:  baseURL + "/oauth2/authorize",
+				TokenURL: baseURL + "/api/oauth2/token",
+			},
+		},
+		APIURL: urlOrDefault(config.APIURL, baseURL+"/api"),
+		CDNURL: "https://cdn.discordapp.com",
+	}
+}
+
+func (p *Discord) Name() string {
+	return "discord"
+}
+
+// GetUser fetches the current user.
+func (p *Discord) GetUser(ctx context.Context, token *Token) (*User, error) {
+	var info map[string]any
+	if err := p.GetJSON(ctx, token, p.APIURL+"/users/@me", &info); err != nil {
+		return nil, err
+	}
+	user := &User{
+		ID:            StringClaim(info, "id"),
+		Email:         StringClaim(info, "email"),
+		EmailVerified: BoolClaim(info, "verified"),
+		Name:          StringClaim(info, "global_name"),
+		Raw:           info,
+	}
+	if user.ID == "" {
+		return nil, missingUserID("id")
+	}
+	if user.Name == "" {
+		user.Name = StringClaim(info, "username")
+	}
+	if avatar := StringClaim(info, "avatar"); avatar != "" {
+		user.AvatarURL = p.CDNURL + "/avatars/" + user.ID + "/" + avatar + ".png"
+	}
+	return user, nil
+}
@@ -0,0 +1,175 @@
+package oauth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+)
+
+// CookieConfig defines the cookie which keeps the state of an authorization request.
+type CookieConfig struct {
+	// Name defaults to "oauth_" followed by the provider name.
+	Name   string
+	Domain string
+	// Path defaults to "/".
+	Path   string
+	Secure bool
+	// MaxAge is how long the user has to complete the authorization, defaults to 10 minutes.
+	MaxAge time.Duration
+}
+
+// FlowConfig defines the configuration of a Flow.
+type FlowConfig struct {
+	// Secret signs the state cookie. It should be at least 32 random bytes.
+	Secret []byte
+	Cookie CookieConfig
+	// Clock tells the current time, defaults to keezle.SystemClock.
+	Clock keezle.Clock
+}
+
+// Flow runs the authorization code flow of a provider.
+// The state, the PKCE code verifier and the nonce of an authorization request are kept in a signed cookie,
+// so that no server-side storage is needed and a callback is only accepted in the browser that started it.
+type Flow struct {
+	Provider Provider
+	Config   FlowConfig
+}
+
+// CallbackResult is the result of a successful callback.
+type CallbackResult struct {
+	Token *Token
+	User  *User
+}
+
+// NewFlow creates a flow for the provider.
+func NewFlow(provider Provider, config FlowConfig) *Flow {
+	if len(config.Secret) == 0 {
+		panic(ErrMissingSecret)
+	}
+	if config.Cookie.Name == "" {
+		config.Cookie.Name = "oauth_" + provider.Name()
+	}
+	if config.Cookie.Path == "" {
+		config.Cookie.Path = "/"
+	}
+	if config.Cookie.MaxAge == 0 {
+		config.Cookie.MaxAge = time.Minute * 10
+	}
+	if config.Clock == nil {
+		config.Clock = keezle.SystemClock
+	}
+	return &Flow{Provider: provider, Config: config}
+}
+
+func (f *Flow) cookie(value string, expires time.Time) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     f.Config.Cookie.Name,
+		Value:    value,
+		Domain:   f.Config.Cookie.Domain,
+		Path:     f.Config.Cookie.Path,
+		Secure:   f.Config.Cookie.Secure,
+		HttpOnly: true,
+		// The callback is a top-level cross-site navigation from the provider, which Lax cookies are sent with.
+		SameSite: http.SameSiteLaxMode,
+		Expires:  expires,
+	}
+	if value == "" {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// Begin starts an authorization request. It sets the state cookie and returns the authorization URL the user
+// has to be redirected to.
+func (f *Flow) Begin(w http.ResponseWriter) (string, error) {
+	state, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	codeVerifier, err := GenerateCodeVerifier()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := f.Config.Clock.Now().Add(f.Config.Cookie.MaxAge)
+	value, err := encodeState(f.Config.Secret, &flowState{
+		Provider:     f.Provider.Name(),
+		State:        state,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		ExpiresAt:    expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, f.cookie(value, expiresAt))
+
+	return f.Provider.GetAuthorizationURL(AuthorizationRequest{
+		State:         state,
+		CodeChallenge: CodeChallengeS256(codeVerifier),
+		Nonce:         nonce,
+	}), nil
+}
+
+// Redirect is a handler which starts an authorization request and redirects the user to the provider.
+func (f *Flow) Redirect(w http.ResponseWriter, req *http.Request) {
+	authURL, err := f.Begin(w)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, req, authURL, http.StatusFound)
+}
+
+// Callback completes the authorization request the callback request belongs to and returns the token and
+// user of the provider. The state cookie is cleared, so that every authorization request completes only once.
+// It returns ErrInvalidState if the request was not started by Begin in the same browser or has expired, and
+// an *Error if the provider reported an error, e.g. ErrorAccessDenied when the user denied the request.
+func (f *Flow) Callback(w http.ResponseWriter, req *http.Request) (*CallbackResult, error) {
+	cookie, err := req.Cookie(f.Config.Cookie.Name)
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+	http.SetCookie(w, f.cookie("", time.Unix(0, 0)))
+
+	state, err := decodeState(f.Config.Secret, cookie.Value, f.Config.Clock.Now())
+	if err != nil {
+		return nil, err
+	}
+	query := req.URL.Query()
+	if state.Provider != f.Provider.Name() || subtle.ConstantTimeCompare([]byte(state.State), []byte(query.Get("state"))) != 1 {
+		return nil, ErrInvalidState
+	}
+
+	if code := query.Get("error"); code != "" {
+		return nil, &Error{
+			Code:        code,
+			Description: query.Get("error_description"),
+			URI:         query.Get("error_uri"),
+		}
+	}
+	code := query.Get("code")
+	if code == "" {
+		return nil, ErrMissingCode
+	}
+
+	token, err := f.Provider.ExchangeCode(req.Context(), ExchangeRequest{
+		Code:         code,
+		CodeVerifier: state.CodeVerifier,
+		Nonce:        state.Nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+	user, err := f.Provider.GetUser(req.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	return &CallbackResult{Token: token, User: user}, nil
+}
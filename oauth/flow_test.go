@@ -0,0 +1,356 @@
+package oauth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/keezletest"
+	"github.com/gaurishhs/keezle/oauth"
+)
+
+var epoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// provider is a stub OAuth server which issues a token for the code "code" if the code verifier matches the
+// code challenge of the last authorization request.
+type provider struct {
+	*httptest.Server
+	t *testing.T
+
+	mu            sync.Mutex
+	codeChallenge string
+	// tokenResponse replaces the response of the token endpoint if set.
+	tokenResponse func(w http.ResponseWriter)
+}
+
+func newProvider(t *testing.T) *provider {
+	p := &provider{t: t}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", p.token)
+	mux.HandleFunc("GET /userinfo", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"sub": "u1", "email": "u1@example.com", "email_verified": true})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *provider) token(w http.ResponseWriter, req *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tokenResponse != nil {
+		p.tokenResponse(w)
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		p.t.Error(err)
+	}
+	switch {
+	case req.PostForm.Get("client_id") != "client" || req.PostForm.Get("client_secret") != "secret":
+		writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "invalid_client"})
+	case req.PostForm.Get("grant_type") == "authorization_code" && req.PostForm.Get("code") != "code":
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_grant"})
+	case req.PostForm.Get("grant_type") == "authorization_code" && oauth.CodeChallengeS256(req.PostForm.Get("code_verifier")) != p.codeChallenge:
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_grant", "error_description": "code verifier mismatch"})
+	default:
+		writeJSON(w, http.StatusOK, map[string]any{"access_token": "access", "token_type": "Bearer", "expires_in": 3600})
+	}
+}
+
+func (p *provider) setTokenResponse(response func(w http.ResponseWriter)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tokenResponse = response
+}
+
+func (p *provider) oauthProvider(name string, clock keezle.Clock) *oauth.GenericProvider {
+	return oauth.NewGenericProvider(name, oauth.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "https://app.example.com/callback",
+		HTTPClient:   p.Client(),
+		Clock:        clock,
+	}, oauth.Endpoint{AuthURL: p.URL + "/authorize", TokenURL: p.URL + "/token"}, p.URL+"/userinfo")
+}
+
+// begin starts an authorization request and returns the state cookie and the state of the authorization URL.
+func (p *provider) begin(t *testing.T, flow *oauth.Flow) (*http.Cookie, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	authURL, err := flow.Begin(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("authorization URL has no S256 code challenge: %s", authURL)
+	}
+	p.mu.Lock()
+	p.codeChallenge = query.Get("code_challenge")
+	p.mu.Unlock()
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("state cookie = %v", cookies)
+	}
+	return cookies[0], query.Get("state")
+}
+
+func callback(flow *oauth.Flow, cookie *http.Cookie, query url.Values) (*oauth.CallbackResult, *httptest.ResponseRecorder, error) {
+	req := httptest.NewRequest(http.MethodGet, "/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	result, err := flow.Callback(rec, req)
+	return result, rec, err
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestFlow(t *testing.T) {
+	p := newProvider(t)
+	clock := keezletest.NewFakeClock(epoch)
+	flow := oauth.NewFlow(p.oauthProvider("stub", clock), oauth.FlowConfig{Secret: secret, Clock: clock})
+
+	cookie, state := p.begin(t, flow)
+	result, rec, err := callback(flow, cookie, url.Values{"state": {state}, "code": {"code"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.User.ID != "u1" || result.User.Email != "u1@example.com" || !result.User.EmailVerified {
+		t.Errorf("user = %+v", result.User)
+	}
+	if want := epoch.Add(time.Hour); !result.Token.ExpiresAt.Equal(want) {
+		t.Errorf("token expiry = %v, want %v", result.Token.ExpiresAt, want)
+	}
+	if cleared := rec.Result().Cookies(); len(cleared) != 1 || cleared[0].MaxAge >= 0 {
+		t.Errorf("state cookie was not cleared: %v", cleared)
+	}
+}
+
+func TestFlowPKCE(t *testing.T) {
+	p := newProvider(t)
+	flow := oauth.NewFlow(p.oauthProvider("stub", nil), oauth.FlowConfig{Secret: secret})
+
+	// The code verifier of the first request does not match the challenge of the second one.
+	cookie, state := p.begin(t, flow)
+	p.begin(t, flow)
+	_, _, err := callback(flow, cookie, url.Values{"state": {state}, "code": {"code"}})
+	var oauthErr *oauth.Error
+	if !errors.As(err, &oauthErr) || oauthErr.Code != oauth.ErrorInvalidGrant {
+		t.Errorf("callback with another code verifier returned %v, want invalid_grant", err)
+	}
+}
+
+func TestFlowState(t *testing.T) {
+	p := newProvider(t)
+	clock := keezletest.NewFakeClock(epoch)
+	flow := oauth.NewFlow(p.oauthProvider("stub", clock), oauth.FlowConfig{Secret: secret, Clock: clock})
+	// other uses the cookie name of flow, as if the provider was renamed.
+	other := oauth.NewFlow(p.oauthProvider("other", clock), oauth.FlowConfig{Secret: secret, Clock: clock, Cookie: oauth.CookieConfig{Name: "oauth_stub"}})
+	otherSecret := oauth.NewFlow(p.oauthProvider("stub", clock), oauth.FlowConfig{Secret: []byte("another secret of at least 32 bytes"), Clock: clock})
+
+	tests := []struct {
+		name   string
+		mutate func(cookie *http.Cookie, query url.Values) (*oauth.Flow, *http.Cookie)
+	}{
+		{"missing cookie", func(cookie *http.Cookie, query url.Values) (*oauth.Flow, *http.Cookie) {
+			return flow, nil
+		}},
+		{"state mismatch", func(cookie *http.Cookie, query url.Values) (*oauth.Flow, *http.Cookie) {
+			query.Set("state", "forged")
+			return flow, cookie
+		}},
+		{"missing state", func(cookie *http.Cookie, query url.Values) (*oauth.Flow, *http.Cookie) {
+			query.Del("state")
+			return flow, cookie
+		}},
+		{"tampered payload", func(cookie *http.Cookie, query url.Values) (*oauth.Flow, *http.Cookie) {
+			payload, signature, _ := strings.Cut(cookie.Value, ".")
+			cookie.Value = flip(payload) + "." + signature
+			return flow, cookie
+		}},
+		{"tampered signature", func(cookie *http.Cookie, query url.Values) (*oauth.Flow, *http.Cookie) {
+			payload, signature, _ := strings.Cut(cookie.Value, ".")
+			cookie.Value = payload + "." + flip(signature)
+			return flow, cookie
+		}},
+		{"unsigned", func(cookie *http.Cookie, query url.Values) (*oauth.Flow, *http.Cookie) {
+			cookie.Value, _, _ = strings.Cut(cookie.Value, ".")
+			return flow, cookie
+		}},
+		{"other secret", func(cookie *http.Cookie, query url.Values) (*oauth.Flow, *http.Cookie) {
+			return otherSecret, cookie
+		}},
+		{"provider mismatch", func(cookie *http.Cookie, query url.Values) (*oauth.Flow, *http.Cookie) {
+			return other, cookie
+		}},
+		{"expired", func(cookie *http.Cookie, query url.Values) (*oauth.Flow, *http.Cookie) {
+			clock.Advance(10 * time.Minute)
+			return flow, cookie
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Set(epoch)
+			cookie, state := p.begin(t, flow)
+			query := url.Values{"state": {state}, "code": {"code"}}
+			callbackFlow, cookie := tt.mutate(cookie, query)
+			if _, _, err := callback(callbackFlow, cookie, query); !errors.Is(err, oauth.ErrInvalidState) {
+				t.Errorf("callback returned %v, want ErrInvalidState", err)
+			}
+		})
+	}
+
+	t.Run("before expiry", func(t *testing.T) {
+		clock.Set(epoch)
+		cookie, state := p.begin(t, flow)
+		clock.Advance(10*time.Minute - time.Second)
+		if _, _, err := callback(flow, cookie, url.Values{"state": {state}, "code": {"code"}}); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// flip changes the first character of a base64url string.
+func flip(s string) string {
+	if s[0] == 'A' {
+		return "B" + s[1:]
+	}
+	return "A" + s[1:]
+}
+
+func TestFlowProviderError(t *testing.T) {
+	p := newProvider(t)
+	flow := oauth.NewFlow(p.oauthProvider("stub", nil), oauth.FlowConfig{Secret: secret})
+
+	cookie, state := p.begin(t, flow)
+	_, _, err := callback(flow, cookie, url.Values{"state": {state}, "error": {"access_denied"}, "error_description": {"denied"}})
+	var oauthErr *oauth.Error
+	if !errors.As(err, &oauthErr) || oauthErr.Code != oauth.ErrorAccessDenied || oauthErr.Description != "denied" {
+		t.Errorf("callback returned %v, want access_denied", err)
+	}
+
+	cookie, state = p.begin(t, flow)
+	if _, _, err := callback(flow, cookie, url.Values{"state": {state}}); !errors.Is(err, oauth.ErrMissingCode) {
+		t.Errorf("callback without code returned %v, want ErrMissingCode", err)
+	}
+}
+
+func TestTokenErrors(t *testing.T) {
+	p := newProvider(t)
+	client := p.oauthProvider("stub", keezletest.NewFakeClock(epoch))
+
+	tests := []struct {
+		name     string
+		response func(w http.ResponseWriter)
+		code     string
+		err      error
+	}{
+		{"json error", func(w http.ResponseWriter) {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_grant", "error_description": "expired"})
+		}, oauth.ErrorInvalidGrant, nil},
+		{"error with success status", func(w http.ResponseWriter) {
+			writeJSON(w, http.StatusOK, map[string]any{"error": "bad_verification_code"})
+		}, "bad_verification_code", nil},
+		{"form encoded error", func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+			w.Write([]byte("error=invalid_grant&error_description=revoked"))
+		}, oauth.ErrorInvalidGrant, nil},
+		{"server error", func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}, "", nil},
+		{"missing access token", func(w http.ResponseWriter) {
+			writeJSON(w, http.StatusOK, map[string]any{"token_type": "Bearer"})
+		}, "", oauth.ErrInvalidToken},
+		{"invalid json", func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte("{"))
+		}, "", oauth.ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.setTokenResponse(tt.response)
+			_, err := client.RefreshToken(context.Background(), "refresh")
+			if err == nil {
+				t.Fatal("token request succeeded")
+			}
+			var oauthErr *oauth.Error
+			if isOAuthErr := errors.As(err, &oauthErr); isOAuthErr != (tt.code != "") || (isOAuthErr && oauthErr.Code != tt.code) {
+				t.Errorf("error = %v, want code %q", err, tt.code)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("error = %v, want %v", err, tt.err)
+			}
+
+			_, err = client.RefreshProviderTokens(context.Background(), "refresh")
+			if revoked := errors.Is(err, keezle.ErrProviderGrantRevoked); revoked != (tt.code == oauth.ErrorInvalidGrant) {
+				t.Errorf("provider token refresh returned %v", err)
+			}
+		})
+	}
+}
+
+func TestTokenResponse(t *testing.T) {
+	p := newProvider(t)
+	client := p.oauthProvider("stub", keezletest.NewFakeClock(epoch))
+
+	tests := []struct {
+		name         string
+		response     func(w http.ResponseWriter)
+		expiresAt    time.Time
+		refreshToken string
+	}{
+		{"numeric expiry", func(w http.ResponseWriter) {
+			writeJSON(w, http.StatusOK, map[string]any{"access_token": "a", "expires_in": 60, "refresh_token": "rotated"})
+		}, epoch.Add(time.Minute), "rotated"},
+		{"string expiry", func(w http.ResponseWriter) {
+			writeJSON(w, http.StatusOK, map[string]any{"access_token": "a", "expires_in": "60"})
+		}, epoch.Add(time.Minute), "refresh"},
+		{"form encoded", func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+			w.Write([]byte("access_token=a&expires_in=60"))
+		}, epoch.Add(time.Minute), "refresh"},
+		{"no expiry", func(w http.ResponseWriter) {
+			writeJSON(w, http.StatusOK, map[string]any{"access_token": "a"})
+		}, time.Time{}, "refresh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p.setTokenResponse(tt.response)
+			token, err := client.RefreshToken(context.Background(), "refresh")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !token.ExpiresAt.Equal(tt.expiresAt) {
+				t.Errorf("expiry = %v, want %v", token.ExpiresAt, tt.expiresAt)
+			}
+			if token.RefreshToken != tt.refreshToken {
+				t.Errorf("refresh token = %q, want %q", token.RefreshToken, tt.refreshToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+)
+
+// GenericProvider is a provider for any OAuth 2.0 server with a user info endpoint.
+type GenericProvider struct {
+	*Client
+	ProviderName string
+	UserInfoURL  string
+	// MapUser maps the response of the user info endpoint to a user. It defaults to MapStandardClaims.
+	MapUser func(info map[string]any) (*User, error)
+}
+
+// NewGenericProvider creates a provider for the endpoints.
+func NewGenericProvider(name string, config Config, endpoint Endpoint, userInfoURL string) *GenericProvider {
+	return &GenericProvider{
+		Client:       &Client{Config: config, Endpoint: endpoint},
+		ProviderName: name,
+		UserInfoURL:  userInfoURL,
+		MapUser:      MapStandardClaims,
+	}
+}
+
+func (p *GenericProvider) Name() string {
+	return p.ProviderName
+}
+
+// GetUser fetches the user info of the token and maps it to a user.
+func (p *GenericProvider) GetUser(ctx context.Context, token *Token) (*User, error) {
+	var info map[string]any
+	if err := p.GetJSON(ctx, token, p.UserInfoURL, &info); err != nil {
+		return nil, err
+	}
+	mapUser := p.MapUser
+	if mapUser == nil {
+		mapUser = MapStandardClaims
+	}
+	return mapUser(info)
+}
+
+// MapStandardClaims maps the standard claims of OpenID Connect to a user.
+func MapStandardClaims(claims map[string]any) (*User, error) {
+	user := &User{
+		ID:            StringClaim(claims, "sub"),
+		Email:         StringClaim(claims, "email"),
+		EmailVerified: BoolClaim(claims, "email_verified"),
+		Name:          StringClaim(claims, "name"),
+		AvatarURL:     StringClaim(claims, "picture"),
+		Raw:           claims,
+	}
+	if user.ID == "" {
+		return nil, missingUserID("sub")
+	}
+	return user, nil
+}
+
+// StringClaim returns the claim as a string. Numbers are formatted, other types return an empty string.
+func StringClaim(claims map[string]any, name string) string {
+	switch value := claims[name].(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return ""
+}
+
+// BoolClaim returns the claim as a bool. Some providers send booleans as strings.
+func BoolClaim(claims map[string]any, name string) bool {
+	switch value := claims[name].(type) {
+	case bool:
+		return value
+	case string:
+		b, _ := strconv.ParseBool(value)
+		return b
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package oauth
+
+import "context"
+
+// GitHub is the GitHub provider. It requests the "read:user" and "user:email" scopes by default.
+// For GitHub Enterprise Server, set Config.BaseURL to the URL of the instance, the API URL then defaults to
+// its "/api/v3" path.
+type GitHub struct {
+	*Client
+	APIURL string
+}
+
+// NewGitHub creates a GitHub provider.
+func NewGitHub(config Config) *GitHub {
+	config.defaultScopes("read:user", "user:email")
+	baseURL := urlOrDefault(config.BaseURL, "https://github.com")
+	apiURL := "https://api.github.com"
+	if config.BaseURL != "" {
+		apiURL = baseURL + "/api/v3"
+	}
+	return &GitHub{
+		Client: &Client{
+			Config: config,
+			Endpoint: Endpoint{
+				AuthURL:  baseURL + "/login/oauth/authorize",
+				TokenURL: baseURL + "/login/oauth/access_token",
+			},
+		},
+		APIURL: urlOrDefault(config.APIURL, apiURL),
+	}
+}
+
+func (p *GitHub) Name() string {
+	return "github"
+}
+
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// GetUser fetches the user and its primary email address. The public email of a GitHub profile carries no
+// verification status, so the email is taken from the emails endpoint instead.
+func (p *GitHub) GetUser(ctx context.Context, token *Token) (*User, error) {
+	var info map[string]any
+	if err := p.GetJSON(ctx, token, p.APIURL+"/user", &info); err != nil {
+		return nil, err
+	}
+	user := &User{
+		ID:        StringClaim(info, "id"),
+		Name:      StringClaim(info, "name"),
+		AvatarURL: StringClaim(info, "avatar_url"),
+		Raw:       info,
+	}
+	if user.ID == "" {
+		return nil, missingUserID("id")
+	}
+	if user.Name == "" {
+		user.Name = StringClaim(info, "login")
+	}
+
+	var emails []githubEmail
+	if err := p.GetJSON(ctx, token, p.APIURL+"/user/emails", &emails); err != nil {
+		return nil, err
+	}
+	for _, email := range emails {
+		if email.Primary {
+			user.Email = email.Email
+			user.EmailVerified = email.Verified
+			break
+		}
+	}
+	return user, nil
+}
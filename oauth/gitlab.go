@@ -0,0 +1,51 @@
+package oauth
+
+import "context"
+
+// GitLab is the GitLab provider. It requests the "read_user" scope by default.
+// For self-managed instances, set Config.BaseURL to the URL of the instance, the API URL then defaults to its
+// "/api/v4" path.
+type GitLab struct {
+	*Client
+	APIURL string
+}
+
+// NewGitLab creates a GitLab provider.
+func NewGitLab(config Config) *GitLab {
+	config.defaultScopes("read_user")
+	baseURL := urlOrDefault(config.BaseURL, "https://gitlab.com")
+	return &GitLab{
+		Client: &Client{
+			Config: config,
+			Endpoint: Endpoint{
+				AuthURL:  baseURL + "/oauth/authorize",
+				TokenURL: baseURL + "/oauth/token",
+			},
+		},
+		APIURL: urlOrDefault(config.APIURL, baseURL+"/api/v4"),
+	}
+}
+
+func (p *GitLab) Name() string {
+	return "gitlab"
+}
+
+// GetUser fetches the current user. GitLab only returns the primary email of a user once it is confirmed.
+func (p *GitLab) GetUser(ctx context.Context, token *Token) (*User, error) {
+	var info map[string]any
+	if err := p.GetJSON(ctx, token, p.APIURL+"/user", &info); err != nil {
+		return nil, err
+	}
+	user := &User{
+		ID:            StringClaim(info, "id"),
+		Email:         StringClaim(info, "email"),
+		EmailVerified: StringClaim(info, "email") != "" && StringClaim(info, "confirmed_at") != "",
+		Name:          StringClaim(info, "name"),
+		AvatarURL:     StringClaim(info, "avatar_url"),
+		Raw:           info,
+	}
+	if user.ID == "" {
+		return nil, missingUserID("id")
+	}
+	return user, nil
+}
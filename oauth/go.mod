@@ -1,3 +1,12 @@
 module github.com/gaurishhs/keezle/oauth
 
 go 1.24.2
+
+require github.com/gaurishhs/keezle v0.0.0-20250709172739-4ff048670fb0
+
+require (
+	github.com/gaurishhs/keezle/models v0.0.0-20250709172739-4ff048670fb0 // indirect
+	github.com/rs/xid v1.6.0 // indirect
+	golang.org/x/crypto v0.39.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+)
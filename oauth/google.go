@@ -0,0 +1,43 @@
+package oauth
+
+import "context"
+
+// Google is the Google provider. It requests the "openid", "email" and "profile" scopes by default.
+// Google only issues refresh tokens if AuthParams sets "access_type" to "offline".
+type Google struct {
+	*Client
+	APIURL string
+}
+
+// NewGoogle creates a Google provider.
+func NewGoogle(config Config) *Google {
+	config.defaultScopes("openid", "email", "profile")
+	endpoint := Endpoint{
+		AuthURL:  "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL: "https://oauth2.googleapis.com/token",
+	}
+	if config.BaseURL != "" {
+		baseURL := urlOrDefault(config.BaseURL, "")
+		endpoint = Endpoint{
+			AuthURL:  baseURL + "/o/oauth2/v2/auth",
+			TokenURL: baseURL + "/token",
+		}
+	}
+	return &Google{
+		Client: &Client{Config: config, Endpoint: endpoint},
+		APIURL: urlOrDefault(config.APIURL, "https://openidconnect.googleapis.com"),
+	}
+}
+
+func (p *Google) Name() string {
+	return "google"
+}
+
+// GetUser fetches the user from the OpenID Connect user info endpoint.
+func (p *Google) GetUser(ctx context.Context, token *Token) (*User, error) {
+	var info map[string]any
+	if err := p.GetJSON(ctx, token, p.APIURL+"/v1/userinfo", &info); err != nil {
+		return nil, err
+	}
+	return MapStandardClaims(info)
+}
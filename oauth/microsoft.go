@@ -0,0 +1,60 @@
+package oauth
+
+import (
+	"context"
+	"net/url"
+)
+
+// Microsoft is the Microsoft identity platform provider for work, school and personal accounts.
+// It requests the "openid", "email", "profile" and "User.Read" scopes by default.
+// Microsoft does not verify the email addresses of accounts, so EmailVerified is always false and users must
+// not be linked by email.
+type Microsoft struct {
+	*Client
+	APIURL string
+}
+
+// NewMicrosoft creates a Microsoft provider for the tenant, which is a tenant id or domain, or one of "common",
+// "organizations" and "consumers". It defaults to "common".
+func NewMicrosoft(config Config, tenant string) *Microsoft {
+	config.defaultScopes("openid", "email", "profile", "User.Read")
+	if tenant == "" {
+		tenant = "common"
+	}
+	baseURL := urlOrDefault(config.BaseURL, "https://login.microsoftonline.com") + "/" + url.PathEscape(tenant)
+	return &Microsoft{
+		Client: &Client{
+			Config: config,
+			Endpoint: Endpoint{
+				AuthURL:  baseURL + "/oauth2/v2.0/authorize",
+				TokenURL: baseURL + "/oauth2/v2.0/token",
+			},
+		},
+		APIURL: urlOrDefault(config.APIURL, "https://graph.microsoft.com"),
+	}
+}
+
+func (p *Microsoft) Name() string {
+	return "microsoft"
+}
+
+// GetUser fetches the user from Microsoft Graph.
+func (p *Microsoft) GetUser(ctx context.Context, token *Token) (*User, error) {
+	var info map[string]any
+	if err := p.GetJSON(ctx, token, p.APIURL+"/v1.0/me", &info); err != nil {
+		return nil, err
+	}
+	user := &User{
+		ID:    StringClaim(info, "id"),
+		Email: StringClaim(info, "mail"),
+		Name:  StringClaim(info, "displayName"),
+		Raw:   info,
+	}
+	if user.ID == "" {
+		return nil, missingUserID("id")
+	}
+	if user.Email == "" {
+		user.Email = StringClaim(info, "userPrincipalName")
+	}
+	return user, nil
+}
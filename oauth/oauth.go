@@ -1 +1,111 @@
+// Package oauth implements the client side of the OAuth 2.0 authorization code flow with PKCE, so that users
+// can sign in with an external provider. A Flow redirects the user to the provider, keeps the state and code
+// verifier in a signed short-lived cookie and, on the callback, exchanges the code for a token and returns the
+// normalized provider user.
 package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidState     = errors.New("oauth: invalid state")
+	ErrMissingCode      = errors.New("oauth: missing authorization code")
+	ErrMissingSecret    = errors.New("oauth: state secret is required")
+	ErrInvalidToken     = errors.New("oauth: invalid token response")
+	ErrInvalidIDToken   = errors.New("oauth: invalid id token")
+	ErrInvalidDiscovery = errors.New("oauth: invalid discovery document")
+	// ErrMissingUserID is returned when the provider returns a user without an id, which would be mapped to
+	// the key of every other such user.
+	ErrMissingUserID = errors.New("oauth: provider user has no id")
+)
+
+// missingUserID returns the error of a user info response without the field of the user id.
+func missingUserID(field string) error {
+	return fmt.Errorf("%w: user info has no %q field", ErrMissingUserID, field)
+}
+
+// Error is an error returned by the provider, either as the "error" parameter of the callback or in the
+// response of the token endpoint, as defined in RFC 6749 section 4.1.2.1 and 5.2.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	URI         string `json:"error_uri,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("oauth: %s: %s", e.Code, e.Description)
+	}
+	return "oauth: " + e.Code
+}
+
+// Error codes of RFC 6749 checked by callers.
+const (
+	ErrorAccessDenied = "access_denied"
+	ErrorInvalidGrant = "invalid_grant"
+)
+
+// Token is the token issued by the token endpoint of a provider.
+type Token struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	// ExpiresAt is zero if the provider did not report the lifetime of the access token.
+	ExpiresAt time.Time
+	Scope     string
+	// IDToken is the OpenID Connect ID token, if the provider issued one.
+	IDToken string
+	// IDTokenClaims holds the claims of the ID token once an OpenID Connect provider has verified it.
+	IDTokenClaims map[string]any
+}
+
+// Expired reports whether the access token has expired at the time, treating tokens which expire within
+// the leeway as expired.
+func (t *Token) Expired(now time.Time, leeway time.Duration) bool {
+	return !t.ExpiresAt.IsZero() && !now.Add(leeway).Before(t.ExpiresAt)
+}
+
+// User is the user of a provider, normalized across providers.
+type User struct {
+	// ID is the stable id of the user at the provider.
+	ID            string
+	Email         string
+	EmailVerified bool
+	Name          string
+	AvatarURL     string
+	// Raw holds the user info as returned by the provider.
+	Raw map[string]any
+}
+
+// AuthorizationRequest holds the parameters of an authorization request.
+type AuthorizationRequest struct {
+	State string
+	// CodeChallenge is the S256 PKCE code challenge.
+	CodeChallenge string
+	// Nonce is the OpenID Connect nonce, which is bound to the ID token.
+	Nonce string
+}
+
+// ExchangeRequest holds the parameters of a code exchange.
+type ExchangeRequest struct {
+	Code         string
+	CodeVerifier string
+	// Nonce is the nonce sent with the authorization request, which the ID token must carry.
+	Nonce string
+}
+
+// Provider is an OAuth 2.0 provider users can sign in with.
+type Provider interface {
+	// Name is the name of the provider, which is used as the key provider of its users.
+	Name() string
+	// GetAuthorizationURL returns the URL of the authorization endpoint the user is redirected to.
+	GetAuthorizationURL(req AuthorizationRequest) string
+	// ExchangeCode exchanges the authorization code of the callback for a token.
+	ExchangeCode(ctx context.Context, req ExchangeRequest) (*Token, error)
+	// GetUser returns the user the token was issued for.
+	GetUser(ctx context.Context, token *Token) (*User, error)
+}
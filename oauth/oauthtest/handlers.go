@@ -0,0 +1,246 @@
+package oauthtest
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gaurishhs/keezle/oauth"
+)
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// fail responds with an OAuth error.
+func fail(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, &oauth.Error{Code: code, Description: description})
+}
+
+func (s *Server) discovery(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, s.DiscoveryDocument())
+}
+
+func (s *Server) jwks(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, http.StatusOK, s.keys.JWKSet())
+}
+
+// authorize signs in the user selected by the "login_hint" parameter or the current user and redirects back
+// with an authorization code. Requests with an invalid client or redirect URI are rejected without redirecting,
+// as defined in RFC 6749 section 4.1.2.1.
+func (s *Server) authorize(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	if query.Get("client_id") != s.Config.ClientID {
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	}
+	redirectURI := query.Get("redirect_uri")
+	if redirectURI == "" && len(s.Config.RedirectURIs) == 1 {
+		redirectURI = s.Config.RedirectURIs[0]
+	}
+	if redirectURI == "" || (len(s.Config.RedirectURIs) > 0 && !slices.Contains(s.Config.RedirectURIs, redirectURI)) {
+		http.Error(w, "invalid redirect uri", http.StatusBadRequest)
+		return
+	}
+	redirect, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect uri", http.StatusBadRequest)
+		return
+	}
+
+	params := url.Values{}
+	if state := query.Get("state"); state != "" {
+		params.Set("state", state)
+	}
+	respond := func() {
+		values := redirect.Query()
+		for key, value := range params {
+			values[key] = value
+		}
+		redirect.RawQuery = values.Encode()
+		http.Redirect(w, req, redirect.String(), http.StatusFound)
+	}
+	respondError := func(code, description string) {
+		params.Set("error", code)
+		params.Set("error_description", description)
+		respond()
+	}
+
+	switch {
+	case query.Get("response_type") != "code":
+		respondError("unsupported_response_type", "only the authorization code flow is supported")
+		return
+	case query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256":
+		respondError("invalid_request", "a S256 code challenge is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.takeFault(FaultAccessDenied); ok {
+		respondError(oauth.ErrorAccessDenied, "the user denied the request")
+		return
+	}
+	subject := query.Get("login_hint")
+	if subject == "" {
+		subject = s.currentUser
+	}
+	if _, ok := s.users[subject]; !ok {
+		respondError("login_required", "no user is signed in")
+		return
+	}
+
+	code := randomToken()
+	expiresAt := s.now().Add(s.Config.CodeLifetime)
+	if _, ok := s.takeFault(FaultExpiredCode); ok {
+		expiresAt = s.now()
+	}
+	s.codes[code] = &authorization{
+		subject:       subject,
+		redirectURI:   query.Get("redirect_uri"),
+		codeChallenge: query.Get("code_challenge"),
+		nonce:         query.Get("nonce"),
+		scope:         query.Get("scope"),
+		expiresAt:     expiresAt,
+	}
+	params.Set("code", code)
+	respond()
+}
+
+// token implements the authorization code and refresh token grants.
+func (s *Server) token(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		fail(w, http.StatusBadRequest, "invalid_request", "invalid form")
+		return
+	}
+	clientId, clientSecret, ok := req.BasicAuth()
+	if !ok {
+		clientId, clientSecret = req.PostForm.Get("client_id"), req.PostForm.Get("client_secret")
+	}
+	if clientId != s.Config.ClientID || (!s.Config.PublicClient &&
+		subtle.ConstantTimeCompare([]byte(clientSecret), []byte(s.Config.ClientSecret)) != 1) {
+		fail(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fault, ok := s.takeFault(FaultInvalidGrant, FaultServerError); ok {
+		if fault == FaultServerError {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		fail(w, http.StatusBadRequest, oauth.ErrorInvalidGrant, "the grant is invalid")
+		return
+	}
+
+	switch grantType := req.PostForm.Get("grant_type"); grantType {
+	case "authorization_code":
+		code := req.PostForm.Get("code")
+		authz, ok := s.codes[code]
+		// Codes are single use, see RFC 6749 section 4.1.2.
+		delete(s.codes, code)
+		switch {
+		case !ok:
+			fail(w, http.StatusBadRequest, oauth.ErrorInvalidGrant, "unknown authorization code")
+		case !s.now().Before(authz.expiresAt):
+			fail(w, http.StatusBadRequest, oauth.ErrorInvalidGrant, "the authorization code has expired")
+		case req.PostForm.Get("redirect_uri") != authz.redirectURI:
+			fail(w, http.StatusBadRequest, oauth.ErrorInvalidGrant, "redirect uri mismatch")
+		case subtle.ConstantTimeCompare([]byte(oauth.CodeChallengeS256(req.PostForm.Get("code_verifier"))), []byte(authz.codeChallenge)) != 1:
+			fail(w, http.StatusBadRequest, oauth.ErrorInvalidGrant, "code verifier mismatch")
+		default:
+			s.issueTokens(w, authz.subject, authz.scope, authz.nonce, authz.scope)
+		}
+	case "refresh_token":
+		token := req.PostForm.Get("refresh_token")
+		grant, ok := s.refreshTokens[token]
+		if !ok {
+			fail(w, http.StatusBadRequest, oauth.ErrorInvalidGrant, "unknown refresh token")
+			return
+		}
+		// The scope can be narrowed, but not extended, see RFC 6749 section 6.
+		scope := grant.scope
+		if requested := req.PostForm.Get("scope"); requested != "" {
+			granted := strings.Fields(grant.scope)
+			for _, value := range strings.Fields(requested) {
+				if !slices.Contains(granted, value) {
+					fail(w, http.StatusBadRequest, "invalid_scope", "scope exceeds the granted scope")
+					return
+				}
+			}
+			scope = requested
+		}
+		// Refresh tokens are rotated and keep the scope of the grant.
+		delete(s.refreshTokens, token)
+		s.issueTokens(w, grant.subject, scope, "", grant.scope)
+	default:
+		fail(w, http.StatusBadRequest, "unsupported_grant_type", "unsupported grant type "+grantType)
+	}
+}
+
+// issueTokens responds with tokens of the scope for the subject, and an ID token if the "openid" scope was
+// requested, as on refresh. The refresh token keeps the scope of the grant. It must be called with s.mu held.
+func (s *Server) issueTokens(w http.ResponseWriter, subject, scope, nonce, grantScope string) {
+	user, ok := s.users[subject]
+	if !ok {
+		fail(w, http.StatusBadRequest, oauth.ErrorInvalidGrant, "unknown user")
+		return
+	}
+	now := s.now()
+	response := map[string]any{
+		"access_token":  randomToken(),
+		"token_type":    "Bearer",
+		"refresh_token": randomToken(),
+		"expires_in":    int64(s.Config.TokenLifetime.Seconds()),
+	}
+	s.accessTokens[response["access_token"].(string)] = accessToken{subject: subject, expiresAt: now.Add(s.Config.TokenLifetime)}
+	s.refreshTokens[response["refresh_token"].(string)] = refreshToken{subject: subject, scope: grantScope}
+	if scope != "" {
+		response["scope"] = scope
+	}
+
+	if slices.Contains(strings.Fields(scope), "openid") {
+		claims := maps.Clone(user.Claims)
+		claims["iss"] = s.URL
+		claims["sub"] = subject
+		claims["aud"] = s.Config.ClientID
+		claims["iat"] = now.Unix()
+		claims["exp"] = now.Add(s.Config.TokenLifetime).Unix()
+		if nonce != "" {
+			claims["nonce"] = nonce
+		}
+		idToken, err := s.keys.Sign(claims)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		response["id_token"] = idToken
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// userInfo returns the claims of the user of the access token.
+func (s *Server) userInfo(w http.ResponseWriter, req *http.Request) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	issued, known := s.accessTokens[token]
+	user := s.users[issued.subject]
+	if !ok || !known || user == nil || !s.now().Before(issued.expiresAt) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	info := maps.Clone(user.Claims)
+	info["sub"] = user.Subject
+	writeJSON(w, http.StatusOK, info)
+}
@@ -0,0 +1,283 @@
+// Package oauthtest provides a mock OpenID Connect identity provider, so that sign-in with oauth providers can
+// be tested end to end without network access or real accounts.
+// A Server runs on a local httptest server and implements the authorization code flow with PKCE, the refresh
+// token grant, a user info endpoint and the signing keys of its ID tokens. The authorization endpoint does not
+// show a login page, it signs in the current user of the server and redirects back right away, and errors such
+// as a denied consent or an expired code can be injected with Server.Fail.
+package oauthtest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/jwt"
+	"github.com/gaurishhs/keezle/oauth"
+)
+
+// Paths of the endpoints of a Server.
+const (
+	DiscoveryPath     = "/.well-known/openid-configuration"
+	AuthorizationPath = "/authorize"
+	TokenPath         = "/token"
+	UserInfoPath      = "/userinfo"
+	JWKSPath          = "/jwks"
+)
+
+// Paths of the Google endpoints, so that oauth.NewGoogle can use a Server as its BaseURL and APIURL.
+const (
+	GoogleAuthorizationPath = "/o/oauth2/v2/auth"
+	GoogleUserInfoPath      = "/v1/userinfo"
+)
+
+// ErrUnknownUser is returned when a user which was not added to the server is signed in.
+var ErrUnknownUser = errors.New("oauthtest: unknown user")
+
+// User is a user of the identity provider.
+type User struct {
+	// Subject is the "sub" claim of the user.
+	Subject string
+	// Claims are added to the ID token and the user info of the user, e.g. "email", "email_verified" or "name".
+	Claims map[string]any
+}
+
+// Fault is an error injected into the next request of the flow it applies to.
+type Fault int
+
+const (
+	// FaultAccessDenied redirects the next authorization request back with the access_denied error, as if the
+	// user denied the consent.
+	FaultAccessDenied Fault = iota + 1
+	// FaultInvalidGrant rejects the next token request with the invalid_grant error, e.g. a revoked refresh
+	// token.
+	FaultInvalidGrant
+	// FaultExpiredCode issues the next authorization code already expired, so that exchanging it fails with the
+	// invalid_grant error.
+	FaultExpiredCode
+	// FaultServerError fails the next token request with an internal server error.
+	FaultServerError
+)
+
+// Config defines the configuration of a Server.
+type Config struct {
+	// ClientID and ClientSecret are the credentials of the only client, default to "client" and "secret".
+	ClientID     string
+	ClientSecret string
+	// PublicClient does not authenticate the client with its secret, as for single page and mobile apps.
+	PublicClient bool
+	// RedirectURIs are the allowed redirect URIs of the client. Any redirect URI is allowed if it is empty.
+	RedirectURIs []string
+	// Users are the users of the identity provider. The first one is the current user.
+	Users []User
+	// CodeLifetime is how long authorization codes are valid, defaults to 1 minute.
+	CodeLifetime time.Duration
+	// TokenLifetime is how long access and ID tokens are valid, defaults to 1 hour.
+	TokenLifetime time.Duration
+	// Key signs the ID tokens, defaults to a new RS256 key.
+	Key *jwt.Key
+	// Clock tells the current time, defaults to keezle.SystemClock.
+	Clock keezle.Clock
+}
+
+// Server is a mock identity provider running on a local httptest server.
+type Server struct {
+	*httptest.Server
+	Config Config
+	keys   *jwt.KeySet
+
+	mu          sync.Mutex
+	users       map[string]*User
+	currentUser string
+	faults      []Fault
+	codes       map[string]*authorization
+	// accessTokens and refreshTokens map tokens to the subject they were issued for.
+	accessTokens  map[string]accessToken
+	refreshTokens map[string]refreshToken
+}
+
+// authorization is an issued authorization code.
+type authorization struct {
+	subject       string
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	scope         string
+	expiresAt     time.Time
+}
+
+type accessToken struct {
+	subject   string
+	expiresAt time.Time
+}
+
+// refreshToken keeps the scope of the grant, which refreshed tokens are issued with.
+type refreshToken struct {
+	subject string
+	scope   string
+}
+
+// NewServer starts a server. It is closed with Close, usually in t.Cleanup.
+// It panics if the signing key can not be generated.
+func NewServer(config Config) *Server {
+	if config.ClientID == "" {
+		config.ClientID = "client"
+	}
+	if config.ClientSecret == "" {
+		config.ClientSecret = "secret"
+	}
+	if config.CodeLifetime == 0 {
+		config.CodeLifetime = time.Minute
+	}
+	if config.TokenLifetime == 0 {
+		config.TokenLifetime = time.Hour
+	}
+	if config.Clock == nil {
+		config.Clock = keezle.SystemClock
+	}
+	if config.Key == nil {
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(err)
+		}
+		config.Key = jwt.NewRSAKey("oauthtest", privateKey)
+	}
+
+	s := &Server{
+		Config:        config,
+		keys:          jwt.NewKeySet(config.Key),
+		users:         map[string]*User{},
+		codes:         map[string]*authorization{},
+		accessTokens:  map[string]accessToken{},
+		refreshTokens: map[string]refreshToken{},
+	}
+	for _, user := range config.Users {
+		s.AddUser(user)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+DiscoveryPath, s.discovery)
+	mux.HandleFunc("GET "+AuthorizationPath, s.authorize)
+	mux.HandleFunc("GET "+GoogleAuthorizationPath, s.authorize)
+	mux.HandleFunc("POST "+TokenPath, s.token)
+	mux.HandleFunc("GET "+UserInfoPath, s.userInfo)
+	mux.HandleFunc("GET "+GoogleUserInfoPath, s.userInfo)
+	mux.HandleFunc("GET "+JWKSPath, s.jwks)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// AddUser adds or replaces a user. The first added user becomes the current user.
+func (s *Server) AddUser(user User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user.Claims == nil {
+		user.Claims = map[string]any{}
+	}
+	s.users[user.Subject] = &user
+	if s.currentUser == "" {
+		s.currentUser = user.Subject
+	}
+}
+
+// SignIn makes the user the current user, who is signed in by the following authorization requests.
+// An authorization request can also select a user with the "login_hint" parameter.
+func (s *Server) SignIn(subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[subject]; !ok {
+		return ErrUnknownUser
+	}
+	s.currentUser = subject
+	return nil
+}
+
+// Fail injects the faults into the next requests they apply to. Each fault applies to one request.
+func (s *Server) Fail(faults ...Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, faults...)
+}
+
+// takeFault removes and reports the first pending fault of the kinds. It must be called with s.mu held.
+func (s *Server) takeFault(kinds ...Fault) (Fault, bool) {
+	for i, fault := range s.faults {
+		for _, kind := range kinds {
+			if fault == kind {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+				return fault, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// DiscoveryDocument returns the discovery document of the server.
+func (s *Server) DiscoveryDocument() *oauth.DiscoveryDocument {
+	return &oauth.DiscoveryDocument{
+		Issuer:                s.URL,
+		AuthorizationEndpoint: s.URL + AuthorizationPath,
+		TokenEndpoint:         s.URL + TokenPath,
+		UserInfoEndpoint:      s.URL + UserInfoPath,
+		JWKSURI:               s.URL + JWKSPath,
+		ScopesSupported:       []string{"openid", "email", "profile"},
+	}
+}
+
+// ClientConfig returns the client registration of the server for the redirect URL.
+func (s *Server) ClientConfig(redirectURL string) oauth.Config {
+	config := oauth.Config{
+		ClientID:    s.Config.ClientID,
+		RedirectURL: redirectURL,
+		HTTPClient:  s.Client(),
+		Clock:       s.Config.Clock,
+	}
+	if !s.Config.PublicClient {
+		config.ClientSecret = s.Config.ClientSecret
+	}
+	return config
+}
+
+// Provider returns an OpenID Connect provider with the name for the server, which verifies the ID tokens of
+// the server.
+func (s *Server) Provider(name, redirectURL string) *oauth.OIDCProvider {
+	return oauth.NewOIDCProvider(name, s.ClientConfig(redirectURL), s.DiscoveryDocument())
+}
+
+// Authorize sends the authorization request of the URL, as returned by oauth.Flow.Begin, and returns the URL
+// the server redirects the browser back to, i.e. the callback with either a code or an error.
+func (s *Server) Authorize(authURL string) (*url.URL, error) {
+	client := *s.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	res, err := client.Get(authURL)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("oauthtest: authorization request returned %s", res.Status)
+	}
+	return res.Location()
+}
+
+func (s *Server) now() time.Time {
+	return s.Config.Clock.Now()
+}
+
+// randomToken returns a random URL safe token.
+func randomToken() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
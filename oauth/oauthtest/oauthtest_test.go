@@ -0,0 +1,272 @@
+package oauthtest_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/keezletest"
+	"github.com/gaurishhs/keezle/oauth"
+	"github.com/gaurishhs/keezle/oauth/oauthtest"
+)
+
+const redirectURL = "https://app.example.com/callback"
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+func newServer(t *testing.T) (*oauthtest.Server, *keezletest.FakeClock) {
+	t.Helper()
+	clock := keezletest.NewFakeClock(time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC))
+	s := oauthtest.NewServer(oauthtest.Config{
+		RedirectURIs: []string{redirectURL},
+		Users: []oauthtest.User{
+			{Subject: "u1", Claims: map[string]any{"email": "u1@example.com", "email_verified": true, "name": "User One"}},
+			{Subject: "u2", Claims: map[string]any{"email": "u2@example.com"}},
+		},
+		Clock: clock,
+	})
+	t.Cleanup(s.Close)
+	return s, clock
+}
+
+// begin starts the flow and sends its authorization request, and returns the callback request with the state
+// cookie.
+func begin(t *testing.T, s *oauthtest.Server, flow *oauth.Flow) *http.Request {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	authURL, err := flow.Begin(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	callbackURL, err := s.Authorize(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, callbackURL.String(), nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func run(t *testing.T, s *oauthtest.Server, flow *oauth.Flow) (*oauth.CallbackResult, error) {
+	t.Helper()
+	return flow.Callback(httptest.NewRecorder(), begin(t, s, flow))
+}
+
+// requestToken posts the parameters to the token endpoint with the client credentials.
+func requestToken(t *testing.T, s *oauthtest.Server, params url.Values) (int, map[string]any) {
+	t.Helper()
+	params.Set("client_id", s.Config.ClientID)
+	params.Set("client_secret", s.Config.ClientSecret)
+	res, err := s.Client().PostForm(s.URL+oauthtest.TokenPath, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var body map[string]any
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, body
+}
+
+func TestFlow(t *testing.T) {
+	s, clock := newServer(t)
+	provider, err := oauth.DiscoverOIDC(context.Background(), "mock", s.URL, s.ClientConfig(redirectURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	flow := oauth.NewFlow(provider, oauth.FlowConfig{Secret: secret, Clock: clock})
+
+	result, err := run(t, s, flow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.User.ID != "u1" || result.User.Email != "u1@example.com" || !result.User.EmailVerified || result.User.Name != "User One" {
+		t.Errorf("user = %+v", result.User)
+	}
+	if result.Token.IDTokenClaims["nonce"] == nil {
+		t.Error("ID token has no nonce")
+	}
+	if want := clock.Now().Add(time.Hour); !result.Token.ExpiresAt.Equal(want) {
+		t.Errorf("token expiry = %v, want %v", result.Token.ExpiresAt, want)
+	}
+
+	if err := s.SignIn("unknown"); !errors.Is(err, oauthtest.ErrUnknownUser) {
+		t.Errorf("signing in an unknown user returned %v", err)
+	}
+	if err := s.SignIn("u2"); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = run(t, s, flow); err != nil {
+		t.Fatal(err)
+	}
+	if result.User.ID != "u2" || result.User.EmailVerified {
+		t.Errorf("user = %+v", result.User)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	s, clock := newServer(t)
+	provider := s.Provider("mock", redirectURL)
+	result, err := run(t, s, oauth.NewFlow(provider, oauth.FlowConfig{Secret: secret, Clock: clock}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scope := result.Token.Scope
+	if scope != "openid email profile" {
+		t.Fatalf("scope = %q", scope)
+	}
+
+	clock.Advance(30 * time.Minute)
+	refreshed, err := provider.RefreshToken(context.Background(), result.Token.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.Scope != scope || refreshed.RefreshToken == result.Token.RefreshToken {
+		t.Errorf("refreshed scope = %q, refresh token rotated = %v", refreshed.Scope, refreshed.RefreshToken != result.Token.RefreshToken)
+	}
+	claims, err := provider.VerifyIDToken(context.Background(), refreshed.IDToken, "")
+	if err != nil {
+		t.Fatalf("ID token of the refresh: %v", err)
+	}
+	if claims["sub"] != "u1" {
+		t.Errorf("claims = %v", claims)
+	}
+
+	// Refresh tokens are single use.
+	var oauthErr *oauth.Error
+	if _, err := provider.RefreshToken(context.Background(), result.Token.RefreshToken); !errors.As(err, &oauthErr) || oauthErr.Code != oauth.ErrorInvalidGrant {
+		t.Errorf("reusing a refresh token returned %v, want invalid_grant", err)
+	}
+
+	// A narrowed refresh issues no ID token without "openid", but the grant keeps its scope.
+	status, body := requestToken(t, s, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshed.RefreshToken}, "scope": {"email"}})
+	if status != http.StatusOK || body["scope"] != "email" || body["id_token"] != nil {
+		t.Fatalf("narrowed refresh = %d %v", status, body)
+	}
+	status, body = requestToken(t, s, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {body["refresh_token"].(string)}})
+	if status != http.StatusOK || body["scope"] != scope || body["id_token"] == nil {
+		t.Fatalf("refresh after a narrowed refresh = %d %v", status, body)
+	}
+	status, body = requestToken(t, s, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {body["refresh_token"].(string)}, "scope": {"openid admin"}})
+	if status != http.StatusBadRequest || body["error"] != "invalid_scope" {
+		t.Errorf("extended refresh = %d %v", status, body)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault oauthtest.Fault
+		code  string
+	}{
+		{"access denied", oauthtest.FaultAccessDenied, oauth.ErrorAccessDenied},
+		{"expired code", oauthtest.FaultExpiredCode, oauth.ErrorInvalidGrant},
+		{"invalid grant", oauthtest.FaultInvalidGrant, oauth.ErrorInvalidGrant},
+		{"server error", oauthtest.FaultServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, clock := newServer(t)
+			flow := oauth.NewFlow(s.Provider("mock", redirectURL), oauth.FlowConfig{Secret: secret, Clock: clock})
+			s.Fail(tt.fault)
+			_, err := run(t, s, flow)
+			var oauthErr *oauth.Error
+			if err == nil || errors.As(err, &oauthErr) != (tt.code != "") || (oauthErr != nil && oauthErr.Code != tt.code) {
+				t.Errorf("flow returned %v, want %q", err, tt.code)
+			}
+			// Each fault applies to one request.
+			if _, err := run(t, s, flow); err != nil {
+				t.Errorf("flow after the fault returned %v", err)
+			}
+		})
+	}
+
+	t.Run("revoked grant", func(t *testing.T) {
+		s, clock := newServer(t)
+		provider := s.Provider("mock", redirectURL)
+		result, err := run(t, s, oauth.NewFlow(provider, oauth.FlowConfig{Secret: secret, Clock: clock}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Fail(oauthtest.FaultInvalidGrant)
+		if _, err := provider.RefreshProviderTokens(context.Background(), result.Token.RefreshToken); !errors.Is(err, keezle.ErrProviderGrantRevoked) {
+			t.Errorf("refresh returned %v, want ErrProviderGrantRevoked", err)
+		}
+	})
+}
+
+func TestAuthorizationCode(t *testing.T) {
+	s, clock := newServer(t)
+	provider := s.Provider("mock", redirectURL)
+	flow := oauth.NewFlow(provider, oauth.FlowConfig{Secret: secret, Clock: clock})
+	var oauthErr *oauth.Error
+
+	t.Run("expired", func(t *testing.T) {
+		req := begin(t, s, flow)
+		clock.Advance(time.Minute)
+		if _, err := flow.Callback(httptest.NewRecorder(), req); !errors.As(err, &oauthErr) || oauthErr.Code != oauth.ErrorInvalidGrant {
+			t.Errorf("callback returned %v, want invalid_grant", err)
+		}
+	})
+
+	t.Run("code verifier mismatch", func(t *testing.T) {
+		code := begin(t, s, flow).URL.Query().Get("code")
+		_, err := provider.ExchangeCode(context.Background(), oauth.ExchangeRequest{Code: code, CodeVerifier: "other"})
+		if !errors.As(err, &oauthErr) || oauthErr.Code != oauth.ErrorInvalidGrant {
+			t.Errorf("exchange returned %v, want invalid_grant", err)
+		}
+	})
+
+	t.Run("single use", func(t *testing.T) {
+		req := begin(t, s, flow)
+		if _, err := flow.Callback(httptest.NewRecorder(), req); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := flow.Callback(httptest.NewRecorder(), req); !errors.As(err, &oauthErr) || oauthErr.Code != oauth.ErrorInvalidGrant {
+			t.Errorf("second callback returned %v, want invalid_grant", err)
+		}
+	})
+
+	t.Run("client secret mismatch", func(t *testing.T) {
+		code := begin(t, s, flow).URL.Query().Get("code")
+		config := s.ClientConfig(redirectURL)
+		config.ClientSecret = "other"
+		_, err := oauth.NewOIDCProvider("mock", config, s.DiscoveryDocument()).ExchangeCode(context.Background(), oauth.ExchangeRequest{Code: code})
+		if !errors.As(err, &oauthErr) || oauthErr.Code != "invalid_client" {
+			t.Errorf("exchange returned %v, want invalid_client", err)
+		}
+	})
+
+	t.Run("unregistered redirect URL", func(t *testing.T) {
+		other := oauth.NewFlow(s.Provider("mock", "https://attacker.example.com/callback"), flow.Config)
+		authURL, err := other.Begin(httptest.NewRecorder())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Authorize(authURL); err == nil {
+			t.Error("authorization request with an unregistered redirect URL was redirected")
+		}
+	})
+}
+
+func TestGoogle(t *testing.T) {
+	s, clock := newServer(t)
+	config := s.ClientConfig(redirectURL)
+	config.BaseURL, config.APIURL = s.URL, s.URL
+	result, err := run(t, s, oauth.NewFlow(oauth.NewGoogle(config), oauth.FlowConfig{Secret: secret, Clock: clock}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.User.ID != "u1" || result.User.Email != "u1@example.com" {
+		t.Errorf("user = %+v", result.User)
+	}
+}
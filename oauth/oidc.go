@@ -0,0 +1,291 @@
+package oauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/jwt"
+)
+
+// DiscoveryDocument is the OpenID Connect discovery document of an issuer.
+type DiscoveryDocument struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserInfoEndpoint      string   `json:"userinfo_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	ScopesSupported       []string `json:"scopes_supported"`
+}
+
+// idTokenClaims are the claims of an ID token checked by VerifyIDToken.
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp"`
+}
+
+// OIDCProvider is a provider for any OpenID Connect issuer, e.g. Keycloak, Okta or Authentik.
+// The ID token returned by the token endpoint is verified against the signing keys of the issuer, which are
+// cached and refetched when a token is signed with an unknown key, so that key rotation needs no restart.
+type OIDCProvider struct {
+	*Client
+	ProviderName string
+	Issuer       string
+	UserInfoURL  string
+	JWKSURL      string
+	// FetchUserInfo merges the response of the user info endpoint into the ID token claims, for issuers which
+	// keep the ID token small.
+	FetchUserInfo bool
+	// MapUser maps the claims to a user. It defaults to MapStandardClaims.
+	MapUser func(claims map[string]any) (*User, error)
+	// Leeway is the allowed clock skew when checking the expiration time of ID tokens, defaults to 1 minute.
+	Leeway time.Duration
+	// KeysMaxAge is how long the signing keys are cached, defaults to 1 hour.
+	KeysMaxAge time.Duration
+	// Clock tells the current time, defaults to the Clock of the Config.
+	Clock keezle.Clock
+
+	mu            sync.Mutex
+	keys          *jwt.KeySet
+	keysFetchedAt time.Time
+	// keysRetriedAt is the time the keys were last refetched for an unknown key id.
+	keysRetriedAt time.Time
+}
+
+// minKeysRefreshInterval limits how often unknown key ids trigger a refetch of the signing keys.
+const minKeysRefreshInterval = time.Minute
+
+// DiscoverOIDC creates a provider for the issuer from its discovery document.
+// It requests the "openid", "email" and "profile" scopes by default.
+func DiscoverOIDC(ctx context.Context, name, issuer string, config Config) (*OIDCProvider, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+	client := &Client{Config: config}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oauth: discovery of %s returned %s", issuer, res.Status)
+	}
+
+	var document DiscoveryDocument
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(&document); err != nil {
+		return nil, ErrInvalidDiscovery
+	}
+	// The issuer must match exactly, so that a document can not impersonate another issuer.
+	if strings.TrimSuffix(document.Issuer, "/") != issuer || document.AuthorizationEndpoint == "" ||
+		document.TokenEndpoint == "" || document.JWKSURI == "" {
+		return nil, ErrInvalidDiscovery
+	}
+	return NewOIDCProvider(name, config, &document), nil
+}
+
+// NewOIDCProvider creates a provider from a discovery document, for issuers which do not publish one.
+func NewOIDCProvider(name string, config Config, document *DiscoveryDocument) *OIDCProvider {
+	config.defaultScopes("openid", "email", "profile")
+	clock := config.Clock
+	if clock == nil {
+		clock = keezle.SystemClock
+	}
+	return &OIDCProvider{
+		Client: &Client{
+			Config: config,
+			Endpoint: Endpoint{
+				AuthURL:  document.AuthorizationEndpoint,
+				TokenURL: document.TokenEndpoint,
+			},
+		},
+		ProviderName: name,
+		Issuer:       document.Issuer,
+		UserInfoURL:  document.UserInfoEndpoint,
+		JWKSURL:      document.JWKSURI,
+		MapUser:      MapStandardClaims,
+		Leeway:       time.Minute,
+		KeysMaxAge:   time.Hour,
+		Clock:        clock,
+	}
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.ProviderName
+}
+
+func (p *OIDCProvider) now() time.Time {
+	if p.Clock == nil {
+		return keezle.SystemClock.Now()
+	}
+	return p.Clock.Now()
+}
+
+// GetAuthorizationURL returns the URL of the authorization endpoint, including the nonce of the request.
+func (p *OIDCProvider) GetAuthorizationURL(req AuthorizationRequest) string {
+	authURL := p.Client.GetAuthorizationURL(req)
+	if req.Nonce != "" {
+		authURL += "&nonce=" + url.QueryEscape(req.Nonce)
+	}
+	return authURL
+}
+
+// ExchangeCode exchanges the code for a token and verifies its ID token.
+func (p *OIDCProvider) ExchangeCode(ctx context.Context, req ExchangeRequest) (*Token, error) {
+	token, err := p.Client.ExchangeCode(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, ErrInvalidIDToken
+	}
+	if token.IDTokenClaims, err = p.VerifyIDToken(ctx, token.IDToken, req.Nonce); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// GetUser maps the verified ID token claims of the token to a user, merged with the user info if
+// FetchUserInfo is set. Tokens without verified claims, e.g. stored or refreshed tokens, are mapped from the
+// user info alone.
+func (p *OIDCProvider) GetUser(ctx context.Context, token *Token) (*User, error) {
+	claims := make(map[string]any, len(token.IDTokenClaims))
+	for name, value := range token.IDTokenClaims {
+		claims[name] = value
+	}
+
+	if p.FetchUserInfo || token.IDTokenClaims == nil {
+		if p.UserInfoURL == "" {
+			return nil, ErrInvalidIDToken
+		}
+		var info map[string]any
+		if err := p.GetJSON(ctx, token, p.UserInfoURL, &info); err != nil {
+			return nil, err
+		}
+		// The user info must belong to the subject of the ID token, see OpenID Connect Core section 5.3.2.
+		if token.IDTokenClaims != nil && StringClaim(info, "sub") != StringClaim(token.IDTokenClaims, "sub") {
+			return nil, ErrInvalidIDToken
+		}
+		for name, value := range info {
+			claims[name] = value
+		}
+	}
+
+	mapUser := p.MapUser
+	if mapUser == nil {
+		mapUser = MapStandardClaims
+	}
+	return mapUser(claims)
+}
+
+// VerifyIDToken verifies the signature, issuer, audience and expiration time of an ID token and returns its
+// claims. The nonce of the token must match the nonce unless it is empty.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, idToken, nonce string) (map[string]any, error) {
+	var claims map[string]any
+	err := p.parse(ctx, idToken, &claims)
+	if errors.Is(err, jwt.ErrUnknownKey) {
+		// The issuer may have rotated its keys.
+		if err = p.refreshKeys(ctx, false); err == nil {
+			err = p.parse(ctx, idToken, &claims)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, jwt.ErrUnknownKey) || errors.Is(err, jwt.ErrInvalidSignature) || errors.Is(err, jwt.ErrInvalidToken) {
+			return nil, ErrInvalidIDToken
+		}
+		return nil, err
+	}
+
+	// Decode the checked claims from the claims map instead of parsing the token twice.
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	var checked idTokenClaims
+	if err := json.Unmarshal(data, &checked); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	switch {
+	case strings.TrimSuffix(checked.Issuer, "/") != strings.TrimSuffix(p.Issuer, "/"):
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidIDToken)
+	case checked.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	case !checked.HasAudience(p.Config.ClientID):
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidIDToken)
+	case len(checked.Audience) > 1 && checked.AuthorizedParty != p.Config.ClientID:
+		return nil, fmt.Errorf("%w: unexpected authorized party", ErrInvalidIDToken)
+	case checked.ExpiresAt == 0 || checked.Validate(p.now(), p.Leeway) != nil:
+		return nil, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	case nonce != "" && subtle.ConstantTimeCompare([]byte(checked.Nonce), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%w: unexpected nonce", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+// parse verifies the token with the cached signing keys, fetching them if they are missing or stale.
+func (p *OIDCProvider) parse(ctx context.Context, token string, claims any) error {
+	p.mu.Lock()
+	stale := p.keys == nil || p.now().Sub(p.keysFetchedAt) >= p.KeysMaxAge
+	p.mu.Unlock()
+	if stale {
+		if err := p.refreshKeys(ctx, true); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+	return keys.Parse(token, claims)
+}
+
+// refreshKeys fetches the signing keys of the issuer. Unless forced, the keys are refetched at most once per
+// minKeysRefreshInterval, so that tokens with made up key ids can not flood the issuer with requests.
+func (p *OIDCProvider) refreshKeys(ctx context.Context, force bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	if !force {
+		if now.Sub(p.keysRetriedAt) < minKeysRefreshInterval {
+			return nil
+		}
+		p.keysRetriedAt = now
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.JWKSURL, nil)
+	if err != nil {
+		return err
+	}
+	res, err := p.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("oauth: %s returned %s", p.JWKSURL, res.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	keys, err := jwt.ParseJWKSet(data)
+	if err != nil {
+		return err
+	}
+
+	p.keys = keys
+	p.keysFetchedAt = now
+	return nil
+}
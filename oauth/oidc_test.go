@@ -0,0 +1,290 @@
+package oauth_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle/jwt"
+	"github.com/gaurishhs/keezle/keezletest"
+	"github.com/gaurishhs/keezle/oauth"
+)
+
+// issuer is a stub OpenID Connect issuer which publishes the keys of its key set.
+type issuer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	keys     *jwt.KeySet
+	fetches  int
+	document func(document *oauth.DiscoveryDocument)
+	userInfo map[string]any
+}
+
+func newIssuer(t *testing.T, keys ...*jwt.Key) *issuer {
+	i := &issuer{keys: jwt.NewKeySet(keys...)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, req *http.Request) {
+		document := &oauth.DiscoveryDocument{
+			Issuer:                i.URL,
+			AuthorizationEndpoint: i.URL + "/authorize",
+			TokenEndpoint:         i.URL + "/token",
+			UserInfoEndpoint:      i.URL + "/userinfo",
+			JWKSURI:               i.URL + "/jwks",
+		}
+		i.mu.Lock()
+		if i.document != nil {
+			i.document(document)
+		}
+		i.mu.Unlock()
+		writeJSON(w, http.StatusOK, document)
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, req *http.Request) {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		i.fetches++
+		writeJSON(w, http.StatusOK, i.keys.JWKSet())
+	})
+	mux.HandleFunc("GET /userinfo", func(w http.ResponseWriter, req *http.Request) {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		writeJSON(w, http.StatusOK, i.userInfo)
+	})
+	i.Server = httptest.NewServer(mux)
+	t.Cleanup(i.Close)
+	return i
+}
+
+func (i *issuer) publish(key *jwt.Key) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keys.Add(key)
+}
+
+func (i *issuer) keyFetches() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.fetches
+}
+
+func (i *issuer) provider(t *testing.T, clock *keezletest.FakeClock) *oauth.OIDCProvider {
+	t.Helper()
+	provider, err := oauth.DiscoverOIDC(context.Background(), "stub", i.URL, oauth.Config{ClientID: "client", HTTPClient: i.Client(), Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+// claims returns valid ID token claims of the issuer for the subject "u1" at the time of the clock.
+func (i *issuer) claims(clock *keezletest.FakeClock) map[string]any {
+	return map[string]any{
+		"iss":   i.URL,
+		"sub":   "u1",
+		"aud":   "client",
+		"iat":   clock.Now().Unix(),
+		"exp":   clock.Now().Add(time.Hour).Unix(),
+		"nonce": "nonce",
+	}
+}
+
+func newEd25519Key(t *testing.T, id string) *jwt.Key {
+	t.Helper()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jwt.NewEd25519Key(id, privateKey)
+}
+
+func sign(t *testing.T, key *jwt.Key, claims map[string]any) string {
+	t.Helper()
+	token, err := jwt.Sign(key, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestDiscoverOIDC(t *testing.T) {
+	tests := []struct {
+		name     string
+		document func(document *oauth.DiscoveryDocument)
+		err      error
+	}{
+		{"valid", nil, nil},
+		{"trailing slash", func(document *oauth.DiscoveryDocument) { document.Issuer += "/" }, nil},
+		{"issuer mismatch", func(document *oauth.DiscoveryDocument) { document.Issuer = "https://attacker.example.com" }, oauth.ErrInvalidDiscovery},
+		{"issuer prefix", func(document *oauth.DiscoveryDocument) { document.Issuer += "/tenant" }, oauth.ErrInvalidDiscovery},
+		{"missing token endpoint", func(document *oauth.DiscoveryDocument) { document.TokenEndpoint = "" }, oauth.ErrInvalidDiscovery},
+		{"missing keys", func(document *oauth.DiscoveryDocument) { document.JWKSURI = "" }, oauth.ErrInvalidDiscovery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newIssuer(t)
+			i.document = tt.document
+			provider, err := oauth.DiscoverOIDC(context.Background(), "stub", i.URL+"/", oauth.Config{ClientID: "client", HTTPClient: i.Client()})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("discovery returned %v, want %v", err, tt.err)
+			}
+			if err == nil && (provider.JWKSURL != i.URL+"/jwks" || provider.Endpoint.TokenURL != i.URL+"/token") {
+				t.Errorf("endpoints = %q, %q", provider.JWKSURL, provider.Endpoint.TokenURL)
+			}
+		})
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	key := newEd25519Key(t, "k1")
+	// forged has the id of the published key, but another private key.
+	forged := newEd25519Key(t, "k1")
+	i := newIssuer(t, key)
+	clock := keezletest.NewFakeClock(epoch)
+	provider := i.provider(t, clock)
+
+	tests := []struct {
+		name   string
+		key    *jwt.Key
+		claims func(claims map[string]any)
+		nonce  string
+		valid  bool
+	}{
+		{"valid", key, nil, "nonce", true},
+		{"any nonce", key, func(claims map[string]any) { delete(claims, "nonce") }, "", true},
+		{"bad signature", forged, nil, "nonce", false},
+		{"issuer mismatch", key, func(claims map[string]any) { claims["iss"] = "https://attacker.example.com" }, "nonce", false},
+		{"missing subject", key, func(claims map[string]any) { delete(claims, "sub") }, "nonce", false},
+		{"audience mismatch", key, func(claims map[string]any) { claims["aud"] = "other" }, "nonce", false},
+		{"multiple audiences", key, func(claims map[string]any) { claims["aud"] = []string{"other", "client"} }, "nonce", false},
+		{"authorized party", key, func(claims map[string]any) {
+			claims["aud"] = []string{"other", "client"}
+			claims["azp"] = "client"
+		}, "nonce", true},
+		{"authorized party mismatch", key, func(claims map[string]any) {
+			claims["aud"] = []string{"other", "client"}
+			claims["azp"] = "other"
+		}, "nonce", false},
+		{"expired within leeway", key, func(claims map[string]any) { claims["exp"] = epoch.Add(-59 * time.Second).Unix() }, "nonce", true},
+		{"expired", key, func(claims map[string]any) { claims["exp"] = epoch.Add(-time.Minute).Unix() }, "nonce", false},
+		{"missing expiry", key, func(claims map[string]any) { delete(claims, "exp") }, "nonce", false},
+		{"not yet valid", key, func(claims map[string]any) { claims["nbf"] = epoch.Add(2 * time.Minute).Unix() }, "nonce", false},
+		{"nonce mismatch", key, nil, "other", false},
+		{"missing nonce", key, func(claims map[string]any) { delete(claims, "nonce") }, "nonce", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := i.claims(clock)
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+			verified, err := provider.VerifyIDToken(context.Background(), sign(t, tt.key, claims), tt.nonce)
+			if tt.valid {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if verified["sub"] != "u1" {
+					t.Errorf("claims = %v", verified)
+				}
+			} else if !errors.Is(err, oauth.ErrInvalidIDToken) {
+				t.Errorf("verification returned %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+
+	t.Run("tampered payload", func(t *testing.T) {
+		token := sign(t, key, i.claims(clock))
+		other := sign(t, key, map[string]any{"iss": i.URL, "sub": "admin", "aud": "client", "exp": epoch.Add(time.Hour).Unix()})
+		parts, otherParts := strings.Split(token, "."), strings.Split(other, ".")
+		parts[1] = otherParts[1]
+		if _, err := provider.VerifyIDToken(context.Background(), strings.Join(parts, "."), ""); !errors.Is(err, oauth.ErrInvalidIDToken) {
+			t.Errorf("verification returned %v, want ErrInvalidIDToken", err)
+		}
+	})
+}
+
+func TestVerifyIDTokenKeyRotation(t *testing.T) {
+	i := newIssuer(t, newEd25519Key(t, "k1"))
+	clock := keezletest.NewFakeClock(epoch)
+	provider := i.provider(t, clock)
+	verify := func(key *jwt.Key) error {
+		_, err := provider.VerifyIDToken(context.Background(), sign(t, key, i.claims(clock)), "nonce")
+		return err
+	}
+
+	// The first token fetches the keys, and is signed with a key the issuer does not publish yet.
+	rotated := newEd25519Key(t, "k2")
+	if err := verify(rotated); !errors.Is(err, oauth.ErrInvalidIDToken) {
+		t.Fatalf("verification with an unpublished key returned %v", err)
+	}
+	fetches := i.keyFetches()
+
+	// The unknown key id triggers a refetch once the interval passed, which finds the rotated key.
+	i.publish(rotated)
+	if err := verify(rotated); !errors.Is(err, oauth.ErrInvalidIDToken) {
+		t.Errorf("unknown key refetched the keys within the interval: %v", err)
+	}
+	if got := i.keyFetches(); got != fetches {
+		t.Errorf("key fetches = %d, want %d", got, fetches)
+	}
+	clock.Advance(time.Minute)
+	if err := verify(rotated); err != nil {
+		t.Fatalf("verification with the rotated key returned %v", err)
+	}
+	if got := i.keyFetches(); got != fetches+1 {
+		t.Errorf("key fetches = %d, want %d", got, fetches+1)
+	}
+
+	// Known keys are served from the cache until it is stale.
+	if err := verify(rotated); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	if err := verify(rotated); err != nil {
+		t.Fatal(err)
+	}
+	if got := i.keyFetches(); got != fetches+2 {
+		t.Errorf("key fetches = %d, want %d", got, fetches+2)
+	}
+}
+
+func TestOIDCGetUserInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		userInfo map[string]any
+		err      error
+	}{
+		{"matching subject", map[string]any{"sub": "u1", "email": "u1@example.com", "email_verified": true}, nil},
+		{"subject mismatch", map[string]any{"sub": "u2", "email": "u2@example.com", "email_verified": true}, oauth.ErrInvalidIDToken},
+		{"missing subject", map[string]any{"email": "u2@example.com"}, oauth.ErrInvalidIDToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := newEd25519Key(t, "k1")
+			i := newIssuer(t, key)
+			i.userInfo = tt.userInfo
+			clock := keezletest.NewFakeClock(epoch)
+			provider := i.provider(t, clock)
+			provider.FetchUserInfo = true
+
+			idToken := sign(t, key, i.claims(clock))
+			claims, err := provider.VerifyIDToken(context.Background(), idToken, "nonce")
+			if err != nil {
+				t.Fatal(err)
+			}
+			user, err := provider.GetUser(context.Background(), &oauth.Token{AccessToken: "access", IDToken: idToken, IDTokenClaims: claims})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("GetUser returned %v, want %v", err, tt.err)
+			}
+			if err == nil && (user.ID != "u1" || user.Email != "u1@example.com" || !user.EmailVerified) {
+				t.Errorf("user = %+v", user)
+			}
+		})
+	}
+}
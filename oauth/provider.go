@@ -1,6 +0,0 @@
-package oauth
-
-type Provider interface {
-	GetAuthorizationURL() (url, state string, err error)
-	ValidateCallback(code, state string)
-}
@@ -0,0 +1,154 @@
+package oauth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/keezletest"
+	"github.com/gaurishhs/keezle/oauth"
+)
+
+// newAPI serves the responses as JSON by path, and requires the access token "access".
+func newAPI(t *testing.T, responses map[string]any) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		response, ok := responses[req.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProviderUsers(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  func(config oauth.Config) oauth.Provider
+		responses map[string]any
+		user      oauth.User
+	}{
+		{
+			name:     "github",
+			provider: func(config oauth.Config) oauth.Provider { return oauth.NewGitHub(config) },
+			responses: map[string]any{
+				"/user": map[string]any{"id": 12345678, "login": "octocat", "avatar_url": "https://avatars.example.com/u1"},
+				"/user/emails": []map[string]any{
+					{"email": "other@example.com", "primary": false, "verified": true},
+					{"email": "octocat@example.com", "primary": true, "verified": false},
+				},
+			},
+			user: oauth.User{ID: "12345678", Name: "octocat", Email: "octocat@example.com", AvatarURL: "https://avatars.example.com/u1"},
+		},
+		{
+			name:     "discord",
+			provider: func(config oauth.Config) oauth.Provider { return oauth.NewDiscord(config) },
+			responses: map[string]any{
+				"/users/@me": map[string]any{"id": "80351110224678912", "username": "nelly", "email": "nelly@example.com", "verified": true, "avatar": "8342729096ea3675442027381ff50dfe"},
+			},
+			user: oauth.User{ID: "80351110224678912", Name: "nelly", Email: "nelly@example.com", EmailVerified: true, AvatarURL: "https://cdn.discordapp.com/avatars/80351110224678912/8342729096ea3675442027381ff50dfe.png"},
+		},
+		{
+			name:     "gitlab",
+			provider: func(config oauth.Config) oauth.Provider { return oauth.NewGitLab(config) },
+			responses: map[string]any{
+				"/user": map[string]any{"id": 1, "name": "Administrator", "email": "admin@example.com", "confirmed_at": "2012-05-23T09:05:22Z"},
+			},
+			user: oauth.User{ID: "1", Name: "Administrator", Email: "admin@example.com", EmailVerified: true},
+		},
+		{
+			name:     "gitlab unconfirmed",
+			provider: func(config oauth.Config) oauth.Provider { return oauth.NewGitLab(config) },
+			responses: map[string]any{
+				"/user": map[string]any{"id": 2, "name": "New", "email": "new@example.com", "confirmed_at": nil},
+			},
+			user: oauth.User{ID: "2", Name: "New", Email: "new@example.com"},
+		},
+		{
+			name:     "microsoft",
+			provider: func(config oauth.Config) oauth.Provider { return oauth.NewMicrosoft(config, "") },
+			responses: map[string]any{
+				"/v1.0/me": map[string]any{"id": "87d349ed-44d7-43e1-9a83-5f2406dee5bd", "displayName": "Adele Vance", "mail": nil, "userPrincipalName": "adele@example.com"},
+			},
+			user: oauth.User{ID: "87d349ed-44d7-43e1-9a83-5f2406dee5bd", Name: "Adele Vance", Email: "adele@example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newAPI(t, tt.responses)
+			provider := tt.provider(oauth.Config{ClientID: "client", APIURL: api.URL, HTTPClient: api.Client()})
+			user, err := provider.GetUser(context.Background(), &oauth.Token{AccessToken: "access"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Raw == nil {
+				t.Error("raw claims are not set")
+			}
+			user.Raw = nil
+			if !reflect.DeepEqual(*user, tt.user) {
+				t.Errorf("user = %+v, want %+v", *user, tt.user)
+			}
+		})
+	}
+}
+
+func TestProviderUsersMissingID(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  func(config oauth.Config) oauth.Provider
+		responses map[string]any
+	}{
+		{"github", func(config oauth.Config) oauth.Provider { return oauth.NewGitHub(config) },
+			map[string]any{"/user": map[string]any{"login": "octocat"}, "/user/emails": []any{}}},
+		{"discord", func(config oauth.Config) oauth.Provider { return oauth.NewDiscord(config) },
+			map[string]any{"/users/@me": map[string]any{"id": "", "username": "nelly"}}},
+		{"gitlab", func(config oauth.Config) oauth.Provider { return oauth.NewGitLab(config) },
+			map[string]any{"/user": map[string]any{"id": nil}}},
+		{"microsoft", func(config oauth.Config) oauth.Provider { return oauth.NewMicrosoft(config, "") },
+			map[string]any{"/v1.0/me": map[string]any{"error": map[string]any{"code": "InvalidAuthenticationToken"}}}},
+		{"generic", func(config oauth.Config) oauth.Provider {
+			return oauth.NewGenericProvider("generic", config, oauth.Endpoint{}, config.APIURL+"/userinfo")
+		}, map[string]any{"/userinfo": map[string]any{"email": "u1@example.com"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newAPI(t, tt.responses)
+			provider := tt.provider(oauth.Config{ClientID: "client", APIURL: api.URL, HTTPClient: api.Client()})
+			if _, err := provider.GetUser(context.Background(), &oauth.Token{AccessToken: "access"}); !errors.Is(err, oauth.ErrMissingUserID) {
+				t.Errorf("GetUser returned %v, want ErrMissingUserID", err)
+			}
+		})
+	}
+}
+
+func TestProviderUserAPIError(t *testing.T) {
+	api := newAPI(t, map[string]any{"/user": map[string]any{"id": 1}})
+	provider := oauth.NewGitLab(oauth.Config{ClientID: "client", APIURL: api.URL, HTTPClient: api.Client()})
+	if _, err := provider.GetUser(context.Background(), &oauth.Token{AccessToken: "expired"}); err == nil {
+		t.Error("GetUser succeeded with a rejected access token")
+	}
+}
+
+func TestSignInWithProviderMissingID(t *testing.T) {
+	adapter := keezletest.NewMemoryAdapter[keezletest.Attributes, keezletest.Attributes]()
+	k := keezle.New(&keezle.Config[keezletest.Attributes, keezletest.Attributes]{Adapter: adapter})
+	signIn := oauth.NewSignIn(k, oauth.SignInConfig[keezletest.Attributes]{LinkPolicy: oauth.LinkVerifiedEmail})
+
+	_, err := signIn.SignInWithProvider("generic", &oauth.User{Email: "u1@example.com", EmailVerified: true}, oauth.SignInOptions[keezletest.Attributes]{})
+	if !errors.Is(err, oauth.ErrMissingUserID) {
+		t.Errorf("sign-in returned %v, want ErrMissingUserID", err)
+	}
+	if adapter.Sessions() != 0 {
+		t.Error("a session was created for a provider user without id")
+	}
+}
@@ -0,0 +1,203 @@
+package oauth
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/models"
+)
+
+var (
+	// ErrAccountConflict is returned when the provider account is already linked to another user.
+	ErrAccountConflict = errors.New("oauth: provider account is linked to another user")
+	// ErrAccountExists is returned when a user with the email of the provider user exists, but the provider
+	// user can not be linked to it. The user has to sign in and link the provider explicitly.
+	ErrAccountExists = errors.New("oauth: a user with this email address already exists")
+)
+
+// LinkPolicy controls whether provider users are linked to existing users with the same email address.
+type LinkPolicy int
+
+const (
+	// LinkNever never links by email address. Provider users without a key get a new user, unless a user with
+	// their email address exists, in which case ErrAccountExists is returned.
+	LinkNever LinkPolicy = iota
+	// LinkVerifiedEmail links provider users to the user with their email address if the provider verified it.
+	// Only enable it for providers which verify email addresses, as anyone could otherwise take over accounts.
+	LinkVerifiedEmail
+)
+
+// SignInConfig defines the configuration of a SignIn.
+type SignInConfig[UA models.AnyStruct] struct {
+	LinkPolicy LinkPolicy
+	// EmailProvider is the key provider of email addresses, used to find users by email. Defaults to "email",
+	// the default provider of httpauth.
+	EmailProvider string
+	// FindUserByEmail returns the id of the user with the email address, or an empty string.
+	// It defaults to looking up the key of EmailProvider with the lowercased address.
+	FindUserByEmail func(email string) (string, error)
+	// UserAttributes returns the attributes of a user created for a provider user.
+	UserAttributes func(user *User) (*UA, error)
+}
+
+// SignIn signs users in with provider accounts, keeping the link between a provider user and a keezle user in
+// a key of the provider. Keys of providers have no password.
+type SignIn[UA, SA models.AnyStruct] struct {
+	Keezle *keezle.Keezle[UA, SA]
+	Config SignInConfig[UA]
+}
+
+// NewSignIn creates a SignIn for the Keezle instance.
+func NewSignIn[UA, SA models.AnyStruct](k *keezle.Keezle[UA, SA], config SignInConfig[UA]) *SignIn[UA, SA] {
+	s := &SignIn[UA, SA]{Keezle: k, Config: config}
+	if s.Config.EmailProvider == "" {
+		s.Config.EmailProvider = "email"
+	}
+	if s.Config.FindUserByEmail == nil {
+		s.Config.FindUserByEmail = s.findUserByEmailKey
+	}
+	return s
+}
+
+// SignInOptions defines the options of a sign-in.
+type SignInOptions[SA models.AnyStruct] struct {
+	// LinkUserID is the id of the signed in user, which the provider account is linked to.
+	// No session is created in that case, the user keeps their current session.
+	LinkUserID string
+	// Attributes, RememberMe and Client are the options of the created session.
+	Attributes SA
+	RememberMe bool
+	Client     keezle.ClientInfo
+	// Token is stored with the key of the provider user if set, see keezle.Keezle.SetProviderTokens.
+	Token *Token
+}
+
+// SignInResult is the result of a sign-in.
+type SignInResult[UA, SA models.AnyStruct] struct {
+	// Session is the created session, it is nil if the account was linked to the signed in user.
+	Session *models.Session[UA, SA]
+	UserID  string
+	// Created is set if a new user was created for the provider user.
+	Created bool
+	// Linked is set if the provider account was linked to an existing user.
+	Linked bool
+}
+
+func (s *SignIn[UA, SA]) findUserByEmailKey(email string) (string, error) {
+	key, err := s.Keezle.GetKey(s.Config.EmailProvider, strings.ToLower(email))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	return key.UserID, nil
+}
+
+// SignInWithProvider signs in the user of a provider, as returned by Flow.Callback.
+// Provider users with a key sign in to the user of the key. Otherwise the account is linked to the signed in
+// user of LinkUserID, to the user with the same email address if the link policy allows it, or a new user is
+// created. A session is created unless the account was linked to the signed in user.
+// It returns ErrMissingUserID if the provider user has no id.
+func (s *SignIn[UA, SA]) SignInWithProvider(provider string, user *User, opts SignInOptions[SA]) (*SignInResult[UA, SA], error) {
+	if user.ID == "" {
+		return nil, ErrMissingUserID
+	}
+	result := &SignInResult[UA, SA]{}
+
+	key, err := s.Keezle.GetKey(provider, user.ID)
+	switch {
+	case err == nil:
+		// The owner of the key is not signing in, so check the link before the key is used.
+		if opts.LinkUserID != "" && key.UserID != opts.LinkUserID {
+			return nil, ErrAccountConflict
+		}
+		// Using the key reports the sign-in to event subscribers.
+		if _, err := s.Keezle.UseKey(provider, user.ID, ""); err != nil {
+			return nil, err
+		}
+		result.UserID = key.UserID
+	case errors.Is(err, sql.ErrNoRows):
+		if result.UserID, err = s.findLinkedUser(user, opts.LinkUserID); err != nil {
+			return nil, err
+		}
+		if result.UserID == "" {
+			if result.UserID, err = s.createUser(provider, user); err != nil {
+				return nil, err
+			}
+			result.Created = true
+		} else {
+			_, err := s.Keezle.CreateKey(keezle.CreateKeyOptions{
+				UserID:         result.UserID,
+				Provider:       provider,
+				ProviderUserID: user.ID,
+			})
+			if err != nil {
+				return nil, err
+			}
+			result.Linked = true
+		}
+	default:
+		return nil, err
+	}
+
+	if opts.Token != nil {
+		if err := s.Keezle.SetProviderTokens(provider, user.ID, opts.Token.ProviderTokens()); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.LinkUserID != "" {
+		return result, nil
+	}
+	result.Session, err = s.Keezle.CreateSession(keezle.CreateSessionOptions[SA]{
+		UserId:     result.UserID,
+		Attributes: opts.Attributes,
+		RememberMe: opts.RememberMe,
+		Client:     opts.Client,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// findLinkedUser returns the id of the user a provider user without a key is linked to, which is the signed in
+// user or the user with the same email address if the link policy allows it. It returns an empty string if a
+// new user has to be created.
+func (s *SignIn[UA, SA]) findLinkedUser(user *User, linkUserId string) (string, error) {
+	if linkUserId != "" || user.Email == "" {
+		return linkUserId, nil
+	}
+
+	userId, err := s.Config.FindUserByEmail(user.Email)
+	if err != nil {
+		return "", err
+	}
+	if userId != "" && (s.Config.LinkPolicy != LinkVerifiedEmail || !user.EmailVerified) {
+		return "", ErrAccountExists
+	}
+	return userId, nil
+}
+
+// createUser creates a user with a key of the provider.
+func (s *SignIn[UA, SA]) createUser(provider string, user *User) (string, error) {
+	opts := keezle.CreateUserOptions[UA]{}
+	opts.Key.Provider = provider
+	opts.Key.ProviderUserID = user.ID
+	if s.Config.UserAttributes != nil {
+		attributes, err := s.Config.UserAttributes(user)
+		if err != nil {
+			return "", err
+		}
+		opts.Attributes = attributes
+	}
+
+	created, err := s.Keezle.CreateUser(opts)
+	if err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
@@ -0,0 +1,96 @@
+package oauth_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/keezletest"
+	"github.com/gaurishhs/keezle/oauth"
+)
+
+type attributes = keezletest.Attributes
+
+// newSignIn returns a sign-in with the link policy and the id of a user with the email key "u1@example.com".
+func newSignIn(t *testing.T, policy oauth.LinkPolicy) (*oauth.SignIn[attributes, attributes], string) {
+	t.Helper()
+	k := keezle.New(&keezle.Config[attributes, attributes]{Adapter: keezletest.NewMemoryAdapter[attributes, attributes]()})
+	opts := keezle.CreateUserOptions[attributes]{}
+	opts.Key.Provider = "email"
+	opts.Key.ProviderUserID = "u1@example.com"
+	opts.Key.Password = "password"
+	user, err := k.CreateUser(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return oauth.NewSignIn(k, oauth.SignInConfig[attributes]{LinkPolicy: policy}), user.ID
+}
+
+func TestSignInWithProvider(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy oauth.LinkPolicy
+		user   oauth.User
+		err    error
+		linked bool
+	}{
+		{"new user", oauth.LinkNever, oauth.User{ID: "1", Email: "u2@example.com", EmailVerified: true}, nil, false},
+		{"existing email", oauth.LinkNever, oauth.User{ID: "1", Email: "U1@example.com", EmailVerified: true}, oauth.ErrAccountExists, false},
+		{"unverified email", oauth.LinkVerifiedEmail, oauth.User{ID: "1", Email: "u1@example.com"}, oauth.ErrAccountExists, false},
+		{"verified email", oauth.LinkVerifiedEmail, oauth.User{ID: "1", Email: "U1@example.com", EmailVerified: true}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signIn, userId := newSignIn(t, tt.policy)
+			result, err := signIn.SignInWithProvider("github", &tt.user, oauth.SignInOptions[attributes]{})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("sign-in returned %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if result.Session == nil || result.Linked != tt.linked || result.Created == tt.linked || (result.UserID == userId) != tt.linked {
+				t.Fatalf("result = %+v", result)
+			}
+
+			// The provider user signs in to the same user again.
+			again, err := signIn.SignInWithProvider("github", &oauth.User{ID: tt.user.ID}, oauth.SignInOptions[attributes]{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.Created || again.Linked || again.UserID != result.UserID || again.Session == nil {
+				t.Errorf("second sign-in = %+v", again)
+			}
+		})
+	}
+}
+
+func TestSignInWithProviderLink(t *testing.T) {
+	signIn, userId := newSignIn(t, oauth.LinkNever)
+	other, err := signIn.SignInWithProvider("github", &oauth.User{ID: "other"}, oauth.SignInOptions[attributes]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logins []keezle.LoginEvent
+	signIn.Keezle.Events.Subscribe(keezle.EventLoginSucceeded, func(event keezle.Event) error {
+		logins = append(logins, *event.(*keezle.LoginEvent))
+		return nil
+	})
+
+	result, err := signIn.SignInWithProvider("gitlab", &oauth.User{ID: "1"}, oauth.SignInOptions[attributes]{LinkUserID: userId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Linked || result.UserID != userId || result.Session != nil {
+		t.Errorf("result = %+v", result)
+	}
+
+	// The account of another user is not linked, and its owner is not signed in.
+	logins = nil
+	if _, err := signIn.SignInWithProvider("github", &oauth.User{ID: "other"}, oauth.SignInOptions[attributes]{LinkUserID: userId}); !errors.Is(err, oauth.ErrAccountConflict) {
+		t.Errorf("linking the account of another user returned %v, want ErrAccountConflict", err)
+	}
+	if len(logins) != 0 {
+		t.Errorf("linking the account of user %s emitted logins %+v", other.UserID, logins)
+	}
+}
@@ -0,0 +1,59 @@
+package oauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// flowState is the state of an authorization request, kept in a cookie until the callback.
+type flowState struct {
+	Provider     string `json:"p"`
+	State        string `json:"s"`
+	CodeVerifier string `json:"v"`
+	Nonce        string `json:"n,omitempty"`
+	ExpiresAt    int64  `json:"e"`
+}
+
+func stateMAC(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// encodeState encodes and signs the state.
+func encodeState(secret []byte, state *flowState) (string, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(stateMAC(secret, payload)), nil
+}
+
+// decodeState verifies the signature and expiration time of an encoded state.
+func decodeState(secret []byte, value string, now time.Time) (*flowState, error) {
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, ErrInvalidState
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, stateMAC(secret, payload)) {
+		return nil, ErrInvalidState
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+	var state flowState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, ErrInvalidState
+	}
+	if now.Unix() >= state.ExpiresAt {
+		return nil, ErrInvalidState
+	}
+	return &state, nil
+}
@@ -0,0 +1,254 @@
+package keezle
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gaurishhs/keezle/adapters"
+)
+
+// GrantRevokedPolicy defines what happens to a key whose provider rejects its refresh token.
+type GrantRevokedPolicy int
+
+const (
+	// GrantRevokedFlag keeps the key and flags its token as revoked, until new tokens are stored for it.
+	GrantRevokedFlag GrantRevokedPolicy = iota
+	// GrantRevokedUnlink deletes the key and its token, unlinking the provider account from the user.
+	GrantRevokedUnlink
+)
+
+// ProviderTokens are the OAuth tokens a provider issued for a key.
+type ProviderTokens struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	TokenType    string    `json:"token_type,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitzero"`
+}
+
+// ProviderTokenRefresher refreshes the tokens of a provider. It must return an error wrapping
+// ErrProviderGrantRevoked if the provider rejects the refresh token. oauth.Client implements it.
+type ProviderTokenRefresher interface {
+	RefreshProviderTokens(ctx context.Context, refreshToken string) (*ProviderTokens, error)
+}
+
+// ProviderTokenConfig enables storing the OAuth tokens of provider keys, so that the application can call
+// provider APIs on behalf of users. The adapter must implement adapters.ProviderTokenStore.
+type ProviderTokenConfig struct {
+	// EncryptionKey is the 32 byte AES-256 key the tokens are encrypted with.
+	EncryptionKey []byte
+	// Refreshers refresh expired access tokens, by provider.
+	Refreshers map[string]ProviderTokenRefresher
+	// OnGrantRevoked defines what happens when a provider rejects a refresh token, defaults to GrantRevokedFlag.
+	OnGrantRevoked GrantRevokedPolicy
+	// RefreshLeeway refreshes access tokens this long before they expire, defaults to 1 minute.
+	RefreshLeeway time.Duration
+}
+
+// keyedMutex serializes operations on the same key.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock locks the key and returns the function unlocking it.
+func (m *keyedMutex) lock(key string) func() {
+	m.mu.Lock()
+	if m.locks == nil {
+		m.locks = make(map[string]*keyedLock)
+	}
+	l, ok := m.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		m.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}
+}
+
+func (k *Keezle[UA, SA]) providerTokenStore() (adapters.ProviderTokenStore, error) {
+	if k.Config.ProviderTokens == nil {
+		return nil, ErrProviderTokensDisabled
+	}
+	store, ok := k.Config.Adapter.(adapters.ProviderTokenStore)
+	if !ok {
+		return nil, ErrProviderTokensUnsupported
+	}
+	return store, nil
+}
+
+func (k *Keezle[UA, SA]) providerTokenCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k.Config.ProviderTokens.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptProviderTokens encrypts the tokens, bound to the key id so that they can not be moved to another key.
+func (k *Keezle[UA, SA]) encryptProviderTokens(keyId string, tokens *ProviderTokens) (string, error) {
+	plaintext, err := json.Marshal(tokens)
+	if err != nil {
+		return "", err
+	}
+	aead, err := k.providerTokenCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, []byte(keyId))), nil
+}
+
+func (k *Keezle[UA, SA]) decryptProviderTokens(keyId, encrypted string) (*ProviderTokens, error) {
+	ciphertext, err := base64.RawStdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := k.providerTokenCipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("provider token ciphertext too short")
+	}
+	plaintext, err := aead.Open(nil, ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():], []byte(keyId))
+	if err != nil {
+		return nil, err
+	}
+	var tokens ProviderTokens
+	if err := json.Unmarshal(plaintext, &tokens); err != nil {
+		return nil, err
+	}
+	return &tokens, nil
+}
+
+// storeProviderTokens encrypts and stores the tokens of the key, clearing a revoked flag.
+func (k *Keezle[UA, SA]) storeProviderTokens(store adapters.ProviderTokenStore, keyId, userId string, tokens *ProviderTokens) error {
+	encrypted, err := k.encryptProviderTokens(keyId, tokens)
+	if err != nil {
+		return err
+	}
+	token := &adapters.ProviderToken{
+		KeyID:     keyId,
+		UserID:    userId,
+		Tokens:    encrypted,
+		UpdatedAt: k.now(),
+	}
+	if !tokens.ExpiresAt.IsZero() {
+		token.ExpiresAt = &tokens.ExpiresAt
+	}
+	return store.SetProviderToken(token)
+}
+
+// SetProviderTokens stores the tokens a provider issued for the key, e.g. after signing in with the provider.
+func (k *Keezle[UA, SA]) SetProviderTokens(provider, providerUserId string, tokens *ProviderTokens) error {
+	store, err := k.providerTokenStore()
+	if err != nil {
+		return err
+	}
+	key, err := k.GetKey(provider, providerUserId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidKeyId
+		}
+		return err
+	}
+	return k.storeProviderTokens(store, key.ID, key.UserID, tokens)
+}
+
+// GetProviderAccessToken returns a valid access token of the key, refreshing the tokens with the refresher of
+// the provider once the access token has expired. Concurrent calls for the same key share a refresh, as
+// providers which rotate refresh tokens reject the second use of a refresh token.
+// It returns ErrProviderTokenNotFound if the key has no tokens, ErrProviderTokenExpired if the access token has
+// expired and can not be refreshed, and ErrProviderGrantRevoked if the user revoked the grant, in which case the
+// key is flagged or unlinked as configured by ProviderTokenConfig.OnGrantRevoked.
+func (k *Keezle[UA, SA]) GetProviderAccessToken(ctx context.Context, provider, providerUserId string) (string, error) {
+	store, err := k.providerTokenStore()
+	if err != nil {
+		return "", err
+	}
+	keyId, err := createKeyId(provider, providerUserId)
+	if err != nil {
+		return "", err
+	}
+
+	unlock := k.providerTokenLocks.lock(keyId)
+	defer unlock()
+
+	token, err := store.GetProviderToken(keyId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrProviderTokenNotFound
+		}
+		return "", err
+	}
+	if token.RevokedAt != nil {
+		return "", ErrProviderGrantRevoked
+	}
+	tokens, err := k.decryptProviderTokens(keyId, token.Tokens)
+	if err != nil {
+		return "", err
+	}
+
+	if tokens.ExpiresAt.IsZero() || k.now().Add(k.Config.ProviderTokens.RefreshLeeway).Before(tokens.ExpiresAt) {
+		return tokens.AccessToken, nil
+	}
+
+	refresher := k.Config.ProviderTokens.Refreshers[provider]
+	if tokens.RefreshToken == "" || refresher == nil {
+		return "", ErrProviderTokenExpired
+	}
+	refreshed, err := refresher.RefreshProviderTokens(ctx, tokens.RefreshToken)
+	if err != nil {
+		if errors.Is(err, ErrProviderGrantRevoked) {
+			if err := k.revokeProviderGrant(store, provider, providerUserId, token); err != nil {
+				return "", err
+			}
+		}
+		return "", err
+	}
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = tokens.RefreshToken
+	}
+	if err := k.storeProviderTokens(store, keyId, token.UserID, refreshed); err != nil {
+		return "", err
+	}
+	return refreshed.AccessToken, nil
+}
+
+// revokeProviderGrant applies the grant revoked policy to the key of the token.
+func (k *Keezle[UA, SA]) revokeProviderGrant(store adapters.ProviderTokenStore, provider, providerUserId string, token *adapters.ProviderToken) error {
+	k.Config.Logger.Log("debug: provider %s rejected the refresh token of a key, the grant has been revoked", provider)
+	if k.Config.ProviderTokens.OnGrantRevoked == GrantRevokedUnlink {
+		return k.DeleteKey(provider, providerUserId)
+	}
+	token.RevokedAt = ptr(k.now())
+	token.UpdatedAt = k.now()
+	return store.SetProviderToken(token)
+}
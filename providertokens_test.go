@@ -0,0 +1,216 @@
+package keezle_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/keezletest"
+)
+
+// providerTokenAdapter is a memory adapter which stores provider tokens.
+type providerTokenAdapter struct {
+	*keezletest.MemoryAdapter[attributes, attributes]
+	keezletest.ProviderTokenStore
+}
+
+// refresher is a provider token refresher which issues access tokens valid for an hour, or rejects the
+// refresh token once revoked is set.
+type refresher struct {
+	clock   *keezletest.FakeClock
+	mu      sync.Mutex
+	revoked bool
+	// refreshTokens are the refresh tokens the refresher was called with.
+	refreshTokens []string
+}
+
+func (r *refresher) RefreshProviderTokens(_ context.Context, refreshToken string) (*keezle.ProviderTokens, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refreshTokens = append(r.refreshTokens, refreshToken)
+	if r.revoked {
+		return nil, fmt.Errorf("github: invalid_grant: %w", keezle.ErrProviderGrantRevoked)
+	}
+	return &keezle.ProviderTokens{
+		AccessToken: fmt.Sprintf("access-%d", len(r.refreshTokens)),
+		ExpiresAt:   r.clock.Now().Add(time.Hour),
+	}, nil
+}
+
+func (r *refresher) calls() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.refreshTokens)
+}
+
+// newProviderKeezle returns an instance storing provider tokens with a user "u1" who has the github key "9".
+func newProviderKeezle(t *testing.T, policy keezle.GrantRevokedPolicy) (*keezle.Keezle[attributes, attributes], *providerTokenAdapter, *refresher) {
+	t.Helper()
+	adapter := &providerTokenAdapter{MemoryAdapter: keezletest.NewMemoryAdapter[attributes, attributes]()}
+	clock := keezletest.NewFakeClock(epoch)
+	github := &refresher{clock: clock}
+	k := keezle.New(&keezle.Config[attributes, attributes]{
+		Adapter: adapter,
+		Clock:   clock,
+		ProviderTokens: &keezle.ProviderTokenConfig{
+			EncryptionKey:  []byte("0123456789abcdef0123456789abcdef"),
+			Refreshers:     map[string]keezle.ProviderTokenRefresher{"github": github},
+			OnGrantRevoked: policy,
+		},
+	})
+	if _, err := k.CreateUser(keezle.CreateUserOptions[attributes]{UserID: "u1", Attributes: &attributes{}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.CreateKey(keezle.CreateKeyOptions{UserID: "u1", Provider: "github", ProviderUserID: "9"}); err != nil {
+		t.Fatal(err)
+	}
+	return k, adapter, github
+}
+
+func TestProviderAccessToken(t *testing.T) {
+	k, _, github := newProviderKeezle(t, keezle.GrantRevokedFlag)
+	ctx := context.Background()
+	err := k.SetProviderTokens("github", "9", &keezle.ProviderTokens{
+		AccessToken:  "access-0",
+		RefreshToken: "refresh",
+		ExpiresAt:    epoch.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if token, err := k.GetProviderAccessToken(ctx, "github", "9"); err != nil || token != "access-0" {
+		t.Fatalf("valid access token = %q, %v", token, err)
+	}
+
+	// The access token is refreshed within the refresh leeway of its expiry.
+	github.clock.Set(epoch.Add(time.Hour - 30*time.Second))
+	if token, err := k.GetProviderAccessToken(ctx, "github", "9"); err != nil || token != "access-1" {
+		t.Fatalf("refreshed access token = %q, %v", token, err)
+	}
+
+	// Concurrent calls share a refresh.
+	github.clock.Advance(2 * time.Hour)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := k.GetProviderAccessToken(ctx, "github", "9"); err != nil || token != "access-2" {
+				t.Errorf("concurrently refreshed access token = %q, %v", token, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The refresher did not return a refresh token, so the previous one is kept.
+	if want := []string{"refresh", "refresh"}; strings.Join(github.refreshTokens, ",") != strings.Join(want, ",") {
+		t.Errorf("refreshed with %q, want %q", github.refreshTokens, want)
+	}
+}
+
+func TestProviderAccessTokenExpired(t *testing.T) {
+	k, _, github := newProviderKeezle(t, keezle.GrantRevokedFlag)
+	ctx := context.Background()
+	if _, err := k.GetProviderAccessToken(ctx, "github", "9"); !errors.Is(err, keezle.ErrProviderTokenNotFound) {
+		t.Errorf("key without tokens returned %v, want ErrProviderTokenNotFound", err)
+	}
+
+	err := k.SetProviderTokens("github", "9", &keezle.ProviderTokens{AccessToken: "access-0", ExpiresAt: epoch.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	github.clock.Advance(time.Hour)
+	if _, err := k.GetProviderAccessToken(ctx, "github", "9"); !errors.Is(err, keezle.ErrProviderTokenExpired) {
+		t.Errorf("expired token without a refresh token returned %v, want ErrProviderTokenExpired", err)
+	}
+	if github.calls() != 0 {
+		t.Error("the refresher was called without a refresh token")
+	}
+}
+
+func TestProviderGrantRevoked(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy keezle.GrantRevokedPolicy
+		// unlinked reports whether the key is deleted.
+		unlinked bool
+		// err is returned by the calls after the grant has been revoked.
+		err error
+	}{
+		{"flag", keezle.GrantRevokedFlag, false, keezle.ErrProviderGrantRevoked},
+		{"unlink", keezle.GrantRevokedUnlink, true, keezle.ErrProviderTokenNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, adapter, github := newProviderKeezle(t, tt.policy)
+			ctx := context.Background()
+			tokens := &keezle.ProviderTokens{AccessToken: "access-0", RefreshToken: "refresh", ExpiresAt: epoch}
+			if err := k.SetProviderTokens("github", "9", tokens); err != nil {
+				t.Fatal(err)
+			}
+
+			github.revoked = true
+			if _, err := k.GetProviderAccessToken(ctx, "github", "9"); !errors.Is(err, keezle.ErrProviderGrantRevoked) {
+				t.Fatalf("rejected refresh token returned %v, want ErrProviderGrantRevoked", err)
+			}
+			if _, err := k.GetKey("github", "9"); (err != nil) != tt.unlinked {
+				t.Errorf("key unlinked = %v, want %v", err != nil, tt.unlinked)
+			}
+			if _, err := k.GetProviderAccessToken(ctx, "github", "9"); !errors.Is(err, tt.err) {
+				t.Errorf("after the grant was revoked returned %v, want %v", err, tt.err)
+			}
+			if github.calls() != 1 {
+				t.Errorf("refresher was called %d times, want once", github.calls())
+			}
+			if tt.unlinked {
+				if _, err := adapter.GetProviderToken("github:9"); err == nil {
+					t.Error("tokens of the unlinked key were not deleted")
+				}
+				return
+			}
+
+			// Storing new tokens, e.g. after the user signed in again, clears the flag.
+			tokens.ExpiresAt = epoch.Add(time.Hour)
+			if err := k.SetProviderTokens("github", "9", tokens); err != nil {
+				t.Fatal(err)
+			}
+			if token, err := k.GetProviderAccessToken(ctx, "github", "9"); err != nil || token != "access-0" {
+				t.Errorf("access token after storing new tokens = %q, %v", token, err)
+			}
+		})
+	}
+}
+
+func TestProviderTokensBoundToKey(t *testing.T) {
+	k, adapter, _ := newProviderKeezle(t, keezle.GrantRevokedFlag)
+	if _, err := k.CreateKey(keezle.CreateKeyOptions{UserID: "u1", Provider: "github", ProviderUserID: "10"}); err != nil {
+		t.Fatal(err)
+	}
+	err := k.SetProviderTokens("github", "9", &keezle.ProviderTokens{AccessToken: "secret-access-token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := adapter.GetProviderToken("github:9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(stored.Tokens, "secret-access-token") {
+		t.Error("tokens are stored in plaintext")
+	}
+
+	// Tokens moved to another key do not decrypt.
+	stored.KeyID = "github:10"
+	if err := adapter.SetProviderToken(stored); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := k.GetProviderAccessToken(context.Background(), "github", "10"); err == nil {
+		t.Errorf("tokens moved to another key decrypted to %q", token)
+	}
+}
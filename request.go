@@ -19,9 +19,14 @@ var AllowedMethods = []string{
 
 // AuthRequest represents an authentication request that can be validated and managed.
 type AuthRequest[UA, SA models.AnyStruct] struct {
-	Request      *http.Request
-	SessionID    *string
-	Keezle       *Keezle[UA, SA]
+	Request   *http.Request
+	SessionID *string
+	Keezle    *Keezle[UA, SA]
+	// Client describes the client which sent the request.
+	Client ClientInfo
+	// WriteCookie writes a cookie to the response.
+	// If it is nil, session cookies are added to the request instead.
+	WriteCookie  func(cookie *http.Cookie)
 	validateOnce sync.Once
 	validateRes  *models.Session[UA, SA]
 	validateErr  error
@@ -34,42 +39,66 @@ func (k *Keezle[UA, SA]) HandleRequest(req *http.Request) (*AuthRequest[UA, SA],
 		if !isValidRequestOrigin(k.Config.CSRF, req) {
 			return nil, ErrInvalidRequestOrigin
 		}
-		return &AuthRequest[UA, SA]{
-			Request:   req,
-			Keezle:    k,
-			SessionID: ptr(k.ReadSessionCookie(req)),
-		}, nil
+	}
+	var sessionId *string
+	if cookie := k.ReadSessionCookie(req); cookie != "" {
+		sessionId = &cookie
 	}
 	return &AuthRequest[UA, SA]{
 		Request:   req,
 		Keezle:    k,
-		SessionID: nil,
+		SessionID: sessionId,
+		Client:    k.ClientInfo(req),
 	}, nil
 }
 
+// CreateSession creates a session for the client of the request and sets the session cookie.
+// The client information of the request is stored with the session unless opts sets it.
+func (r *AuthRequest[UA, SA]) CreateSession(opts CreateSessionOptions[SA]) (*models.Session[UA, SA], error) {
+	if opts.Client == (ClientInfo{}) {
+		opts.Client = r.Client
+	}
+	session, err := r.Keezle.CreateSession(opts)
+	if err != nil {
+		return nil, err
+	}
+	r.Invalidate()
+	r.SetSession(session)
+	return session, nil
+}
+
 // SetSession sets the session for the AuthRequest and updates the session cookie.
 func (r *AuthRequest[UA, SA]) SetSession(session *models.Session[UA, SA]) {
 	if session == nil {
 		r.SessionID = nil
-		r.Request.AddCookie(r.Keezle.CreateSessionCookie(nil))
+		r.writeCookie(r.Keezle.CreateSessionCookie(nil))
 		return
 	}
 	if deref(r.SessionID) == session.ID {
 		return
 	}
 	r.SessionID = &session.ID
-	r.Request.AddCookie(r.Keezle.CreateSessionCookie(session))
+	r.writeCookie(r.Keezle.CreateSessionCookie(session))
+}
+
+func (r *AuthRequest[UA, SA]) writeCookie(cookie *http.Cookie) {
+	if r.WriteCookie != nil {
+		r.WriteCookie(cookie)
+		return
+	}
+	r.Request.AddCookie(cookie)
 }
 
 // Validate validates the session associated with the AuthRequest and resets the session if it is idle.
+// The session binding is checked against the client of the request.
 func (r *AuthRequest[UA, SA]) Validate() (*models.Session[UA, SA], error) {
 	r.validateOnce.Do((func() {
 		if r.SessionID == nil {
 			return
 		}
-		session, err := r.Keezle.ValidateSession(deref(r.SessionID))
+		session, err := r.Keezle.ValidateSessionWithClient(deref(r.SessionID), r.Client)
 		if err != nil {
-			if errors.Is(err, ErrInvalidSessionId) {
+			if errors.Is(err, ErrInvalidSessionId) || errors.Is(err, ErrSessionExpired) || errors.Is(err, ErrSessionBindingMismatch) {
 				r.SetSession(nil)
 				return
 			}
@@ -0,0 +1,137 @@
+package keezle_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/adapters"
+	"github.com/gaurishhs/keezle/keezletest"
+	"github.com/gaurishhs/keezle/models"
+)
+
+// rotatingAdapter is a memory adapter which rotates sessions atomically by serializing the rotations.
+type rotatingAdapter struct {
+	*keezletest.MemoryAdapter[attributes, attributes]
+	mu sync.Mutex
+}
+
+func (a *rotatingAdapter) RotateSession(sessionId string, session *models.DBSession[attributes], graceExpiresAt time.Time, limit *adapters.SessionLimit, now time.Time) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	current, _, err := a.GetSessionAndUser(sessionId)
+	if err != nil {
+		return "", err
+	}
+	if current.ReplacedBy != nil {
+		return *current.ReplacedBy, nil
+	}
+	_, err = a.UpdateSession(sessionId, &models.DBSession[attributes]{
+		ActiveExpiresAt: &graceExpiresAt,
+		IdleExpiresAt:   &graceExpiresAt,
+		ReplacedBy:      session.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+	return *session.ID, a.CreateSession(session)
+}
+
+func TestSessionRotation(t *testing.T) {
+	k, clock := newKeezle(t, &keezle.SessionConfig{
+		ActivePeriod:        time.Hour,
+		IdlePeriod:          time.Hour,
+		RotationPeriod:      10 * time.Minute,
+		RotationGracePeriod: time.Minute,
+		MaxLifetime:         25 * time.Minute,
+	})
+	session, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(5 * time.Minute)
+	if got, err := k.ValidateSession(session.ID); err != nil || got.ID != session.ID {
+		t.Fatalf("session was rotated before the rotation period: %v, %v", got, err)
+	}
+
+	clock.Advance(5 * time.Minute)
+	rotated, err := k.ValidateSession(session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.ID == session.ID || !rotated.Fresh {
+		t.Fatalf("session was not rotated: id %q, fresh %v", rotated.ID, rotated.Fresh)
+	}
+	if !rotated.CreatedAt.Equal(session.CreatedAt) {
+		t.Errorf("rotated session created at %v, want %v", rotated.CreatedAt, session.CreatedAt)
+	}
+
+	clock.Advance(time.Minute - time.Second)
+	got, err := k.ValidateSession(session.ID)
+	if err != nil {
+		t.Fatalf("old id within the grace period: %v", err)
+	}
+	if got.ID != rotated.ID || !got.Fresh {
+		t.Errorf("old id resolved to %q, fresh %v, want %q", got.ID, got.Fresh, rotated.ID)
+	}
+
+	clock.Advance(time.Second)
+	if _, err := k.ValidateSession(session.ID); !errors.Is(err, keezle.ErrInvalidSessionId) {
+		t.Errorf("old id after the grace period returned %v, want ErrInvalidSessionId", err)
+	}
+	if got, err := k.ValidateSession(rotated.ID); err != nil || got.ID != rotated.ID {
+		t.Errorf("rotated session after the grace period: %v, %v", got, err)
+	}
+
+	// The rotated session keeps the creation time of the session, so the maximum lifetime still applies.
+	clock.Set(epoch.Add(25 * time.Minute))
+	if _, err := k.ValidateSession(rotated.ID); !errors.Is(err, keezle.ErrSessionExpired) {
+		t.Errorf("rotated session past the maximum lifetime returned %v, want ErrSessionExpired", err)
+	}
+}
+
+func TestConcurrentSessionRotation(t *testing.T) {
+	adapter := &rotatingAdapter{MemoryAdapter: keezletest.NewMemoryAdapter[attributes, attributes]()}
+	clock := keezletest.NewFakeClock(epoch)
+	k := keezle.New(&keezle.Config[attributes, attributes]{
+		Adapter: adapter,
+		Session: &keezle.SessionConfig{ActivePeriod: time.Hour, IdlePeriod: time.Hour, RotationPeriod: time.Minute},
+		Clock:   clock,
+	})
+	if _, err := k.CreateUser(keezle.CreateUserOptions[attributes]{UserID: "u1", Attributes: &attributes{}}); err != nil {
+		t.Fatal(err)
+	}
+	session, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+
+	ids := make([]string, 8)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rotated, err := k.ValidateSession(session.ID)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ids[i] = rotated.ID
+		}()
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		if id == session.ID || id != ids[0] {
+			t.Fatalf("concurrent rotations returned %q, want a single successor", ids)
+		}
+	}
+	if n := adapter.Sessions(); n != 2 {
+		t.Errorf("%d sessions stored, want the session and its successor", n)
+	}
+}
@@ -0,0 +1,116 @@
+package saml
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// Metadata returns the metadata of the service provider, which is imported by the identity provider.
+func (sp *ServiceProvider) Metadata() ([]byte, error) {
+	entity := etree.NewElement("md:EntityDescriptor")
+	entity.CreateAttr("xmlns:md", MetadataNamespace)
+	entity.CreateAttr("entityID", sp.Config.EntityID)
+
+	descriptor := entity.CreateElement("md:SPSSODescriptor")
+	descriptor.CreateAttr("AuthnRequestsSigned", strconv.FormatBool(sp.Config.Key != nil))
+	descriptor.CreateAttr("WantAssertionsSigned", strconv.FormatBool(sp.Config.WantAssertionsSigned))
+	descriptor.CreateAttr("protocolSupportEnumeration", ProtocolNamespace)
+	if sp.Config.Certificate != nil {
+		keyDescriptor := descriptor.CreateElement("md:KeyDescriptor")
+		keyDescriptor.CreateAttr("use", "signing")
+		keyInfo := keyDescriptor.CreateElement("ds:KeyInfo")
+		keyInfo.CreateAttr("xmlns:ds", dsig.Namespace)
+		keyInfo.CreateElement("ds:X509Data").CreateElement("ds:X509Certificate").
+			SetText(base64.StdEncoding.EncodeToString(sp.Config.Certificate.Raw))
+	}
+	if sp.Config.NameIDFormat != "" {
+		descriptor.CreateElement("md:NameIDFormat").SetText(sp.Config.NameIDFormat)
+	}
+	acs := descriptor.CreateElement("md:AssertionConsumerService")
+	acs.CreateAttr("Binding", HTTPPostBinding)
+	acs.CreateAttr("Location", sp.Config.ACSURL)
+	acs.CreateAttr("index", "0")
+	acs.CreateAttr("isDefault", "true")
+
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	doc.SetRoot(entity)
+	doc.Indent(2)
+	return doc.WriteToBytes()
+}
+
+// ServeMetadata serves the metadata of the service provider.
+func (sp *ServiceProvider) ServeMetadata(w http.ResponseWriter, req *http.Request) {
+	metadata, err := sp.Metadata()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(metadata)
+}
+
+type xmlEntityDescriptor struct {
+	XMLName           xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID          string   `xml:"entityID,attr"`
+	IDPSSODescriptors []struct {
+		KeyDescriptors []struct {
+			Use     string `xml:"use,attr"`
+			KeyInfo struct {
+				X509Data struct {
+					Certificates []string `xml:"http://www.w3.org/2000/09/xmldsig# X509Certificate"`
+				} `xml:"http://www.w3.org/2000/09/xmldsig# X509Data"`
+			} `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:metadata KeyDescriptor"`
+		SingleSignOnServices []struct {
+			Binding  string `xml:"Binding,attr"`
+			Location string `xml:"Location,attr"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleSignOnService"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:metadata IDPSSODescriptor"`
+}
+
+// ParseIdentityProviderMetadata returns the identity provider described by its metadata, as exported by the
+// identity provider. The signature of the metadata is not verified, it has to be obtained from a trusted source.
+// The single sign-on service with the HTTP-Redirect binding is preferred over the HTTP-POST binding.
+func ParseIdentityProviderMetadata(data []byte) (*IdentityProvider, error) {
+	var entity xmlEntityDescriptor
+	if err := xml.Unmarshal(data, &entity); err != nil || entity.EntityID == "" || len(entity.IDPSSODescriptors) == 0 {
+		return nil, ErrInvalidMetadata
+	}
+
+	idp := &IdentityProvider{EntityID: entity.EntityID}
+	descriptor := entity.IDPSSODescriptors[0]
+	for _, keyDescriptor := range descriptor.KeyDescriptors {
+		if keyDescriptor.Use != "" && keyDescriptor.Use != "signing" {
+			continue
+		}
+		for _, encoded := range keyDescriptor.KeyInfo.X509Data.Certificates {
+			der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+			if err != nil {
+				return nil, ErrInvalidMetadata
+			}
+			certificate, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, ErrInvalidMetadata
+			}
+			idp.Certificates = append(idp.Certificates, certificate)
+		}
+	}
+	for _, service := range descriptor.SingleSignOnServices {
+		if service.Binding == HTTPRedirectBinding || (service.Binding == HTTPPostBinding && idp.SSOURL == "") {
+			idp.SSOURL = service.Location
+			idp.SSOBinding = service.Binding
+		}
+	}
+	if idp.SSOURL == "" || len(idp.Certificates) == 0 {
+		return nil, ErrInvalidMetadata
+	}
+	return idp, nil
+}
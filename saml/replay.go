@@ -0,0 +1,54 @@
+package saml
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+)
+
+// ReplayCache remembers the ids of used assertions until they expire, so that an assertion is only accepted
+// once.
+type ReplayCache interface {
+	// Use records the id of an assertion which is valid until expiresAt. It returns false if the id has already
+	// been used.
+	Use(id string, expiresAt time.Time) (bool, error)
+}
+
+// MemoryReplayCache is a ReplayCache kept in memory. It only detects replays within a single process, deployments
+// with several instances need a shared cache.
+type MemoryReplayCache struct {
+	// Clock tells the current time, defaults to keezle.SystemClock.
+	Clock keezle.Clock
+
+	mu  sync.Mutex
+	ids map[string]time.Time
+	// pruned is the time expired ids were last removed, which happens at most once a minute.
+	pruned time.Time
+}
+
+// NewMemoryReplayCache creates an empty MemoryReplayCache.
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{Clock: keezle.SystemClock, ids: map[string]time.Time{}}
+}
+
+func (c *MemoryReplayCache) Use(id string, expiresAt time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.Clock.Now()
+	if now.Sub(c.pruned) > time.Minute {
+		for usedId, usedExpiresAt := range c.ids {
+			if now.After(usedExpiresAt) {
+				delete(c.ids, usedId)
+			}
+		}
+		c.pruned = now
+	}
+
+	if usedExpiresAt, ok := c.ids[id]; ok && !now.After(usedExpiresAt) {
+		return false, nil
+	}
+	c.ids[id] = expiresAt
+	return true, nil
+}
@@ -0,0 +1,328 @@
+package saml
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+// maxResponseSize is the maximum size of a response posted to the assertion consumer service.
+const maxResponseSize = 1 << 20
+
+// bearerMethod is the method of the subject confirmation of web browser SSO.
+const bearerMethod = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+
+type xmlStatusCode struct {
+	Value      string         `xml:"Value,attr"`
+	StatusCode *xmlStatusCode `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusCode"`
+}
+
+type xmlResponse struct {
+	XMLName      xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol Response"`
+	ID           string   `xml:"ID,attr"`
+	Version      string   `xml:"Version,attr"`
+	InResponseTo string   `xml:"InResponseTo,attr"`
+	Destination  string   `xml:"Destination,attr"`
+	Issuer       string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Status       struct {
+		StatusCode    xmlStatusCode `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusCode"`
+		StatusMessage string        `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusMessage"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:protocol Status"`
+}
+
+type xmlSubjectConfirmation struct {
+	Method string `xml:"Method,attr"`
+	Data   struct {
+		NotBefore    time.Time `xml:"NotBefore,attr"`
+		NotOnOrAfter time.Time `xml:"NotOnOrAfter,attr"`
+		Recipient    string    `xml:"Recipient,attr"`
+		InResponseTo string    `xml:"InResponseTo,attr"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
+}
+
+type xmlAssertion struct {
+	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	ID      string   `xml:"ID,attr"`
+	Version string   `xml:"Version,attr"`
+	Issuer  string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Subject struct {
+		NameID struct {
+			Format string `xml:"Format,attr"`
+			Value  string `xml:",chardata"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+		SubjectConfirmations []xmlSubjectConfirmation `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmation"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Subject"`
+	Conditions *struct {
+		NotBefore            time.Time `xml:"NotBefore,attr"`
+		NotOnOrAfter         time.Time `xml:"NotOnOrAfter,attr"`
+		AudienceRestrictions []struct {
+			Audiences []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Audience"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AudienceRestriction"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Conditions"`
+	AuthnStatements []struct {
+		AuthnInstant        time.Time `xml:"AuthnInstant,attr"`
+		SessionIndex        string    `xml:"SessionIndex,attr"`
+		SessionNotOnOrAfter time.Time `xml:"SessionNotOnOrAfter,attr"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AuthnStatement"`
+	AttributeStatements []struct {
+		Attributes []struct {
+			Name   string   `xml:"Name,attr"`
+			Values []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeValue"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Attribute"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeStatement"`
+}
+
+// ParseResponse validates the response posted to the assertion consumer service and returns its assertion.
+// The request cookie is cleared, so that every AuthnRequest completes only once. It returns ErrInvalidRequest if
+// the response does not belong to a login started by Begin in the same browser, unless IdP-initiated logins are
+// allowed, and a *StatusError if the identity provider reported an error.
+func (sp *ServiceProvider) ParseResponse(w http.ResponseWriter, req *http.Request) (*Assertion, error) {
+	if req.Method != http.MethodPost {
+		return nil, ErrInvalidResponse
+	}
+	req.Body = http.MaxBytesReader(w, req.Body, maxResponseSize)
+	if err := req.ParseForm(); err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	var requestId string
+	if cookie, err := req.Cookie(sp.Config.Cookie.Name); err == nil {
+		http.SetCookie(w, sp.cookie("", time.Unix(0, 0)))
+		state, err := decodeState(sp.Config.Secret, cookie.Value, sp.Config.Clock.Now())
+		if err != nil {
+			return nil, err
+		}
+		if state.Provider != sp.Config.Name || subtle.ConstantTimeCompare([]byte(state.RelayState), []byte(req.PostForm.Get("RelayState"))) != 1 {
+			return nil, ErrInvalidRequest
+		}
+		requestId = state.ID
+	} else if !sp.Config.AllowIdPInitiated {
+		return nil, ErrInvalidRequest
+	}
+	return sp.ValidateResponse(req.PostForm.Get("SAMLResponse"), requestId)
+}
+
+// ValidateResponse validates an encoded response, the SAMLResponse parameter of the HTTP-POST binding, and returns
+// its assertion. The requestId is the id of the AuthnRequest the response answers, it is empty for IdP-initiated
+// logins. Either the response or the assertion must be signed by the identity provider. Only signed elements
+// are read, so that unsigned elements can not be wrapped around the signed ones.
+func (sp *ServiceProvider) ValidateResponse(encoded, requestId string) (*Assertion, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, ErrInvalidResponse
+	}
+	root := doc.Root()
+	if root == nil || root.Tag != "Response" || root.NamespaceURI() != ProtocolNamespace {
+		return nil, ErrInvalidResponse
+	}
+
+	// The status is checked before the signature, as identity providers may not sign error responses.
+	var response xmlResponse
+	if err := unmarshalElement(root, &response); err != nil {
+		return nil, ErrInvalidResponse
+	}
+	if status := response.Status.StatusCode; status.Value != StatusSuccess {
+		statusErr := &StatusError{Code: status.Value, Message: response.Status.StatusMessage}
+		if status.StatusCode != nil {
+			statusErr.SubCode = status.StatusCode.Value
+		}
+		return nil, statusErr
+	}
+
+	responseSigned := hasSignature(root)
+	if responseSigned {
+		if root, err = sp.validateSignature(root); err != nil {
+			return nil, err
+		}
+		response = xmlResponse{}
+		if err := unmarshalElement(root, &response); err != nil {
+			return nil, ErrInvalidResponse
+		}
+	}
+	if err := sp.validateResponse(&response, requestId); err != nil {
+		return nil, err
+	}
+
+	var assertions []*etree.Element
+	for _, child := range root.ChildElements() {
+		if child.NamespaceURI() != AssertionNamespace {
+			continue
+		}
+		switch child.Tag {
+		case "EncryptedAssertion":
+			return nil, ErrEncryptedAssertion
+		case "Assertion":
+			assertions = append(assertions, child)
+		}
+	}
+	if len(assertions) != 1 {
+		return nil, fmt.Errorf("%w: expected one assertion", ErrInvalidResponse)
+	}
+	assertionEl := assertions[0]
+	if !responseSigned || sp.Config.WantAssertionsSigned || hasSignature(assertionEl) {
+		ctx, err := etreeutils.NSBuildParentContext(assertionEl)
+		if err != nil {
+			return nil, ErrInvalidResponse
+		}
+		// The assertion is detached with the namespaces declared by the response, which its signature covers.
+		if assertionEl, err = etreeutils.NSDetatch(ctx, assertionEl); err != nil {
+			return nil, ErrInvalidResponse
+		}
+		if assertionEl, err = sp.validateSignature(assertionEl); err != nil {
+			return nil, err
+		}
+	}
+
+	var assertion xmlAssertion
+	if err := unmarshalElement(assertionEl, &assertion); err != nil {
+		return nil, ErrInvalidResponse
+	}
+	return sp.validateAssertion(&assertion, requestId)
+}
+
+// hasSignature reports whether the element has an enveloped signature.
+func hasSignature(el *etree.Element) bool {
+	for _, child := range el.ChildElements() {
+		if child.Tag == dsig.SignatureTag && child.NamespaceURI() == dsig.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSignature verifies the enveloped signature of the element with the certificates of the identity
+// provider and returns the signed content.
+func (sp *ServiceProvider) validateSignature(el *etree.Element) (*etree.Element, error) {
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{
+		Roots: sp.Config.IdentityProvider.Certificates,
+	})
+	// The validity of the certificates is checked at the time of the service provider.
+	ctx.Clock = dsig.NewFakeClockAt(sp.Config.Clock.Now())
+	signed, err := ctx.Validate(el)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	return signed, nil
+}
+
+// unmarshalElement unmarshals the element in the context of the namespaces declared by its ancestors.
+func unmarshalElement(el *etree.Element, v any) error {
+	ctx, err := etreeutils.NSBuildParentContext(el)
+	if err != nil {
+		return err
+	}
+	return etreeutils.NSUnmarshalElement(ctx, el, v)
+}
+
+// validateResponse checks that the response was issued by the identity provider for the request.
+func (sp *ServiceProvider) validateResponse(response *xmlResponse, requestId string) error {
+	switch {
+	case response.Version != "2.0":
+		return fmt.Errorf("%w: unsupported version", ErrInvalidResponse)
+	case response.Destination != "" && response.Destination != sp.Config.ACSURL:
+		return fmt.Errorf("%w: unexpected destination", ErrInvalidResponse)
+	case response.Issuer != "" && response.Issuer != sp.Config.IdentityProvider.EntityID:
+		return fmt.Errorf("%w: unexpected issuer", ErrInvalidResponse)
+	case response.InResponseTo != requestId:
+		return ErrInvalidRequest
+	case requestId == "" && !sp.Config.AllowIdPInitiated:
+		return ErrInvalidRequest
+	}
+	return nil
+}
+
+// validateAssertion checks the subject and the conditions of an assertion and records it in the replay cache.
+func (sp *ServiceProvider) validateAssertion(assertion *xmlAssertion, requestId string) (*Assertion, error) {
+	now := sp.Config.Clock.Now()
+	skew := sp.Config.ClockSkew
+
+	switch {
+	case assertion.Version != "2.0" || assertion.ID == "":
+		return nil, ErrInvalidResponse
+	case assertion.Issuer != sp.Config.IdentityProvider.EntityID:
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidResponse)
+	case strings.TrimSpace(assertion.Subject.NameID.Value) == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidResponse)
+	case len(assertion.AuthnStatements) == 0:
+		return nil, fmt.Errorf("%w: missing authentication statement", ErrInvalidResponse)
+	}
+
+	// A bearer confirmation binds the assertion to the assertion consumer service and the request.
+	var expiresAt time.Time
+	for _, confirmation := range assertion.Subject.SubjectConfirmations {
+		data := confirmation.Data
+		if confirmation.Method == bearerMethod && data.Recipient == sp.Config.ACSURL && data.InResponseTo == requestId &&
+			!data.NotOnOrAfter.IsZero() && now.Before(data.NotOnOrAfter.Add(skew)) &&
+			(data.NotBefore.IsZero() || !now.Add(skew).Before(data.NotBefore)) {
+			expiresAt = data.NotOnOrAfter
+			break
+		}
+	}
+	if expiresAt.IsZero() {
+		return nil, fmt.Errorf("%w: no valid subject confirmation", ErrInvalidResponse)
+	}
+
+	conditions := assertion.Conditions
+	if conditions == nil || len(conditions.AudienceRestrictions) == 0 {
+		return nil, fmt.Errorf("%w: missing audience", ErrInvalidResponse)
+	}
+	for _, restriction := range conditions.AudienceRestrictions {
+		if !slices.Contains(restriction.Audiences, sp.Config.EntityID) {
+			return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidResponse)
+		}
+	}
+	if !conditions.NotBefore.IsZero() && now.Add(skew).Before(conditions.NotBefore) {
+		return nil, fmt.Errorf("%w: not yet valid", ErrInvalidResponse)
+	}
+	if !conditions.NotOnOrAfter.IsZero() {
+		if !now.Before(conditions.NotOnOrAfter.Add(skew)) {
+			return nil, fmt.Errorf("%w: expired", ErrInvalidResponse)
+		}
+		if conditions.NotOnOrAfter.After(expiresAt) {
+			expiresAt = conditions.NotOnOrAfter
+		}
+	}
+
+	authn := assertion.AuthnStatements[0]
+	if !authn.SessionNotOnOrAfter.IsZero() && !now.Before(authn.SessionNotOnOrAfter) {
+		return nil, fmt.Errorf("%w: session expired", ErrInvalidResponse)
+	}
+
+	fresh, err := sp.Config.ReplayCache.Use(assertion.Issuer+"|"+assertion.ID, expiresAt.Add(skew))
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, ErrAssertionReplayed
+	}
+
+	result := &Assertion{
+		ID:                  assertion.ID,
+		Issuer:              assertion.Issuer,
+		NameID:              strings.TrimSpace(assertion.Subject.NameID.Value),
+		NameIDFormat:        assertion.Subject.NameID.Format,
+		SessionIndex:        authn.SessionIndex,
+		AuthnInstant:        authn.AuthnInstant,
+		SessionNotOnOrAfter: authn.SessionNotOnOrAfter,
+		Attributes:          map[string][]string{},
+	}
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			result.Attributes[attribute.Name] = append(result.Attributes[attribute.Name], attribute.Values...)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,417 @@
+package saml_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/gaurishhs/keezle/keezletest"
+	"github.com/gaurishhs/keezle/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+var epoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+const (
+	spEntityID  = "https://sp.example.com/metadata"
+	acsURL      = "https://sp.example.com/acs"
+	idpEntityID = "https://idp.example.com"
+)
+
+// identityProvider signs responses with a self-signed certificate, which is valid for a day from epoch.
+type identityProvider struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newIdentityProvider(t *testing.T) *identityProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    epoch.Add(-time.Hour),
+		NotAfter:     epoch.Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &identityProvider{key: key, cert: cert}
+}
+
+func newServiceProvider(idp *identityProvider, clock *keezletest.FakeClock, configure func(config *saml.Config)) *saml.ServiceProvider {
+	config := saml.Config{
+		EntityID: spEntityID,
+		ACSURL:   acsURL,
+		IdentityProvider: saml.IdentityProvider{
+			EntityID:     idpEntityID,
+			SSOURL:       "https://idp.example.com/sso",
+			Certificates: []*x509.Certificate{idp.cert},
+		},
+		Clock:  clock,
+		Secret: []byte("0123456789abcdef0123456789abcdef"),
+	}
+	if configure != nil {
+		configure(&config)
+	}
+	return saml.NewServiceProvider(config)
+}
+
+// response describes a canned response, issued at epoch.
+type response struct {
+	assertionID   string
+	inResponseTo  string
+	audience      string
+	recipient     string
+	status        string
+	signResponse  bool
+	signAssertion bool
+	// tamper modifies the response after it was signed.
+	tamper func(root *etree.Element)
+}
+
+// assertionIDs makes the ids of canned assertions unique, so that they are not rejected as replays.
+var assertionIDs int
+
+func validResponse(requestId string) response {
+	assertionIDs++
+	return response{
+		assertionID:   fmt.Sprintf("_assertion%d", assertionIDs),
+		inResponseTo:  requestId,
+		audience:      spEntityID,
+		recipient:     acsURL,
+		status:        saml.StatusSuccess,
+		signAssertion: true,
+	}
+}
+
+// encode builds the response, signs it with the key of the identity provider and encodes it for the HTTP-POST
+// binding. The subject confirmation and the conditions are valid for 5 minutes.
+func (idp *identityProvider) encode(t *testing.T, r response) string {
+	t.Helper()
+	instant := epoch.Format(time.RFC3339)
+	expires := epoch.Add(5 * time.Minute).Format(time.RFC3339)
+
+	root := etree.NewElement("samlp:Response")
+	root.CreateAttr("xmlns:samlp", saml.ProtocolNamespace)
+	root.CreateAttr("xmlns:saml", saml.AssertionNamespace)
+	root.CreateAttr("ID", "_response"+r.assertionID)
+	root.CreateAttr("Version", "2.0")
+	root.CreateAttr("IssueInstant", instant)
+	root.CreateAttr("Destination", acsURL)
+	if r.inResponseTo != "" {
+		root.CreateAttr("InResponseTo", r.inResponseTo)
+	}
+	root.CreateElement("saml:Issuer").SetText(idpEntityID)
+	status := root.CreateElement("samlp:Status").CreateElement("samlp:StatusCode")
+	status.CreateAttr("Value", r.status)
+	if r.status != saml.StatusSuccess {
+		status.CreateElement("samlp:StatusCode").CreateAttr("Value", "urn:oasis:names:tc:SAML:2.0:status:AuthnFailed")
+	}
+
+	assertion := etree.NewElement("saml:Assertion")
+	assertion.CreateAttr("xmlns:saml", saml.AssertionNamespace)
+	assertion.CreateAttr("ID", r.assertionID)
+	assertion.CreateAttr("Version", "2.0")
+	assertion.CreateAttr("IssueInstant", instant)
+	assertion.CreateElement("saml:Issuer").SetText(idpEntityID)
+	subject := assertion.CreateElement("saml:Subject")
+	nameID := subject.CreateElement("saml:NameID")
+	nameID.CreateAttr("Format", saml.NameIDFormatPersistent)
+	nameID.SetText("u1")
+	confirmation := subject.CreateElement("saml:SubjectConfirmation")
+	confirmation.CreateAttr("Method", "urn:oasis:names:tc:SAML:2.0:cm:bearer")
+	data := confirmation.CreateElement("saml:SubjectConfirmationData")
+	if r.inResponseTo != "" {
+		data.CreateAttr("InResponseTo", r.inResponseTo)
+	}
+	data.CreateAttr("NotOnOrAfter", expires)
+	data.CreateAttr("Recipient", r.recipient)
+	conditions := assertion.CreateElement("saml:Conditions")
+	conditions.CreateAttr("NotBefore", epoch.Add(-time.Minute).Format(time.RFC3339))
+	conditions.CreateAttr("NotOnOrAfter", expires)
+	conditions.CreateElement("saml:AudienceRestriction").CreateElement("saml:Audience").SetText(r.audience)
+	authn := assertion.CreateElement("saml:AuthnStatement")
+	authn.CreateAttr("AuthnInstant", instant)
+	authn.CreateAttr("SessionIndex", "index")
+	attribute := assertion.CreateElement("saml:AttributeStatement").CreateElement("saml:Attribute")
+	attribute.CreateAttr("Name", "groups")
+	attribute.CreateElement("saml:AttributeValue").SetText("admins")
+	attribute.CreateElement("saml:AttributeValue").SetText("developers")
+
+	ctx, err := dsig.NewSigningContext(idp.key, [][]byte{idp.cert.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	if r.signAssertion {
+		if assertion, err = ctx.SignEnveloped(assertion); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root.AddChild(assertion)
+	if r.signResponse {
+		if root, err = ctx.SignEnveloped(root); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r.tamper != nil {
+		r.tamper(root)
+	}
+	b, err := etree.NewDocumentWithRoot(root).WriteToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func TestValidateResponse(t *testing.T) {
+	idp := newIdentityProvider(t)
+	other := newIdentityProvider(t)
+	clock := keezletest.NewFakeClock(epoch)
+	sp := newServiceProvider(idp, clock, nil)
+	strict := newServiceProvider(idp, clock, func(config *saml.Config) { config.WantAssertionsSigned = true })
+
+	tests := []struct {
+		name     string
+		sp       *saml.ServiceProvider
+		idp      *identityProvider
+		response func(r *response)
+		elapsed  time.Duration
+		err      error
+	}{
+		{"signed assertion", sp, idp, nil, 0, nil},
+		{"signed response", sp, idp, func(r *response) { r.signAssertion, r.signResponse = false, true }, 0, nil},
+		{"signed response and assertion", sp, idp, func(r *response) { r.signResponse = true }, 0, nil},
+		{"unsigned", sp, idp, func(r *response) { r.signAssertion = false }, 0, saml.ErrInvalidSignature},
+		{"other key", sp, other, nil, 0, saml.ErrInvalidSignature},
+		{"unsigned assertion required", strict, idp, func(r *response) { r.signAssertion, r.signResponse = false, true }, 0, saml.ErrInvalidSignature},
+		{"tampered assertion", sp, idp, func(r *response) {
+			r.tamper = func(root *etree.Element) { root.FindElement(".//NameID").SetText("admin") }
+		}, 0, saml.ErrInvalidSignature},
+		{"tampered response", sp, idp, func(r *response) {
+			r.signAssertion, r.signResponse = false, true
+			r.tamper = func(root *etree.Element) { root.FindElement(".//NameID").SetText("admin") }
+		}, 0, saml.ErrInvalidSignature},
+		{"wrapped unsigned assertion", sp, idp, func(r *response) {
+			r.tamper = func(root *etree.Element) {
+				evil := root.FindElement("./Assertion").Copy()
+				evil.RemoveChild(evil.FindElement("./Signature"))
+				evil.FindElement(".//NameID").SetText("admin")
+				evil.CreateAttr("ID", "_evil")
+				root.InsertChildAt(2, evil)
+			}
+		}, 0, saml.ErrInvalidResponse},
+		{"wrapped signed response", sp, idp, func(r *response) {
+			r.signAssertion, r.signResponse = false, true
+			r.tamper = func(root *etree.Element) {
+				signed := root.FindElement("./Assertion")
+				evil := signed.Copy()
+				evil.FindElement(".//NameID").SetText("admin")
+				root.RemoveChild(signed)
+				root.CreateElement("samlp:Extensions").AddChild(signed)
+				root.AddChild(evil)
+			}
+		}, 0, saml.ErrInvalidSignature},
+		{"audience mismatch", sp, idp, func(r *response) { r.audience = "https://other.example.com/metadata" }, 0, saml.ErrInvalidResponse},
+		{"recipient mismatch", sp, idp, func(r *response) { r.recipient = "https://other.example.com/acs" }, 0, saml.ErrInvalidResponse},
+		{"in response to another request", sp, idp, func(r *response) { r.inResponseTo = "_other" }, 0, saml.ErrInvalidRequest},
+		{"unsolicited", sp, idp, func(r *response) { r.inResponseTo = "" }, 0, saml.ErrInvalidRequest},
+		{"confirmation of another request", sp, idp, func(r *response) {
+			r.inResponseTo = "_other"
+			r.tamper = func(root *etree.Element) { root.CreateAttr("InResponseTo", "_request") }
+		}, 0, saml.ErrInvalidResponse},
+		{"expired within clock skew", sp, idp, nil, 8*time.Minute - time.Second, nil},
+		{"expired", sp, idp, nil, 8 * time.Minute, saml.ErrInvalidResponse},
+		{"not yet valid", sp, idp, nil, -5 * time.Minute, saml.ErrInvalidResponse},
+		{"expired certificate", sp, idp, nil, 25 * time.Hour, saml.ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Set(epoch)
+			r := validResponse("_request")
+			if tt.response != nil {
+				tt.response(&r)
+			}
+			encoded := tt.idp.encode(t, r)
+			clock.Advance(tt.elapsed)
+			assertion, err := tt.sp.ValidateResponse(encoded, "_request")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("validation returned %v, want %v", err, tt.err)
+			}
+			if err == nil && (assertion.NameID != "u1" || assertion.SessionIndex != "index" || len(assertion.Attributes["groups"]) != 2) {
+				t.Errorf("assertion = %+v", assertion)
+			}
+		})
+	}
+}
+
+func TestValidateResponseStatus(t *testing.T) {
+	idp := newIdentityProvider(t)
+	sp := newServiceProvider(idp, keezletest.NewFakeClock(epoch), nil)
+
+	r := validResponse("_request")
+	r.status, r.signAssertion = "urn:oasis:names:tc:SAML:2.0:status:Responder", false
+	_, err := sp.ValidateResponse(idp.encode(t, r), "_request")
+	var statusErr *saml.StatusError
+	if !errors.As(err, &statusErr) || statusErr.SubCode != "urn:oasis:names:tc:SAML:2.0:status:AuthnFailed" {
+		t.Errorf("validation returned %v, want a status error", err)
+	}
+}
+
+func TestValidateResponseReplay(t *testing.T) {
+	idp := newIdentityProvider(t)
+	clock := keezletest.NewFakeClock(epoch)
+	sp := newServiceProvider(idp, clock, nil)
+
+	encoded := idp.encode(t, validResponse("_request"))
+	if _, err := sp.ValidateResponse(encoded, "_request"); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	if _, err := sp.ValidateResponse(encoded, "_request"); !errors.Is(err, saml.ErrAssertionReplayed) {
+		t.Errorf("replay returned %v, want ErrAssertionReplayed", err)
+	}
+	// The assertion expires before the cache forgets it.
+	clock.Advance(7 * time.Minute)
+	if _, err := sp.ValidateResponse(encoded, "_request"); !errors.Is(err, saml.ErrInvalidResponse) {
+		t.Errorf("replay of an expired assertion returned %v, want ErrInvalidResponse", err)
+	}
+}
+
+func TestMemoryReplayCache(t *testing.T) {
+	clock := keezletest.NewFakeClock(epoch)
+	cache := saml.NewMemoryReplayCache()
+	cache.Clock = clock
+	use := func(id string, want bool) {
+		t.Helper()
+		if fresh, err := cache.Use(id, epoch.Add(time.Hour)); err != nil || fresh != want {
+			t.Errorf("Use(%q) = %v, %v, want %v", id, fresh, err, want)
+		}
+	}
+
+	use("a", true)
+	use("a", false)
+	use("b", true)
+	clock.Advance(time.Hour)
+	use("a", false)
+	clock.Advance(time.Second)
+	use("a", true)
+}
+
+// post posts the response to the assertion consumer service with the cookies.
+func post(sp *saml.ServiceProvider, encoded, relayState string, cookies ...*http.Cookie) (*saml.Assertion, *httptest.ResponseRecorder, error) {
+	form := url.Values{"SAMLResponse": {encoded}, "RelayState": {relayState}}
+	req := httptest.NewRequest(http.MethodPost, "/acs", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	assertion, err := sp.ParseResponse(rec, req)
+	return assertion, rec, err
+}
+
+func TestParseResponse(t *testing.T) {
+	idp := newIdentityProvider(t)
+	clock := keezletest.NewFakeClock(epoch)
+	sp := newServiceProvider(idp, clock, nil)
+	other := newServiceProvider(idp, clock, func(config *saml.Config) {
+		config.Name = "other"
+		config.Cookie.Name = "saml_saml"
+	})
+
+	tests := []struct {
+		name       string
+		sp         *saml.ServiceProvider
+		relayState func(relayState string) string
+		cookie     func(cookie *http.Cookie) *http.Cookie
+		elapsed    time.Duration
+		err        error
+	}{
+		{"valid", sp, nil, nil, 0, nil},
+		{"relay state mismatch", sp, func(string) string { return "other" }, nil, 0, saml.ErrInvalidRequest},
+		{"missing cookie", sp, nil, func(*http.Cookie) *http.Cookie { return nil }, 0, saml.ErrInvalidRequest},
+		{"tampered cookie", sp, nil, func(cookie *http.Cookie) *http.Cookie {
+			payload, signature, _ := strings.Cut(cookie.Value, ".")
+			cookie.Value = payload + "." + strings.Repeat("A", len(signature))
+			return cookie
+		}, 0, saml.ErrInvalidRequest},
+		{"provider mismatch", other, nil, nil, 0, saml.ErrInvalidRequest},
+		{"expired cookie", sp, nil, nil, 10 * time.Minute, saml.ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Set(epoch)
+			rec := httptest.NewRecorder()
+			req, err := sp.Begin(rec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cookie := rec.Result().Cookies()[0]
+			relayState := req.RelayState
+			if tt.relayState != nil {
+				relayState = tt.relayState(relayState)
+			}
+			var cookies []*http.Cookie
+			if tt.cookie != nil {
+				cookie = tt.cookie(cookie)
+			}
+			if cookie != nil {
+				cookies = append(cookies, cookie)
+			}
+
+			encoded := idp.encode(t, validResponse(req.ID))
+			clock.Advance(tt.elapsed)
+			assertion, rec, err := post(tt.sp, encoded, relayState, cookies...)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ParseResponse returned %v, want %v", err, tt.err)
+			}
+			if err == nil && assertion.NameID != "u1" {
+				t.Errorf("assertion = %+v", assertion)
+			}
+			if cookie != nil {
+				if cleared := rec.Result().Cookies(); len(cleared) != 1 || cleared[0].MaxAge >= 0 {
+					t.Errorf("request cookie was not cleared: %v", cleared)
+				}
+			}
+		})
+	}
+}
+
+func TestParseResponseIdPInitiated(t *testing.T) {
+	idp := newIdentityProvider(t)
+	clock := keezletest.NewFakeClock(epoch)
+	open := newServiceProvider(idp, clock, func(config *saml.Config) { config.AllowIdPInitiated = true })
+
+	encoded := idp.encode(t, validResponse(""))
+	if _, _, err := post(newServiceProvider(idp, clock, nil), encoded, ""); !errors.Is(err, saml.ErrInvalidRequest) {
+		t.Errorf("unsolicited response returned %v, want ErrInvalidRequest", err)
+	}
+	if assertion, _, err := post(open, encoded, ""); err != nil || assertion.NameID != "u1" {
+		t.Fatalf("unsolicited response returned %v, %v", assertion, err)
+	}
+	if _, _, err := post(open, encoded, ""); !errors.Is(err, saml.ErrAssertionReplayed) {
+		t.Errorf("replayed unsolicited response returned %v, want ErrAssertionReplayed", err)
+	}
+}
@@ -0,0 +1,113 @@
+// Package saml implements a SAML 2.0 service provider, so that the users of enterprise customers can sign in
+// with the identity provider of their organization. A ServiceProvider publishes its metadata, sends
+// AuthnRequests with the HTTP-Redirect or HTTP-POST binding and validates the signed responses posted back to
+// the assertion consumer service. The id of the request is kept in a signed short-lived cookie, so that a
+// response is only accepted in the browser that started the login. A SignIn maps the NameID of an assertion
+// to a key and creates the session.
+// Encrypted assertions are not supported.
+package saml
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrMissingSecret = errors.New("saml: request secret is required")
+	// ErrInvalidRequest is returned when a response does not belong to a login started by the browser, or the
+	// login has expired.
+	ErrInvalidRequest = errors.New("saml: response does not belong to a pending request")
+	// ErrInvalidResponse is returned when a response is malformed or does not satisfy the conditions of its
+	// assertion, e.g. because it was issued for another service provider or has expired.
+	ErrInvalidResponse = errors.New("saml: invalid response")
+	// ErrInvalidSignature is returned when neither the response nor the assertion carries a valid signature of
+	// the identity provider.
+	ErrInvalidSignature = errors.New("saml: invalid signature")
+	// ErrEncryptedAssertion is returned for responses with an encrypted assertion, which are not supported.
+	ErrEncryptedAssertion = errors.New("saml: encrypted assertions are not supported")
+	// ErrAssertionReplayed is returned when an assertion has already been used.
+	ErrAssertionReplayed = errors.New("saml: assertion has already been used")
+	ErrInvalidMetadata   = errors.New("saml: invalid metadata")
+)
+
+// Namespaces of SAML 2.0.
+const (
+	AssertionNamespace = "urn:oasis:names:tc:SAML:2.0:assertion"
+	ProtocolNamespace  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	MetadataNamespace  = "urn:oasis:names:tc:SAML:2.0:metadata"
+)
+
+// Bindings AuthnRequests are sent and responses are received with.
+const (
+	HTTPRedirectBinding = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	HTTPPostBinding     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+)
+
+// Formats of NameIDs.
+const (
+	NameIDFormatUnspecified  = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+	NameIDFormatEmailAddress = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormatPersistent   = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	NameIDFormatTransient    = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+)
+
+// StatusSuccess is the status code of successful responses.
+const StatusSuccess = "urn:oasis:names:tc:SAML:2.0:status:Success"
+
+// StatusError is returned when the identity provider responded with a status other than success, e.g. because
+// the user could not be authenticated.
+type StatusError struct {
+	Code string
+	// SubCode is the second-level status code, e.g. "urn:oasis:names:tc:SAML:2.0:status:AuthnFailed".
+	SubCode string
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	code := e.Code
+	if e.SubCode != "" {
+		code += " " + e.SubCode
+	}
+	if e.Message != "" {
+		return fmt.Sprintf("saml: %s: %s", code, e.Message)
+	}
+	return "saml: " + code
+}
+
+// IdentityProvider is the identity provider users sign in with.
+type IdentityProvider struct {
+	EntityID string
+	// SSOURL is the URL of the single sign-on service AuthnRequests are sent to.
+	SSOURL string
+	// SSOBinding is the binding of the single sign-on service, defaults to HTTPRedirectBinding.
+	SSOBinding string
+	// Certificates are the certificates responses and assertions may be signed with. During a key rollover the
+	// identity provider publishes both the old and the new certificate.
+	Certificates []*x509.Certificate
+}
+
+// Assertion is a validated assertion about the user who signed in.
+type Assertion struct {
+	ID string
+	// Issuer is the entity id of the identity provider.
+	Issuer       string
+	NameID       string
+	NameIDFormat string
+	// SessionIndex identifies the session of the user at the identity provider.
+	SessionIndex string
+	AuthnInstant time.Time
+	// SessionNotOnOrAfter is the time the identity provider wants the session to end, it is zero if unset.
+	SessionNotOnOrAfter time.Time
+	// Attributes are the values of the attributes of the user by attribute name.
+	Attributes map[string][]string
+}
+
+// Attribute returns the first value of an attribute, or an empty string.
+func (a *Assertion) Attribute(name string) string {
+	if values := a.Attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,163 @@
+package saml
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/models"
+)
+
+var (
+	// ErrAccountConflict is returned when the identity provider user is already linked to another user.
+	ErrAccountConflict = errors.New("saml: identity provider user is linked to another user")
+	// ErrTransientNameID is returned when a transient NameID would be mapped to a key, as it changes with
+	// every login.
+	ErrTransientNameID = errors.New("saml: transient name id can not identify a user")
+)
+
+// SignInConfig defines the configuration of a SignIn.
+type SignInConfig[UA models.AnyStruct] struct {
+	// ProviderUserID returns the id identifying the user at the identity provider, which is the provider user id
+	// of the key. It defaults to the NameID, which should have a persistent format. Identity providers without
+	// persistent NameIDs usually send a stable attribute, e.g. an object id.
+	ProviderUserID func(assertion *Assertion) (string, error)
+	// FindUser returns the id of an existing user an identity provider user without a key is linked to on the
+	// first sign-in, or an empty string to create a user. Only link users the identity provider is trusted for,
+	// e.g. users with an email address of a domain verified by the customer. Defaults to never linking.
+	FindUser func(assertion *Assertion) (string, error)
+	// UserAttributes returns the attributes of a user created for an identity provider user.
+	UserAttributes func(assertion *Assertion) (*UA, error)
+}
+
+// SignIn signs users in with assertions of a service provider, keeping the link between an identity provider
+// user and a keezle user in a key of the service provider. Keys of service providers have no password.
+type SignIn[UA, SA models.AnyStruct] struct {
+	Keezle          *keezle.Keezle[UA, SA]
+	ServiceProvider *ServiceProvider
+	Config          SignInConfig[UA]
+}
+
+// NewSignIn creates a SignIn for the Keezle instance and the service provider.
+func NewSignIn[UA, SA models.AnyStruct](k *keezle.Keezle[UA, SA], sp *ServiceProvider, config SignInConfig[UA]) *SignIn[UA, SA] {
+	s := &SignIn[UA, SA]{Keezle: k, ServiceProvider: sp, Config: config}
+	if s.Config.ProviderUserID == nil {
+		s.Config.ProviderUserID = nameID
+	}
+	return s
+}
+
+func nameID(assertion *Assertion) (string, error) {
+	if assertion.NameIDFormat == NameIDFormatTransient {
+		return "", ErrTransientNameID
+	}
+	return assertion.NameID, nil
+}
+
+// SignInOptions defines the options of a sign-in.
+type SignInOptions[SA models.AnyStruct] struct {
+	// LinkUserID is the id of the signed in user, which the identity provider user is linked to.
+	// No session is created in that case, the user keeps their current session.
+	LinkUserID string
+	// Attributes, RememberMe and Client are the options of the created session.
+	Attributes SA
+	RememberMe bool
+	Client     keezle.ClientInfo
+}
+
+// SignInResult is the result of a sign-in.
+type SignInResult[UA, SA models.AnyStruct] struct {
+	// Session is the created session, it is nil if the account was linked to the signed in user.
+	Session *models.Session[UA, SA]
+	UserID  string
+	// Created is set if a new user was created for the identity provider user.
+	Created bool
+	// Linked is set if the identity provider user was linked to an existing user.
+	Linked bool
+}
+
+// SignInWithAssertion signs in the user of an assertion, as returned by ServiceProvider.ParseResponse.
+// Identity provider users with a key sign in to the user of the key. Otherwise they are linked to the signed in
+// user of LinkUserID or the user returned by FindUser, or a new user is created. A session is created unless
+// the identity provider user was linked to the signed in user.
+func (s *SignIn[UA, SA]) SignInWithAssertion(assertion *Assertion, opts SignInOptions[SA]) (*SignInResult[UA, SA], error) {
+	provider := s.ServiceProvider.Config.Name
+	providerUserId, err := s.Config.ProviderUserID(assertion)
+	if err != nil {
+		return nil, err
+	}
+	result := &SignInResult[UA, SA]{}
+
+	_, err = s.Keezle.GetKey(provider, providerUserId)
+	switch {
+	case err == nil:
+		// Using the key reports the sign-in to event subscribers.
+		key, err := s.Keezle.UseKey(provider, providerUserId, "")
+		if err != nil {
+			return nil, err
+		}
+		if opts.LinkUserID != "" && key.UserID != opts.LinkUserID {
+			return nil, ErrAccountConflict
+		}
+		result.UserID = key.UserID
+	case errors.Is(err, sql.ErrNoRows):
+		result.UserID = opts.LinkUserID
+		if result.UserID == "" && s.Config.FindUser != nil {
+			if result.UserID, err = s.Config.FindUser(assertion); err != nil {
+				return nil, err
+			}
+		}
+		if result.UserID == "" {
+			if result.UserID, err = s.createUser(provider, providerUserId, assertion); err != nil {
+				return nil, err
+			}
+			result.Created = true
+		} else {
+			_, err := s.Keezle.CreateKey(keezle.CreateKeyOptions{
+				UserID:         result.UserID,
+				Provider:       provider,
+				ProviderUserID: providerUserId,
+			})
+			if err != nil {
+				return nil, err
+			}
+			result.Linked = true
+		}
+	default:
+		return nil, err
+	}
+
+	if opts.LinkUserID != "" {
+		return result, nil
+	}
+	result.Session, err = s.Keezle.CreateSession(keezle.CreateSessionOptions[SA]{
+		UserId:     result.UserID,
+		Attributes: opts.Attributes,
+		RememberMe: opts.RememberMe,
+		Client:     opts.Client,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// createUser creates a user with a key of the service provider.
+func (s *SignIn[UA, SA]) createUser(provider, providerUserId string, assertion *Assertion) (string, error) {
+	opts := keezle.CreateUserOptions[UA]{}
+	opts.Key.Provider = provider
+	opts.Key.ProviderUserID = providerUserId
+	if s.Config.UserAttributes != nil {
+		attributes, err := s.Config.UserAttributes(assertion)
+		if err != nil {
+			return "", err
+		}
+		opts.Attributes = attributes
+	}
+
+	created, err := s.Keezle.CreateUser(opts)
+	if err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
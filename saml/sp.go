@@ -0,0 +1,320 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/gaurishhs/keezle"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// CookieConfig defines the cookie which keeps the id of a pending AuthnRequest.
+type CookieConfig struct {
+	// Name defaults to "saml_" followed by the name of the service provider.
+	Name   string
+	Domain string
+	// Path defaults to "/".
+	Path string
+	// Secure should be set in production. The response is posted to the assertion consumer service by a
+	// cross-site form, which browsers only send SameSite=None cookies with, and SameSite=None cookies must be
+	// secure.
+	Secure bool
+	// MaxAge is how long the user has to complete the login, defaults to 10 minutes.
+	MaxAge time.Duration
+}
+
+// Config defines the configuration of a ServiceProvider.
+type Config struct {
+	// Name is the name of the service provider, which is used as the key provider of its users. Defaults to
+	// "saml". Applications with an identity provider per customer use a name per customer, e.g. "saml:acme".
+	Name string
+	// EntityID identifies the service provider, it is usually the URL of the metadata.
+	EntityID string
+	// ACSURL is the URL of the assertion consumer service, which the identity provider posts responses to.
+	ACSURL           string
+	IdentityProvider IdentityProvider
+	// Key and Certificate sign AuthnRequests if set. The certificate is published in the metadata.
+	Key         crypto.Signer
+	Certificate *x509.Certificate
+	// NameIDFormat is the format of the NameID requested from the identity provider, e.g. NameIDFormatPersistent.
+	NameIDFormat string
+	// WantAssertionsSigned requires assertions to be signed themselves. Otherwise a signature of the response is
+	// sufficient.
+	WantAssertionsSigned bool
+	// AllowIdPInitiated accepts responses without an AuthnRequest, which the identity provider sends when the
+	// user starts the login from its portal. As these can not be bound to the browser, they are only protected
+	// by the replay cache.
+	AllowIdPInitiated bool
+	// ClockSkew is the tolerated difference between the clocks of the identity provider and the server,
+	// defaults to 3 minutes.
+	ClockSkew time.Duration
+	// Clock tells the current time, defaults to keezle.SystemClock.
+	Clock keezle.Clock
+	// ReplayCache defaults to a MemoryReplayCache using the Clock.
+	ReplayCache ReplayCache
+	// Secret signs the request cookie. It should be at least 32 random bytes.
+	Secret []byte
+	Cookie CookieConfig
+}
+
+// ServiceProvider is a SAML 2.0 service provider for an identity provider.
+type ServiceProvider struct {
+	Config Config
+}
+
+// NewServiceProvider creates a service provider.
+// It panics if the entity id, the assertion consumer service or the identity provider is missing.
+func NewServiceProvider(config Config) *ServiceProvider {
+	if len(config.Secret) == 0 {
+		panic(ErrMissingSecret)
+	}
+	if config.EntityID == "" || config.ACSURL == "" {
+		panic("service provider requires an entity id and an assertion consumer service URL")
+	}
+	idp := config.IdentityProvider
+	if idp.EntityID == "" || idp.SSOURL == "" || len(idp.Certificates) == 0 {
+		panic("service provider requires the entity id, single sign-on URL and certificates of the identity provider")
+	}
+	if config.Key != nil && config.Certificate == nil {
+		panic("service provider requires the certificate of its key")
+	}
+	if config.Name == "" {
+		config.Name = "saml"
+	}
+	if config.IdentityProvider.SSOBinding == "" {
+		config.IdentityProvider.SSOBinding = HTTPRedirectBinding
+	}
+	if config.ClockSkew == 0 {
+		config.ClockSkew = time.Minute * 3
+	}
+	if config.Clock == nil {
+		config.Clock = keezle.SystemClock
+	}
+	if config.ReplayCache == nil {
+		cache := NewMemoryReplayCache()
+		cache.Clock = config.Clock
+		config.ReplayCache = cache
+	}
+	if config.Cookie.Name == "" {
+		config.Cookie.Name = "saml_" + config.Name
+	}
+	if config.Cookie.Path == "" {
+		config.Cookie.Path = "/"
+	}
+	if config.Cookie.MaxAge == 0 {
+		config.Cookie.MaxAge = time.Minute * 10
+	}
+	return &ServiceProvider{Config: config}
+}
+
+func (sp *ServiceProvider) cookie(value string, expires time.Time) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     sp.Config.Cookie.Name,
+		Value:    value,
+		Domain:   sp.Config.Cookie.Domain,
+		Path:     sp.Config.Cookie.Path,
+		Secure:   sp.Config.Cookie.Secure,
+		HttpOnly: true,
+		Expires:  expires,
+	}
+	if sp.Config.Cookie.Secure {
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	if value == "" {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// AuthnRequest is a pending login, which is sent to the identity provider with RedirectURL or PostForm.
+type AuthnRequest struct {
+	ID           string
+	IssueInstant time.Time
+	// RelayState is returned by the identity provider with the response. It is bound to the request cookie.
+	RelayState string
+}
+
+// Begin starts a login. It sets the request cookie and returns the AuthnRequest which has to be sent to the
+// identity provider.
+func (sp *ServiceProvider) Begin(w http.ResponseWriter) (*AuthnRequest, error) {
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	relayState, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := sp.Config.Clock.Now()
+	expiresAt := now.Add(sp.Config.Cookie.MaxAge)
+	value, err := encodeState(sp.Config.Secret, &requestState{
+		Provider:   sp.Config.Name,
+		ID:         id,
+		RelayState: relayState,
+		ExpiresAt:  expiresAt.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	http.SetCookie(w, sp.cookie(value, expiresAt))
+	return &AuthnRequest{ID: id, IssueInstant: now, RelayState: relayState}, nil
+}
+
+// authnRequestElement returns the AuthnRequest as an XML element.
+func (sp *ServiceProvider) authnRequestElement(req *AuthnRequest) *etree.Element {
+	el := etree.NewElement("samlp:AuthnRequest")
+	el.CreateAttr("xmlns:samlp", ProtocolNamespace)
+	el.CreateAttr("xmlns:saml", AssertionNamespace)
+	el.CreateAttr("ID", req.ID)
+	el.CreateAttr("Version", "2.0")
+	el.CreateAttr("IssueInstant", req.IssueInstant.UTC().Format(time.RFC3339))
+	el.CreateAttr("Destination", sp.Config.IdentityProvider.SSOURL)
+	el.CreateAttr("AssertionConsumerServiceURL", sp.Config.ACSURL)
+	el.CreateAttr("ProtocolBinding", HTTPPostBinding)
+	el.CreateElement("saml:Issuer").SetText(sp.Config.EntityID)
+	policy := el.CreateElement("samlp:NameIDPolicy")
+	if sp.Config.NameIDFormat != "" {
+		policy.CreateAttr("Format", sp.Config.NameIDFormat)
+	}
+	policy.CreateAttr("AllowCreate", "true")
+	return el
+}
+
+// signingContext returns the context signing with the key of the service provider.
+func (sp *ServiceProvider) signingContext() (*dsig.SigningContext, error) {
+	ctx, err := dsig.NewSigningContext(sp.Config.Key, [][]byte{sp.Config.Certificate.Raw})
+	if err != nil {
+		return nil, err
+	}
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+	switch sp.Config.Key.Public().(type) {
+	case *rsa.PublicKey:
+		err = ctx.SetSignatureMethod(dsig.RSASHA256SignatureMethod)
+	case *ecdsa.PublicKey:
+		err = ctx.SetSignatureMethod(dsig.ECDSASHA256SignatureMethod)
+	}
+	return ctx, err
+}
+
+// RedirectURL returns the URL sending the AuthnRequest with the HTTP-Redirect binding. The request is signed
+// with the query string signature of the binding if the service provider has a key.
+func (sp *ServiceProvider) RedirectURL(req *AuthnRequest) (string, error) {
+	data, err := etree.NewDocumentWithRoot(sp.authnRequestElement(req)).WriteToBytes()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	writer.Write(data)
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+
+	// The signature is computed over the query string in this exact order.
+	query := "SAMLRequest=" + url.QueryEscape(base64.StdEncoding.EncodeToString(buf.Bytes())) +
+		"&RelayState=" + url.QueryEscape(req.RelayState)
+	if sp.Config.Key != nil {
+		ctx, err := sp.signingContext()
+		if err != nil {
+			return "", err
+		}
+		query += "&SigAlg=" + url.QueryEscape(ctx.GetSignatureMethodIdentifier())
+		signature, err := ctx.SignString(query)
+		if err != nil {
+			return "", err
+		}
+		query += "&Signature=" + url.QueryEscape(base64.StdEncoding.EncodeToString(signature))
+	}
+
+	separator := "?"
+	if strings.Contains(sp.Config.IdentityProvider.SSOURL, "?") {
+		separator = "&"
+	}
+	return sp.Config.IdentityProvider.SSOURL + separator + query, nil
+}
+
+var postFormTemplate = template.Must(template.New("post").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Signing in</title></head>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.URL}}">
+<input type="hidden" name="SAMLRequest" value="{{.SAMLRequest}}">
+<input type="hidden" name="RelayState" value="{{.RelayState}}">
+<noscript><button type="submit">Continue</button></noscript>
+</form>
+</body>
+</html>
+`))
+
+// PostForm returns the HTML page sending the AuthnRequest with the HTTP-POST binding. The request carries an
+// enveloped signature if the service provider has a key.
+func (sp *ServiceProvider) PostForm(req *AuthnRequest) ([]byte, error) {
+	el := sp.authnRequestElement(req)
+	if sp.Config.Key != nil {
+		ctx, err := sp.signingContext()
+		if err != nil {
+			return nil, err
+		}
+		signature, err := ctx.ConstructSignature(el, true)
+		if err != nil {
+			return nil, err
+		}
+		// The schema requires the signature to follow the issuer.
+		el.InsertChildAt(1, signature)
+	}
+	data, err := etree.NewDocumentWithRoot(el).WriteToBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = postFormTemplate.Execute(&buf, map[string]string{
+		"URL":         sp.Config.IdentityProvider.SSOURL,
+		"SAMLRequest": base64.StdEncoding.EncodeToString(data),
+		"RelayState":  req.RelayState,
+	})
+	return buf.Bytes(), err
+}
+
+// Redirect is a handler which starts a login and sends the user to the identity provider with its binding.
+func (sp *ServiceProvider) Redirect(w http.ResponseWriter, req *http.Request) {
+	authnReq, err := sp.Begin(w)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if sp.Config.IdentityProvider.SSOBinding == HTTPPostBinding {
+		page, err := sp.PostForm(authnReq)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(page)
+		return
+	}
+
+	redirectURL, err := sp.RedirectURL(authnReq)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, req, redirectURL, http.StatusFound)
+}
@@ -0,0 +1,77 @@
+package saml
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// requestState is the state of an AuthnRequest, kept in a cookie until the response is posted back.
+type requestState struct {
+	Provider   string `json:"p"`
+	ID         string `json:"i"`
+	RelayState string `json:"r"`
+	ExpiresAt  int64  `json:"e"`
+}
+
+func stateMAC(secret []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// encodeState encodes and signs the state.
+func encodeState(secret []byte, state *requestState) (string, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(stateMAC(secret, payload)), nil
+}
+
+// decodeState verifies the signature and expiration time of an encoded state.
+func decodeState(secret []byte, value string, now time.Time) (*requestState, error) {
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, ErrInvalidRequest
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, stateMAC(secret, payload)) {
+		return nil, ErrInvalidRequest
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidRequest
+	}
+	var state requestState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, ErrInvalidRequest
+	}
+	if now.Unix() >= state.ExpiresAt {
+		return nil, ErrInvalidRequest
+	}
+	return &state, nil
+}
+
+// randomID returns a random id for a SAML message. Ids are of type xsd:ID, which must not start with a digit.
+func randomID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -1,9 +1,14 @@
 package keezle
 
 import (
+	"database/sql"
+	"errors"
+	"maps"
 	"net/http"
+	"slices"
 	"time"
 
+	"github.com/gaurishhs/keezle/adapters"
 	"github.com/gaurishhs/keezle/models"
 	"github.com/gaurishhs/keezle/utils"
 )
@@ -13,10 +18,106 @@ type CreateSessionOptions[SA models.AnyStruct] struct {
 	SessionId  string
 	UserId     string
 	Attributes SA
+	// RememberMe creates a persistent session using the periods from SessionConfig.RememberMe.
+	RememberMe bool
+	// Client describes the client the session is created for.
+	Client ClientInfo
 }
 
-func isValidSession[SA models.AnyStruct](dbSession *models.DBSession[SA]) bool {
-	return dbSession.IdleExpiresAt.After(time.Now())
+// sessionPeriods returns the active and idle periods for a persistent or regular session.
+func (k *Keezle[UA, SA]) sessionPeriods(persistent bool) (activePeriod, idlePeriod time.Duration) {
+	if persistent {
+		return k.Config.Session.RememberMe.ActivePeriod, k.Config.Session.RememberMe.IdlePeriod
+	}
+	return k.Config.Session.ActivePeriod, k.Config.Session.IdlePeriod
+}
+
+// sessionCreatedAt returns the time the session was created.
+// Sessions created before the creation time was tracked are treated as created at the zero time.
+func sessionCreatedAt[SA models.AnyStruct](dbSession *models.DBSession[SA]) time.Time {
+	return derefTime(dbSession.CreatedAt)
+}
+
+// sessionLastSeenAt returns the time the session was last seen, falling back to its creation time.
+func sessionLastSeenAt[SA models.AnyStruct](dbSession *models.DBSession[SA]) time.Time {
+	if dbSession.LastSeenAt == nil {
+		return sessionCreatedAt(dbSession)
+	}
+	return *dbSession.LastSeenAt
+}
+
+// sessionExpiries returns the active and idle expiration times for a session renewed now.
+// Both are capped by the maximum lifetime of the session if one is configured.
+func (k *Keezle[UA, SA]) sessionExpiries(persistent bool, createdAt time.Time) (activeExpiresAt, idleExpiresAt time.Time) {
+	activePeriod, idlePeriod := k.sessionPeriods(persistent)
+	activeExpiresAt = k.now().Add(activePeriod)
+	idleExpiresAt = activeExpiresAt.Add(idlePeriod)
+	if k.Config.Session.MaxLifetime > 0 {
+		maxExpiresAt := createdAt.Add(k.Config.Session.MaxLifetime)
+		if activeExpiresAt.After(maxExpiresAt) {
+			activeExpiresAt = maxExpiresAt
+		}
+		if idleExpiresAt.After(maxExpiresAt) {
+			idleExpiresAt = maxExpiresAt
+		}
+	}
+	return activeExpiresAt, idleExpiresAt
+}
+
+// exceedsMaxLifetime reports whether the session has outlived the maximum session lifetime.
+func (k *Keezle[UA, SA]) exceedsMaxLifetime(dbSession *models.DBSession[SA]) bool {
+	if k.Config.Session.MaxLifetime <= 0 || dbSession.CreatedAt == nil {
+		return false
+	}
+	return !dbSession.CreatedAt.Add(k.Config.Session.MaxLifetime).After(k.now())
+}
+
+// shouldRotate reports whether the session id is due to be rotated.
+func (k *Keezle[UA, SA]) shouldRotate(dbSession *models.DBSession[SA]) bool {
+	if k.Config.Session.RotationPeriod <= 0 {
+		return false
+	}
+	issuedAt := dbSession.IssuedAt
+	if issuedAt == nil {
+		issuedAt = dbSession.CreatedAt
+	}
+	if issuedAt == nil {
+		return true
+	}
+	return !issuedAt.Add(k.Config.Session.RotationPeriod).After(k.now())
+}
+
+// sessionIdleExpiresAt returns the time the session expires. Sessions stored without an idle expiration time
+// expire at the end of their active period.
+func sessionIdleExpiresAt[SA models.AnyStruct](dbSession *models.DBSession[SA]) time.Time {
+	if dbSession.IdleExpiresAt == nil {
+		return derefTime(dbSession.ActiveExpiresAt)
+	}
+	return *dbSession.IdleExpiresAt
+}
+
+// sessionState returns the state of the session at the time.
+func sessionState[SA models.AnyStruct](dbSession *models.DBSession[SA], now time.Time) string {
+	switch {
+	case now.Before(derefTime(dbSession.ActiveExpiresAt)):
+		return models.SessionStateActive
+	case now.Before(sessionIdleExpiresAt(dbSession)):
+		return models.SessionStateIdle
+	default:
+		return models.SessionStateExpired
+	}
+}
+
+// shouldRenew reports whether enough of the active period has elapsed for the session to be renewed.
+// Renewing only past SessionConfig.RenewalThreshold avoids writing the session on every request.
+func (k *Keezle[UA, SA]) shouldRenew(dbSession *models.DBSession[SA]) bool {
+	activePeriod, _ := k.sessionPeriods(derefBool(dbSession.Persistent))
+	remaining := derefTime(dbSession.ActiveExpiresAt).Sub(k.now())
+	return remaining <= time.Duration(float64(activePeriod)*(1-k.Config.Session.RenewalThreshold))
+}
+
+func (k *Keezle[UA, SA]) isValidSession(dbSession *models.DBSession[SA]) bool {
+	return sessionIdleExpiresAt(dbSession).After(k.now()) && !k.exceedsMaxLifetime(dbSession)
 }
 
 func derefTime(t *time.Time) time.Time {
@@ -26,6 +127,27 @@ func derefTime(t *time.Time) time.Time {
 	return *t
 }
 
+func derefInt(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+func derefBool(b *bool) bool {
+	if b == nil {
+		return false
+	}
+	return *b
+}
+
+func nilIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
 func ptr[T any](v T) *T {
 	return &v
 }
@@ -37,17 +159,33 @@ func (k *Keezle[UA, SA]) TransformSession(dbSession *models.DBSession[SA], dbUse
 	if err != nil {
 		return nil, err
 	}
-	var state string = "idle"
-	if dbSession.ActiveExpiresAt.Before(time.Now()) {
-		state = "active"
-	}
 	session := &models.Session[UA, SA]{
 		ID:              deref(dbSession.ID),
 		User:            dbUser,
 		ActiveExpiresAt: derefTime(dbSession.ActiveExpiresAt),
-		IdleExpiresAt:   derefTime(dbSession.IdleExpiresAt),
+		IdleExpiresAt:   sessionIdleExpiresAt(dbSession),
 		Attributes:      sessionAttributes,
-		State:           state,
+		State:           sessionState(dbSession, k.now()),
+		Fresh:           fresh,
+		Persistent:      derefBool(dbSession.Persistent),
+		CreatedAt:       sessionCreatedAt(dbSession),
+		LastSeenAt:      sessionLastSeenAt(dbSession),
+		IPAddress:       deref(dbSession.IPAddress),
+		UserAgent:       deref(dbSession.UserAgent),
+		AuthenticatedAt: sessionCreatedAt(dbSession),
+		AuthLevel:       AuthLevelLogin,
+	}
+	if dbSession.AuthenticatedAt != nil {
+		session.AuthenticatedAt = *dbSession.AuthenticatedAt
+	}
+	if dbSession.AuthLevel != nil {
+		session.AuthLevel = *dbSession.AuthLevel
+	}
+	if dbSession.AuthLevels != nil {
+		session.AuthLevels = maps.Clone(*dbSession.AuthLevels)
+	} else {
+		// Sessions stored before the levels were recorded separately only know their last authentication.
+		session.AuthLevels = models.AuthLevels{session.AuthLevel: session.AuthenticatedAt}
 	}
 	return session, nil
 }
@@ -58,9 +196,15 @@ func (k *Keezle[UA, SA]) GetSession(sessionId string) (*models.Session[UA, SA],
 		return nil, ErrInvalidSessionId
 	}
 
-	dbSession, dbUser, err := k.Config.Adapter.GetSessionAndUser(sessionId)
+	if k.isStateless() {
+		return k.getStatelessSession(sessionId)
+	}
 
+	dbSession, dbUser, err := k.Config.Adapter.GetSessionAndUser(sessionId)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidSessionId
+		}
 		return nil, err
 	}
 
@@ -73,7 +217,12 @@ func (k *Keezle[UA, SA]) GetSession(sessionId string) (*models.Session[UA, SA],
 }
 
 // GetAllUserSessions retrieves all sessions for a user by their user ID.
+// Stateless sessions are not stored, so they can not be listed.
 func (k *Keezle[UA, SA]) GetAllUserSessions(userId string) ([]*models.Session[UA, SA], error) {
+	if k.isStateless() {
+		return nil, ErrStatelessSession
+	}
+
 	dbSessions, err := k.Config.Adapter.GetSessionsByUser(userId)
 	if err != nil {
 		return nil, err
@@ -81,7 +230,7 @@ func (k *Keezle[UA, SA]) GetAllUserSessions(userId string) ([]*models.Session[UA
 
 	var sessions []*models.Session[UA, SA]
 	for _, dbSession := range dbSessions {
-		if !isValidSession(dbSession) {
+		if !k.isValidSession(dbSession) || dbSession.ReplacedBy != nil {
 			continue
 		}
 		user, err := k.GetUser(deref(dbSession.UserId))
@@ -107,24 +256,100 @@ func (k *Keezle[UA, SA]) CreateSession(opts CreateSessionOptions[SA]) (*models.S
 		}
 		sessionId = id
 	}
+	now := k.now()
+	activeExpiresAt, idleExpiresAt := k.sessionExpiries(opts.RememberMe, now)
 	session := &models.DBSession[SA]{
 		ID:              &sessionId,
 		UserId:          &opts.UserId,
 		Attributes:      &opts.Attributes,
-		ActiveExpiresAt: ptr(time.Now().Add(k.Config.Session.ActivePeriod)),
-		IdleExpiresAt:   ptr(time.Now().Add(k.Config.Session.ActivePeriod).Add(k.Config.Session.IdlePeriod)),
+		ActiveExpiresAt: &activeExpiresAt,
+		IdleExpiresAt:   &idleExpiresAt,
+		Persistent:      &opts.RememberMe,
+		CreatedAt:       &now,
+		IssuedAt:        &now,
+		LastSeenAt:      &now,
+		IPAddress:       nilIfEmpty(opts.Client.IPAddress),
+		UserAgent:       nilIfEmpty(opts.Client.UserAgent),
+		AuthenticatedAt: &now,
+		AuthLevel:       ptr(AuthLevelLogin),
+		AuthLevels:      &models.AuthLevels{AuthLevelLogin: now},
+	}
+	if k.Config.Session.Binding != nil {
+		session.Binding = k.Config.Session.Binding.sessionBinding(opts.Client)
 	}
 	user, err := k.GetUser(opts.UserId)
 	if err != nil {
 		return nil, err
 	}
 
-	err = k.Config.Adapter.CreateSession(session)
+	created, err := k.TransformSession(session, user, false)
 	if err != nil {
 		return nil, err
 	}
+	event := &SessionEvent[UA, SA]{EventMeta: k.newEventMeta(EventSessionCreated), Session: created}
+	if err := k.Events.before(event); err != nil {
+		return nil, err
+	}
+
+	if k.isStateless() {
+		if created, err = k.createStatelessSession(session, user); err != nil {
+			return nil, err
+		}
+		event.Session = created
+	} else {
+		if limit := k.Config.Session.Limit; limit != nil && limit.Max > 0 {
+			err = k.createLimitedSession(session, limit, now)
+		} else {
+			err = k.Config.Adapter.CreateSession(session)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	k.Events.after(event)
+	return created, nil
+}
+
+// createLimitedSession creates the session while enforcing the session limit of its user.
+// It returns ErrSessionLimitReached if the limit rejects the session.
+func (k *Keezle[UA, SA]) createLimitedSession(session *models.DBSession[SA], limit *SessionLimit, now time.Time) error {
+	if limiter, ok := k.Config.Adapter.(adapters.SessionLimiter[SA]); ok {
+		return limiter.CreateSessionWithLimit(session, limit, now)
+	}
+
+	k.Config.Logger.Log("debug: adapter does not implement adapters.SessionLimiter, enforcing session limit non-atomically")
+	dbSessions, err := k.Config.Adapter.GetSessionsByUser(deref(session.UserId))
+	if err != nil {
+		return err
+	}
+
+	var sessions []*models.DBSession[SA]
+	for _, dbSession := range dbSessions {
+		if k.isValidSession(dbSession) && dbSession.ReplacedBy == nil {
+			sessions = append(sessions, dbSession)
+		}
+	}
+
+	excess := len(sessions) - limit.Max + 1
+	if excess > 0 {
+		if limit.Strategy == SessionLimitReject {
+			return ErrSessionLimitReached
+		}
+		slices.SortFunc(sessions, func(a, b *models.DBSession[SA]) int {
+			if limit.Strategy == SessionLimitEvictLeastRecentlyUsed {
+				return sessionLastSeenAt(a).Compare(sessionLastSeenAt(b))
+			}
+			return sessionCreatedAt(a).Compare(sessionCreatedAt(b))
+		})
+		for _, dbSession := range sessions[:excess] {
+			if err := k.Config.Adapter.DeleteSession(deref(dbSession.ID)); err != nil {
+				return err
+			}
+		}
+	}
 
-	return k.TransformSession(session, user, false)
+	return k.Config.Adapter.CreateSession(session)
 }
 
 // UpdateSession updates an existing session with new attributes.
@@ -133,12 +358,16 @@ func (k *Keezle[UA, SA]) UpdateSession(sessionId string, newSession *models.DBSe
 		return nil, ErrInvalidSessionId
 	}
 
+	if k.isStateless() {
+		return nil, ErrStatelessSession
+	}
+
 	dbSession, err := k.Config.Adapter.UpdateSession(sessionId, newSession)
 	if err != nil {
 		return nil, err
 	}
 
-	user, err := k.GetUser(deref(newSession.UserId))
+	user, err := k.GetUser(deref(dbSession.UserId))
 	if err != nil {
 		return nil, err
 	}
@@ -147,17 +376,61 @@ func (k *Keezle[UA, SA]) UpdateSession(sessionId string, newSession *models.DBSe
 }
 
 // DeleteSession deletes a session by its ID.
+// Stateless sessions are revoked instead.
 func (k *Keezle[UA, SA]) DeleteSession(sessionId string) error {
 	if sessionId == "" {
 		return ErrInvalidSessionId
 	}
 
-	return k.Config.Adapter.DeleteSession(sessionId)
+	event := &SessionRevokedEvent{EventMeta: k.newEventMeta(EventSessionRevoked), SessionID: sessionId}
+	if k.isStateless() {
+		claims, err := k.parseSessionToken(sessionId)
+		if err != nil {
+			return err
+		}
+		event.SessionID, event.UserID = claims.ID, claims.Subject
+		if err := k.Events.before(event); err != nil {
+			return err
+		}
+		if err := k.revokeStatelessSession(claims); err != nil {
+			return err
+		}
+		k.Events.after(event)
+		return nil
+	}
+
+	if dbSession, _, err := k.Config.Adapter.GetSessionAndUser(sessionId); err == nil {
+		event.UserID = deref(dbSession.UserId)
+	}
+	if err := k.Events.before(event); err != nil {
+		return err
+	}
+	if err := k.Config.Adapter.DeleteSession(sessionId); err != nil {
+		return err
+	}
+	k.Events.after(event)
+	return nil
 }
 
 // DeleteAllUserSessions deletes all sessions for a user by their user ID.
+// Stateless sessions are revoked instead.
 func (k *Keezle[UA, SA]) DeleteAllUserSessions(userId string) error {
-	return k.Config.Adapter.DeleteAllUserSessions(userId)
+	event := &SessionRevokedEvent{EventMeta: k.newEventMeta(EventSessionRevoked), UserID: userId}
+	if err := k.Events.before(event); err != nil {
+		return err
+	}
+
+	var err error
+	if k.isStateless() {
+		err = k.revokeStatelessUserSessions(userId)
+	} else {
+		err = k.Config.Adapter.DeleteAllUserSessions(userId)
+	}
+	if err != nil {
+		return err
+	}
+	k.Events.after(event)
+	return nil
 }
 
 // DeleteInvalidUserSessions deletes all invalid sessions for a user by their user ID.
@@ -168,7 +441,7 @@ func (k *Keezle[UA, SA]) DeleteInvalidUserSessions(userId string) error {
 	}
 
 	for _, dbSession := range dbSessions {
-		if isValidSession(dbSession) {
+		if k.isValidSession(dbSession) {
 			continue
 		}
 		err = k.Config.Adapter.DeleteSession(deref(dbSession.ID))
@@ -180,71 +453,307 @@ func (k *Keezle[UA, SA]) DeleteInvalidUserSessions(userId string) error {
 	return nil
 }
 
-// ValidateSession checks if a session is valid and returns the session if it is active.
-// If the session is idle, it updates the session's expiration times and returns the updated session.
+// ValidateSession checks if a session is valid and returns it.
+// Once SessionConfig.RenewalThreshold of the active period has elapsed, the session's expiration times are
+// renewed and the returned session is fresh.
+// Expired sessions and sessions that have outlived SessionConfig.MaxLifetime are deleted and ErrSessionExpired
+// is returned.
+// If the session id is due for rotation, the session is moved to a new id and the returned session is fresh.
+// The old id keeps resolving to the new session for SessionConfig.RotationGracePeriod.
+// The session binding is not checked, use ValidateSessionWithClient for that.
 func (k *Keezle[UA, SA]) ValidateSession(sessionId string) (*models.Session[UA, SA], error) {
+	return k.validateSession(sessionId, nil)
+}
+
+// ValidateSessionWithClient validates the session like ValidateSession and additionally checks that the
+// client matches the session binding. On a mismatch Config.OnBindingMismatch is called and, unless the
+// binding policy is BindingReport, ErrSessionBindingMismatch is returned.
+func (k *Keezle[UA, SA]) ValidateSessionWithClient(sessionId string, client ClientInfo) (*models.Session[UA, SA], error) {
+	return k.validateSession(sessionId, &client)
+}
+
+func (k *Keezle[UA, SA]) validateSession(sessionId string, client *ClientInfo) (*models.Session[UA, SA], error) {
 	if sessionId == "" {
 		return nil, ErrInvalidSessionId
 	}
 
+	if k.isStateless() {
+		return k.validateStatelessSession(sessionId)
+	}
+
 	dbSession, dbUser, err := k.Config.Adapter.GetSessionAndUser(sessionId)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidSessionId
+		}
 		return nil, err
 	}
 
+	if dbSession.ReplacedBy != nil {
+		return k.validateReplacedSession(dbSession, client)
+	}
+
+	if k.exceedsMaxLifetime(dbSession) || sessionState(dbSession, k.now()) == models.SessionStateExpired {
+		if err := k.Config.Adapter.DeleteSession(sessionId); err != nil {
+			return nil, err
+		}
+		k.Events.notify(&SessionRevokedEvent{
+			EventMeta: k.newEventMeta(EventSessionExpired),
+			SessionID: sessionId,
+			UserID:    deref(dbSession.UserId),
+		})
+		return nil, ErrSessionExpired
+	}
+
 	user, err := k.TransformUser(dbUser)
 	if err != nil {
 		return nil, err
 	}
 
+	if client != nil && dbSession.Binding != nil {
+		if err := k.checkSessionBinding(dbSession, user, *client); err != nil {
+			return nil, err
+		}
+	}
+
+	if k.shouldRotate(dbSession) {
+		return k.rotateSession(dbSession, user)
+	}
+
+	if !k.shouldRenew(dbSession) {
+		return k.TransformSession(dbSession, user, false)
+	}
+
+	activeExpiresAt, idleExpiresAt := k.sessionExpiries(derefBool(dbSession.Persistent), sessionCreatedAt(dbSession))
+	if !activeExpiresAt.After(derefTime(dbSession.ActiveExpiresAt)) {
+		// The session is capped by its maximum lifetime and can not be extended any further.
+		return k.TransformSession(dbSession, user, false)
+	}
+
 	session, err := k.TransformSession(dbSession, user, false)
 	if err != nil {
 		return nil, err
 	}
+	event := &SessionEvent[UA, SA]{EventMeta: k.newEventMeta(EventSessionRenewed), Session: session}
+	if err := k.Events.before(event); err != nil {
+		return nil, err
+	}
 
-	if session.State == "active" {
-		return session, nil
+	updatedSession, err := k.Config.Adapter.UpdateSession(sessionId, &models.DBSession[SA]{
+		ActiveExpiresAt: &activeExpiresAt,
+		IdleExpiresAt:   &idleExpiresAt,
+		LastSeenAt:      ptr(k.now()),
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	updatedSession, err := k.UpdateSession(sessionId, &models.DBSession[SA]{
-		ActiveExpiresAt: ptr(time.Now().Add(k.Config.Session.ActivePeriod)),
-		IdleExpiresAt:   ptr(time.Now().Add(k.Config.Session.ActivePeriod).Add(k.Config.Session.IdlePeriod)),
+	if event.Session, err = k.TransformSession(updatedSession, user, true); err != nil {
+		return nil, err
+	}
+	k.Events.after(event)
+	return event.Session, nil
+}
+
+// validateReplacedSession validates a session whose id has been rotated.
+// During the grace period the old id resolves to the session that replaced it, which is returned as fresh
+// so that the client picks up the new id.
+func (k *Keezle[UA, SA]) validateReplacedSession(dbSession *models.DBSession[SA], client *ClientInfo) (*models.Session[UA, SA], error) {
+	if !sessionIdleExpiresAt(dbSession).After(k.now()) {
+		return nil, ErrInvalidSessionId
+	}
+
+	session, err := k.validateSession(deref(dbSession.ReplacedBy), client)
+	if err != nil {
+		return nil, err
+	}
+	session.Fresh = true
+	return session, nil
+}
+
+// checkSessionBinding compares the session binding with the client and applies the binding policy.
+func (k *Keezle[UA, SA]) checkSessionBinding(dbSession *models.DBSession[SA], user *models.User[UA], client ClientInfo) error {
+	config := k.Config.Session.Binding
+	if config == nil {
+		config = &BindingConfig{}
+	}
+	mismatch := config.checkBinding(dbSession.Binding, client)
+	if !mismatch.Any() {
+		return nil
+	}
+
+	session, err := k.TransformSession(dbSession, user, false)
+	if err != nil {
+		return err
+	}
+	if k.Config.OnBindingMismatch != nil {
+		k.Config.OnBindingMismatch(session, client, mismatch)
+	}
+	k.Events.notify(&BindingMismatchEvent[UA, SA]{
+		EventMeta: k.newEventMeta(EventSessionBindingMismatch),
+		Session:   session,
+		Client:    client,
+		Mismatch:  mismatch,
 	})
 
+	switch config.Policy {
+	case BindingReport:
+		return nil
+	case BindingRequireReauth:
+		if err := k.Config.Adapter.DeleteSession(deref(dbSession.ID)); err != nil {
+			return err
+		}
+	}
+	return ErrSessionBindingMismatch
+}
+
+// rotateSession moves the session to a new id and renews it.
+// The old session is kept for the rotation grace period and points to the new one, so that concurrent
+// requests still carrying the old id are not logged out. A session is only rotated once, concurrent requests
+// rotating it at the same time receive the same successor. The new session counts towards the session limit.
+func (k *Keezle[UA, SA]) rotateSession(dbSession *models.DBSession[SA], user *models.User[UA]) (*models.Session[UA, SA], error) {
+	newSessionId, err := utils.GenerateRandomString(32)
 	if err != nil {
 		return nil, err
 	}
 
-	return &models.Session[UA, SA]{
-		ID:              updatedSession.ID,
-		User:            dbUser,
-		ActiveExpiresAt: updatedSession.ActiveExpiresAt,
-		IdleExpiresAt:   updatedSession.IdleExpiresAt,
-		Attributes:      updatedSession.Attributes,
-		State:           updatedSession.State,
-		Fresh:           true,
-	}, nil
+	now := k.now()
+	createdAt := sessionCreatedAt(dbSession)
+	if dbSession.CreatedAt == nil {
+		createdAt = now
+	}
+	activeExpiresAt, idleExpiresAt := k.sessionExpiries(derefBool(dbSession.Persistent), createdAt)
+	newSession := &models.DBSession[SA]{
+		ID:              &newSessionId,
+		UserId:          dbSession.UserId,
+		Attributes:      dbSession.Attributes,
+		ActiveExpiresAt: &activeExpiresAt,
+		IdleExpiresAt:   &idleExpiresAt,
+		Persistent:      dbSession.Persistent,
+		CreatedAt:       &createdAt,
+		IssuedAt:        &now,
+		LastSeenAt:      &now,
+		IPAddress:       dbSession.IPAddress,
+		UserAgent:       dbSession.UserAgent,
+		Binding:         dbSession.Binding,
+		AuthenticatedAt: dbSession.AuthenticatedAt,
+		AuthLevel:       dbSession.AuthLevel,
+		AuthLevels:      dbSession.AuthLevels,
+	}
+
+	session, err := k.TransformSession(dbSession, user, false)
+	if err != nil {
+		return nil, err
+	}
+	event := &SessionEvent[UA, SA]{EventMeta: k.newEventMeta(EventSessionRotated), Session: session}
+	if err := k.Events.before(event); err != nil {
+		return nil, err
+	}
+
+	graceExpiresAt := now.Add(k.Config.Session.RotationGracePeriod)
+	if graceExpiresAt.After(sessionIdleExpiresAt(dbSession)) {
+		graceExpiresAt = sessionIdleExpiresAt(dbSession)
+	}
+	var limit *SessionLimit
+	if k.Config.Session.Limit != nil && k.Config.Session.Limit.Max > 0 {
+		limit = k.Config.Session.Limit
+	}
+	replacedBy, err := k.replaceSession(dbSession, newSession, graceExpiresAt, limit, now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidSessionId
+		}
+		return nil, err
+	}
+	if replacedBy != newSessionId {
+		// A concurrent request has rotated the session first, both continue with its successor.
+		successor, err := k.validateSession(replacedBy, nil)
+		if err != nil {
+			return nil, err
+		}
+		successor.Fresh = true
+		return successor, nil
+	}
+
+	if event.Session, err = k.TransformSession(newSession, user, true); err != nil {
+		return nil, err
+	}
+	event.PreviousID = deref(dbSession.ID)
+	k.Events.after(event)
+	return event.Session, nil
+}
+
+// replaceSession marks the session as replaced by the new session, unless it has been replaced already, and
+// creates the new session within the session limit. It returns the id of the session which replaced the
+// session.
+func (k *Keezle[UA, SA]) replaceSession(dbSession, newSession *models.DBSession[SA], graceExpiresAt time.Time, limit *SessionLimit, now time.Time) (string, error) {
+	if rotator, ok := k.Config.Adapter.(adapters.SessionRotator[SA]); ok {
+		return rotator.RotateSession(deref(dbSession.ID), newSession, graceExpiresAt, limit, now)
+	}
+
+	k.Config.Logger.Log("debug: adapter does not implement adapters.SessionRotator, rotating session non-atomically")
+	current, _, err := k.Config.Adapter.GetSessionAndUser(deref(dbSession.ID))
+	if err != nil {
+		return "", err
+	}
+	if current.ReplacedBy != nil {
+		return *current.ReplacedBy, nil
+	}
+	// The session is marked as replaced first, so that it does not count towards the session limit.
+	_, err = k.Config.Adapter.UpdateSession(deref(dbSession.ID), &models.DBSession[SA]{
+		ActiveExpiresAt: &graceExpiresAt,
+		IdleExpiresAt:   &graceExpiresAt,
+		ReplacedBy:      newSession.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+	if limit != nil {
+		err = k.createLimitedSession(newSession, limit, now)
+	} else {
+		err = k.Config.Adapter.CreateSession(newSession)
+	}
+	if err != nil {
+		return "", err
+	}
+	return deref(newSession.ID), nil
 }
 
 // CreateSessionCookie creates a http cookie for the session.
+// Passing a nil session creates a blank cookie that removes the session cookie from the client.
 func (k *Keezle[UA, SA]) CreateSessionCookie(session *models.Session[UA, SA]) *http.Cookie {
-	var expires time.Time
+	cookieConfig := k.Config.Session.Cookie
+	cookie := &http.Cookie{
+		Name:     cookieConfig.Name,
+		HttpOnly: true,
+		Secure:   cookieConfig.Secure,
+		Domain:   cookieConfig.Domain,
+		Path:     cookieConfig.Path,
+		SameSite: cookieConfig.SameSite,
+	}
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+	if cookie.SameSite == 0 {
+		cookie.SameSite = http.SameSiteLaxMode
+	}
+
 	if session == nil {
-		expires = time.Unix(0, 0)
-	} else if k.Config.Session.Cookie.Expires {
-		expires = session.IdleExpiresAt
-	} else {
-		expires = time.Now().Add(time.Hour * 24 * 365)
+		cookie.Expires = time.Unix(0, 0)
+		cookie.MaxAge = -1
+		return cookie
 	}
 
-	return &http.Cookie{
-		Name:     k.Config.Session.Cookie.Name,
-		HttpOnly: true,
-		Secure:   k.Config.Session.Cookie.Secure,
-		Expires:  expires,
-		Value:    session.ID,
-		// TODO: k.Config.Session.Cookie attributes should be configurable
+	cookie.Value = session.ID
+	if !session.Persistent {
+		return cookie
+	}
+	if cookieConfig.Expires {
+		cookie.Expires = session.IdleExpiresAt
+	} else {
+		cookie.Expires = k.now().Add(time.Hour * 24 * 365)
 	}
+	return cookie
 }
 
 // ReadSessionCookie reads the session cookie from the request and returns its value.
@@ -0,0 +1,152 @@
+package keezle_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/keezletest"
+	"github.com/gaurishhs/keezle/models"
+)
+
+type attributes = keezletest.Attributes
+
+var epoch = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// newKeezle returns an instance on a memory adapter and a fake clock with a user "u1".
+func newKeezle(t *testing.T, session *keezle.SessionConfig) (*keezle.Keezle[attributes, attributes], *keezletest.FakeClock) {
+	t.Helper()
+	clock := keezletest.NewFakeClock(epoch)
+	k := keezle.New(&keezle.Config[attributes, attributes]{
+		Adapter: keezletest.NewMemoryAdapter[attributes, attributes](),
+		Session: session,
+		Clock:   clock,
+	})
+	if _, err := k.CreateUser(keezle.CreateUserOptions[attributes]{UserID: "u1", Attributes: &attributes{}}); err != nil {
+		t.Fatal(err)
+	}
+	return k, clock
+}
+
+func TestSessionStates(t *testing.T) {
+	k, clock := newKeezle(t, &keezle.SessionConfig{ActivePeriod: time.Hour, IdlePeriod: 2 * time.Hour})
+	session, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		state   string
+	}{
+		{"new", 0, models.SessionStateActive},
+		{"before active expiry", time.Hour - time.Second, models.SessionStateActive},
+		{"at active expiry", time.Hour, models.SessionStateIdle},
+		{"before idle expiry", 3*time.Hour - time.Second, models.SessionStateIdle},
+		{"at idle expiry", 3 * time.Hour, models.SessionStateExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Set(epoch.Add(tt.elapsed))
+			got, err := k.GetSession(session.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.State != tt.state {
+				t.Errorf("state = %q, want %q", got.State, tt.state)
+			}
+		})
+	}
+
+	if _, err := k.ValidateSession(session.ID); !errors.Is(err, keezle.ErrSessionExpired) {
+		t.Errorf("validating an expired session returned %v, want ErrSessionExpired", err)
+	}
+	if _, err := k.GetSession(session.ID); !errors.Is(err, keezle.ErrInvalidSessionId) {
+		t.Errorf("expired session was not deleted: %v", err)
+	}
+}
+
+func TestRememberMeLifetime(t *testing.T) {
+	config := &keezle.SessionConfig{
+		ActivePeriod: time.Hour,
+		IdlePeriod:   time.Hour,
+		RememberMe:   &keezle.RememberMeConfig{ActivePeriod: 24 * time.Hour, IdlePeriod: 7 * 24 * time.Hour},
+	}
+	tests := []struct {
+		name       string
+		rememberMe bool
+		active     time.Duration
+		idle       time.Duration
+	}{
+		{"session", false, time.Hour, 2 * time.Hour},
+		{"remember me", true, 24 * time.Hour, 8 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, clock := newKeezle(t, config)
+			session, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}, RememberMe: tt.rememberMe})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if session.Persistent != tt.rememberMe {
+				t.Errorf("persistent = %v, want %v", session.Persistent, tt.rememberMe)
+			}
+			if want := epoch.Add(tt.active); !session.ActiveExpiresAt.Equal(want) {
+				t.Errorf("active expiry = %v, want %v", session.ActiveExpiresAt, want)
+			}
+			if want := epoch.Add(tt.idle); !session.IdleExpiresAt.Equal(want) {
+				t.Errorf("idle expiry = %v, want %v", session.IdleExpiresAt, want)
+			}
+
+			clock.Set(epoch.Add(tt.idle))
+			if _, err := k.ValidateSession(session.ID); !errors.Is(err, keezle.ErrSessionExpired) {
+				t.Errorf("validating at the idle expiry returned %v, want ErrSessionExpired", err)
+			}
+		})
+	}
+}
+
+func TestSessionRenewalThreshold(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold float64
+		elapsed   time.Duration
+		renewed   bool
+	}{
+		{"default before half", 0, 29 * time.Minute, false},
+		{"default at half", 0, 30 * time.Minute, true},
+		{"low threshold", 0.1, 6 * time.Minute, true},
+		{"full threshold while active", 1, 59 * time.Minute, false},
+		{"full threshold when idle", 1, 61 * time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, clock := newKeezle(t, &keezle.SessionConfig{ActivePeriod: time.Hour, IdlePeriod: time.Hour, RenewalThreshold: tt.threshold})
+			session, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			clock.Advance(tt.elapsed)
+			validated, err := k.ValidateSession(session.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if validated.Fresh != tt.renewed {
+				t.Errorf("fresh = %v, want %v", validated.Fresh, tt.renewed)
+			}
+			want := session.ActiveExpiresAt
+			if tt.renewed {
+				want = clock.Now().Add(time.Hour)
+			}
+			if !validated.ActiveExpiresAt.Equal(want) {
+				t.Errorf("active expiry = %v, want %v", validated.ActiveExpiresAt, want)
+			}
+			if validated.State != models.SessionStateActive {
+				t.Errorf("state = %q, want %q", validated.State, models.SessionStateActive)
+			}
+		})
+	}
+}
@@ -0,0 +1,448 @@
+package keezle
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gaurishhs/keezle/adapters"
+	"github.com/gaurishhs/keezle/jwt"
+	"github.com/gaurishhs/keezle/models"
+)
+
+// StatelessConfig enables stateless sessions.
+// Stateless sessions are not stored by the adapter. Their id is a signed token carrying the user id, the
+// expiration times and the session attributes, which ValidateSession verifies without a database query.
+// Deleting a stateless session adds it to a revocation list, which requires an adapter implementing
+// adapters.RevocationStore and is synced at most once per RevocationSyncInterval.
+// Session rotation, binding, limits and updates are not supported for stateless sessions.
+type StatelessConfig struct {
+	// Keys holds the keys used to sign and verify session tokens. Its signing key must be able to sign.
+	Keys *jwt.KeySet
+	// Issuer is written to and required in the "iss" claim of session tokens.
+	Issuer string
+	// UserAttributes includes the user attributes in session tokens, so that validated sessions carry them.
+	// Otherwise the user of a validated session only has its ID set.
+	UserAttributes bool
+	// RevocationSyncInterval is how long the revocation list is cached, defaults to 30 seconds.
+	// Revocations made by other instances take up to this long to be enforced.
+	RevocationSyncInterval time.Duration
+}
+
+// canSign reports whether the signing key of Keys can sign session tokens.
+func (c *StatelessConfig) canSign() bool {
+	key := c.Keys.SigningKey()
+	return key != nil && key.CanSign()
+}
+
+// sessionClaims are the claims of a stateless session token.
+type sessionClaims struct {
+	jwt.RegisteredClaims
+	ActiveExpiresAt int64 `json:"aexp"`
+	// CreatedAt is the unix time of the login in milliseconds, see isRevoked.
+	CreatedAt       int64 `json:"cat"`
+	Persistent      bool  `json:"per,omitempty"`
+	AuthenticatedAt int64 `json:"aat,omitempty"`
+	AuthLevel       int   `json:"alv,omitempty"`
+	// AuthLevels maps the authentication levels to the unix time of their last authentication.
+	AuthLevels        map[int]int64 `json:"als,omitempty"`
+	SessionAttributes string        `json:"sat,omitempty"`
+	UserAttributes    string        `json:"uat,omitempty"`
+}
+
+// revocationList caches the revocations of the revocation store.
+type revocationList struct {
+	mu          sync.Mutex
+	fetchedAt   time.Time
+	revocations []*adapters.Revocation
+}
+
+func (k *Keezle[UA, SA]) isStateless() bool {
+	return k.Config.Session.Stateless != nil
+}
+
+// encodeAttributes encodes attributes with their driver.Valuer implementation.
+func encodeAttributes(attributes models.AnyStruct) (string, error) {
+	value, err := attributes.Value()
+	if err != nil {
+		return "", err
+	}
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case []byte:
+		return string(value), nil
+	case string:
+		return value, nil
+	default:
+		return "", fmt.Errorf("keezle: cannot encode attributes of type %T", value)
+	}
+}
+
+// decodeAttributes decodes attributes encoded by encodeAttributes with their sql.Scanner implementation.
+func decodeAttributes[T models.AnyStruct](encoded string) (*T, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	var attributes T
+	// Scan has a value receiver, so attributes of a map type are decoded into an initialized map.
+	if v := reflect.ValueOf(&attributes).Elem(); v.Kind() == reflect.Map {
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+	if err := attributes.Scan([]byte(encoded)); err != nil {
+		return nil, err
+	}
+	return &attributes, nil
+}
+
+func unixTime(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+func unixMilli(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// ceilUnixMilli returns the unix time of t in milliseconds rounded up.
+func ceilUnixMilli(t time.Time) int64 {
+	msec := t.UnixMilli()
+	if t.Nanosecond()%int(time.Millisecond) > 0 {
+		msec++
+	}
+	return msec
+}
+
+func fromUnix(sec int64) *time.Time {
+	if sec == 0 {
+		return nil
+	}
+	return ptr(time.Unix(sec, 0))
+}
+
+func fromUnixMilli(msec int64) *time.Time {
+	if msec == 0 {
+		return nil
+	}
+	return ptr(time.UnixMilli(msec))
+}
+
+// signSessionToken returns the token of a stateless session.
+func (k *Keezle[UA, SA]) signSessionToken(dbSession *models.DBSession[SA], user *models.User[UA]) (string, error) {
+	claims := sessionClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        deref(dbSession.ID),
+			Issuer:    k.Config.Session.Stateless.Issuer,
+			Subject:   deref(dbSession.UserId),
+			ExpiresAt: sessionIdleExpiresAt(dbSession).Unix(),
+			IssuedAt:  k.now().Unix(),
+		},
+		ActiveExpiresAt: unixTime(dbSession.ActiveExpiresAt),
+		CreatedAt:       unixMilli(dbSession.CreatedAt),
+		Persistent:      derefBool(dbSession.Persistent),
+		AuthenticatedAt: unixTime(dbSession.AuthenticatedAt),
+		AuthLevel:       derefInt(dbSession.AuthLevel),
+	}
+	if dbSession.AuthLevels != nil {
+		claims.AuthLevels = make(map[int]int64, len(*dbSession.AuthLevels))
+		for level, authenticatedAt := range *dbSession.AuthLevels {
+			claims.AuthLevels[level] = authenticatedAt.Unix()
+		}
+	}
+
+	if dbSession.Attributes != nil {
+		attributes, err := encodeAttributes(*dbSession.Attributes)
+		if err != nil {
+			return "", err
+		}
+		claims.SessionAttributes = attributes
+	}
+	if k.Config.Session.Stateless.UserAttributes && user.Attributes != nil {
+		attributes, err := encodeAttributes(*user.Attributes)
+		if err != nil {
+			return "", err
+		}
+		claims.UserAttributes = attributes
+	}
+
+	return k.Config.Session.Stateless.Keys.Sign(claims)
+}
+
+// parseSessionToken verifies the signature and issuer of a stateless session token.
+// The expiration time is not checked.
+func (k *Keezle[UA, SA]) parseSessionToken(token string) (*sessionClaims, error) {
+	var claims sessionClaims
+	if err := k.Config.Session.Stateless.Keys.Parse(token, &claims); err != nil {
+		return nil, ErrInvalidSessionId
+	}
+	if claims.Issuer != k.Config.Session.Stateless.Issuer || claims.ID == "" || claims.Subject == "" {
+		return nil, ErrInvalidSessionId
+	}
+	return &claims, nil
+}
+
+// sessionFromClaims returns the database session and the user carried by the claims of a token.
+func sessionFromClaims[UA, SA models.AnyStruct](claims *sessionClaims) (*models.DBSession[SA], *models.User[UA], error) {
+	sessionAttributes, err := decodeAttributes[SA](claims.SessionAttributes)
+	if err != nil {
+		return nil, nil, err
+	}
+	userAttributes, err := decodeAttributes[UA](claims.UserAttributes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dbSession := &models.DBSession[SA]{
+		ID:              &claims.ID,
+		UserId:          &claims.Subject,
+		ActiveExpiresAt: fromUnix(claims.ActiveExpiresAt),
+		IdleExpiresAt:   fromUnix(claims.ExpiresAt),
+		Attributes:      sessionAttributes,
+		Persistent:      &claims.Persistent,
+		CreatedAt:       fromUnixMilli(claims.CreatedAt),
+		IssuedAt:        fromUnix(claims.IssuedAt),
+		AuthenticatedAt: fromUnix(claims.AuthenticatedAt),
+	}
+	if claims.AuthLevel != 0 {
+		dbSession.AuthLevel = &claims.AuthLevel
+	}
+	if claims.AuthLevels != nil {
+		levels := make(models.AuthLevels, len(claims.AuthLevels))
+		for level, authenticatedAt := range claims.AuthLevels {
+			levels[level] = time.Unix(authenticatedAt, 0)
+		}
+		dbSession.AuthLevels = &levels
+	}
+	user := &models.User[UA]{
+		ID:         claims.Subject,
+		Attributes: userAttributes,
+	}
+	return dbSession, user, nil
+}
+
+// createStatelessSession issues the token of a new stateless session.
+func (k *Keezle[UA, SA]) createStatelessSession(dbSession *models.DBSession[SA], user *models.User[UA]) (*models.Session[UA, SA], error) {
+	token, err := k.signSessionToken(dbSession, user)
+	if err != nil {
+		return nil, err
+	}
+	session, err := k.TransformSession(dbSession, user, false)
+	if err != nil {
+		return nil, err
+	}
+	session.ID = token
+	return session, nil
+}
+
+// getStatelessSession returns the stateless session of a token without renewing it.
+func (k *Keezle[UA, SA]) getStatelessSession(token string) (*models.Session[UA, SA], error) {
+	claims, err := k.parseSessionToken(token)
+	if err != nil {
+		return nil, err
+	}
+	dbSession, dbUser, err := sessionFromClaims[UA, SA](claims)
+	if err != nil {
+		return nil, err
+	}
+	user, err := k.TransformUser(dbUser)
+	if err != nil {
+		return nil, err
+	}
+	session, err := k.TransformSession(dbSession, user, false)
+	if err != nil {
+		return nil, err
+	}
+	session.ID = token
+	return session, nil
+}
+
+// validateStatelessSession verifies the token of a stateless session and renews it once
+// SessionConfig.RenewalThreshold of the active period has elapsed.
+func (k *Keezle[UA, SA]) validateStatelessSession(token string) (*models.Session[UA, SA], error) {
+	claims, err := k.parseSessionToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	dbSession, dbUser, err := sessionFromClaims[UA, SA](claims)
+	if err != nil {
+		return nil, err
+	}
+	if sessionState(dbSession, k.now()) == models.SessionStateExpired || k.exceedsMaxLifetime(dbSession) {
+		return nil, ErrSessionExpired
+	}
+
+	revoked, err := k.isRevoked(claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidSessionId
+	}
+
+	user, err := k.TransformUser(dbUser)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := k.TransformSession(dbSession, user, false)
+	if err != nil {
+		return nil, err
+	}
+	session.ID = token
+	// A signing key replaced by a verification key can not renew tokens, which stay valid until they expire.
+	if !k.shouldRenew(dbSession) || !k.Config.Session.Stateless.canSign() {
+		return session, nil
+	}
+	activeExpiresAt, idleExpiresAt := k.sessionExpiries(derefBool(dbSession.Persistent), sessionCreatedAt(dbSession))
+	if !activeExpiresAt.After(derefTime(dbSession.ActiveExpiresAt)) {
+		return session, nil
+	}
+
+	event := &SessionEvent[UA, SA]{EventMeta: k.newEventMeta(EventSessionRenewed), Session: session}
+	if err := k.Events.before(event); err != nil {
+		return nil, err
+	}
+	dbSession.ActiveExpiresAt = &activeExpiresAt
+	dbSession.IdleExpiresAt = &idleExpiresAt
+	if token, err = k.signSessionToken(dbSession, dbUser); err != nil {
+		return nil, err
+	}
+	if event.Session, err = k.TransformSession(dbSession, user, true); err != nil {
+		return nil, err
+	}
+	event.Session.ID = token
+	k.Events.after(event)
+	return event.Session, nil
+}
+
+// revocationStore returns the revocation store of the adapter.
+func (k *Keezle[UA, SA]) revocationStore() (adapters.RevocationStore, error) {
+	store, ok := k.Config.Adapter.(adapters.RevocationStore)
+	if !ok {
+		return nil, ErrRevocationNotSupported
+	}
+	return store, nil
+}
+
+// isRevoked reports whether the session token has been revoked.
+// Adapters without a revocation store can not revoke stateless sessions, so nothing is revoked.
+func (k *Keezle[UA, SA]) isRevoked(claims *sessionClaims) (bool, error) {
+	store, err := k.revocationStore()
+	if err != nil {
+		return false, nil
+	}
+
+	list := &k.revocations
+	now := k.now()
+	list.mu.Lock()
+	stale := now.Sub(list.fetchedAt) >= k.Config.Session.Stateless.RevocationSyncInterval
+	list.mu.Unlock()
+	if stale {
+		// The store is queried without holding the lock, so that a slow query does not block validations
+		// which would be served from the cache.
+		revocations, err := store.GetRevocations(now)
+		if err != nil {
+			return false, err
+		}
+		list.update(revocations, now)
+	}
+
+	list.mu.Lock()
+	defer list.mu.Unlock()
+	for _, revocation := range list.revocations {
+		if revocation.SessionID != "" {
+			if revocation.SessionID == claims.ID {
+				return true, nil
+			}
+			continue
+		}
+		// Renewed tokens keep the creation time of the session, which is never after their issue time. Tokens
+		// carry it in milliseconds, so it is compared to the revocation time rounded up, and sessions created
+		// in the millisecond of the revocation are revoked as well.
+		if revocation.UserID == claims.Subject && claims.CreatedAt < ceilUnixMilli(revocation.RevokedAt) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// update replaces the cached revocations with the revocations fetched at now. Cached revocations which have not
+// expired are kept, since revocations made while the store was queried may be missing from the fetched ones.
+func (l *revocationList) update(fetched []*adapters.Revocation, now time.Time) {
+	type revocationKey struct {
+		sessionId, userId string
+		revokedAt         int64
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.fetchedAt.After(now) {
+		return
+	}
+	seen := make(map[revocationKey]bool, len(fetched))
+	for _, revocation := range fetched {
+		seen[revocationKey{revocation.SessionID, revocation.UserID, revocation.RevokedAt.UnixMicro()}] = true
+	}
+	for _, revocation := range l.revocations {
+		key := revocationKey{revocation.SessionID, revocation.UserID, revocation.RevokedAt.UnixMicro()}
+		if !seen[key] && revocation.ExpiresAt.After(now) {
+			fetched = append(fetched, revocation)
+		}
+	}
+	l.revocations = fetched
+	l.fetchedAt = now
+}
+
+// revoke stores the revocation and adds it to the cached revocation list.
+func (k *Keezle[UA, SA]) revoke(revocation *adapters.Revocation) error {
+	store, err := k.revocationStore()
+	if err != nil {
+		return err
+	}
+	if err := store.CreateRevocation(revocation); err != nil {
+		return err
+	}
+
+	k.revocations.mu.Lock()
+	k.revocations.revocations = append(k.revocations.revocations, revocation)
+	k.revocations.mu.Unlock()
+	return nil
+}
+
+// revocationExpiresAt returns the time after which a revocation made now is no longer needed.
+// Until the revocation has been synced by every instance a revoked token can still be renewed, after which it
+// is valid for up to the longest active and idle period.
+func (k *Keezle[UA, SA]) revocationExpiresAt(now time.Time) time.Time {
+	lifetime := max(
+		k.Config.Session.ActivePeriod+k.Config.Session.IdlePeriod,
+		k.Config.Session.RememberMe.ActivePeriod+k.Config.Session.RememberMe.IdlePeriod,
+	)
+	return now.Add(k.Config.Session.Stateless.RevocationSyncInterval + lifetime)
+}
+
+// revokeStatelessSession revokes the stateless session of the token claims.
+func (k *Keezle[UA, SA]) revokeStatelessSession(claims *sessionClaims) error {
+	now := k.now()
+	return k.revoke(&adapters.Revocation{
+		SessionID: claims.ID,
+		UserID:    claims.Subject,
+		RevokedAt: now,
+		ExpiresAt: k.revocationExpiresAt(now),
+	})
+}
+
+// revokeStatelessUserSessions revokes every stateless session created for the user so far.
+func (k *Keezle[UA, SA]) revokeStatelessUserSessions(userId string) error {
+	now := k.now()
+	return k.revoke(&adapters.Revocation{
+		UserID:    userId,
+		RevokedAt: now,
+		ExpiresAt: k.revocationExpiresAt(now),
+	})
+}
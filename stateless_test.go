@@ -0,0 +1,220 @@
+package keezle_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/jwt"
+	"github.com/gaurishhs/keezle/keezletest"
+)
+
+type revocationAdapter struct {
+	*keezletest.MemoryAdapter[attributes, attributes]
+	*keezletest.RevocationStore
+}
+
+func newSigningKey(t *testing.T, id string) *jwt.Key {
+	t.Helper()
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jwt.NewEd25519Key(id, privateKey)
+}
+
+// newStatelessKeezle returns an instance with stateless sessions signed by the keys and a user "u1".
+// Instances sharing the adapter share users and revocations.
+func newStatelessKeezle(t *testing.T, adapter *revocationAdapter, keys *jwt.KeySet, clock *keezletest.FakeClock) *keezle.Keezle[attributes, attributes] {
+	t.Helper()
+	k := keezle.New(&keezle.Config[attributes, attributes]{
+		Adapter: adapter,
+		Session: &keezle.SessionConfig{
+			ActivePeriod: time.Hour,
+			IdlePeriod:   time.Hour,
+			Stateless:    &keezle.StatelessConfig{Keys: keys, Issuer: "keezle", RevocationSyncInterval: time.Minute},
+		},
+		Clock: clock,
+	})
+	if _, err := k.GetUser("u1"); err != nil {
+		if _, err := k.CreateUser(keezle.CreateUserOptions[attributes]{UserID: "u1", Attributes: &attributes{}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return k
+}
+
+func newRevocationAdapter() *revocationAdapter {
+	return &revocationAdapter{keezletest.NewMemoryAdapter[attributes, attributes](), &keezletest.RevocationStore{}}
+}
+
+func createSession(t *testing.T, k *keezle.Keezle[attributes, attributes]) string {
+	t.Helper()
+	session, err := k.CreateSession(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{"theme": "dark"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return session.ID
+}
+
+func TestStatelessSession(t *testing.T) {
+	adapter := newRevocationAdapter()
+	clock := keezletest.NewFakeClock(epoch)
+	k := newStatelessKeezle(t, adapter, jwt.NewKeySet(newSigningKey(t, "k1")), clock)
+	token := createSession(t, k)
+	if adapter.Sessions() != 0 {
+		t.Error("the stateless session was stored")
+	}
+
+	session, err := k.ValidateSession(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Fresh || session.User.ID != "u1" || (*session.Attributes)["theme"] != "dark" {
+		t.Errorf("session = %+v", session)
+	}
+	if _, err := k.ValidateSession(token + "x"); !errors.Is(err, keezle.ErrInvalidSessionId) {
+		t.Errorf("validating a tampered token returned %v, want ErrInvalidSessionId", err)
+	}
+
+	clock.Advance(30 * time.Minute)
+	renewed, err := k.ValidateSession(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !renewed.Fresh || renewed.ID == token || !renewed.ActiveExpiresAt.Equal(clock.Now().Add(time.Hour)) {
+		t.Errorf("renewed session = %+v", renewed)
+	}
+
+	clock.Advance(2 * time.Hour)
+	if _, err := k.ValidateSession(renewed.ID); !errors.Is(err, keezle.ErrSessionExpired) {
+		t.Errorf("validating an expired token returned %v, want ErrSessionExpired", err)
+	}
+}
+
+func TestStatelessRevocation(t *testing.T) {
+	adapter := newRevocationAdapter()
+	keys := jwt.NewKeySet(newSigningKey(t, "k1"))
+	clock := keezletest.NewFakeClock(epoch.Add(100 * time.Millisecond))
+	k := newStatelessKeezle(t, adapter, keys, clock)
+	other := newStatelessKeezle(t, adapter, keys, clock)
+
+	t.Run("session", func(t *testing.T) {
+		token := createSession(t, k)
+		clock.Advance(30 * time.Minute)
+		renewed, err := k.ValidateSession(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := other.ValidateSession(token); err != nil {
+			t.Fatal(err)
+		}
+		if err := k.DeleteSession(token); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := k.ValidateSession(renewed.ID); !errors.Is(err, keezle.ErrInvalidSessionId) {
+			t.Errorf("validating the renewed token of a revoked session returned %v, want ErrInvalidSessionId", err)
+		}
+		if _, err := other.ValidateSession(token); err != nil {
+			t.Errorf("the revocation was synced before the interval: %v", err)
+		}
+		clock.Advance(time.Minute)
+		if _, err := other.ValidateSession(token); !errors.Is(err, keezle.ErrInvalidSessionId) {
+			t.Errorf("the revocation was not synced after the interval: %v", err)
+		}
+	})
+
+	t.Run("user", func(t *testing.T) {
+		before := createSession(t, k)
+		clock.Advance(200 * time.Millisecond)
+		if err := k.DeleteAllUserSessions("u1"); err != nil {
+			t.Fatal(err)
+		}
+		// A login in the same second as the revocation is not revoked.
+		clock.Advance(200 * time.Millisecond)
+		after := createSession(t, k)
+
+		if _, err := k.ValidateSession(before); !errors.Is(err, keezle.ErrInvalidSessionId) {
+			t.Errorf("validating a session created before the revocation returned %v, want ErrInvalidSessionId", err)
+		}
+		if _, err := k.ValidateSession(after); err != nil {
+			t.Errorf("validating a session created after the revocation returned %v", err)
+		}
+	})
+}
+
+func TestStatelessKeyRotation(t *testing.T) {
+	adapter := newRevocationAdapter()
+	keys := jwt.NewKeySet(newSigningKey(t, "k1"))
+	clock := keezletest.NewFakeClock(epoch)
+	k := newStatelessKeezle(t, adapter, keys, clock)
+	old := createSession(t, k)
+
+	keys.Add(newSigningKey(t, "k2"))
+	if err := keys.SetSigningKey("k2"); err != nil {
+		t.Fatal(err)
+	}
+	rotated := createSession(t, k)
+	var header struct {
+		KeyID string `json:"kid"`
+	}
+	data, err := base64.RawURLEncoding.DecodeString(strings.Split(rotated, ".")[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &header); err != nil || header.KeyID != "k2" {
+		t.Errorf("key id = %q, %v", header.KeyID, err)
+	}
+	for _, token := range []string{old, rotated} {
+		if _, err := k.ValidateSession(token); err != nil {
+			t.Errorf("validating a token of the key set returned %v", err)
+		}
+	}
+
+	keys.Remove("k1")
+	if _, err := k.ValidateSession(old); !errors.Is(err, keezle.ErrInvalidSessionId) {
+		t.Errorf("validating a token of a removed key returned %v, want ErrInvalidSessionId", err)
+	}
+	if _, err := k.ValidateSession(rotated); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStatelessVerificationKey(t *testing.T) {
+	key := newSigningKey(t, "k1")
+	verificationKey := jwt.NewEd25519VerificationKey("k1", key.PublicKey)
+	adapter := newRevocationAdapter()
+	clock := keezletest.NewFakeClock(epoch)
+
+	t.Run("new", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r == nil || !strings.Contains(r.(string), "signing key") {
+				t.Errorf("New with a verification key recovered %v", r)
+			}
+		}()
+		newStatelessKeezle(t, adapter, jwt.NewKeySet(verificationKey), clock)
+	})
+
+	t.Run("renewal", func(t *testing.T) {
+		keys := jwt.NewKeySet(key)
+		k := newStatelessKeezle(t, adapter, keys, clock)
+		token := createSession(t, k)
+
+		// Replacing the signing key by its verification key stops renewal, but tokens stay valid.
+		keys.Add(verificationKey)
+		clock.Advance(45 * time.Minute)
+		session, err := k.ValidateSession(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if session.Fresh || session.ID != token {
+			t.Errorf("session = %+v", session)
+		}
+	})
+}
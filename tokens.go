@@ -0,0 +1,312 @@
+package keezle
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/gaurishhs/keezle/adapters"
+	"github.com/gaurishhs/keezle/jwt"
+	"github.com/gaurishhs/keezle/models"
+	"github.com/gaurishhs/keezle/utils"
+)
+
+// TokenConfig defines the configuration of a TokenService.
+type TokenConfig struct {
+	// Keys holds the keys used to sign and verify access tokens.
+	Keys *jwt.KeySet
+	// Issuer is written to and required in the "iss" claim of access tokens.
+	Issuer string
+	// Audience is written to and required in the "aud" claim of access tokens, if set.
+	Audience string
+	// AccessTokenLifetime defaults to 15 minutes.
+	AccessTokenLifetime time.Duration
+	// RefreshTokenLifetime defaults to 30 days. Refresh tokens also stop working once their session expires.
+	RefreshTokenLifetime time.Duration
+}
+
+// TokenPair is a pair of an access token and a refresh token.
+type TokenPair struct {
+	AccessToken           string
+	AccessTokenExpiresAt  time.Time
+	RefreshToken          string
+	RefreshTokenExpiresAt time.Time
+}
+
+// AccessTokenClaims are the claims of an access token.
+type AccessTokenClaims struct {
+	jwt.RegisteredClaims
+	// SessionHandle identifies the session the token was issued for. It is the hash of the session id, as
+	// access tokens are readable by their holder and the session id is a credential.
+	SessionHandle string `json:"sid"`
+}
+
+// TokenService issues access and refresh token pairs for API clients on top of sessions.
+// Every pair issued by IssueTokens creates a session which forms the token family of its refresh tokens.
+// Refresh tokens are single-use: refreshing returns a new pair and reusing a refreshed token revokes the
+// whole family, as it indicates that the token has been stolen.
+// The adapter must implement adapters.RefreshTokenStore.
+type TokenService[UA, SA models.AnyStruct] struct {
+	Keezle *Keezle[UA, SA]
+	Config *TokenConfig
+}
+
+// NewTokenService creates a token service for the Keezle instance.
+func NewTokenService[UA, SA models.AnyStruct](k *Keezle[UA, SA], config *TokenConfig) *TokenService[UA, SA] {
+	if config == nil || config.Keys == nil || config.Keys.SigningKey() == nil {
+		panic("token service requires a signing key")
+	}
+
+	if config.AccessTokenLifetime == 0 {
+		config.AccessTokenLifetime = time.Minute * 15
+	}
+
+	if config.RefreshTokenLifetime == 0 {
+		config.RefreshTokenLifetime = time.Hour * 24 * 30
+	}
+
+	return &TokenService[UA, SA]{
+		Keezle: k,
+		Config: config,
+	}
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionHandle returns the handle of the session in the access tokens of its family.
+func sessionHandle(sessionId string) string {
+	sum := sha256.Sum256([]byte("sid:" + sessionId))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *TokenService[UA, SA]) store() (adapters.RefreshTokenStore, error) {
+	if s.Keezle.isStateless() {
+		return nil, ErrStatelessSession
+	}
+	store, ok := s.Keezle.Config.Adapter.(adapters.RefreshTokenStore)
+	if !ok {
+		return nil, ErrRefreshTokensNotSupported
+	}
+	return store, nil
+}
+
+// issue issues a token pair for the session.
+func (s *TokenService[UA, SA]) issue(store adapters.RefreshTokenStore, session *models.Session[UA, SA]) (*TokenPair, error) {
+	now := s.Keezle.now()
+	pair := &TokenPair{
+		AccessTokenExpiresAt:  now.Add(s.Config.AccessTokenLifetime),
+		RefreshTokenExpiresAt: now.Add(s.Config.RefreshTokenLifetime),
+	}
+	if pair.RefreshTokenExpiresAt.After(session.IdleExpiresAt) {
+		pair.RefreshTokenExpiresAt = session.IdleExpiresAt
+	}
+	if pair.AccessTokenExpiresAt.After(pair.RefreshTokenExpiresAt) {
+		pair.AccessTokenExpiresAt = pair.RefreshTokenExpiresAt
+	}
+
+	tokenId, err := utils.GenerateRandomString(16)
+	if err != nil {
+		return nil, err
+	}
+	claims := AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenId,
+			Issuer:    s.Config.Issuer,
+			Subject:   session.User.ID,
+			ExpiresAt: pair.AccessTokenExpiresAt.Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		SessionHandle: sessionHandle(session.ID),
+	}
+	if s.Config.Audience != "" {
+		claims.Audience = []string{s.Config.Audience}
+	}
+	if pair.AccessToken, err = s.Config.Keys.Sign(claims); err != nil {
+		return nil, err
+	}
+
+	if pair.RefreshToken, err = utils.GenerateRandomString(32); err != nil {
+		return nil, err
+	}
+	err = store.CreateRefreshToken(&adapters.RefreshToken{
+		Hash:      hashRefreshToken(pair.RefreshToken),
+		Family:    session.ID,
+		UserID:    session.User.ID,
+		CreatedAt: now,
+		ExpiresAt: pair.RefreshTokenExpiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// IssueTokens creates a session with the options and issues the first token pair of its family.
+func (s *TokenService[UA, SA]) IssueTokens(opts CreateSessionOptions[SA]) (*TokenPair, *models.Session[UA, SA], error) {
+	store, err := s.store()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session, err := s.Keezle.CreateSession(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pair, err := s.issue(store, session)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, session, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair and renews the session of its family.
+// It returns ErrRefreshTokenReused and revokes the family if the token has been used before, and
+// ErrInvalidRefreshToken if the token is unknown, expired or its session is no longer valid.
+func (s *TokenService[UA, SA]) Refresh(refreshToken string) (*TokenPair, error) {
+	store, err := s.store()
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.Keezle.now()
+	token, err := store.UseRefreshToken(hashRefreshToken(refreshToken), now)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if token.UsedAt != nil {
+		s.Keezle.Config.Logger.Log("debug: refresh token of session family was reused, revoking the family")
+		if err := s.revokeFamily(store, token.Family); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if !token.ExpiresAt.After(now) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := s.renewSession(token.Family)
+	if err != nil {
+		if errors.Is(err, ErrInvalidSessionId) || errors.Is(err, ErrSessionExpired) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	return s.issue(store, session)
+}
+
+// renewSession renews the session of a token family.
+// Session ids are never rotated here, as they identify the family.
+func (s *TokenService[UA, SA]) renewSession(sessionId string) (*models.Session[UA, SA], error) {
+	session, err := s.Keezle.GetSession(sessionId)
+	if err != nil {
+		return nil, err
+	}
+	if session.State == models.SessionStateExpired {
+		return nil, ErrSessionExpired
+	}
+	if s.Keezle.Config.Session.MaxLifetime > 0 && !session.CreatedAt.Add(s.Keezle.Config.Session.MaxLifetime).After(s.Keezle.now()) {
+		return nil, ErrSessionExpired
+	}
+
+	event := &SessionEvent[UA, SA]{EventMeta: s.Keezle.newEventMeta(EventSessionRenewed), Session: session}
+	if err := s.Keezle.Events.before(event); err != nil {
+		return nil, err
+	}
+
+	activeExpiresAt, idleExpiresAt := s.Keezle.sessionExpiries(session.Persistent, session.CreatedAt)
+	renewed, err := s.Keezle.UpdateSession(sessionId, &models.DBSession[SA]{
+		ActiveExpiresAt: &activeExpiresAt,
+		IdleExpiresAt:   &idleExpiresAt,
+		LastSeenAt:      ptr(s.Keezle.now()),
+	})
+	if err != nil {
+		return nil, err
+	}
+	event.Session = renewed
+	s.Keezle.Events.after(event)
+	return renewed, nil
+}
+
+func (s *TokenService[UA, SA]) revokeFamily(store adapters.RefreshTokenStore, family string) error {
+	if err := store.DeleteRefreshTokenFamily(family); err != nil {
+		return err
+	}
+	if err := s.Keezle.DeleteSession(family); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	return nil
+}
+
+// Revoke revokes the token family of a refresh token and deletes its session, e.g. on logout.
+// Access tokens issued to the family stay valid until they expire unless ValidateAccessToken is asked to
+// check the session.
+func (s *TokenService[UA, SA]) Revoke(refreshToken string) error {
+	store, err := s.store()
+	if err != nil {
+		return err
+	}
+	token, err := store.UseRefreshToken(hashRefreshToken(refreshToken), s.Keezle.now())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidRefreshToken
+		}
+		return err
+	}
+	return s.revokeFamily(store, token.Family)
+}
+
+// ValidateAccessToken verifies an access token and returns its claims.
+// The token is verified offline, unless checkSession is set, in which case its session must still be valid.
+func (s *TokenService[UA, SA]) ValidateAccessToken(accessToken string, checkSession bool) (*AccessTokenClaims, error) {
+	var claims AccessTokenClaims
+	if err := s.Config.Keys.Parse(accessToken, &claims); err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+	if claims.Issuer != s.Config.Issuer || claims.SessionHandle == "" {
+		return nil, ErrInvalidAccessToken
+	}
+	if s.Config.Audience != "" && !claims.HasAudience(s.Config.Audience) {
+		return nil, ErrInvalidAccessToken
+	}
+	if err := claims.Validate(s.Keezle.now(), 0); err != nil {
+		return nil, ErrInvalidAccessToken
+	}
+
+	if checkSession {
+		found, err := s.hasSession(claims.Subject, claims.SessionHandle)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, ErrInvalidAccessToken
+		}
+	}
+	return &claims, nil
+}
+
+// hasSession reports whether the user has a valid session with the handle.
+// Only the handle is known, so the session is looked up among the sessions of the user.
+func (s *TokenService[UA, SA]) hasSession(userId, handle string) (bool, error) {
+	sessions, err := s.Keezle.GetAllUserSessions(userId)
+	if err != nil {
+		return false, err
+	}
+	for _, session := range sessions {
+		if subtle.ConstantTimeCompare([]byte(sessionHandle(session.ID)), []byte(handle)) == 1 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,159 @@
+package keezle_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gaurishhs/keezle"
+	"github.com/gaurishhs/keezle/jwt"
+	"github.com/gaurishhs/keezle/keezletest"
+)
+
+// tokenAdapter is a memory adapter which stores refresh tokens.
+type tokenAdapter struct {
+	*keezletest.MemoryAdapter[attributes, attributes]
+	keezletest.RefreshTokenStore
+}
+
+// newTokenService returns a token service on a memory adapter with a user "u1", its adapter and its clock.
+func newTokenService(t *testing.T) (*keezle.TokenService[attributes, attributes], *tokenAdapter, *keezletest.FakeClock) {
+	t.Helper()
+	adapter := &tokenAdapter{MemoryAdapter: keezletest.NewMemoryAdapter[attributes, attributes]()}
+	clock := keezletest.NewFakeClock(epoch)
+	k := keezle.New(&keezle.Config[attributes, attributes]{
+		Adapter: adapter,
+		Session: &keezle.SessionConfig{ActivePeriod: 24 * time.Hour, IdlePeriod: 24 * time.Hour},
+		Clock:   clock,
+	})
+	if _, err := k.CreateUser(keezle.CreateUserOptions[attributes]{UserID: "u1", Attributes: &attributes{}}); err != nil {
+		t.Fatal(err)
+	}
+	service := keezle.NewTokenService(k, &keezle.TokenConfig{
+		Keys:                 jwt.NewKeySet(jwt.NewHMACKey("k1", []byte("0123456789abcdef0123456789abcdef"))),
+		Issuer:               "https://api.example.com",
+		Audience:             "app",
+		RefreshTokenLifetime: time.Hour,
+	})
+	return service, adapter, clock
+}
+
+func TestRefreshToken(t *testing.T) {
+	service, _, clock := newTokenService(t)
+	first, session, err := service.IssueTokens(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := service.ValidateAccessToken(first.AccessToken, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "u1" || claims.SessionHandle == "" || claims.SessionHandle == session.ID {
+		t.Errorf("claims = %+v, want the subject and a handle which is not the session id", claims)
+	}
+
+	clock.Advance(30 * time.Minute)
+	second, err := service.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Error("refreshing returned the same refresh token")
+	}
+	if refreshed, err := service.ValidateAccessToken(second.AccessToken, true); err != nil || refreshed.SessionHandle != claims.SessionHandle {
+		t.Errorf("refreshed access token: %+v, %v, want the session handle of the family", refreshed, err)
+	}
+
+	// The refreshed token is past the lifetime of the first token.
+	clock.Advance(45 * time.Minute)
+	if _, err := service.Refresh(second.RefreshToken); err != nil {
+		t.Errorf("refreshing the refreshed token: %v", err)
+	}
+}
+
+func TestRefreshTokenExpired(t *testing.T) {
+	service, _, clock := newTokenService(t)
+	pair, _, err := service.IssueTokens(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(time.Hour)
+	if _, err := service.Refresh(pair.RefreshToken); !errors.Is(err, keezle.ErrInvalidRefreshToken) {
+		t.Errorf("refreshing an expired token returned %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := service.Refresh("unknown"); !errors.Is(err, keezle.ErrInvalidRefreshToken) {
+		t.Errorf("refreshing an unknown token returned %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	service, adapter, _ := newTokenService(t)
+	first, session, err := service.IssueTokens(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := service.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A second family of the user is not affected by the reuse.
+	other, _, err := service.IssueTokens(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.Refresh(first.RefreshToken); !errors.Is(err, keezle.ErrRefreshTokenReused) {
+		t.Fatalf("reusing a refreshed token returned %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := service.Refresh(second.RefreshToken); !errors.Is(err, keezle.ErrInvalidRefreshToken) {
+		t.Errorf("refreshing the latest token of the revoked family returned %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := service.Keezle.GetSession(session.ID); !errors.Is(err, keezle.ErrInvalidSessionId) {
+		t.Errorf("session of the revoked family was not deleted: %v", err)
+	}
+	if _, err := service.ValidateAccessToken(second.AccessToken, true); !errors.Is(err, keezle.ErrInvalidAccessToken) {
+		t.Errorf("checking the session of an access token of the revoked family returned %v, want ErrInvalidAccessToken", err)
+	}
+	if _, err := service.ValidateAccessToken(second.AccessToken, false); err != nil {
+		t.Errorf("access tokens of the revoked family stay valid offline: %v", err)
+	}
+
+	if n := adapter.RefreshTokens(); n != 1 {
+		t.Errorf("%d refresh tokens stored, want the token of the other family", n)
+	}
+	if _, err := service.Refresh(other.RefreshToken); err != nil {
+		t.Errorf("refreshing the other family: %v", err)
+	}
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	service, adapter, _ := newTokenService(t)
+	pair, session, err := service.IssueTokens(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Revoke(pair.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Refresh(pair.RefreshToken); !errors.Is(err, keezle.ErrInvalidRefreshToken) {
+		t.Errorf("refreshing a revoked token returned %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := service.Keezle.GetSession(session.ID); !errors.Is(err, keezle.ErrInvalidSessionId) {
+		t.Errorf("session of the revoked family was not deleted: %v", err)
+	}
+	if n := adapter.RefreshTokens(); n != 0 {
+		t.Errorf("%d refresh tokens stored after revoking, want 0", n)
+	}
+}
+
+func TestRefreshTokensNotSupported(t *testing.T) {
+	k, _ := newKeezle(t, nil)
+	service := keezle.NewTokenService(k, &keezle.TokenConfig{
+		Keys:   jwt.NewKeySet(jwt.NewHMACKey("k1", []byte("0123456789abcdef0123456789abcdef"))),
+		Issuer: "https://api.example.com",
+	})
+	if _, _, err := service.IssueTokens(keezle.CreateSessionOptions[attributes]{UserId: "u1", Attributes: attributes{}}); !errors.Is(err, keezle.ErrRefreshTokensNotSupported) {
+		t.Errorf("issuing tokens without a refresh token store returned %v, want ErrRefreshTokensNotSupported", err)
+	}
+}
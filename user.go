@@ -39,6 +39,11 @@ func (k *Keezle[UA, SA]) CreateUser(opts CreateUserOptions[UA]) (*models.User[UA
 		ID:         opts.UserID,
 		Attributes: opts.Attributes,
 	}
+	event := &UserEvent[UA]{EventMeta: k.newEventMeta(EventUserCreated), User: user}
+	if err := k.Events.before(event); err != nil {
+		return nil, err
+	}
+
 	if opts.Key.Provider == "" && opts.Key.ProviderUserID == "" {
 		err := k.Config.Adapter.CreateUser(&adapters.CreateUserOpts[UA]{
 			User: user,
@@ -46,6 +51,7 @@ func (k *Keezle[UA, SA]) CreateUser(opts CreateUserOptions[UA]) (*models.User[UA
 		if err != nil {
 			return nil, err
 		}
+		k.Events.after(event)
 		return k.TransformUser(user)
 	}
 
@@ -54,11 +60,21 @@ func (k *Keezle[UA, SA]) CreateUser(opts CreateUserOptions[UA]) (*models.User[UA
 		return nil, err
 	}
 
+	var hashedPassword *string
+	if opts.Key.Password != "" {
+		hash, err := k.Config.Hash(opts.Key.Password)
+		if err != nil {
+			return nil, err
+		}
+		hashedPassword = &hash
+	}
+
 	err = k.Config.Adapter.CreateUser(&adapters.CreateUserOpts[UA]{
 		User: user,
 		Key: &models.DBKey{
 			ID:       &keyId,
-			Password: &opts.Key.Password,
+			UserID:   &user.ID,
+			Password: hashedPassword,
 		},
 	})
 
@@ -66,6 +82,7 @@ func (k *Keezle[UA, SA]) CreateUser(opts CreateUserOptions[UA]) (*models.User[UA
 		return nil, err
 	}
 
+	k.Events.after(event)
 	return k.TransformUser(user)
 }
 
@@ -85,7 +102,15 @@ func (k *Keezle[UA, SA]) UpdateUser(userId string, attributes UA) (*models.User[
 
 // DeleteUser deletes a user by their ID.
 func (k *Keezle[UA, SA]) DeleteUser(userId string) error {
-	return k.Config.Adapter.DeleteUser(userId)
+	event := &UserEvent[UA]{EventMeta: k.newEventMeta(EventUserDeleted), User: &models.User[UA]{ID: userId}}
+	if err := k.Events.before(event); err != nil {
+		return err
+	}
+	if err := k.Config.Adapter.DeleteUser(userId); err != nil {
+		return err
+	}
+	k.Events.after(event)
+	return nil
 }
 
 // GetUsersByAttribute retrieves users based on a specific attribute and its value.
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var ErrUnsupportedKeyType = errors.New("unsupported key type")
+
+// thumbprintMembers lists the required members of a JWK per key type, in lexicographic order.
+var thumbprintMembers = map[string][]string{
+	"EC":  {"crv", "kty", "x", "y"},
+	"OKP": {"crv", "kty", "x"},
+	"RSA": {"e", "kty", "n"},
+	"oct": {"k", "kty"},
+}
+
+// JWKThumbprint computes the RFC 7638 SHA-256 thumbprint of a JSON Web Key, as used to identify the key of
+// a DPoP proof. The result is base64url encoded without padding.
+func JWKThumbprint(jwk map[string]any) (string, error) {
+	kty, _ := jwk["kty"].(string)
+	members, ok := thumbprintMembers[kty]
+	if !ok {
+		return "", ErrUnsupportedKeyType
+	}
+
+	// encoding/json writes map keys in sorted order, which is the canonical form required by RFC 7638.
+	required := make(map[string]string, len(members))
+	for _, member := range members {
+		value, ok := jwk[member].(string)
+		if !ok || value == "" {
+			return "", errors.New("jwk is missing the " + member + " member")
+		}
+		required[member] = value
+	}
+	data, err := json.Marshal(required)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
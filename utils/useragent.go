@@ -0,0 +1,64 @@
+package utils
+
+import "strings"
+
+type userAgentToken struct {
+	token string
+	name  string
+}
+
+// The order matters: several browsers include the tokens of the browsers they are based on,
+// e.g. Edge and Opera send "Chrome" and Chrome sends "Safari".
+var browserTokens = []userAgentToken{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chromium/", "Chromium"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"curl/", "curl"},
+}
+
+// Mobile platforms are matched before desktop ones, as Android user agents contain "Linux" and
+// iOS user agents contain "Mac OS X".
+var platformTokens = []userAgentToken{
+	{"iPhone", "iPhone"},
+	{"iPad", "iPad"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Windows", "Windows"},
+	{"Macintosh", "macOS"},
+	{"Linux", "Linux"},
+}
+
+func matchUserAgent(userAgent string, tokens []userAgentToken) string {
+	for _, t := range tokens {
+		if strings.Contains(userAgent, t.token) {
+			return t.name
+		}
+	}
+	return ""
+}
+
+// DescribeUserAgent returns a short, human-readable description of the device of a user agent,
+// such as "Firefox on Windows", for use in session lists.
+// Unrecognized user agents are described as "Unknown device".
+func DescribeUserAgent(userAgent string) string {
+	browser := matchUserAgent(userAgent, browserTokens)
+	platform := matchUserAgent(userAgent, platformTokens)
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	default:
+		return "Unknown device"
+	}
+}